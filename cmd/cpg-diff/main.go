@@ -0,0 +1,72 @@
+// Command cpg-diff compares two CPG databases, for example those generated
+// from a pull request's base and head, and reports the architectural
+// changes: functions added, removed, or modified, call edges, metrics,
+// findings, and implements relations.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"cpg-gen/cpg"
+)
+
+// errDiffers is returned by run under -exit-code when the databases differ.
+var errDiffers = errors.New("databases differ")
+
+func main() {
+	if err := run(); errors.Is(err, errDiffers) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	format := flag.String("format", "text", "Output format: "+strings.Join(cpg.DiffFormats, ", ")+" (markdown is meant for PR comments)")
+	limit := flag.Int("max", 50, "Entries listed per section in text and markdown output (0 for all)")
+	output := flag.String("o", "", "Write the report to this file instead of stdout")
+	exitCode := flag.Bool("exit-code", false, "Exit with status 2 when the databases differ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: cpg-diff [flags] <old.db> <new.db>\n\n")
+		fmt.Fprintf(os.Stderr, "Reports the architectural differences between two CPG databases.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		return fmt.Errorf("expected 2 arguments, got %d", flag.NArg())
+	}
+
+	d, err := cpg.DiffDatabases(flag.Arg(0), flag.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	err = d.Write(w, *format, *limit)
+	if w != os.Stdout {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if *exitCode && !d.Empty() {
+		return errDiffers
+	}
+	return nil
+}
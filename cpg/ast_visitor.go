@@ -1,12 +1,15 @@
-package main
+package cpg
 
 import (
 	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/tools/go/packages"
 )
@@ -74,7 +77,9 @@ func (fl *FuncLookup) Get(file string, line, col int) string {
 
 // WalkAST walks the AST of all packages, producing CPG nodes and AST edges.
 // Returns a PosLookup for SSA→AST mapping and a FuncLookup for parent tracking.
-func WalkAST(pkgs []*packages.Package, fset *token.FileSet, cpg *CPG, prog *Progress) (*PosLookup, *FuncLookup) {
+// Packages are walked on up to workers goroutines into per-package shards that
+// are replayed in package order, so the result matches a serial walk.
+func WalkAST(pkgs []*packages.Package, fset *token.FileSet, ms *ModuleSet, cpg *CPG, workers int, prog *Progress) (*PosLookup, *FuncLookup) {
 	prog.Log("Walking AST...")
 
 	posLookup := NewPosLookup()
@@ -84,171 +89,188 @@ func WalkAST(pkgs []*packages.Package, fset *token.FileSet, cpg *CPG, prog *Prog
 	var nodeCount, edgeCount int
 	var skippedFiles int
 
-	for _, pkg := range pkgs {
-		relPkg := modSet.RelPkg(pkg.PkgPath)
-
-		// Create package node
-		pkgID := PkgID(pkg.PkgPath)
-		cpg.AddNode(Node{
-			ID:      pkgID,
-			Kind:    "package",
-			Name:    pkg.Name,
-			Package: relPkg,
-		})
-		nodeCount++
+	forEachOrdered(len(pkgs), workers, func(i int) *walkShard {
+		return walkPackage(pkgs[i], fset, ms)
+	}, func(_ int, sh *walkShard) {
+		edgeCount += sh.replay(cpg, posLookup, funcLookup, defLookup)
+		nodeCount += sh.nodeCount
+		edgeCount += sh.edgeCount
+		skippedFiles += sh.skippedFiles
+	})
 
-		// Import edges: package → imported package (internal modules only)
-		for impPath := range pkg.Imports {
-			if modSet.IsKnownPkg(impPath) {
-				cpg.AddEdge(Edge{Source: pkgID, Target: PkgID(impPath), Kind: "imports"})
-				edgeCount++
-			}
-		}
+	// Emit has_method edges: type_decl → function for each method.
+	// Done after all packages are walked so defLookup is fully populated.
+	hmCount := emitHasMethodEdges(pkgs, fset, defLookup, cpg)
+	constraintCount := emitConstraintEdges(pkgs, defLookup, cpg)
+	fieldTypeCount := emitFieldTypeEdges(pkgs, defLookup, cpg)
+	linknameCount := emitLinknameEdges(pkgs, ms, defLookup, cpg)
 
-		var initFuncIDs []string // collect init() funcs for ordering
+	prog.Log("Created %d nodes, %d AST edges, %d has_method edges, %d constraint edges, %d field_type edges, %d linkname edges (skipped %d generated, test, or excluded files)",
+		nodeCount, edgeCount, hmCount, constraintCount, fieldTypeCount, linknameCount, skippedFiles)
 
-		for i, file := range pkg.Syntax {
-			// Get the actual file path
-			if i >= len(pkg.CompiledGoFiles) {
-				continue
-			}
-			absFile := pkg.CompiledGoFiles[i]
+	return posLookup, funcLookup
+}
 
-			// Compute relative path via ModuleSet
-			relFile := modSet.RelFile(absFile)
-			if relFile == "" {
-				continue
-			}
+// walkPackage walks one package into a shard. It only reads shared state
+// (type info, file set, module set), so packages can be walked concurrently.
+func walkPackage(pkg *packages.Package, fset *token.FileSet, ms *ModuleSet) *walkShard {
+	out := &walkShard{}
+	relPkg := ms.RelPkg(pkg.PkgPath)
+
+	// Create package node
+	pkgID := PkgID(relPkg)
+	out.AddNode(Node{
+		ID:      pkgID,
+		Kind:    "package",
+		Name:    pkg.Name,
+		Package: relPkg,
+	})
+	out.nodeCount++
 
-			if shouldSkipFile(relFile) {
-				skippedFiles++
-				continue
-			}
+	// Import edges: package → imported package (internal modules only)
+	for _, impPath := range slices.Sorted(maps.Keys(pkg.Imports)) {
+		if ms.IsKnownPkg(impPath) {
+			out.AddEdge(Edge{Source: pkgID, Target: PkgID(ms.RelPkg(impPath)), Kind: "imports"})
+			out.edgeCount++
+		}
+	}
 
-			// Create file node
-			fileID := FileID(relFile)
-			fileProps := map[string]any{
-				"loc": 0, // overwritten below from file.End() position
-			}
-			if strings.HasSuffix(relFile, ".pb.go") || strings.HasSuffix(relFile, "_generated.go") {
-				fileProps["is_generated"] = true
-			}
-			// Extract build tags from file comments
-			for _, cg := range file.Comments {
-				for _, c := range cg.List {
-					if strings.HasPrefix(c.Text, "//go:build ") {
-						fileProps["build_tags"] = strings.TrimPrefix(c.Text, "//go:build ")
-					} else if strings.HasPrefix(c.Text, "// +build ") {
-						if _, exists := fileProps["build_tags"]; !exists {
-							fileProps["build_tags"] = strings.TrimPrefix(c.Text, "// +build ")
-						}
-					}
-				}
-			}
-			// Compute actual LOC from file end position
-			if file.End().IsValid() {
-				fileProps["loc"] = fset.Position(file.End()).Line
-			}
-			cpg.AddNode(Node{
-				ID:         fileID,
-				Kind:       "file",
-				Name:       BaseName(relFile),
-				File:       relFile,
-				Package:    relPkg,
-				EndLine:    fset.Position(file.End()).Line,
-				Properties: fileProps,
-			})
-			nodeCount++
-			cpg.AddEdge(Edge{Source: pkgID, Target: fileID, Kind: "ast"})
-			edgeCount++
-
-			// Read source content for the sources table
-			if _, ok := cpg.Sources[relFile]; !ok {
-				content, err := os.ReadFile(absFile)
-				if err == nil {
-					cpg.Sources[relFile] = string(content)
-				}
-			}
+	for i, file := range pkg.Syntax {
+		// Get the actual file path
+		if i >= len(pkg.CompiledGoFiles) {
+			continue
+		}
+		absFile := pkg.CompiledGoFiles[i]
 
-			// Walk AST of this file
-			v := &astVisitor{
-				pkg:         pkg,
-				relPkg:      relPkg,
-				relFile:     relFile,
-				fileID:      fileID,
-				fset:        fset,
-				cpg:         cpg,
-				posLookup:   posLookup,
-				funcLookup:  funcLookup,
-				defLookup:   defLookup,
-				source:      cpg.Sources[relFile],
-				parentStack: []string{fileID},
-				initIDs:     &initFuncIDs,
-				scopeNodes:  make(map[string]bool),
-			}
-			ast.Walk(v, file)
+		// Compute relative path via ModuleSet
+		relFile := ms.RelFile(absFile)
+		if relFile == "" {
+			continue
+		}
 
-			// Extract comments (not visited by ast.Walk — they're separate)
-			for _, cg := range file.Comments {
-				cLine, cCol := v.pos(cg.Pos())
-				if cLine == 0 {
-					continue
-				}
-				cID := StmtID(relPkg, BaseName(relFile), cLine, cCol, "comment")
-				text := cg.Text()
-				if len(text) > 200 {
-					text = text[:200] + "..."
+		if ms.SkipFile(absFile, relFile) {
+			out.skippedFiles++
+			continue
+		}
+
+		// Create file node
+		fileID := FileID(relFile)
+		fileProps := map[string]any{
+			"loc": 0, // overwritten below from file.End() position
+		}
+		generated := ms.IsGenerated(absFile)
+		if generated {
+			fileProps["is_generated"] = true
+		}
+		// Extract build tags from file comments
+		for _, cg := range file.Comments {
+			for _, c := range cg.List {
+				if strings.HasPrefix(c.Text, "//go:build ") {
+					fileProps["build_tags"] = strings.TrimPrefix(c.Text, "//go:build ")
+				} else if strings.HasPrefix(c.Text, "// +build ") {
+					if _, exists := fileProps["build_tags"]; !exists {
+						fileProps["build_tags"] = strings.TrimPrefix(c.Text, "// +build ")
+					}
 				}
-				cpg.AddNode(Node{
-					ID:      cID,
-					Kind:    "comment",
-					Name:    text,
-					File:    relFile,
-					Line:    cLine,
-					Col:     cCol,
-					EndLine: v.endLine(cg.End()),
-					Package: relPkg,
-				})
-				cpg.AddEdge(Edge{Source: fileID, Target: cID, Kind: "ast"})
-				nodeCount += 1
-				edgeCount += 1
 			}
-
-			nodeCount += v.nodeCount
-			edgeCount += v.edgeCount
+		}
+		// Compute actual LOC from file end position
+		if file.End().IsValid() {
+			fileProps["loc"] = fset.Position(file.End()).Line
+		}
+		fileNode := Node{
+			ID:         fileID,
+			Kind:       "file",
+			Name:       BaseName(relFile),
+			File:       relFile,
+			Package:    relPkg,
+			EndLine:    fset.Position(file.End()).Line,
+			Properties: fileProps,
+		}
+		// The file spans all of its source, comments before the package
+		// clause included.
+		if tf := fset.File(file.Pos()); tf != nil {
+			end := fset.Position(tf.Pos(tf.Size()))
+			fileNode.EndOffset, fileNode.EndLine, fileNode.EndCol = end.Offset, end.Line, end.Column
+		}
+		out.AddNode(fileNode)
+		out.nodeCount++
+		out.AddEdge(Edge{Source: pkgID, Target: fileID, Kind: "ast"})
+		out.edgeCount++
+
+		// Read source content for the sources table
+		var source string
+		if content, err := os.ReadFile(absFile); err == nil {
+			source = string(content)
+			out.sources = append(out.sources, lookupEntry{file: relFile, id: source})
 		}
 
-		// Chain init() functions within this package in source order
-		for i := 1; i < len(initFuncIDs); i++ {
-			cpg.AddEdge(Edge{
-				Source: initFuncIDs[i-1], Target: initFuncIDs[i], Kind: "init_order",
-				Properties: map[string]any{"order": i},
-			})
-			edgeCount++
+		// Walk AST of this file
+		v := &astVisitor{
+			pkg:         pkg,
+			relPkg:      relPkg,
+			relFile:     relFile,
+			generated:   generated,
+			fileID:      fileID,
+			fset:        fset,
+			out:         out,
+			source:      source,
+			parentStack: []string{fileID},
+			initIDs:     &out.initIDs,
+			scopeNodes:  make(map[string]bool),
 		}
-	}
+		ast.Walk(v, file)
 
-	// Emit has_method edges: type_decl → function for each method.
-	// Done after all packages are walked so defLookup is fully populated.
-	hmCount := emitHasMethodEdges(pkgs, fset, defLookup, cpg)
+		// Extract comments (not visited by ast.Walk — they're separate)
+		for _, cg := range file.Comments {
+			cLine, cCol := v.pos(cg.Pos())
+			if cLine == 0 {
+				continue
+			}
+			cID := StmtID(relPkg, BaseName(relFile), cLine, cCol, "comment")
+			text := cg.Text()
+			text = truncate(text, 200)
+			comment := Node{
+				ID:      cID,
+				Kind:    "comment",
+				Name:    text,
+				File:    relFile,
+				Line:    cLine,
+				Col:     cCol,
+				Package: relPkg,
+			}
+			v.setSpan(&comment, cg.Pos(), cg.End())
+			out.AddNode(comment)
+			out.AddEdge(Edge{Source: fileID, Target: cID, Kind: "ast"})
+			out.nodeCount += 1
+			out.edgeCount += 1
+		}
+		emitDirectives(out, pkg, file, v, ms)
 
-	prog.Log("Created %d nodes, %d AST edges, %d has_method edges (skipped %d generated/test files)",
-		nodeCount, edgeCount, hmCount, skippedFiles)
+		out.nodeCount += v.nodeCount
+		out.edgeCount += v.edgeCount
+	}
 
-	return posLookup, funcLookup
+	// Chain init() functions within this package in source order
+	for i := 1; i < len(out.initIDs); i++ {
+		out.AddEdge(Edge{
+			Source: out.initIDs[i-1], Target: out.initIDs[i], Kind: "init_order",
+			Properties: map[string]any{"order": i},
+		})
+		out.edgeCount++
+	}
+	return out
 }
 
 type astVisitor struct {
-	pkg        *packages.Package
-	relPkg     string
-	relFile    string
-	fileID     string
-	fset       *token.FileSet
-	cpg        *CPG
-	posLookup  *PosLookup
-	funcLookup *FuncLookup
-	defLookup  *DefLookup
-	source     string // raw source text for current file
+	pkg       *packages.Package
+	relPkg    string
+	relFile   string
+	generated bool // relFile is generated code (marks its declarations)
+	fileID    string
+	fset      *token.FileSet
+	out       *walkShard // receives nodes, edges, and lookup entries
+	source    string     // raw source text for current file
 	// parentStack tracks the current parent node ID for AST edges.
 	// Top of stack = current parent.
 	parentStack []string
@@ -258,6 +280,9 @@ type astVisitor struct {
 	deferIDs []string
 	// initIDs collects init() function node IDs for ordering.
 	initIDs *[]string
+	// genDoc is the doc comment of the enclosing type declaration group; a
+	// lone "type T ..." keeps its doc there rather than on the TypeSpec.
+	genDoc *ast.CommentGroup
 	// scopeNodes tracks node IDs that introduce a new lexical scope (functions and blocks).
 	scopeNodes map[string]bool
 	nodeCount  int
@@ -268,10 +293,15 @@ func (v *astVisitor) currentParent() string {
 	return v.parentStack[len(v.parentStack)-1]
 }
 
-func (v *astVisitor) addNodeAndEdge(n Node) {
+// addNodeAndEdge adds n under the current parent, spanning the source of
+// syn (nil for none).
+func (v *astVisitor) addNodeAndEdge(n Node, syn ast.Node) {
 	n.Package = v.relPkg
 	n.File = v.relFile
 	n.ParentFunction = v.curFunc
+	if syn != nil {
+		v.setSpan(&n, syn.Pos(), syn.End())
+	}
 
 	// Add nesting depth for statement/expression nodes inside functions.
 	// Depth 0 = direct function body, 1 = inside one control structure, etc.
@@ -287,16 +317,16 @@ func (v *astVisitor) addNodeAndEdge(n Node) {
 		}
 	}
 
-	v.cpg.AddNode(n)
+	v.out.AddNode(n)
 	v.nodeCount++
 
 	// AST edge from parent to this node
-	v.cpg.AddEdge(Edge{Source: v.currentParent(), Target: n.ID, Kind: "ast"})
+	v.out.AddEdge(Edge{Source: v.currentParent(), Target: n.ID, Kind: "ast"})
 	v.edgeCount++
 
 	// Register in position lookup
 	if n.Line > 0 {
-		v.posLookup.Set(n.File, n.Line, n.Col, n.ID)
+		v.out.SetPos(n.File, n.Line, n.Col, n.ID)
 	}
 }
 
@@ -310,7 +340,7 @@ func (v *astVisitor) emitDocEdge(declID string, doc *ast.CommentGroup) {
 		return
 	}
 	commentID := StmtID(v.relPkg, BaseName(v.relFile), cLine, cCol, "comment")
-	v.cpg.AddEdge(Edge{Source: declID, Target: commentID, Kind: "doc"})
+	v.out.AddEdge(Edge{Source: declID, Target: commentID, Kind: "doc"})
 	v.edgeCount++
 }
 
@@ -322,6 +352,19 @@ func (v *astVisitor) pos(p token.Pos) (line, col int) {
 	return pos.Line, pos.Column
 }
 
+// setSpan records the byte offsets of [start, end) on n with the end column,
+// and the end line when n has none.
+func (v *astVisitor) setSpan(n *Node, start, end token.Pos) {
+	if !start.IsValid() || !end.IsValid() {
+		return
+	}
+	s, e := v.fset.Position(start), v.fset.Position(end)
+	n.StartOffset, n.EndOffset, n.EndCol = s.Offset, e.Offset, e.Column
+	if n.EndLine == 0 {
+		n.EndLine = e.Line
+	}
+}
+
 func (v *astVisitor) endLine(end token.Pos) int {
 	if !end.IsValid() {
 		return 0
@@ -347,32 +390,32 @@ func (v *astVisitor) Visit(node ast.Node) ast.Visitor {
 		id := v.visitCallExpr(n)
 		v.parentStack = append(v.parentStack, id)
 	case *ast.IfStmt:
-		v.visitStmtWithCode(n.If, v.endLine(n.End()), "if", "if", n.Pos(), n.Body.Lbrace)
+		v.visitStmtWithCode(n, n.If, "if", "if", n.Pos(), n.Body.Lbrace)
 		v.emitConditionEdge("if", n.If, n.Cond)
 	case *ast.ForStmt:
-		v.visitStmtWithCode(n.For, v.endLine(n.End()), "for", "for", n.Pos(), n.Body.Lbrace)
+		v.visitStmtWithCode(n, n.For, "for", "for", n.Pos(), n.Body.Lbrace)
 		v.emitConditionEdge("for", n.For, n.Cond)
 	case *ast.RangeStmt:
-		v.visitStmtWithCode(n.Range, v.endLine(n.End()), "for", "range", n.Pos(), n.Body.Lbrace)
+		v.visitStmtWithCode(n, n.Range, "for", "range", n.Pos(), n.Body.Lbrace)
 	case *ast.SwitchStmt:
-		v.visitStmtWithCode(n.Switch, v.endLine(n.End()), "switch", "switch", n.Pos(), n.Body.Lbrace)
+		v.visitStmtWithProps(n, n.Switch, "switch", "switch", n.Pos(), n.Body.Lbrace, v.enumSwitchProps(n))
 		v.emitConditionEdge("switch", n.Switch, n.Tag)
 	case *ast.TypeSwitchStmt:
-		v.visitStmtWithCode(n.Switch, v.endLine(n.End()), "switch", "type switch", n.Pos(), n.Body.Lbrace)
+		v.visitStmtWithCode(n, n.Switch, "switch", "type switch", n.Pos(), n.Body.Lbrace)
 	case *ast.SelectStmt:
-		v.visitStmt(n.Select, v.endLine(n.End()), "select", "select")
+		v.visitStmt(n, n.Select, "select", "select")
 	case *ast.CaseClause:
-		v.visitStmt(n.Case, v.endLine(n.End()), "case", "case")
+		v.visitStmt(n, n.Case, "case", "case")
 	case *ast.CommClause:
-		v.visitStmt(n.Case, v.endLine(n.End()), "case", "comm case")
+		v.visitStmt(n, n.Case, "case", "comm case")
 	case *ast.ReturnStmt:
-		v.visitStmtWithCode(n.Return, v.endLine(n.End()), "return", "return", n.Pos(), n.End())
+		v.visitStmtWithCode(n, n.Return, "return", "return", n.Pos(), n.End())
 	case *ast.AssignStmt:
 		v.visitAssign(n)
 	case *ast.GoStmt:
 		v.visitGoStmt(n)
 	case *ast.DeferStmt:
-		v.visitStmt(n.Defer, v.endLine(n.End()), "defer", "defer")
+		v.visitStmt(n, n.Defer, "defer", "defer")
 		// Track defers for LIFO ordering
 		line, col := v.pos(n.Defer)
 		if line > 0 {
@@ -380,18 +423,15 @@ func (v *astVisitor) Visit(node ast.Node) ast.Visitor {
 		}
 	case *ast.SendStmt:
 		line, col := v.pos(n.Arrow)
-		v.visitStmtAt(line, col, v.endLine(n.End()), "send", "send")
+		v.visitStmtAt(n, line, col, "send", "send")
 	case *ast.BranchStmt:
-		v.visitStmt(n.TokPos, v.endLine(n.End()), "branch", n.Tok.String())
+		v.visitStmt(n, n.TokPos, "branch", n.Tok.String())
 		// branch_target edge: break/continue/goto with label → labeled statement
 		if n.Label != nil {
 			if obj := v.pkg.TypesInfo.Uses[n.Label]; obj != nil {
-				if targetID := v.defLookup.Get(obj); targetID != "" {
-					bLine, bCol := v.pos(n.TokPos)
-					branchID := StmtID(v.relPkg, BaseName(v.relFile), bLine, bCol, "branch")
-					v.cpg.AddEdge(Edge{Source: branchID, Target: targetID, Kind: "branch_target"})
-					v.edgeCount++
-				}
+				bLine, bCol := v.pos(n.TokPos)
+				branchID := StmtID(v.relPkg, BaseName(v.relFile), bLine, bCol, "branch")
+				v.out.AddRef(Edge{Source: branchID, Kind: "branch_target"}, obj, false)
 			}
 		}
 	case *ast.LabeledStmt:
@@ -403,10 +443,10 @@ func (v *astVisitor) Visit(node ast.Node) ast.Visitor {
 			Name: n.Label.Name,
 			Line: line,
 			Col:  col,
-		})
+		}, n)
 		// Register label for branch_target resolution
 		if obj := v.pkg.TypesInfo.Defs[n.Label]; obj != nil {
-			v.defLookup.Set(obj, id)
+			v.out.SetDef(obj, id)
 		}
 		v.parentStack = append(v.parentStack, id)
 	case *ast.BlockStmt:
@@ -430,22 +470,22 @@ func (v *astVisitor) Visit(node ast.Node) ast.Visitor {
 		id := v.visitSelectorExpr(n)
 		v.parentStack = append(v.parentStack, id)
 	case *ast.UnaryExpr:
-		v.visitExpr(n.OpPos, n.Op.String(), "unary_expr")
+		v.visitExpr(n, n.OpPos, n.Op.String(), "unary_expr")
 	case *ast.BinaryExpr:
-		v.visitExpr(n.OpPos, n.Op.String(), "binary_expr")
+		v.visitExpr(n, n.OpPos, n.Op.String(), "binary_expr")
 	case *ast.IndexExpr:
-		v.visitExpr(n.Lbrack, "index", "index_expr")
+		v.visitExpr(n, n.Lbrack, "index", "index_expr")
 	case *ast.SliceExpr:
-		v.visitExpr(n.Lbrack, "slice", "slice_expr")
+		v.visitExpr(n, n.Lbrack, "slice", "slice_expr")
 	case *ast.TypeAssertExpr:
-		v.visitExpr(n.Lparen, "type_assert", "type_assert_expr")
+		v.visitExpr(n, n.Lparen, "type_assert", "type_assert_expr")
 	case *ast.KeyValueExpr:
-		v.visitExpr(n.Colon, "key_value", "key_value_expr")
+		v.visitExpr(n, n.Colon, "key_value", "key_value_expr")
 	case *ast.ImportSpec:
 		v.visitImportSpec(n)
 		return nil // leaf node
 	case *ast.IncDecStmt:
-		v.visitStmt(n.TokPos, v.endLine(n.End()), "inc_dec", n.Tok.String())
+		v.visitStmt(n, n.TokPos, "inc_dec", n.Tok.String())
 	default:
 		v.parentStack = append(v.parentStack, v.currentParent()) // balance push
 	}
@@ -465,10 +505,14 @@ func (v *astVisitor) visitFuncDecl(n *ast.FuncDecl) ast.Visitor {
 
 	funcID := FuncID(v.relPkg, recv, name, BaseName(v.relFile), line, col)
 
+	kind := "function"
 	var typeInfo string
 	if obj := v.pkg.TypesInfo.Defs[n.Name]; obj != nil {
 		typeInfo = obj.Type().String()
-		v.defLookup.Set(obj, funcID)
+		v.out.SetDef(obj, funcID)
+		if recv == "" && strings.HasSuffix(v.relFile, "_test.go") {
+			kind = testFuncKind(name, obj.Type().(*types.Signature))
+		}
 	}
 
 	displayName := name
@@ -481,7 +525,7 @@ func (v *astVisitor) visitFuncDecl(n *ast.FuncDecl) ast.Visitor {
 
 	node := Node{
 		ID:       funcID,
-		Kind:     "function",
+		Kind:     kind,
 		Name:     displayName,
 		Line:     line,
 		Col:      col,
@@ -495,6 +539,10 @@ func (v *astVisitor) visitFuncDecl(n *ast.FuncDecl) ast.Visitor {
 	if recv != "" {
 		node.Properties["receiver"] = recv
 	}
+	if v.generated {
+		node.Properties["is_generated"] = true
+	}
+	setDeprecatedProps(node.Properties, n.Doc)
 	if n.Type.TypeParams != nil && n.Type.TypeParams.NumFields() > 0 {
 		node.Properties["generic"] = true
 	}
@@ -524,18 +572,18 @@ func (v *astVisitor) visitFuncDecl(n *ast.FuncDecl) ast.Visitor {
 	if sig := v.codeSnippet(n.Pos(), n.Type.End(), 200); sig != "" {
 		node.Properties["code"] = sig
 	}
-	v.addNodeAndEdge(node)
+	v.addNodeAndEdge(node, n)
 	v.emitDocEdge(funcID, n.Doc)
 
 	// Register in func lookup for SSA mapping.
 	// Store both func-keyword position AND name position because
 	// SSA uses the name identifier position (types.Func.Pos()), not the func keyword.
-	v.funcLookup.Set(v.relFile, line, col, funcID)
+	v.out.SetFunc(v.relFile, line, col, funcID)
 	if n.Name != nil {
 		nameLine, nameCol := v.pos(n.Name.Pos())
-		v.funcLookup.Set(v.relFile, nameLine, nameCol, funcID)
+		v.out.SetFunc(v.relFile, nameLine, nameCol, funcID)
 		// Also register name position in posLookup for type relationship resolution
-		v.posLookup.Set(v.relFile, nameLine, nameCol, funcID)
+		v.out.SetPos(v.relFile, nameLine, nameCol, funcID)
 	}
 
 	// Track init() functions for ordering
@@ -589,9 +637,9 @@ func (v *astVisitor) visitFuncLit(n *ast.FuncLit) ast.Visitor {
 		Col:     col,
 		EndLine: el,
 	}
-	v.addNodeAndEdge(node)
+	v.addNodeAndEdge(node, n)
 
-	v.funcLookup.Set(v.relFile, line, col, funcID)
+	v.out.SetFunc(v.relFile, line, col, funcID)
 
 	v.scopeNodes[funcID] = true
 	v.parentStack = append(v.parentStack, funcID)
@@ -696,7 +744,7 @@ func (v *astVisitor) visitCallExpr(n *ast.CallExpr) string {
 		EndLine:    v.endLine(n.End()),
 		TypeInfo:   typeInfo,
 		Properties: props,
-	})
+	}, n)
 
 	// eval_type: call expression → return type declaration
 	v.emitEvalType(id, n)
@@ -704,7 +752,7 @@ func (v *astVisitor) visitCallExpr(n *ast.CallExpr) string {
 	// Receiver edge: method call → receiver expression
 	if sel, ok := n.Fun.(*ast.SelectorExpr); ok {
 		if recvID := v.exprNodeID(sel.X); recvID != "" {
-			v.cpg.AddEdge(Edge{Source: id, Target: recvID, Kind: "receiver"})
+			v.out.AddEdge(Edge{Source: id, Target: recvID, Kind: "receiver"})
 			v.edgeCount++
 		}
 	}
@@ -712,7 +760,7 @@ func (v *astVisitor) visitCallExpr(n *ast.CallExpr) string {
 	// Emit argument edges from call → each argument expression
 	for i, arg := range n.Args {
 		if argID := v.exprNodeID(arg); argID != "" {
-			v.cpg.AddEdge(Edge{
+			v.out.AddEdge(Edge{
 				Source: id, Target: argID, Kind: "argument",
 				Properties: map[string]any{"index": i},
 			})
@@ -726,9 +774,15 @@ func (v *astVisitor) visitCallExpr(n *ast.CallExpr) string {
 	return id
 }
 
-// visitStmtWithCode creates a statement node with an optional code snippet.
-// codeStart/codeEnd define the range for the snippet (pass invalid Pos to skip).
-func (v *astVisitor) visitStmtWithCode(p token.Pos, el int, kind, name string, codeStart, codeEnd token.Pos) {
+// visitStmtWithCode creates a statement node for syn, positioned at p, with an
+// optional code snippet. codeStart/codeEnd define the range for the snippet
+// (pass invalid Pos to skip).
+func (v *astVisitor) visitStmtWithCode(syn ast.Node, p token.Pos, kind, name string, codeStart, codeEnd token.Pos) {
+	v.visitStmtWithProps(syn, p, kind, name, codeStart, codeEnd, nil)
+}
+
+// visitStmtWithProps is visitStmtWithCode with further properties.
+func (v *astVisitor) visitStmtWithProps(syn ast.Node, p token.Pos, kind, name string, codeStart, codeEnd token.Pos, props map[string]any) {
 	line, col := v.pos(p)
 	if line == 0 {
 		v.parentStack = append(v.parentStack, v.currentParent()) // balance push
@@ -736,9 +790,11 @@ func (v *astVisitor) visitStmtWithCode(p token.Pos, el int, kind, name string, c
 	}
 	id := StmtID(v.relPkg, BaseName(v.relFile), line, col, kind)
 
-	var props map[string]any
 	if code := v.codeSnippet(codeStart, codeEnd, 120); code != "" {
-		props = map[string]any{"code": code}
+		if props == nil {
+			props = map[string]any{}
+		}
+		props["code"] = code
 	}
 
 	v.addNodeAndEdge(Node{
@@ -747,18 +803,17 @@ func (v *astVisitor) visitStmtWithCode(p token.Pos, el int, kind, name string, c
 		Name:       name,
 		Line:       line,
 		Col:        col,
-		EndLine:    el,
 		Properties: props,
-	})
+	}, syn)
 
 	v.parentStack = append(v.parentStack, id)
 }
 
-func (v *astVisitor) visitStmt(p token.Pos, el int, kind, name string) {
-	v.visitStmtWithCode(p, el, kind, name, 0, 0)
+func (v *astVisitor) visitStmt(syn ast.Node, p token.Pos, kind, name string) {
+	v.visitStmtWithCode(syn, p, kind, name, 0, 0)
 }
 
-func (v *astVisitor) visitStmtAt(line, col, el int, kind, name string) {
+func (v *astVisitor) visitStmtAt(syn ast.Node, line, col int, kind, name string) {
 	if line == 0 {
 		v.parentStack = append(v.parentStack, v.currentParent()) // balance push
 		return
@@ -766,19 +821,19 @@ func (v *astVisitor) visitStmtAt(line, col, el int, kind, name string) {
 	id := StmtID(v.relPkg, BaseName(v.relFile), line, col, kind)
 
 	v.addNodeAndEdge(Node{
-		ID:      id,
-		Kind:    kind,
-		Name:    name,
-		Line:    line,
-		Col:     col,
-		EndLine: el,
-	})
+		ID:   id,
+		Kind: kind,
+		Name: name,
+		Line: line,
+		Col:  col,
+	}, syn)
 
 	v.parentStack = append(v.parentStack, id)
 }
 
-// visitExpr creates a node for expression types and pushes onto parent stack.
-func (v *astVisitor) visitExpr(p token.Pos, name, kind string) {
+// visitExpr creates a node for expression syn, positioned at its operator p,
+// and pushes onto parent stack.
+func (v *astVisitor) visitExpr(syn ast.Node, p token.Pos, name, kind string) {
 	line, col := v.pos(p)
 	if line == 0 {
 		v.parentStack = append(v.parentStack, v.currentParent())
@@ -791,7 +846,7 @@ func (v *astVisitor) visitExpr(p token.Pos, name, kind string) {
 		Name: name,
 		Line: line,
 		Col:  col,
-	})
+	}, syn)
 	v.parentStack = append(v.parentStack, id)
 }
 
@@ -812,12 +867,12 @@ func (v *astVisitor) visitBlock(n *ast.BlockStmt) {
 		Line:    line,
 		Col:     col,
 		EndLine: el,
-	})
+	}, n)
 	// Register as scope boundary and emit scope edge to nearest enclosing scope
 	v.scopeNodes[id] = true
 	for i := len(v.parentStack) - 1; i >= 0; i-- {
 		if v.scopeNodes[v.parentStack[i]] {
-			v.cpg.AddEdge(Edge{Source: id, Target: v.parentStack[i], Kind: "scope"})
+			v.out.AddEdge(Edge{Source: id, Target: v.parentStack[i], Kind: "scope"})
 			v.edgeCount++
 			break
 		}
@@ -830,7 +885,7 @@ func (v *astVisitor) visitBlock(n *ast.BlockStmt) {
 		for _, stmt := range n.List {
 			curID := v.stmtNodeID(stmt)
 			if curID != "" && prevID != "" {
-				v.cpg.AddEdge(Edge{Source: prevID, Target: curID, Kind: "next_sibling"})
+				v.out.AddEdge(Edge{Source: prevID, Target: curID, Kind: "next_sibling"})
 				v.edgeCount++
 			}
 			if curID != "" {
@@ -904,7 +959,7 @@ func (v *astVisitor) emitDeferOrdering() {
 	}
 	// LIFO: last defer runs first → chain in reverse
 	for i := len(v.deferIDs) - 1; i > 0; i-- {
-		v.cpg.AddEdge(Edge{
+		v.out.AddEdge(Edge{
 			Source: v.deferIDs[i], Target: v.deferIDs[i-1],
 			Kind:       "defer_order",
 			Properties: map[string]any{"exec_order": len(v.deferIDs) - i},
@@ -923,7 +978,7 @@ func (v *astVisitor) visitGoStmt(n *ast.GoStmt) {
 		Line:    line,
 		Col:     col,
 		EndLine: v.endLine(n.End()),
-	})
+	}, n)
 	v.parentStack = append(v.parentStack, id)
 
 	// Spawn edge: go stmt → launched function (if identifiable).
@@ -931,12 +986,12 @@ func (v *astVisitor) visitGoStmt(n *ast.GoStmt) {
 	// The function reference spawn enables tracing which function is launched.
 	// The call expression spawn enables tracing the actual invocation (with args).
 	if calleeID := v.exprNodeID(n.Call.Fun); calleeID != "" {
-		v.cpg.AddEdge(Edge{Source: id, Target: calleeID, Kind: "spawn"})
+		v.out.AddEdge(Edge{Source: id, Target: calleeID, Kind: "spawn"})
 		v.edgeCount++
 	}
 	// spawn_call edge: go stmt → call expression that is launched as a goroutine
 	if callID := v.exprNodeID(n.Call); callID != "" {
-		v.cpg.AddEdge(Edge{Source: id, Target: callID, Kind: "spawn_call"})
+		v.out.AddEdge(Edge{Source: id, Target: callID, Kind: "spawn_call"})
 		v.edgeCount++
 	}
 }
@@ -958,7 +1013,7 @@ func (v *astVisitor) visitAssign(n *ast.AssignStmt) {
 		Col:        col,
 		EndLine:    v.endLine(n.End()),
 		Properties: props,
-	})
+	}, n)
 
 	// For short variable declarations, create local variable nodes
 	if n.Tok == token.DEFINE {
@@ -973,7 +1028,7 @@ func (v *astVisitor) visitAssign(n *ast.AssignStmt) {
 			var typeInfo string
 			if obj := v.pkg.TypesInfo.Defs[ident]; obj != nil {
 				typeInfo = obj.Type().String()
-				v.defLookup.Set(obj, vid)
+				v.out.SetDef(obj, vid)
 			}
 
 			v.addNodeAndEdge(Node{
@@ -983,12 +1038,12 @@ func (v *astVisitor) visitAssign(n *ast.AssignStmt) {
 				Line:     vLine,
 				Col:      vCol,
 				TypeInfo: typeInfo,
-			})
+			}, ident)
 
 			// Initializer edge: local variable → RHS expression
 			if i < len(n.Rhs) {
 				if rhsID := v.exprNodeID(n.Rhs[i]); rhsID != "" {
-					v.cpg.AddEdge(Edge{Source: vid, Target: rhsID, Kind: "initializer"})
+					v.out.AddEdge(Edge{Source: vid, Target: rhsID, Kind: "initializer"})
 					v.edgeCount++
 				}
 			}
@@ -1001,11 +1056,15 @@ func (v *astVisitor) visitAssign(n *ast.AssignStmt) {
 func (v *astVisitor) visitGenDecl(n *ast.GenDecl) {
 	switch n.Tok { //nolint:exhaustive // only VAR/CONST/TYPE are relevant
 	case token.VAR, token.CONST:
-		for _, spec := range n.Specs {
+		var values []ast.Expr // a const spec without values repeats the previous ones
+		for si, spec := range n.Specs {
 			vs, ok := spec.(*ast.ValueSpec)
 			if !ok {
 				continue
 			}
+			if len(vs.Values) > 0 {
+				values = vs.Values
+			}
 			for i, name := range vs.Names {
 				if name.Name == "_" {
 					continue
@@ -1013,41 +1072,50 @@ func (v *astVisitor) visitGenDecl(n *ast.GenDecl) {
 				line, col := v.pos(name.Pos())
 				id := StmtID(v.relPkg, BaseName(v.relFile), line, col, "local")
 
+				// Doc from ValueSpec first, fall back to GenDecl doc
+				doc := vs.Doc
+				if doc == nil {
+					doc = n.Doc
+				}
+				props := map[string]any{
+					"decl":     n.Tok.String(),
+					"exported": token.IsExported(name.Name),
+				}
+				setDeprecatedProps(props, doc)
 				var typeInfo string
 				if obj := v.pkg.TypesInfo.Defs[name]; obj != nil {
 					typeInfo = obj.Type().String()
-					v.defLookup.Set(obj, id)
+					v.out.SetDef(obj, id)
+					if c, ok := obj.(*types.Const); ok {
+						setConstProps(props, c.Val(), c.Type())
+						if v.usesIota(values) {
+							props["iota"] = si
+						}
+					}
 				}
 
 				v.addNodeAndEdge(Node{
-					ID:       id,
-					Kind:     "local",
-					Name:     name.Name,
-					Line:     line,
-					Col:      col,
-					TypeInfo: typeInfo,
-					Properties: map[string]any{
-						"decl":     n.Tok.String(),
-						"exported": token.IsExported(name.Name),
-					},
-				})
+					ID:         id,
+					Kind:       "local",
+					Name:       name.Name,
+					Line:       line,
+					Col:        col,
+					TypeInfo:   typeInfo,
+					Properties: props,
+				}, name)
 				// Initializer edge: var/const → RHS expression
 				if i < len(vs.Values) {
 					if rhsID := v.exprNodeID(vs.Values[i]); rhsID != "" {
-						v.cpg.AddEdge(Edge{Source: id, Target: rhsID, Kind: "initializer"})
+						v.out.AddEdge(Edge{Source: id, Target: rhsID, Kind: "initializer"})
 						v.edgeCount++
 					}
 				}
-				// Doc from ValueSpec first, fall back to GenDecl doc
-				doc := vs.Doc
-				if doc == nil {
-					doc = n.Doc
-				}
 				v.emitDocEdge(id, doc)
 			}
 		}
 	case token.TYPE:
 		// TypeSpec is handled by visitTypeSpec when ast.Walk visits it
+		v.genDoc = n.Doc
 	}
 }
 
@@ -1069,7 +1137,7 @@ func (v *astVisitor) visitTypeSpec(n *ast.TypeSpec) {
 	var typeInfo string
 	if obj := v.pkg.TypesInfo.Defs[n.Name]; obj != nil {
 		typeInfo = obj.Type().String()
-		v.defLookup.Set(obj, id)
+		v.out.SetDef(obj, id)
 	}
 
 	props := map[string]any{
@@ -1083,6 +1151,15 @@ func (v *astVisitor) visitTypeSpec(n *ast.TypeSpec) {
 	if n.TypeParams != nil && n.TypeParams.NumFields() > 0 {
 		props["generic"] = true
 	}
+	if v.generated {
+		props["is_generated"] = true
+	}
+	// Doc from TypeSpec first, fall back to GenDecl doc
+	doc := n.Doc
+	if doc == nil {
+		doc = v.genDoc
+	}
+	setDeprecatedProps(props, doc)
 
 	v.addNodeAndEdge(Node{
 		ID:         id,
@@ -1093,12 +1170,12 @@ func (v *astVisitor) visitTypeSpec(n *ast.TypeSpec) {
 		EndLine:    el,
 		TypeInfo:   typeInfo,
 		Properties: props,
-	})
+	}, n)
 
-	v.emitDocEdge(id, n.Doc)
+	v.emitDocEdge(id, doc)
 
 	// Register type_decl in pos lookup for type relationship edges
-	v.posLookup.Set(v.relFile, line, col, id)
+	v.out.SetPos(v.relFile, line, col, id)
 
 	// Push type_decl onto parent stack so children (type params, fields) are parented correctly.
 	v.parentStack = append(v.parentStack, id)
@@ -1157,7 +1234,7 @@ func (v *astVisitor) visitImportSpec(n *ast.ImportSpec) {
 		Line:       line,
 		Col:        col,
 		Properties: props,
-	})
+	}, n)
 	v.emitDocEdge(id, n.Doc)
 }
 
@@ -1179,9 +1256,18 @@ func (v *astVisitor) visitField(field *ast.Field) {
 
 	id := StmtID(v.relPkg, BaseName(v.relFile), line, col, "field")
 
-	// Register field definition for REF edges
+	// Register field definition for REF edges, and each name's position
+	// for the field accesses SSA reports
 	if len(field.Names) > 0 {
-		v.defLookup.Set(v.pkg.TypesInfo.Defs[field.Names[0]], id)
+		v.out.SetDef(v.pkg.TypesInfo.Defs[field.Names[0]], id)
+		for _, n := range field.Names {
+			nameLine, nameCol := v.pos(n.Pos())
+			v.out.SetPos(v.relFile, nameLine, nameCol, id)
+		}
+	} else if ident := embeddedFieldIdent(field.Type); ident != nil {
+		v.out.SetDef(v.pkg.TypesInfo.Defs[ident], id)
+		identLine, identCol := v.pos(ident.Pos())
+		v.out.SetPos(v.relFile, identLine, identCol, id)
 	}
 
 	props := map[string]any{
@@ -1194,10 +1280,14 @@ func (v *astVisitor) visitField(field *ast.Field) {
 			tag = tag[1 : len(tag)-1]
 		}
 		props["tag"] = tag
+		if tags := parseStructTag(tag); len(tags) > 0 {
+			props["tags"] = structTagProps(tags)
+		}
 	}
 	if len(field.Names) == 0 {
 		props["embedded"] = true
 	}
+	setDeprecatedProps(props, field.Doc)
 
 	v.addNodeAndEdge(Node{
 		ID:         id,
@@ -1207,7 +1297,7 @@ func (v *astVisitor) visitField(field *ast.Field) {
 		Col:        col,
 		TypeInfo:   typeInfo,
 		Properties: props,
-	})
+	}, field)
 	v.emitDocEdge(id, field.Doc)
 }
 
@@ -1248,7 +1338,7 @@ func (v *astVisitor) visitFieldList(fl *ast.FieldList, kind string) {
 				Col:        col,
 				TypeInfo:   typeInfo,
 				Properties: props,
-			})
+			}, field)
 			continue
 		}
 
@@ -1263,10 +1353,164 @@ func (v *astVisitor) visitFieldList(fl *ast.FieldList, kind string) {
 				Col:        col,
 				TypeInfo:   typeInfo,
 				Properties: props,
+			}, name)
+			v.out.SetDef(v.pkg.TypesInfo.Defs[name], id)
+		}
+	}
+}
+
+// emitConstraintEdges links each type_param node to the named interfaces its
+// constraint refers to. Like has_method edges, they are emitted once every
+// package is walked, as constraints may be declared after their use.
+func emitConstraintEdges(pkgs []*packages.Package, defLookup *DefLookup, cpg *CPG) int {
+	count := 0
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				var params *ast.FieldList
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					params = n.Type.TypeParams
+				case *ast.TypeSpec:
+					params = n.TypeParams
+				}
+				if params == nil {
+					return true
+				}
+				for _, field := range params.List {
+					for _, name := range field.Names {
+						obj := pkg.TypesInfo.Defs[name]
+						paramID := defLookup.Get(obj)
+						if paramID == "" {
+							continue
+						}
+						tp, ok := obj.Type().(*types.TypeParam)
+						if !ok {
+							continue
+						}
+						for _, c := range constraintTypes(tp.Constraint()) {
+							if target := defLookup.Get(c); target != "" {
+								cpg.AddEdge(Edge{Source: paramID, Target: target, Kind: "constraint"})
+								count++
+							}
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return count
+}
+
+// emitFieldTypeEdges links each struct field node to the declaration of the
+// named type it holds, looking through pointers, slices, arrays, and map
+// values. The wrap property spells what was looked through ("[]*",
+// "map[string]"), so serialized paths can tell lists and maps apart. Like
+// constraint edges, these run after all packages are walked because fields
+// routinely refer to types declared further down.
+func emitFieldTypeEdges(pkgs []*packages.Package, defLookup *DefLookup, cpg *CPG) int {
+	count := 0
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				st, ok := n.(*ast.StructType)
+				if !ok || st.Fields == nil {
+					return true
+				}
+				for _, field := range st.Fields.List {
+					var ident *ast.Ident
+					if len(field.Names) > 0 {
+						ident = field.Names[0]
+					} else {
+						ident = embeddedFieldIdent(field.Type)
+					}
+					if ident == nil {
+						continue
+					}
+					obj := pkg.TypesInfo.Defs[ident]
+					fieldID := defLookup.Get(obj)
+					if fieldID == "" {
+						continue
+					}
+					named, wrap := fieldElemType(obj.Type())
+					if named == nil {
+						continue
+					}
+					target := defLookup.Get(named.Origin().Obj())
+					if target == "" {
+						continue
+					}
+					var props map[string]any
+					if wrap != "" {
+						props = map[string]any{"wrap": wrap}
+					}
+					cpg.AddEdge(Edge{Source: fieldID, Target: target, Kind: "field_type", Properties: props})
+					count++
+				}
+				return true
 			})
-			v.defLookup.Set(v.pkg.TypesInfo.Defs[name], id)
 		}
 	}
+	return count
+}
+
+// fieldElemType returns the named type a field holds and the pointer, slice,
+// array, and map layers around it, or nil when there is none (func, chan,
+// and anonymous struct fields).
+func fieldElemType(t types.Type) (*types.Named, string) {
+	qualifier := func(p *types.Package) string { return p.Name() }
+	var wrap strings.Builder
+	for {
+		switch u := types.Unalias(t).(type) {
+		case *types.Named:
+			return u, wrap.String()
+		case *types.Pointer:
+			wrap.WriteString("*")
+			t = u.Elem()
+		case *types.Slice:
+			wrap.WriteString("[]")
+			t = u.Elem()
+		case *types.Array:
+			fmt.Fprintf(&wrap, "[%d]", u.Len())
+			t = u.Elem()
+		case *types.Map:
+			wrap.WriteString("map[" + types.TypeString(u.Key(), qualifier) + "]")
+			t = u.Elem()
+		default:
+			return nil, ""
+		}
+	}
+}
+
+// constraintTypes returns the named interfaces a type parameter constraint
+// refers to: the constraint itself when it is one, or those embedded in or
+// united by an inline constraint such as "Number | ~string".
+func constraintTypes(t types.Type) []types.Object {
+	var objs []types.Object
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		switch t := t.(type) {
+		case *types.Named:
+			if types.IsInterface(t) {
+				objs = append(objs, t.Origin().Obj())
+			}
+		case *types.Alias:
+			walk(types.Unalias(t))
+		case *types.Interface:
+			for i := range t.NumEmbeddeds() {
+				walk(t.EmbeddedType(i))
+			}
+		case *types.Union:
+			for i := range t.Len() {
+				walk(t.Term(i).Type())
+			}
+		}
+	}
+	if t != nil {
+		walk(t)
+	}
+	return objs
 }
 
 func (v *astVisitor) visitCompositeLit(n *ast.CompositeLit) string {
@@ -1284,7 +1528,7 @@ func (v *astVisitor) visitCompositeLit(n *ast.CompositeLit) string {
 		Name: typeName,
 		Line: line,
 		Col:  col,
-	})
+	}, n)
 
 	// eval_type: composite literal → type declaration
 	v.emitEvalType(id, n)
@@ -1296,10 +1540,7 @@ func (v *astVisitor) visitBasicLit(n *ast.BasicLit) {
 	line, col := v.pos(n.Pos())
 	id := StmtID(v.relPkg, BaseName(v.relFile), line, col, "literal")
 
-	val := n.Value
-	if len(val) > 50 {
-		val = val[:50] + "..."
-	}
+	val := truncate(n.Value, 50)
 
 	v.addNodeAndEdge(Node{
 		ID:   id,
@@ -1310,44 +1551,57 @@ func (v *astVisitor) visitBasicLit(n *ast.BasicLit) {
 		Properties: map[string]any{
 			"literal_kind": n.Kind.String(),
 		},
-	})
+	}, n)
 }
 
 // visitIdent creates an identifier node for variable/function/type/const references.
 // Only handles Uses (references), not Defs (declarations handled elsewhere).
 func (v *astVisitor) visitIdent(n *ast.Ident) {
-	obj := v.pkg.TypesInfo.Uses[n]
-	if obj == nil {
-		return // definition-side ident or unresolved
-	}
-	// Only create nodes for meaningful references
-	switch obj.(type) {
-	case *types.Var, *types.Func, *types.Const, *types.TypeName:
-		// proceed
-	default:
-		return // skip PkgName, Builtin, Label, Nil
+	if !v.identHasNode(n) {
+		return
 	}
+	obj := v.pkg.TypesInfo.Uses[n]
 
 	line, col := v.pos(n.Pos())
 	id := StmtID(v.relPkg, BaseName(v.relFile), line, col, "identifier")
 
+	var props map[string]any
+	// The Sel of pkg.Const shares the selector's position; the selector
+	// carries the value, so each qualified use is listed once.
+	isSel := v.currentParent() == StmtID(v.relPkg, BaseName(v.relFile), line, col, "selector")
+	if c, ok := obj.(*types.Const); ok && c.Parent() != types.Universe && !isSel {
+		// Predeclared iota, true, and false are left out; a const decl's iota
+		// property has the value iota takes there.
+		props = map[string]any{}
+		setConstProps(props, c.Val(), c.Type())
+	}
+
 	v.addNodeAndEdge(Node{
-		ID:       id,
-		Kind:     "identifier",
-		Name:     n.Name,
-		Line:     line,
-		Col:      col,
-		TypeInfo: obj.Type().String(),
-	})
+		ID:         id,
+		Kind:       "identifier",
+		Name:       n.Name,
+		Line:       line,
+		Col:        col,
+		TypeInfo:   obj.Type().String(),
+		Properties: props,
+	}, n)
 
 	// eval_type: identifier → type declaration
 	v.emitEvalType(id, n)
 
 	// REF edge: identifier → declaration
-	if declID := v.defLookup.Get(obj); declID != "" {
-		v.cpg.AddEdge(Edge{Source: id, Target: declID, Kind: "ref"})
-		v.edgeCount++
+	v.out.AddRef(Edge{Source: id, Kind: "ref"}, obj, false)
+}
+
+// identHasNode reports whether visitIdent gives n a node: it refers to a
+// variable, function, constant, or type. Definitions, package names,
+// builtins, labels, and nil get none.
+func (v *astVisitor) identHasNode(n *ast.Ident) bool {
+	switch v.pkg.TypesInfo.Uses[n].(type) {
+	case *types.Var, *types.Func, *types.Const, *types.TypeName:
+		return true
 	}
+	return false
 }
 
 // visitSelectorExpr creates a node for field/method access (x.Field).
@@ -1366,14 +1620,17 @@ func (v *astVisitor) visitSelectorExpr(n *ast.SelectorExpr) string {
 		name = ident.Name + "." + n.Sel.Name
 	}
 
+	props := map[string]any{}
 	var typeInfo string
 	if obj := v.pkg.TypesInfo.Uses[n.Sel]; obj != nil {
 		typeInfo = obj.Type().String()
+		if c, ok := obj.(*types.Const); ok {
+			setConstProps(props, c.Val(), c.Type()) // pkg.Const
+		}
 	} else if tv, ok := v.pkg.TypesInfo.Selections[n]; ok {
 		typeInfo = tv.Type().String()
 	}
 
-	props := map[string]any{}
 	// Annotate the selection kind: field_val, method_val (bound), or method_expr (unbound).
 	// This is critical for call graph precision: method values capture the receiver
 	// and are equivalent to closures, while method expressions do not.
@@ -1401,22 +1658,16 @@ func (v *astVisitor) visitSelectorExpr(n *ast.SelectorExpr) string {
 		TypeInfo:   typeInfo,
 		Properties: props,
 	}
-	v.addNodeAndEdge(node)
+	v.addNodeAndEdge(node, n)
 
 	// eval_type: selector → type declaration
 	v.emitEvalType(id, n)
 
 	// REF edge: selector → field/method declaration
 	if obj := v.pkg.TypesInfo.Uses[n.Sel]; obj != nil {
-		if declID := v.defLookup.Get(obj); declID != "" {
-			v.cpg.AddEdge(Edge{Source: id, Target: declID, Kind: "ref"})
-			v.edgeCount++
-		}
+		v.out.AddRef(Edge{Source: id, Kind: "ref"}, obj, false)
 	} else if sel, ok := v.pkg.TypesInfo.Selections[n]; ok {
-		if declID := v.defLookup.Get(sel.Obj()); declID != "" {
-			v.cpg.AddEdge(Edge{Source: id, Target: declID, Kind: "ref"})
-			v.edgeCount++
-		}
+		v.out.AddRef(Edge{Source: id, Kind: "ref"}, sel.Obj(), false)
 	}
 
 	return id
@@ -1436,11 +1687,19 @@ func (v *astVisitor) codeSnippet(start, end token.Pos, maxLen int) string {
 	if startOff < 0 || endOff <= startOff || endOff > len(v.source) {
 		return ""
 	}
-	snippet := v.source[startOff:endOff]
-	if len(snippet) > maxLen {
-		snippet = snippet[:maxLen] + "..."
+	return truncate(v.source[startOff:endOff], maxLen)
+}
+
+// truncate shortens s to at most n bytes plus "...", backing up to a rune
+// boundary so the result stays valid UTF-8.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
 	}
-	return snippet
+	return s[:n] + "..."
 }
 
 // emitErrorWrapEdge detects error wrapping calls and emits error_wrap edges
@@ -1452,7 +1711,7 @@ func (v *astVisitor) emitErrorWrapEdge(callID, callee string, args []ast.Expr) {
 		// errors.Join(errs ...error) wraps all arguments into a single error.
 		for _, arg := range args {
 			if errID := v.exprNodeID(arg); errID != "" {
-				v.cpg.AddEdge(Edge{Source: callID, Target: errID, Kind: "error_wrap"})
+				v.out.AddEdge(Edge{Source: callID, Target: errID, Kind: "error_wrap"})
 				v.edgeCount++
 			}
 		}
@@ -1504,7 +1763,7 @@ func (v *astVisitor) emitFmtErrorfWrapEdges(callID string, args []ast.Expr) {
 		verb := fmtStr[i]
 		if verb == 'w' && argIdx < len(args) {
 			if errID := v.exprNodeID(args[argIdx]); errID != "" {
-				v.cpg.AddEdge(Edge{
+				v.out.AddEdge(Edge{
 					Source: callID, Target: errID,
 					Kind: "error_wrap",
 				})
@@ -1532,10 +1791,7 @@ func (v *astVisitor) emitEvalType(nodeID string, expr ast.Expr) {
 		return
 	}
 	tObj := named.Obj()
-	if typeID := v.defLookup.Get(tObj); typeID != "" && typeID != nodeID {
-		v.cpg.AddEdge(Edge{Source: nodeID, Target: typeID, Kind: "eval_type"})
-		v.edgeCount++
-	}
+	v.out.AddRef(Edge{Source: nodeID, Kind: "eval_type"}, tObj, true)
 }
 
 // exprNodeID predicts the CPG node ID that will be created for an expression.
@@ -1544,6 +1800,9 @@ func (v *astVisitor) exprNodeID(expr ast.Expr) string {
 	base := BaseName(v.relFile)
 	switch e := expr.(type) {
 	case *ast.Ident:
+		if !v.identHasNode(e) {
+			return ""
+		}
 		line, col := v.pos(e.Pos())
 		return StmtID(v.relPkg, base, line, col, "identifier")
 	case *ast.CallExpr:
@@ -1595,7 +1854,7 @@ func (v *astVisitor) emitConditionEdge(kind string, stmtPos token.Pos, cond ast.
 	}
 	line, col := v.pos(stmtPos)
 	stmtID := StmtID(v.relPkg, BaseName(v.relFile), line, col, kind)
-	v.cpg.AddEdge(Edge{Source: stmtID, Target: condID, Kind: "condition"})
+	v.out.AddEdge(Edge{Source: stmtID, Target: condID, Kind: "condition"})
 	v.edgeCount++
 }
 
@@ -1672,6 +1931,24 @@ func emitHasMethodEdges(pkgs []*packages.Package, _ *token.FileSet, defLookup *D
 	return count
 }
 
+// embeddedFieldIdent returns the identifier naming an embedded field: T in
+// T, *T, pkg.T, and T[int]. types.Info.Defs maps it to the field.
+func embeddedFieldIdent(expr ast.Expr) *ast.Ident {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t
+	case *ast.StarExpr:
+		return embeddedFieldIdent(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel
+	case *ast.IndexExpr:
+		return embeddedFieldIdent(t.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldIdent(t.X)
+	}
+	return nil
+}
+
 // exprTypeName extracts a human-readable name from a type expression.
 func exprTypeName(expr ast.Expr) string {
 	switch t := expr.(type) {
@@ -0,0 +1,458 @@
+package cpg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// cacheFormat is bumped whenever the fragment encoding changes.
+const cacheFormat = "cpg-cache/2"
+
+// Cache is a content-addressed store of per-package CPG fragments in a
+// directory shared between runs. A package's key covers its own analyzed
+// files, every in-module package it transitively imports, the go.mod and
+// go.sum of every workspace module, the Go toolchain version, the generator
+// binary, and the settings that shape the graph (modules, file filter,
+// phases, platform). An unchanged key means the package's nodes, edges,
+// sources, and metrics can be reused as they are.
+//
+// Like -incremental, reuse is package-granular: call edges and tests links
+// that the whole-program call graph would add from an unchanged package into
+// a changed one are only picked up when the unchanged package is itself
+// re-analyzed.
+type Cache struct {
+	dir   string
+	stats CacheStats
+}
+
+// CacheStats counts cache traffic for one generation.
+type CacheStats struct {
+	Hits, Misses int   // package and escape-analysis lookups
+	Written      int   // fragments stored
+	BytesRead    int64 // compressed
+	BytesWritten int64 // compressed
+}
+
+func (s CacheStats) String() string {
+	rate := 0.0
+	if total := s.Hits + s.Misses; total > 0 {
+		rate = 100 * float64(s.Hits) / float64(total)
+	}
+	return fmt.Sprintf("%d hits, %d misses (%.0f%% hit rate), read %s, wrote %d fragments (%s)",
+		s.Hits, s.Misses, rate, formatBytes(s.BytesRead), s.Written, formatBytes(s.BytesWritten))
+}
+
+// OpenCache opens (creating if needed) the cache directory dir.
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Stats returns the traffic counted so far.
+func (c *Cache) Stats() CacheStats {
+	return c.stats
+}
+
+// fragment is the part of a CPG owned by one package: its nodes, the edges
+// leaving them (or entering them from external stubs), the external stubs
+// those edges reference, its metrics, and its source files.
+type fragment struct {
+	Nodes   []Node
+	Edges   []Edge
+	Metrics []Metrics
+	Sources map[string]string
+}
+
+// addTo adds f to g. Elements g already holds are kept (first wins), so a
+// fragment can be layered over a freshly walked AST.
+func (f *fragment) addTo(g *CPG) {
+	for _, n := range f.Nodes {
+		g.AddNode(n)
+	}
+	for _, e := range f.Edges {
+		g.AddEdge(e)
+	}
+	for _, m := range f.Metrics {
+		if _, ok := g.Metrics[m.FunctionID]; !ok {
+			g.Metrics[m.FunctionID] = &m
+		}
+	}
+	for file, content := range f.Sources {
+		g.AddSource(file, content)
+	}
+}
+
+// path returns where the entry for key lives: two levels deep so that no
+// directory grows too large.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json.gz")
+}
+
+// get decodes the entry for key into v, reporting whether it existed. A
+// corrupt entry counts as a miss and is removed.
+func (c *Cache) get(key string, v any) bool {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		c.stats.Misses++
+		return false
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err == nil {
+		dec := json.NewDecoder(bufio.NewReader(zr))
+		dec.UseNumber()
+		err = dec.Decode(v)
+	}
+	if err != nil {
+		os.Remove(c.path(key))
+		c.stats.Misses++
+		return false
+	}
+	if info, err := f.Stat(); err == nil {
+		c.stats.BytesRead += info.Size()
+	}
+	c.stats.Hits++
+	return true
+}
+
+// put stores v under key. The entry is written to a temporary file and
+// renamed into place, so concurrent runs sharing the directory never see a
+// partial entry.
+func (c *Cache) put(key string, v any) error {
+	dir := filepath.Dir(c.path(key))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("create cache entry: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op after the rename
+
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(v)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("store cache entry: %w", err)
+	}
+	if info, err := os.Stat(c.path(key)); err == nil {
+		c.stats.BytesWritten += info.Size()
+	}
+	c.stats.Written++
+	return nil
+}
+
+// runKey hashes everything outside the analyzed files that shapes the graph
+// for platform: the generator itself, the Go toolchain, module requirements,
+// and the generation settings.
+func runKey(ctx context.Context, cfg *Config, ms *ModuleSet, goworkPath string, platform Platform) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, cacheFormat)
+
+	exe, err := executableHash()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(h, "generator", exe)
+
+	cmd := exec.CommandContext(ctx, "go", "env", "GOVERSION")
+	cmd.Dir = ms.PrimaryDir()
+	cmd.Env = platform.env(workspaceEnv(os.Environ(), goworkPath))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go env GOVERSION: %w", err)
+	}
+	fmt.Fprintln(h, "go", strings.TrimSpace(string(out)))
+
+	// The workspace lists every module directory, including discovered
+	// sub-modules; their go.mod and go.sum pin all external dependencies.
+	work, err := os.ReadFile(goworkPath)
+	if err != nil {
+		return "", fmt.Errorf("read go.work: %w", err)
+	}
+	h.Write(work)
+	for _, line := range strings.Split(string(work), "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+		dir := strings.TrimSpace(line)
+		for _, name := range []string{"go.mod", "go.sum"} {
+			hashFile(h, filepath.Join(dir, name))
+		}
+	}
+
+	for _, m := range ms.Dirs() {
+		fmt.Fprintln(h, "module", m.Dir, m.ModPath, m.Prefix)
+	}
+	f := ms.files
+	fmt.Fprintln(h, "files", f.SkipTests, f.SkipGenerated, f.Include, f.Exclude)
+	fmt.Fprintln(h, "skipped phases", cfg.phases.Skipped())
+	fmt.Fprintln(h, "platform", platform.Name(), platform.buildFlags())
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile writes path and its content (or its absence) to h.
+func hashFile(h hash.Hash, path string) {
+	fmt.Fprintln(h, "file", path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(h, "missing")
+		return
+	}
+	h.Write(data)
+}
+
+var (
+	exeHashOnce sync.Once
+	exeHash     string
+	exeHashErr  error
+)
+
+// executableHash returns the SHA-256 of the running binary, so that any
+// change to the generator invalidates every cache entry.
+func executableHash() (string, error) {
+	exeHashOnce.Do(func() {
+		path, err := os.Executable()
+		if err != nil {
+			exeHashErr = fmt.Errorf("locate executable: %w", err)
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			exeHashErr = fmt.Errorf("hash executable: %w", err)
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			exeHashErr = fmt.Errorf("hash executable: %w", err)
+			return
+		}
+		exeHash = hex.EncodeToString(h.Sum(nil))
+	})
+	return exeHash, exeHashErr
+}
+
+// packageKeys returns the cache key of every package, by import path. A key
+// combines run with the package's own file hashes and those of every loaded
+// package it transitively imports, so an edit re-keys the edited package and
+// all of its reverse dependencies, the same set -incremental re-analyzes.
+func packageKeys(run string, pkgs []*packages.Package, hashes map[string]FileHash) map[string]string {
+	files := make(map[string][]string)
+	for file, h := range hashes {
+		files[h.PkgPath] = append(files[h.PkgPath], file+" "+h.Hash)
+	}
+	own := make(map[string]string, len(pkgs))
+	byPath := make(map[string]*packages.Package, len(pkgs))
+	for _, pkg := range pkgs {
+		sort.Strings(files[pkg.PkgPath])
+		sum := sha256.Sum256([]byte(strings.Join(files[pkg.PkgPath], "\n")))
+		own[pkg.PkgPath] = hex.EncodeToString(sum[:])
+		byPath[pkg.PkgPath] = pkg
+	}
+
+	keys := make(map[string]string, len(pkgs))
+	for _, pkg := range pkgs {
+		// Test variants may import a package that imports them back, so the
+		// closure is collected with a visited set rather than recursively keyed.
+		closure := map[string]bool{pkg.PkgPath: true}
+		stack := []*packages.Package{pkg}
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for impPath := range cur.Imports {
+				if dep, ok := byPath[impPath]; ok && !closure[impPath] {
+					closure[impPath] = true
+					stack = append(stack, dep)
+				}
+			}
+		}
+		deps := make([]string, 0, len(closure))
+		for p := range closure {
+			deps = append(deps, p+" "+own[p])
+		}
+		sort.Strings(deps)
+
+		h := sha256.New()
+		fmt.Fprintln(h, run)
+		fmt.Fprintln(h, "package", pkg.PkgPath)
+		for _, d := range deps {
+			fmt.Fprintln(h, d)
+		}
+		keys[pkg.PkgPath] = hex.EncodeToString(h.Sum(nil))
+	}
+	return keys
+}
+
+// partition splits g into one fragment per loaded package. Nodes belong to
+// the package they were found in; an edge belongs to its source's package,
+// or to its target's when the source is an external stub. External stubs are
+// copied into every fragment with an edge referencing them. It returns
+// false if some node or edge belongs to no package, in which case the graph
+// cannot be rebuilt from fragments.
+func partition(g *CPG, ms *ModuleSet, pkgs []*packages.Package) (map[string]*fragment, bool) {
+	byRel := make(map[string]string, len(pkgs))
+	frags := make(map[string]*fragment, len(pkgs))
+	for _, pkg := range pkgs {
+		byRel[ms.RelPkg(pkg.PkgPath)] = pkg.PkgPath
+		frags[pkg.PkgPath] = &fragment{Sources: map[string]string{}}
+	}
+
+	owner := make(map[string]string) // node ID → import path
+	stubs := make(map[string]Node)
+	for n := range g.AllNodes() {
+		if pkgPath, ok := byRel[n.Package]; ok {
+			owner[n.ID] = pkgPath
+			frags[pkgPath].Nodes = append(frags[pkgPath].Nodes, n)
+		} else {
+			stubs[n.ID] = n
+		}
+	}
+
+	used := make(map[string]map[string]bool) // import path → stub IDs added
+	referenced := make(map[string]bool)
+	complete := true
+	for e := range g.AllEdges() {
+		pkgPath, ok := owner[e.Source]
+		if !ok {
+			pkgPath, ok = owner[e.Target]
+		}
+		if !ok {
+			complete = false
+			continue
+		}
+		f := frags[pkgPath]
+		f.Edges = append(f.Edges, e)
+		for _, id := range []string{e.Source, e.Target} {
+			stub, isStub := stubs[id]
+			if !isStub || used[pkgPath][id] {
+				continue
+			}
+			if used[pkgPath] == nil {
+				used[pkgPath] = make(map[string]bool)
+			}
+			used[pkgPath][id] = true
+			referenced[id] = true
+			f.Nodes = append(f.Nodes, stub)
+		}
+	}
+	if len(referenced) < len(stubs) {
+		complete = false
+	}
+
+	// Metrics for external stubs are rebuilt by ComputeFanInOut.
+	for id, m := range g.Metrics {
+		if pkgPath, ok := owner[id]; ok {
+			frags[pkgPath].Metrics = append(frags[pkgPath].Metrics, *m)
+		}
+	}
+	for _, f := range frags {
+		sort.Slice(f.Metrics, func(i, j int) bool { return f.Metrics[i].FunctionID < f.Metrics[j].FunctionID })
+	}
+
+	for file, content := range g.AllSources() {
+		h, ok := g.FileHashes[file]
+		if !ok || frags[h.PkgPath] == nil {
+			complete = false
+			continue
+		}
+		frags[h.PkgPath].Sources[file] = content
+	}
+	return frags, complete
+}
+
+// escapeKey returns the cache key for escape analysis of module m: it covers
+// every package key in the module, so any edit in it reruns the compiler.
+func escapeKey(m ModuleInfo, ms *ModuleSet, keys map[string]string) string {
+	var pkgKeys []string
+	for pkgPath, key := range keys {
+		if mod, ok := ms.ModuleOf(pkgPath); ok && mod.Dir == m.Dir {
+			pkgKeys = append(pkgKeys, key)
+		}
+	}
+	sort.Strings(pkgKeys)
+	h := sha256.New()
+	fmt.Fprintln(h, "escape", m.Dir, m.Prefix)
+	for _, k := range pkgKeys {
+		fmt.Fprintln(h, k)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// escapes returns escape analysis results for mods, reusing cached results
+// for modules whose packages are unchanged and running the compiler only for
+// the rest. Results of modules whose build failed or timed out are not
+// stored.
+func (c *Cache) escapes(ctx context.Context, mods []ModuleInfo, ms *ModuleSet, keys map[string]string, timeout time.Duration, prog *Progress) ([]EscapeResult, []PhaseIssue, error) {
+	cached := make(map[string][]EscapeResult)
+	var missing []ModuleInfo
+	for _, m := range mods {
+		var results []EscapeResult
+		if c.get(escapeKey(m, ms, keys), &results) {
+			cached[m.Dir] = results
+		} else {
+			missing = append(missing, m)
+		}
+	}
+	var issues []PhaseIssue
+	if len(missing) > 0 {
+		results, iss, err := RunEscapeAnalysis(ctx, missing, timeout, prog)
+		if err != nil {
+			return nil, nil, err
+		}
+		issues = iss
+		degraded := make(map[string]bool)
+		for _, is := range issues {
+			degraded[is.Module] = true
+		}
+		byPrefix := make(map[string][]EscapeResult)
+		for _, r := range results {
+			byPrefix[r.Module] = append(byPrefix[r.Module], r)
+		}
+		for _, m := range missing {
+			cached[m.Dir] = byPrefix[m.Prefix]
+			if degraded[m.ModPath] {
+				continue // incomplete
+			}
+			if err := c.put(escapeKey(m, ms, keys), byPrefix[m.Prefix]); err != nil {
+				prog.Log("  warning: %v", err)
+			}
+		}
+	} else {
+		prog.Log("Escape analysis: reusing cached results for %d modules", len(mods))
+	}
+
+	var all []EscapeResult
+	for _, m := range mods {
+		all = append(all, cached[m.Dir]...)
+	}
+	return all, issues, nil
+}
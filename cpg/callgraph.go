@@ -1,16 +1,22 @@
-package main
+package cpg
 
 import (
 	"go/token"
+	"go/types"
+	"maps"
+	"sort"
+	"strings"
 
 	"golang.org/x/tools/go/callgraph"
 	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/ssa"
 )
 
 // BuildCallGraph constructs a VTA call graph and emits call/call_site edges.
 func BuildCallGraph(
 	ssaResult *SSAResult,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	posLookup *PosLookup,
 	funcLookup *FuncLookup,
 	cpg *CPG,
@@ -21,26 +27,34 @@ func BuildCallGraph(
 	cg := vta.CallGraph(ssaResult.AllFuncs, nil)
 	cg.DeleteSyntheticNodes()
 
-	var callEdges, callSiteEdges, paramInEdges, paramOutEdges, callToReturnEdges int
+	var callEdges, callSiteEdges, paramInEdges, paramOutEdges, callToReturnEdges, instCount int
 	var vtaTotal, vtaProm, vtaMatched, stubCount int
 	stubs := make(map[string]bool) // track created stub nodes
 
-	_ = callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
+	visit := func(edge *callgraph.Edge) error {
 		caller := edge.Caller.Func
 		callee := edge.Callee.Func
 
 		vtaTotal++
 
-		// At least one must be in a known module
-		callerKnown := caller.Pkg != nil && modSet.IsKnownPkg(caller.Pkg.Pkg.Path())
-		calleeKnown := callee.Pkg != nil && modSet.IsKnownPkg(callee.Pkg.Pkg.Path())
+		// At least one must be in a known module. Instantiations of generic
+		// functions have no package of their own; they count as their origin's.
+		callerPkg, calleePkg := funcPkg(caller), funcPkg(callee)
+		callerKnown := callerPkg != nil && ms.IsKnownPkg(callerPkg.Pkg.Path())
+		calleeKnown := calleePkg != nil && ms.IsKnownPkg(calleePkg.Pkg.Path())
 		if !callerKnown && !calleeKnown {
 			return nil
 		}
+		// Incremental mode: keep only edges touching a re-analyzed package
+		callerInScope := callerPkg != nil && cpg.InScope(callerPkg.Pkg.Path())
+		calleeInScope := calleePkg != nil && cpg.InScope(calleePkg.Pkg.Path())
+		if !callerInScope && !calleeInScope {
+			return nil
+		}
 		vtaProm++
 
-		callerID := ssaFuncNodeID(caller, fset, funcLookup)
-		calleeID := ssaFuncNodeID(callee, fset, funcLookup)
+		callerID := ssaFuncNodeID(caller, fset, ms, funcLookup)
+		calleeID := ssaFuncNodeID(callee, fset, ms, funcLookup)
 
 		if callerID == "" {
 			return nil
@@ -49,26 +63,35 @@ func BuildCallGraph(
 		// Create stub node for external callee if it doesn't have a known module node.
 		// If the callee belongs to a known module but wasn't found in funcLookup
 		// (e.g., in a skipped generated/test file), don't create a misleading
-		// "ext::" stub — just skip the edge entirely.
-		if calleeID == "" && callee.Pkg != nil {
+		// "ext::" stub — just skip the edge entirely. Calls to an instantiation
+		// go to the stub of its generic origin, as internal ones resolve to
+		// the generic declaration by position.
+		if calleeID == "" && calleePkg != nil {
 			if calleeKnown {
 				// Known-module function without an AST node (skipped file).
 				// Skip rather than create a phantom external stub.
 				return nil
 			}
-			pkgPath := callee.Pkg.Pkg.Path()
-			stubID := "ext::" + callee.String()
+			target := callee
+			if origin := callee.Origin(); origin != nil {
+				target = origin
+			}
+			stubID := "ext::" + target.String()
 			if !stubs[stubID] {
+				props := map[string]any{
+					"external":  true,
+					"full_name": target.String(),
+				}
+				if fn, ok := target.Object().(*types.Func); ok {
+					setExternalDeprecation(props, fn, ssaResult.Deprecated)
+				}
 				cpg.AddNode(Node{
-					ID:       stubID,
-					Kind:     "function",
-					Name:     callee.Name(),
-					Package:  modSet.RelPkg(pkgPath),
-					TypeInfo: callee.Signature.String(),
-					Properties: map[string]any{
-						"external":  true,
-						"full_name": callee.String(),
-					},
+					ID:         stubID,
+					Kind:       "function",
+					Name:       target.Name(),
+					Package:    ms.RelPkg(calleePkg.Pkg.Path()),
+					TypeInfo:   target.Signature.String(),
+					Properties: props,
 				})
 				stubs[stubID] = true
 				stubCount++
@@ -104,17 +127,23 @@ func BuildCallGraph(
 			return nil
 		}
 		p := fset.Position(sitePos)
-		relFile := modSet.RelFile(p.Filename)
+		relFile := ms.RelFile(p.Filename)
 		var siteID string
 		if relFile != "" {
 			siteID = posLookup.Get(relFile, p.Line, p.Column)
 		}
 		if siteID != "" {
+			siteProps := props
+			if instID := addInstantiation(callee, callerPkg, calleeID, ms, cpg); instID != "" {
+				siteProps = maps.Clone(props)
+				siteProps["instance"] = instID
+				instCount++
+			}
 			cpg.AddEdge(Edge{
 				Source:     siteID,
 				Target:     calleeID,
 				Kind:       "call_site",
-				Properties: props,
+				Properties: siteProps,
 			})
 			callSiteEdges++
 		}
@@ -135,7 +164,7 @@ func BuildCallGraph(
 				continue
 			}
 			aPos := fset.Position(argPos)
-			aFile := modSet.RelFile(aPos.Filename)
+			aFile := ms.RelFile(aPos.Filename)
 			if aFile == "" {
 				continue // argument from file outside known modules
 			}
@@ -148,7 +177,7 @@ func BuildCallGraph(
 				continue
 			}
 			pPos := fset.Position(paramPos)
-			pFile := modSet.RelFile(pPos.Filename)
+			pFile := ms.RelFile(pPos.Filename)
 			if pFile == "" {
 				continue // parameter from file outside known modules
 			}
@@ -185,10 +214,112 @@ func BuildCallGraph(
 		}
 
 		return nil
-	})
+	}
+	for _, edge := range orderedCallEdges(cg, fset) {
+		_ = visit(edge)
+	}
 
 	prog.Log("VTA: %d total edges, %d known-module pairs, %d matched to AST, %d external stubs", vtaTotal, vtaProm, vtaMatched, stubCount)
 	prog.Log("Created %d call, %d call_site, %d param_in, %d param_out, %d call_to_return edges", callEdges, callSiteEdges, paramInEdges, paramOutEdges, callToReturnEdges)
+	if instCount > 0 {
+		prog.Log("Linked %d call sites to generic instantiations", instCount)
+	}
+}
+
+// funcPkg returns the package fn belongs to. Instantiations of generic
+// functions (and closures inside them) have no package of their own, so
+// theirs is their generic origin's.
+func funcPkg(fn *ssa.Function) *ssa.Package {
+	if fn.Pkg == nil {
+		if origin := fn.Origin(); origin != nil {
+			return origin.Pkg
+		}
+	}
+	return fn.Pkg
+}
+
+// addInstantiation records the instantiation a call site in callerPkg calls,
+// if callee is one: an instantiation node in the calling package (where the
+// compiler instantiates it too) with an instantiates edge to the generic
+// origin originID. It returns the node's ID, or "" for other callees.
+func addInstantiation(callee *ssa.Function, callerPkg *ssa.Package, originID string, ms *ModuleSet, cpg *CPG) string {
+	if callee.Parent() != nil || len(callee.TypeArgs()) == 0 || callerPkg == nil {
+		return ""
+	}
+	qualifier := func(p *types.Package) string { return ms.RelPkg(p.Path()) }
+	typeArgs := make([]string, len(callee.TypeArgs()))
+	for i, t := range callee.TypeArgs() {
+		typeArgs[i] = types.TypeString(t, qualifier)
+	}
+	// Methods of generic types carry the type arguments on their receiver.
+	origin := callee.Origin()
+	name := origin.Name() + "[" + strings.Join(typeArgs, ", ") + "]"
+	if recv := callee.Signature.Recv(); recv != nil {
+		name = "(" + types.TypeString(recv.Type(), qualifier) + ")." + origin.Name()
+	}
+	fullName := name
+	if callee.Signature.Recv() == nil {
+		fullName = ms.RelPkg(origin.Pkg.Pkg.Path()) + "." + name
+	}
+
+	relPkg := ms.RelPkg(callerPkg.Pkg.Path())
+	id := relPkg + "::" + fullName
+	cpg.AddNode(Node{
+		ID:       id,
+		Kind:     "instantiation",
+		Name:     name,
+		Package:  relPkg,
+		TypeInfo: callee.Signature.String(),
+		Properties: map[string]any{
+			"full_name": fullName,
+			"type_args": typeArgs,
+		},
+	})
+	cpg.AddEdge(Edge{
+		Source:     id,
+		Target:     originID,
+		Kind:       "instantiates",
+		Properties: map[string]any{"type_args": typeArgs},
+	})
+	return id
+}
+
+// orderedCallEdges returns every edge of cg ordered by caller, call site
+// position, and callee, so stub nodes and edges are emitted in the same order
+// on every run (callgraph.GraphVisitEdges follows map order).
+func orderedCallEdges(cg *callgraph.Graph, fset *token.FileSet) []*callgraph.Edge {
+	keys := make(map[*ssa.Function]funcKey, len(cg.Nodes))
+	key := func(fn *ssa.Function) funcKey {
+		k, ok := keys[fn]
+		if !ok {
+			k = keyOf(fn, fset)
+			keys[fn] = k
+		}
+		return k
+	}
+	var edges []*callgraph.Edge
+	for _, n := range cg.Nodes {
+		edges = append(edges, n.Out...)
+	}
+	// Sites are compared by file offset: token.Pos values depend on the order
+	// go/packages happened to parse files in.
+	siteOffset := func(e *callgraph.Edge) int {
+		if e.Site == nil || !e.Site.Pos().IsValid() {
+			return -1
+		}
+		return fset.Position(e.Site.Pos()).Offset
+	}
+	sort.SliceStable(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if ka, kb := key(a.Caller.Func), key(b.Caller.Func); ka != kb {
+			return ka.less(kb)
+		}
+		if oa, ob := siteOffset(a), siteOffset(b); oa != ob {
+			return oa < ob
+		}
+		return key(a.Callee.Func).less(key(b.Callee.Func))
+	})
+	return edges
 }
 
 // ComputeFanInOut calculates fan-in, fan-out, and recursion from the call graph edges.
@@ -202,7 +333,7 @@ func ComputeFanInOut(cpg *CPG) {
 	fanOut := make(map[string]int)     // source → count
 	recursive := make(map[string]bool) // functions with self-referencing call edges
 
-	for _, e := range cpg.Edges {
+	for e := range cpg.AllEdges() {
 		if e.Kind != "call" {
 			continue
 		}
@@ -215,13 +346,17 @@ func ComputeFanInOut(cpg *CPG) {
 	}
 
 	// Mark recursive functions in node properties
-	for i := range cpg.Nodes {
-		if cpg.Nodes[i].Kind == "function" && recursive[cpg.Nodes[i].ID] {
-			if cpg.Nodes[i].Properties == nil {
-				cpg.Nodes[i].Properties = map[string]any{}
+	if len(recursive) > 0 {
+		cpg.UpdateNodes(func(n *Node) bool {
+			if n.Kind != "function" || !recursive[n.ID] {
+				return false
 			}
-			cpg.Nodes[i].Properties["recursive"] = true
-		}
+			if n.Properties == nil {
+				n.Properties = map[string]any{}
+			}
+			n.Properties["recursive"] = true
+			return true
+		})
 	}
 
 	// Update existing metrics entries
@@ -1,4 +1,4 @@
-package main
+package cpg
 
 import (
 	"go/token"
@@ -17,91 +17,111 @@ import (
 func ExtractCDG(
 	ssaResult *SSAResult,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	funcLookup *FuncLookup,
 	cpg *CPG,
+	workers int,
 	prog *Progress,
 ) {
 	prog.Log("Extracting CDG (control dependence)...")
 
 	var cdgEdges, domEdges, pdomEdges, cdgFuncs int
 
-	for fn := range ssaResult.AllFuncs {
-		if fn.Pkg == nil || fn.Synthetic != "" {
-			continue
-		}
-		if !modSet.IsKnownPkg(fn.Pkg.Pkg.Path()) {
-			continue
-		}
-		if len(fn.Blocks) < 2 {
-			continue
+	var fns []*ssa.Function
+	for _, fn := range ssaResult.Funcs {
+		if cpg.InScope(fn.Pkg.Pkg.Path()) && len(fn.Blocks) >= 2 {
+			fns = append(fns, fn)
 		}
+	}
 
-		funcNodeID := ssaFuncNodeID(fn, fset, funcLookup)
-		if funcNodeID == "" {
-			continue
+	forEachOrdered(len(fns), workers, func(i int) *cdgResult {
+		return extractFuncCDG(fns[i], fset, ms, funcLookup)
+	}, func(_ int, r *cdgResult) {
+		if r == nil {
+			return
 		}
+		cpg.Merge(&r.out)
+		cdgEdges += r.cdgEdges
+		domEdges += r.domEdges
+		pdomEdges += r.pdomEdges
+		cdgFuncs++
+	})
 
-		n := len(fn.Blocks)
-		blockIDs := make([]string, n)
-		for i := range fn.Blocks {
-			blockIDs[i] = BlockID(funcNodeID, i)
-		}
+	prog.Log("Created %d CDG, %d dom, %d pdom edges across %d functions", cdgEdges, domEdges, pdomEdges, cdgFuncs)
+}
 
-		// Compute post-dominator tree
-		ipdom := postDominators(fn.Blocks)
+type cdgResult struct {
+	out                           graphBuffer
+	cdgEdges, domEdges, pdomEdges int
+}
 
-		// Emit CDG edges from post-dominance frontiers.
-		// For each CFG edge (u → v) where v ≠ ipdom(u):
-		//   Walk from v up the pdom tree to ipdom(u), stopping there.
-		//   Each visited node w gets CDG edge: u → w.
-		for u, block := range fn.Blocks {
-			if len(block.Succs) < 2 {
-				continue // only branching blocks create control dependence
-			}
-			for _, succBlock := range block.Succs {
-				v := succBlock.Index
-				stop := ipdom[u] // stop at immediate post-dominator of u
-
-				w := v
-				for w != -1 && w != stop {
-					cpg.AddEdge(Edge{
-						Source: blockIDs[u],
-						Target: blockIDs[w],
-						Kind:   "cdg",
-					})
-					cdgEdges++
-					w = ipdom[w]
-				}
-			}
-		}
-		// Dominator edges (from SSA's built-in dominator tree)
-		for _, block := range fn.Blocks {
-			for _, child := range block.Dominees() {
-				cpg.AddEdge(Edge{
-					Source: blockIDs[block.Index],
-					Target: blockIDs[child.Index],
-					Kind:   "dom",
-				})
-				domEdges++
-			}
+// extractFuncCDG computes CDG, dom, and pdom edges for one function, or
+// returns nil when the function has no AST node.
+func extractFuncCDG(fn *ssa.Function, fset *token.FileSet, ms *ModuleSet, funcLookup *FuncLookup) *cdgResult {
+	funcNodeID := ssaFuncNodeID(fn, fset, ms, funcLookup)
+	if funcNodeID == "" {
+		return nil
+	}
+	r := &cdgResult{}
+	out := &r.out
+
+	n := len(fn.Blocks)
+	blockIDs := make([]string, n)
+	for i := range fn.Blocks {
+		blockIDs[i] = BlockID(funcNodeID, i)
+	}
+
+	// Compute post-dominator tree
+	ipdom := postDominators(fn.Blocks)
+
+	// Emit CDG edges from post-dominance frontiers.
+	// For each CFG edge (u → v) where v ≠ ipdom(u):
+	//   Walk from v up the pdom tree to ipdom(u), stopping there.
+	//   Each visited node w gets CDG edge: u → w.
+	for u, block := range fn.Blocks {
+		if len(block.Succs) < 2 {
+			continue // only branching blocks create control dependence
 		}
+		for _, succBlock := range block.Succs {
+			v := succBlock.Index
+			stop := ipdom[u] // stop at immediate post-dominator of u
 
-		// Post-dominator edges (from our computed pdom tree)
-		for i := 0; i < n; i++ {
-			if ipdom[i] >= 0 && ipdom[i] < n {
-				cpg.AddEdge(Edge{
-					Source: blockIDs[ipdom[i]],
-					Target: blockIDs[i],
-					Kind:   "pdom",
+			w := v
+			for w != -1 && w != stop {
+				out.AddEdge(Edge{
+					Source: blockIDs[u],
+					Target: blockIDs[w],
+					Kind:   "cdg",
 				})
-				pdomEdges++
+				r.cdgEdges++
+				w = ipdom[w]
 			}
 		}
-
-		cdgFuncs++
+	}
+	// Dominator edges (from SSA's built-in dominator tree)
+	for _, block := range fn.Blocks {
+		for _, child := range block.Dominees() {
+			out.AddEdge(Edge{
+				Source: blockIDs[block.Index],
+				Target: blockIDs[child.Index],
+				Kind:   "dom",
+			})
+			r.domEdges++
+		}
 	}
 
-	prog.Log("Created %d CDG, %d dom, %d pdom edges across %d functions", cdgEdges, domEdges, pdomEdges, cdgFuncs)
+	// Post-dominator edges (from our computed pdom tree)
+	for i := 0; i < n; i++ {
+		if ipdom[i] >= 0 && ipdom[i] < n {
+			out.AddEdge(Edge{
+				Source: blockIDs[ipdom[i]],
+				Target: blockIDs[i],
+				Kind:   "pdom",
+			})
+			r.pdomEdges++
+		}
+	}
+	return r
 }
 
 // postDominators computes the immediate post-dominator tree using the
@@ -0,0 +1,571 @@
+package cpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a declarative generation recipe, loaded from -config (YAML or
+// JSON) or assembled from command-line flags. Relative directories in a
+// config file are resolved against the file's own directory, so a recipe
+// checked into a repository works from any working directory.
+//
+//	primary: .
+//	modules:
+//	  - dir: ../client_golang
+//	  - dir: ../prometheus-adapter
+//	    name: adapter
+//	  - dir: github.com/prometheus/alertmanager@v0.27.0
+//	exclude: ["web/ui/**"]
+//	skip_phases: [escape]
+//	platforms: [linux/amd64, windows/amd64, darwin/arm64]
+//	schema_roots: [config.Config]
+//	thresholds:
+//	  complexity: 20
+//	memory:
+//	  limit: 4GiB
+//	  stream: true
+//	cache_dir: .cpg-cache
+//	timeouts:
+//	  escape: 20m
+//	output:
+//	  path: cpg.db
+type Config struct {
+	Primary       string         `yaml:"primary" json:"primary"`
+	Modules       []ModuleConfig `yaml:"modules" json:"modules"`
+	Include       []string       `yaml:"include" json:"include"`
+	Exclude       []string       `yaml:"exclude" json:"exclude"`
+	SkipTests     *bool          `yaml:"skip_tests" json:"skip_tests"`
+	SkipGenerated *bool          `yaml:"skip_generated" json:"skip_generated"`
+	Phases        []string       `yaml:"phases" json:"phases"`
+	SkipPhases    []string       `yaml:"skip_phases" json:"skip_phases"`
+	Profiles      []string       `yaml:"profiles" json:"profiles"`
+	Platforms     []string       `yaml:"platforms" json:"platforms"`
+	Workers       int            `yaml:"workers" json:"workers"` // 0 means GOMAXPROCS
+	Thresholds    Thresholds     `yaml:"thresholds" json:"thresholds"`
+	SchemaRoots   []string       `yaml:"schema_roots" json:"schema_roots"` // root config types of serialized_schema, e.g. config.Config
+	Memory        MemoryConfig   `yaml:"memory" json:"memory"`
+	CacheDir      string         `yaml:"cache_dir" json:"cache_dir"` // per-package fragment cache; empty disables it
+	Timeouts      TimeoutConfig  `yaml:"timeouts" json:"timeouts"`
+	Output        OutputConfig   `yaml:"output" json:"output"`
+
+	// Resolved by Validate.
+	primary       ModuleInfo
+	extras        []ModuleInfo
+	phases        *PhaseSet
+	platforms     []Platform
+	memoryLimit   int64
+	escapeTimeout time.Duration
+	gitTimeout    time.Duration
+	file          string // set by LoadConfig
+}
+
+// ModuleConfig declares one additional module. Path and Name are optional:
+// the module path is read from Dir/go.mod and the name defaults to the last
+// element of the module path. Dir may instead be a module@version spec, which
+// is analyzed from the Go module cache and downloaded there if missing.
+type ModuleConfig struct {
+	Dir  string `yaml:"dir" json:"dir"`
+	Path string `yaml:"path" json:"path"`
+	Name string `yaml:"name" json:"name"`
+}
+
+// MemoryConfig bounds the generator's memory use. Limit is a soft limit for
+// the Go runtime (default 8GiB; "off" disables it). With Stream, nodes,
+// edges, and sources are spilled to a staging database in SpillDir (default:
+// the output directory) whenever they outgrow an eighth of the limit, so the
+// graph no longer has to fit in memory; loaded packages and SSA still do.
+type MemoryConfig struct {
+	Limit    string `yaml:"limit" json:"limit"`
+	Stream   bool   `yaml:"stream" json:"stream"`
+	SpillDir string `yaml:"spill_dir" json:"spill_dir"`
+}
+
+// TimeoutConfig bounds each run of an external tool, as a Go duration
+// ("90s", "10m") or "off". Escape is per module `go build -gcflags=-m`
+// (default 10m); Git is per git command (default 2m). A tool that runs out
+// of time is killed and its phase is recorded as degraded.
+type TimeoutConfig struct {
+	Escape string `yaml:"escape" json:"escape"`
+	Git    string `yaml:"git" json:"git"`
+}
+
+// DefaultMemoryLimit is the runtime memory limit used when none is configured.
+const DefaultMemoryLimit = 8 << 30
+
+// OutputConfig controls where and how the database is written.
+type OutputConfig struct {
+	Path           string `yaml:"path" json:"path"`
+	Validate       bool   `yaml:"validate" json:"validate"`
+	ValidateReport string `yaml:"validate_report" json:"validate_report"` // JSON validation report; implies Validate
+	Incremental    bool   `yaml:"incremental" json:"incremental"`
+	Verbose        bool   `yaml:"verbose" json:"verbose"`
+}
+
+// Thresholds are the cut-offs used by threshold-based findings. Zero values
+// fall back to the defaults from DefaultThresholds.
+type Thresholds struct {
+	Complexity    int `yaml:"complexity" json:"complexity"`         // 'complexity' finding: cyclomatic complexity ≥ N
+	FunctionLines int `yaml:"function_lines" json:"function_lines"` // 'size' finding: function LOC ≥ N
+	NestingDepth  int `yaml:"nesting_depth" json:"nesting_depth"`   // 'nesting' finding: control-structure depth ≥ N
+	HubFan        int `yaml:"hub_fan" json:"hub_fan"`               // 'hub' finding: fan-in and fan-out both ≥ N
+}
+
+// DefaultThresholds returns the built-in finding thresholds.
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		Complexity:    15,
+		FunctionLines: 100,
+		NestingDepth:  8,
+		HubFan:        10,
+	}
+}
+
+// withDefaults fills zero fields from DefaultThresholds.
+func (t Thresholds) withDefaults() Thresholds {
+	d := DefaultThresholds()
+	if t.Complexity == 0 {
+		t.Complexity = d.Complexity
+	}
+	if t.FunctionLines == 0 {
+		t.FunctionLines = d.FunctionLines
+	}
+	if t.NestingDepth == 0 {
+		t.NestingDepth = d.NestingDepth
+	}
+	if t.HubFan == 0 {
+		t.HubFan = d.HubFan
+	}
+	return t
+}
+
+// LoadConfig reads a YAML or JSON config file (chosen by extension; anything
+// other than .json is parsed as YAML). Unknown keys are rejected so typos
+// surface immediately instead of being silently ignored.
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	cfg := &Config{file: file}
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("parse config %s: %w", file, err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) { // io.EOF: empty file
+			return nil, fmt.Errorf("parse config %s: %w", file, err)
+		}
+	}
+
+	// Resolve directories relative to the config file.
+	base, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("config dir: %w", err)
+	}
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) || IsModuleSpec(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	cfg.Primary = resolve(cfg.Primary)
+	cfg.Output.Path = resolve(cfg.Output.Path)
+	cfg.Output.ValidateReport = resolve(cfg.Output.ValidateReport)
+	cfg.Memory.SpillDir = resolve(cfg.Memory.SpillDir)
+	cfg.CacheDir = resolve(cfg.CacheDir)
+	for i := range cfg.Modules {
+		cfg.Modules[i].Dir = resolve(cfg.Modules[i].Dir)
+	}
+	return cfg, nil
+}
+
+// Validate checks the whole config and resolves module paths and prefixes.
+// All problems are reported together, each prefixed with its field.
+func (c *Config) Validate() error {
+	return c.ValidateContext(context.Background())
+}
+
+// ValidateContext is Validate with a context that bounds the download of
+// module@version specs. If ctx is cancelled, its error is returned alone.
+func (c *Config) ValidateContext(ctx context.Context) error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	// Modules
+	if c.Primary == "" {
+		fail("primary", "required (config key or first argument)")
+	} else if mod, err := resolveModule(ctx, c.Primary, "", ""); err != nil {
+		fail("primary", "%v", err)
+	} else {
+		c.primary = mod
+	}
+	c.extras = nil
+	names := map[string]string{"": "primary"}
+	for i, m := range c.Modules {
+		field := fmt.Sprintf("modules[%d]", i)
+		if m.Dir == "" {
+			fail(field+".dir", "required")
+			continue
+		}
+		mod, err := resolveModule(ctx, m.Dir, m.Path, m.Name)
+		if err != nil {
+			fail(field, "%v", err)
+			continue
+		}
+		if mod.Prefix == "" {
+			mod.Prefix = DerivePrefix(mod.ModPath)
+		}
+		if prev, dup := names[mod.Prefix]; dup {
+			fail(field+".name", "%q is already used by %s", mod.Prefix, prev)
+			continue
+		}
+		names[mod.Prefix] = field
+		c.extras = append(c.extras, mod)
+	}
+
+	// File filters
+	for i, g := range c.Include {
+		if err := validateGlob(g); err != nil {
+			fail(fmt.Sprintf("include[%d]", i), "%v", err)
+		}
+	}
+	for i, g := range c.Exclude {
+		if err := validateGlob(g); err != nil {
+			fail(fmt.Sprintf("exclude[%d]", i), "%v", err)
+		}
+	}
+
+	// Phases
+	if ps, err := ResolvePhases(c.Phases, c.SkipPhases); err != nil {
+		fail("phases", "%v", err)
+	} else {
+		c.phases = ps
+	}
+
+	// Profiles
+	for i, p := range c.Profiles {
+		if p != "none" && !slices.Contains(ProfileNames(), p) {
+			fail(fmt.Sprintf("profiles[%d]", i), "unknown profile %q (available: %s)", p, strings.Join(ProfileNames(), ", "))
+		}
+	}
+
+	// Platforms
+	c.platforms = nil
+	seen := make(map[string]bool)
+	for i, spec := range c.Platforms {
+		p, err := ParsePlatform(spec)
+		if err != nil {
+			fail(fmt.Sprintf("platforms[%d]", i), "%v", err)
+			continue
+		}
+		if seen[p.Name()] {
+			fail(fmt.Sprintf("platforms[%d]", i), "%s listed twice", p.Name())
+			continue
+		}
+		seen[p.Name()] = true
+		c.platforms = append(c.platforms, p)
+	}
+	if len(c.Platforms) > 1 && c.Output.Incremental {
+		fail("output.incremental", "not supported with multiple platforms")
+	}
+
+	if c.Workers < 0 {
+		fail("workers", "must not be negative, got %d", c.Workers)
+	}
+
+	// Memory
+	c.memoryLimit = DefaultMemoryLimit
+	if c.Memory.Limit != "" {
+		if n, err := ParseByteSize(c.Memory.Limit); err != nil {
+			fail("memory.limit", "%v", err)
+		} else {
+			c.memoryLimit = n
+		}
+	}
+	if c.Memory.Stream {
+		if len(c.Platforms) > 1 {
+			fail("memory.stream", "not supported with multiple platforms")
+		}
+		if c.Memory.SpillDir != "" {
+			if info, err := os.Stat(c.Memory.SpillDir); err != nil || !info.IsDir() {
+				fail("memory.spill_dir", "directory %s does not exist", c.Memory.SpillDir)
+			}
+		}
+	}
+
+	// Timeouts
+	for _, t := range []struct {
+		field, value string
+		dst          *time.Duration
+		def          time.Duration
+	}{
+		{"timeouts.escape", c.Timeouts.Escape, &c.escapeTimeout, DefaultEscapeTimeout},
+		{"timeouts.git", c.Timeouts.Git, &c.gitTimeout, DefaultGitTimeout},
+	} {
+		*t.dst = t.def
+		switch d, err := time.ParseDuration(t.value); {
+		case t.value == "":
+		case t.value == "off":
+			*t.dst = 0
+		case err != nil || d <= 0:
+			fail(t.field, "want a positive duration such as 10m, or off; got %q", t.value)
+		default:
+			*t.dst = d
+		}
+	}
+
+	// Cache: fragments are split out of the finished graph in memory, and an
+	// incremental run already reuses the previous database.
+	if c.CacheDir != "" {
+		if c.Memory.Stream {
+			fail("cache_dir", "not supported with memory.stream")
+		}
+		if c.Output.Incremental {
+			fail("cache_dir", "not supported with output.incremental")
+		}
+	}
+
+	// Thresholds
+	for _, th := range []struct {
+		name string
+		val  int
+	}{
+		{"complexity", c.Thresholds.Complexity},
+		{"function_lines", c.Thresholds.FunctionLines},
+		{"nesting_depth", c.Thresholds.NestingDepth},
+		{"hub_fan", c.Thresholds.HubFan},
+	} {
+		if th.val < 0 {
+			fail("thresholds."+th.name, "must not be negative, got %d", th.val)
+		}
+	}
+
+	// Output: the path is optional for library use with a custom Sink.
+	if c.Output.Path != "" {
+		if info, err := os.Stat(filepath.Dir(c.Output.Path)); err != nil || !info.IsDir() {
+			fail("output.path", "directory %s does not exist", filepath.Dir(c.Output.Path))
+		}
+	} else if c.Output.Incremental {
+		fail("output.path", "required for incremental updates")
+	}
+	if c.Output.ValidateReport != "" {
+		if info, err := os.Stat(filepath.Dir(c.Output.ValidateReport)); err != nil || !info.IsDir() {
+			fail("output.validate_report", "directory %s does not exist", filepath.Dir(c.Output.ValidateReport))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// PhaseEnabled reports whether an optional phase runs, per the phase
+// selection resolved by Validate.
+func (c *Config) PhaseEnabled(name string) bool {
+	return c.phases.Enabled(name)
+}
+
+// BuildPlatforms returns the build configurations to load, in order. Without
+// a platforms list this is the single host configuration.
+func (c *Config) BuildPlatforms() []Platform {
+	if len(c.platforms) == 0 {
+		return []Platform{{}}
+	}
+	return c.platforms
+}
+
+// WorkerCount returns the number of goroutines for the sharded phases.
+func (c *Config) WorkerCount() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return DefaultWorkers()
+}
+
+// ModuleSet returns the modules and file filter resolved by Validate.
+func (c *Config) ModuleSet() *ModuleSet {
+	return NewModuleSet(c.primary, c.extras, FileFilter{
+		SkipTests:     c.SkipTests == nil || *c.SkipTests,
+		SkipGenerated: c.SkipGenerated == nil || *c.SkipGenerated,
+		Include:       c.Include,
+		Exclude:       c.Exclude,
+	})
+}
+
+// MemoryLimit returns the runtime soft memory limit in bytes (math.MaxInt64
+// when disabled).
+func (c *Config) MemoryLimit() int64 {
+	return c.memoryLimit
+}
+
+// NewGraph returns the CPG the pipeline fills: in-memory by default, or
+// spilling to a staging database next to the output (or in the system temp
+// directory when there is no output path) when streaming. The
+// spill budget is an eighth of the memory limit, leaving the rest for
+// packages, SSA, and lookups.
+func (c *Config) NewGraph() (*CPG, error) {
+	if !c.Memory.Stream {
+		return NewCPG(), nil
+	}
+	dir := c.Memory.SpillDir
+	if dir == "" && c.Output.Path != "" {
+		dir = filepath.Dir(c.Output.Path)
+	}
+	return NewStreamingCPG(dir, c.memoryLimit/8)
+}
+
+// resolveModule builds a ModuleInfo for dir, reading the module path from
+// go.mod when modPath is empty. The prefix is name as given; callers derive
+// one for additional modules.
+func resolveModule(ctx context.Context, dir, modPath, name string) (ModuleInfo, error) {
+	if IsModuleSpec(dir) {
+		return resolveModuleVersion(ctx, dir, modPath, name)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ModuleInfo{}, fmt.Errorf("invalid dir %q: %w", dir, err)
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return ModuleInfo{}, fmt.Errorf("dir %s does not exist", abs)
+	}
+	if modPath == "" {
+		if modPath, err = ReadModulePath(abs); err != nil {
+			return ModuleInfo{}, err
+		}
+	}
+	return ModuleInfo{
+		Dir:     abs,
+		ModPath: modPath,
+		Prefix:  name,
+		Version: DetectVersion(abs),
+	}, nil
+}
+
+// resolveModuleVersion resolves a module@version spec (see
+// resolveModuleSpec). The module cache copy has no git history, so its
+// version is the one resolved rather than `git describe` output.
+func resolveModuleVersion(ctx context.Context, spec, modPath, name string) (ModuleInfo, error) {
+	dir, path, version, err := resolveModuleSpec(ctx, spec)
+	if err != nil {
+		return ModuleInfo{}, err
+	}
+	if modPath != "" && modPath != path {
+		return ModuleInfo{}, fmt.Errorf("%s: module path %s does not match %s", spec, modPath, path)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		return ModuleInfo{}, fmt.Errorf("%s has no go.mod and cannot join the workspace", spec)
+	}
+	return ModuleInfo{
+		Dir:     dir,
+		ModPath: path,
+		Prefix:  name,
+		Version: version,
+		Cached:  true,
+	}, nil
+}
+
+// ParseModuleSpecs parses the -modules flag into module declarations. Each
+// comma-separated entry is "dir", "dir:name", or the explicit
+// "dir:modpath:name", where dir may also be a module@version spec such as
+// "github.com/prometheus/alertmanager@v0.27.0" taken from the module cache.
+func ParseModuleSpecs(spec string) ([]ModuleConfig, error) {
+	var mods []ModuleConfig
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		switch len(parts) {
+		case 1:
+			mods = append(mods, ModuleConfig{Dir: parts[0]})
+		case 2:
+			mods = append(mods, ModuleConfig{Dir: parts[0], Name: parts[1]})
+		case 3:
+			mods = append(mods, ModuleConfig{Dir: parts[0], Path: parts[1], Name: parts[2]})
+		default:
+			return nil, fmt.Errorf("invalid -modules entry %q (want dir, dir:name, or dir:modpath:name)", entry)
+		}
+	}
+	return mods, nil
+}
+
+// validateGlob checks that every segment of a slash-separated glob is a valid
+// path.Match pattern ("**" is accepted as a whole segment).
+func validateGlob(pattern string) error {
+	if pattern == "" {
+		return errors.New("empty pattern")
+	}
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the slash-separated name matches pattern. Each
+// segment is matched with path.Match; a "**" segment matches zero or more
+// whole segments. A pattern without "/" also matches the base name, so
+// "*.pb.go" excludes generated files in every directory, and a pattern
+// matching one of name's directories matches name, so "web/ui" excludes
+// everything under web/ui.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	pat, segs := strings.Split(strings.TrimSuffix(pattern, "/"), "/"), strings.Split(name, "/")
+	for n := len(segs); n > 0; n-- {
+		if matchSegments(pat, segs[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
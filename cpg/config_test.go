@@ -0,0 +1,103 @@
+package cpg
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestLoadConfig checks that config files reject unknown keys in both
+// formats and that relative paths resolve against the file's directory.
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, tc := range []struct{ name, content, key string }{
+		{"typo.yaml", "primary: .\nworker: 4\n", "worker"},
+		{"nested.yaml", "output:\n  paht: cpg.db\n", "paht"},
+		{"typo.json", `{"primary": ".", "skip_test": true}`, "skip_test"},
+		{"nested.json", `{"memory": {"stream": true, "spill": "/tmp"}}`, "spill"},
+	} {
+		_, err := LoadConfig(write(tc.name, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.key) {
+			t.Errorf("%s: LoadConfig = %v, want an error naming %q", tc.name, err, tc.key)
+		}
+	}
+
+	cfg, err := LoadConfig(write("cpg.yaml", `
+primary: ../src/app
+modules:
+  - dir: lib
+  - dir: golang.org/x/mod@v0.20.0
+  - dir: /abs/other
+cache_dir: .cache
+memory:
+  spill_dir: spill
+output:
+  path: out/cpg.db
+  validate_report: report.json
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ field, got, want string }{
+		{"primary", cfg.Primary, filepath.Join(filepath.Dir(dir), "src", "app")},
+		{"modules[0].dir", cfg.Modules[0].Dir, filepath.Join(dir, "lib")},
+		{"modules[1].dir", cfg.Modules[1].Dir, "golang.org/x/mod@v0.20.0"},
+		{"modules[2].dir", cfg.Modules[2].Dir, "/abs/other"},
+		{"cache_dir", cfg.CacheDir, filepath.Join(dir, ".cache")},
+		{"memory.spill_dir", cfg.Memory.SpillDir, filepath.Join(dir, "spill")},
+		{"output.path", cfg.Output.Path, filepath.Join(dir, "out", "cpg.db")},
+		{"output.validate_report", cfg.Output.ValidateReport, filepath.Join(dir, "report.json")},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.field, tc.got, tc.want)
+		}
+	}
+
+	jsonCfg, err := LoadConfig(write("cpg.json", `{"primary": "app", "output": {"path": "cpg.db"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "app"); jsonCfg.Primary != want {
+		t.Errorf("json primary = %q, want %q", jsonCfg.Primary, want)
+	}
+}
+
+// TestValidateReportsAllErrors checks that Validate reports every invalid
+// field at once, each prefixed with its name.
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := &Config{
+		Primary:    filepath.Join(t.TempDir(), "missing"),
+		Modules:    []ModuleConfig{{}},
+		Include:    []string{"a/[b"},
+		SkipPhases: []string{"bogus"},
+		Profiles:   []string{"nope"},
+		Platforms:  []string{"linux"},
+		Workers:    -1,
+		Memory:     MemoryConfig{Limit: "lots"},
+		Timeouts:   TimeoutConfig{Git: "soon"},
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate succeeded")
+	}
+	var fields []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		field, _, _ := strings.Cut(line, ":")
+		fields = append(fields, field)
+	}
+	want := []string{"primary", "modules[0].dir", "include[0]", "phases", "profiles[0]", "platforms[0]", "workers", "memory.limit", "timeouts.git"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("Validate reported %q, want %q:\n%v", fields, want, err)
+	}
+}
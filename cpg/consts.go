@@ -0,0 +1,257 @@
+package cpg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// maxConstStringLen caps string constant values stored as properties.
+const maxConstStringLen = 200
+
+// setConstProps records a constant's value on a const declaration or on an
+// identifier or selector naming one: value as a Go literal, value_type (the
+// constant's type, "untyped int" for untyped ones), and value_text where
+// the type has a more readable form (time.Duration "5m0s", runes 'a').
+func setConstProps(props map[string]any, val constant.Value, typ types.Type) {
+	props["value"] = constLiteral(val)
+	props["value_type"] = typ.String()
+	if text := constText(val, typ); text != "" {
+		props["value_text"] = text
+	}
+}
+
+// constLiteral renders val as Go source would spell it. Floats use the
+// shortest float64 form when one exists; long strings are cut short.
+func constLiteral(val constant.Value) string {
+	switch val.Kind() {
+	case constant.String:
+		s := constant.StringVal(val)
+		if len(s) <= maxConstStringLen {
+			return strconv.Quote(s)
+		}
+		cut := maxConstStringLen
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		return strconv.Quote(s[:cut]) + "..."
+	case constant.Float:
+		if f, _ := constant.Float64Val(val); !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return val.String()
+	}
+	return val.ExactString()
+}
+
+// constText returns the typed rendering of val, or "" when the literal is
+// as readable.
+func constText(val constant.Value, typ types.Type) string {
+	if val.Kind() != constant.Int {
+		return ""
+	}
+	n, ok := constant.Int64Val(val)
+	if !ok {
+		return ""
+	}
+	if named, ok := types.Unalias(typ).(*types.Named); ok {
+		if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Duration" {
+			return time.Duration(n).String()
+		}
+	}
+	if b, ok := types.Unalias(typ).(*types.Basic); ok && (b.Kind() == types.UntypedRune || b.Kind() == types.Int32 && b.Name() == "rune") {
+		return strconv.QuoteRune(rune(n))
+	}
+	return ""
+}
+
+// usesIota reports whether any of exprs refers to the predeclared iota.
+func (v *astVisitor) usesIota(exprs []ast.Expr) bool {
+	iota := types.Universe.Lookup("iota")
+	found := false
+	for _, e := range exprs {
+		ast.Inspect(e, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && v.pkg.TypesInfo.Uses[id] == iota {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// enumMembers returns the constants of the defined type named, in value
+// order, when it is enum-like: at least two of them declared in its package.
+// Only exported ones count when the switch is in another package.
+func enumMembers(named *types.Named, from *types.Package) []*types.Const {
+	pkg := named.Obj().Pkg()
+	if pkg == nil {
+		return nil
+	}
+	var members []*types.Const
+	for _, name := range pkg.Scope().Names() {
+		c, ok := pkg.Scope().Lookup(name).(*types.Const)
+		if !ok || !types.Identical(c.Type(), named) || (pkg != from && !c.Exported()) {
+			continue
+		}
+		members = append(members, c)
+	}
+	if len(members) < 2 {
+		return nil
+	}
+	slices.SortStableFunc(members, func(a, b *types.Const) int {
+		switch a.Val().Kind() {
+		case constant.Int, constant.Float, constant.String:
+		default:
+			return 0 // bool and complex values are unordered
+		}
+		switch {
+		case constant.Compare(a.Val(), token.LSS, b.Val()):
+			return -1
+		case constant.Compare(b.Val(), token.LSS, a.Val()):
+			return 1
+		}
+		return 0
+	})
+	return members
+}
+
+// enumSwitchProps describes how an expression switch on an enum-typed tag
+// covers the enum: enum_type, enum_values (distinct member values),
+// enum_covered, enum_missing (one name per uncovered value), and
+// has_default. It returns nil for any other switch.
+func (v *astVisitor) enumSwitchProps(n *ast.SwitchStmt) map[string]any {
+	if n.Tag == nil {
+		return nil
+	}
+	tv, ok := v.pkg.TypesInfo.Types[n.Tag]
+	if !ok {
+		return nil
+	}
+	named, ok := types.Unalias(tv.Type).(*types.Named)
+	if !ok {
+		return nil
+	}
+	members := enumMembers(named, v.pkg.Types)
+	if members == nil {
+		return nil
+	}
+
+	covered := make(map[string]bool)
+	hasDefault := false
+	for _, stmt := range n.Body.List {
+		cc, ok := stmt.(*ast.CaseClause)
+		if !ok {
+			continue
+		}
+		if cc.List == nil {
+			hasDefault = true
+		}
+		for _, e := range cc.List {
+			if tv, ok := v.pkg.TypesInfo.Types[e]; ok && tv.Value != nil {
+				covered[tv.Value.ExactString()] = true
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	missing := []string{}
+	coveredValues := 0
+	for _, c := range members {
+		key := c.Val().ExactString()
+		if seen[key] {
+			continue // another name for the same value
+		}
+		seen[key] = true
+		if covered[key] {
+			coveredValues++
+		} else {
+			missing = append(missing, c.Name())
+		}
+	}
+	return map[string]any{
+		"enum_type":    named.String(),
+		"enum_values":  len(seen),
+		"enum_covered": coveredValues,
+		"enum_missing": missing,
+		"has_default":  hasDefault,
+	}
+}
+
+// createConstantViews builds constant_uses, v_enum_groups, and
+// v_enum_switches from the value properties the AST walk records.
+func createConstantViews(conn *sqlite.Conn) error {
+	ddl := `
+-- Every identifier or selector naming a constant, with its value and the
+-- declaration when it is in the analyzed code
+CREATE VIEW constant_uses AS
+  SELECT u.id AS use_id, u.name, u.file, u.line, u.col, u.package, u.parent_function,
+    json_extract(u.properties, '$.value') AS value,
+    json_extract(u.properties, '$.value_type') AS value_type,
+    json_extract(u.properties, '$.value_text') AS value_text,
+    r.target AS const_id
+  FROM nodes u
+  LEFT JOIN edges r ON r.source = u.id AND r.kind = 'ref'
+  WHERE u.kind IN ('identifier', 'selector')
+    AND json_extract(u.properties, '$.value') IS NOT NULL;
+
+-- Enum-like constant groups: defined types of the analyzed code with two or
+-- more constants
+CREATE VIEW v_enum_groups AS
+  SELECT t.id AS type_id, t.type_info AS type_name,
+    t.package, COUNT(*) AS member_count,
+    SUM(CASE WHEN json_extract(c.properties, '$.iota') IS NOT NULL THEN 1 ELSE 0 END) AS iota_members,
+    json_group_array(json_object('name', c.name, 'value', json_extract(c.properties, '$.value'), 'id', c.id)
+      ORDER BY c.file, c.line, c.col) AS members
+  FROM nodes t
+  JOIN nodes c ON c.kind = 'local' AND c.type_info = t.type_info
+    AND json_extract(c.properties, '$.decl') = 'const'
+  WHERE t.kind = 'type_decl'
+  GROUP BY t.id
+  HAVING COUNT(*) >= 2;
+
+-- Expression switches on an enum-typed tag and how much of the enum their
+-- cases cover
+CREATE VIEW v_enum_switches AS
+  SELECT s.id AS switch_id, s.file, s.line, s.package, s.parent_function,
+    json_extract(s.properties, '$.enum_type') AS enum_type,
+    (SELECT t.id FROM nodes t WHERE t.kind = 'type_decl' AND t.type_info = json_extract(s.properties, '$.enum_type')
+     ORDER BY t.id LIMIT 1) AS enum_type_id,
+    json_extract(s.properties, '$.enum_values') AS enum_values,
+    json_extract(s.properties, '$.enum_covered') AS enum_covered,
+    json_extract(s.properties, '$.enum_missing') AS enum_missing,
+    json_extract(s.properties, '$.has_default') AS has_default
+  FROM nodes s
+  WHERE s.kind = 'switch' AND json_extract(s.properties, '$.enum_type') IS NOT NULL;
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('view', 'constant_uses', 'Identifiers and selectors naming a constant (local or external), with value, value_type, value_text, and the declaration', 'SELECT file, line, name FROM constant_uses WHERE value_text = ''5m0s'''),
+('view', 'v_enum_groups', 'Defined types with two or more constants, with their members in declaration order; type_name is the import-path qualified name, as enum_type in v_enum_switches', 'SELECT type_name, member_count, members FROM v_enum_groups'),
+('view', 'v_enum_switches', 'Switches on an enum-typed tag: distinct enum values, how many the cases cover, uncovered member names, default clause; enum_type_id is the type_decl (type_id in v_enum_groups) when the type is in the analyzed code', 'SELECT * FROM v_enum_switches WHERE enum_covered < enum_values AND NOT has_default'),
+('node_property', 'value', 'Constant value as a Go literal, on const declarations and on identifiers/selectors naming a constant', '300000000000'),
+('node_property', 'value_type', 'Type of the constant value', 'time.Duration'),
+('node_property', 'value_text', 'Readable form of a typed constant value', '5m0s'),
+('node_property', 'iota', 'Value of iota in the const spec declaring the constant, when its expression uses iota', '2'),
+('node_property', 'enum_type', 'Enum type of a switch tag; also enum_values, enum_covered, enum_missing, has_default', 'example.com/x.Mode');
+
+INSERT INTO queries (name, description, sql) VALUES
+('constant_value_uses', 'Where a constant value is used, by literal or readable value',
+ 'SELECT file, line, name, value, value_text FROM constant_uses WHERE value = :value OR value_text = :value ORDER BY file, line'),
+('incomplete_enum_switches', 'Switches on an enum that leave values uncovered without a default',
+ 'SELECT file, line, enum_type, enum_missing FROM v_enum_switches WHERE enum_covered < enum_values AND NOT has_default ORDER BY file, line');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("constant views: %w", err)
+	}
+	return nil
+}
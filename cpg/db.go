@@ -1,8 +1,12 @@
-package main
+package cpg
 
 import (
+	"context"
 	"fmt"
+	"iter"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 
 	"zombiezen.com/go/sqlite"
@@ -11,34 +15,41 @@ import (
 
 const batchSize = 50000
 
-// WriteDB writes the CPG to a SQLite database file.
-func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []GitFileHistory, validate bool, prog *Progress) error {
+// DBOptions carries the run settings that shape the derived tables.
+type DBOptions struct {
+	Modules        *ModuleSet
+	GitHistory     []GitFileHistory
+	Profiles       []Profile
+	Thresholds     Thresholds
+	Phases         *PhaseSet    // nil runs every phase
+	Platforms      []Platform   // merged build configurations; empty for a host-only run
+	Validate       bool         // check the invariants in validate.go after writing
+	ValidateReport string       // file for the JSON validation report; implies Validate
+	Snapshot       SnapshotInfo // the tree the graph was generated from
+	Issues         []PhaseIssue // why enrichment phases ran with incomplete input
+	SchemaRoots    []string     // full names of the serialized_schema root types; empty picks tagged *Config types
+}
+
+// WriteDB writes the CPG to a SQLite database file. Once ctx is done the
+// running statement is interrupted and the partial database is removed.
+func WriteDB(ctx context.Context, path string, cpg *CPG, escapeResults []EscapeResult, opts DBOptions, prog *Progress) (err error) {
 	prog.Log("Writing SQLite to %s ...", path)
 
-	_ = os.Remove(path) // ignore if doesn't exist
+	removeDB(path) // ignore if doesn't exist
 
-	conn, err := sqlite.OpenConn(path, sqlite.OpenCreate, sqlite.OpenReadWrite, sqlite.OpenWAL)
+	conn, err := openDB(path)
 	if err != nil {
-		return fmt.Errorf("open sqlite: %w", err)
-	}
-	defer func() { _ = conn.Close() }()
-
-	// Performance pragmas
-	if err := sqlitex.ExecuteTransient(conn, "PRAGMA synchronous = NORMAL", nil); err != nil {
-		return err
-	}
-	if err := sqlitex.ExecuteTransient(conn, "PRAGMA temp_store = MEMORY", nil); err != nil {
-		return err
-	}
-	if err := sqlitex.ExecuteTransient(conn, "PRAGMA mmap_size = 268435456", nil); err != nil {
-		return err
-	}
-	if err := sqlitex.ExecuteTransient(conn, "PRAGMA cache_size = -64000", nil); err != nil {
-		return err
-	}
-	if err := sqlitex.ExecuteTransient(conn, "PRAGMA journal_mode = WAL", nil); err != nil {
 		return err
 	}
+	conn.SetInterrupt(ctx.Done())
+	defer func() {
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			removeDB(path)
+			prog.Log("Interrupted; removed %s", path)
+			err = ctx.Err()
+		}
+	}()
 
 	// Create tables without indexes (deferred creation for speed)
 	if err := createTables(conn); err != nil {
@@ -51,15 +62,15 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 		return fmt.Errorf("begin tx: %w", err)
 	}
 
-	if err := insertNodes(conn, cpg.Nodes, prog); err != nil {
+	if err := insertNodes(conn, cpg.SortedNodes(), prog); err != nil {
 		endFn(&err)
 		return err
 	}
-	if err := insertEdges(conn, cpg.Edges, prog); err != nil {
+	if err := insertEdges(conn, cpg.SortedEdges(), prog); err != nil {
 		endFn(&err)
 		return err
 	}
-	if err := insertSources(conn, cpg.Sources, prog); err != nil {
+	if err := insertSources(conn, cpg.AllSources(), prog); err != nil {
 		endFn(&err)
 		return err
 	}
@@ -67,12 +78,70 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 		endFn(&err)
 		return err
 	}
+	if err := insertFileHashes(conn, opts.Modules, cpg.FileHashes); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertEscapeAnnotations(conn, escapeResults); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertModules(conn, opts.Modules.Dirs()); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertBaseSnapshot(conn, opts.Snapshot); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err = cpg.Err(); err != nil {
+		endFn(&err)
+		return err
+	}
 
 	endFn(&err)
 	if err != nil {
 		return fmt.Errorf("commit: %w", err)
 	}
 
+	return buildDerived(ctx, conn, path, opts, false, prog)
+}
+
+// openDB opens (or creates) the SQLite file at path with the bulk-load pragmas
+// used by both full and incremental writes.
+func openDB(path string) (*sqlite.Conn, error) {
+	conn, err := sqlite.OpenConn(path, sqlite.OpenCreate, sqlite.OpenReadWrite, sqlite.OpenWAL)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	// Performance pragmas
+	for _, pragma := range []string{
+		"PRAGMA synchronous = NORMAL",
+		"PRAGMA temp_store = MEMORY",
+		"PRAGMA mmap_size = 268435456",
+		"PRAGMA cache_size = -64000",
+		"PRAGMA journal_mode = WAL",
+	} {
+		if err := sqlitex.ExecuteTransient(conn, pragma, nil); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// buildDerived computes every table, view, and heuristic edge that is derived
+// from the base tables (nodes, edges, sources, metrics, file_hashes,
+// escape_annotations). It runs after a full write and again after an
+// incremental update has spliced new package data into the base tables.
+// In the incremental case UpdateDB has kept the heuristic DFG and EOG edges
+// of unaffected packages, sources_fts, and orphan_edges, so only call sites
+// of the packages in temp.stale_pkgs get new edges (see staleCallSites).
+// The caller interrupts the connection once ctx is done.
+func buildDerived(ctx context.Context, conn *sqlite.Conn, path string, opts DBOptions, incremental bool, prog *Progress) error {
+	issues := slices.Clone(opts.Issues)
+
 	// Create flow semantics table for stdlib data-flow modeling
 	prog.Log("Building flow semantics model...")
 	if err := createFlowSemantics(conn); err != nil {
@@ -95,7 +164,8 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 		 WHERE site_e.kind = 'call_site'
 		   AND callee.id LIKE 'ext::%'
 		   AND (fs.flow_from = 'arg:*'
-		        OR fs.flow_from = 'arg:' || json_extract(arg_e.properties, '$.index'))`,
+		        OR fs.flow_from = 'arg:' || json_extract(arg_e.properties, '$.index'))`+
+			staleCallSites("site_e.source", incremental),
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error { return nil },
 		}); err != nil {
@@ -117,7 +187,8 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 		 JOIN edges dst_arg ON dst_arg.source = site_e.source AND dst_arg.kind = 'argument'
 		   AND fs.flow_to = 'arg:' || json_extract(dst_arg.properties, '$.index')
 		 WHERE site_e.kind = 'call_site'
-		   AND callee.id LIKE 'ext::%'`,
+		   AND callee.id LIKE 'ext::%'`+
+			staleCallSites("site_e.source", incremental),
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error { return nil },
 		}); err != nil {
@@ -137,7 +208,8 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 		   AND NOT EXISTS (
 		     SELECT 1 FROM flow_semantics fs
 		     WHERE callee.package = fs.package AND callee.name = fs.func_name
-		   )`,
+		   )`+
+			staleCallSites("site_e.source", incremental),
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error { return nil },
 		}); err != nil {
@@ -151,17 +223,34 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 			totalDFG, preciseDFG, sideEffectDFG, fallbackDFG)
 	}
 
-	// Clean up orphan edges before indexing
+	// Move orphan edges out of edges before indexing. They are kept in
+	// orphan_edges, where the edge_endpoints invariant reports them; an
+	// incremental update adds to the ones its previous runs moved.
+	if err := sqlitex.ExecuteScript(conn, `
+CREATE TABLE IF NOT EXISTS orphan_edges (kind TEXT, source TEXT, target TEXT, properties TEXT, missing TEXT);
+INSERT INTO orphan_edges (kind, source, target, properties, missing)
+  SELECT e.kind, e.source, e.target, e.properties,
+    CASE WHEN s.id IS NULL AND t.id IS NULL THEN 'both' WHEN s.id IS NULL THEN 'source' ELSE 'target' END AS missing
+  FROM edges e
+  LEFT JOIN nodes s ON s.id = e.source
+  LEFT JOIN nodes t ON t.id = e.target
+  WHERE s.id IS NULL OR t.id IS NULL;
+DELETE FROM edges WHERE source NOT IN (SELECT id FROM nodes) OR target NOT IN (SELECT id FROM nodes);`, nil); err != nil {
+		return fmt.Errorf("orphan cleanup: %w", err)
+	}
+	var orphans []string
 	if err := sqlitex.ExecuteTransient(conn,
-		`DELETE FROM edges WHERE source NOT IN (SELECT id FROM nodes) OR target NOT IN (SELECT id FROM nodes)`,
+		`SELECT kind, COUNT(*) FROM orphan_edges GROUP BY kind ORDER BY COUNT(*) DESC, kind`,
 		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error { return nil },
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				orphans = append(orphans, fmt.Sprintf("%d %s", stmt.ColumnInt(1), stmt.ColumnText(0)))
+				return nil
+			},
 		}); err != nil {
-		return fmt.Errorf("orphan cleanup: %w", err)
+		return fmt.Errorf("count orphan edges: %w", err)
 	}
-	changes := conn.Changes()
-	if changes > 0 {
-		prog.Log("Removed %d orphan edges", changes)
+	if len(orphans) > 0 {
+		prog.Log("  warning: removed orphan edges (%s); see orphan_edges", strings.Join(orphans, ", "))
 	}
 
 	// Create indexes after all inserts
@@ -171,15 +260,19 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 	}
 
 	// EOG: expression evaluation order for call arguments
-	prog.Log("Computing evaluation order edges...")
-	if err := computeEOG(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("eog") {
+		prog.Log("Computing evaluation order edges...")
+		if err := computeEOG(conn, incremental, prog); err != nil {
+			return err
+		}
 	}
 
-	// FTS5 full-text search on source code
-	prog.Log("Building FTS5 index...")
-	if err := createFTS(conn); err != nil {
-		return err
+	// FTS5 full-text search on source code; UpdateDB reindexes stale files
+	if opts.Phases.Enabled("fts") && !incremental {
+		prog.Log("Building FTS5 index...")
+		if err := createFTS(conn); err != nil {
+			return err
+		}
 	}
 
 	// Pre-computed summary statistics for viewer dashboards
@@ -189,41 +282,76 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 	}
 
 	// Pre-built analysis views and example queries
+	if err := createThresholds(conn, opts.Thresholds); err != nil {
+		return err
+	}
+
 	prog.Log("Creating analysis views...")
 	if err := createAnalysisViews(conn); err != nil {
 		return err
 	}
 
-	// Security taint model: classify known sources/sinks/barriers
-	prog.Log("Building taint model...")
-	if err := createTaintModel(conn); err != nil {
+	// Schema documentation: self-describing DB for interview candidates.
+	// Built early so the builders below can document their tables.
+	prog.Log("Building schema documentation...")
+	if err := createSchemaDocs(conn); err != nil {
 		return err
 	}
 
-	// Additional analysis: API surface, method sets, risk scores, etc.
-	prog.Log("Computing additional analysis...")
-	if err := createAdditionalAnalysis(conn, prog); err != nil {
+	// Deprecated APIs and the calls still using them, and package-level
+	// variables with their readers and writers. Their findings must be in
+	// before the dashboards and hotspots read findings.
+	if err := createDeprecationViews(conn); err != nil {
 		return err
 	}
+	if opts.Phases.Enabled("globals") {
+		if err := createGlobals(conn, prog); err != nil {
+			return err
+		}
+	}
+
+	// Security taint model: classify known sources/sinks/barriers
+	if opts.Phases.Enabled("taint_model") {
+		prog.Log("Building taint model...")
+		if err := createTaintModel(conn); err != nil {
+			return err
+		}
+	}
+
+	// Additional analysis: API surface, method sets, risk scores, etc.
+	if opts.Phases.Enabled("additional_analysis") {
+		prog.Log("Computing additional analysis...")
+		if err := createAdditionalAnalysis(conn, prog); err != nil {
+			return err
+		}
+	}
 
 	// Apply escape analysis annotations from the Go compiler
-	if len(escapeResults) > 0 {
+	if opts.Phases.Enabled("escape") {
 		prog.Log("Applying escape analysis annotations...")
-		if err := applyEscapeAnalysis(conn, escapeResults, prog); err != nil {
+		if err := applyEscapeAnalysis(conn, prog); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			prog.Log("Warning: escape analysis failed: %v", err)
+			issues = append(issues, PhaseIssue{Phase: "escape", Reason: "apply annotations: " + err.Error()})
 		}
 	}
 
 	// Advanced analysis: stability metrics, risk scores, dead code, etc.
-	prog.Log("Computing advanced analysis...")
-	if err := createAdvancedAnalysis(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("advanced_analysis") {
+		prog.Log("Computing advanced analysis...")
+		if err := createAdvancedAnalysis(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// Cohesion, concurrency, and pattern analysis
-	prog.Log("Computing cohesion and patterns...")
-	if err := createCohesionAndPatterns(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("cohesion_patterns") {
+		prog.Log("Computing cohesion and patterns...")
+		if err := createCohesionAndPatterns(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// Run ANALYZE before dashboard queries — without statistics, the query planner
@@ -234,85 +362,146 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 	}
 
 	// Pre-computed dashboard data for easy chart rendering
-	prog.Log("Building dashboard data...")
-	if err := createDashboardData(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("dashboard") {
+		prog.Log("Building dashboard data...")
+		if err := createDashboardData(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// Graph intelligence: top-N tables, cross-package coupling, error chains
-	prog.Log("Building graph intelligence...")
-	if err := createGraphIntelligence(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("graph_intelligence") {
+		prog.Log("Building graph intelligence...")
+		if err := createGraphIntelligence(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// File-level analysis and dependency graph data for visualization
-	prog.Log("Building file and dependency analysis...")
-	if err := createFileAndDepAnalysis(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("file_deps") {
+		prog.Log("Building file and dependency analysis...")
+		if err := createFileAndDepAnalysis(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// Type system analysis: hierarchy, implementation map, method resolution
-	prog.Log("Building type system analysis...")
-	if err := createTypeSystemAnalysis(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("type_system") {
+		prog.Log("Building type system analysis...")
+		if err := createTypeSystemAnalysis(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// Code navigation aids and pattern summaries
-	prog.Log("Building navigation and patterns...")
-	if err := createNavigationAndPatterns(conn, prog); err != nil {
+	if opts.Phases.Enabled("navigation") {
+		prog.Log("Building navigation and patterns...")
+		if err := createNavigationAndPatterns(conn, prog); err != nil {
+			return err
+		}
+	}
+
+	// Constant uses, enum groups, and enum switch coverage
+	if err := createConstantViews(conn); err != nil {
 		return err
 	}
 
-	// Schema documentation: self-describing DB for interview candidates
-	prog.Log("Building schema documentation...")
-	if err := createSchemaDocs(conn); err != nil {
+	// Directives: go:generate, go:embed, go:linkname, nolint, ...
+	if err := createDirectiveViews(conn); err != nil {
+		return err
+	}
+
+	// Which functions read and write which struct fields
+	if opts.Phases.Enabled("field_access") {
+		if err := createFieldAccessViews(conn); err != nil {
+			return err
+		}
+	}
+
+	// Build configurations the graph was merged from
+	if err := createPlatformTables(conn, opts.Platforms); err != nil {
+		return err
+	}
+
+	// Snapshots of other revisions recorded next to this graph
+	if err := createSnapshotViews(conn); err != nil {
 		return err
 	}
 
+	// Test reachability: which tests cover each function
+	if opts.Phases.Enabled("tests") {
+		if err := createTestCoverage(conn, prog); err != nil {
+			return err
+		}
+	}
+
+	// Config key paths from struct tags
+	if opts.Phases.Enabled("serialized_schema") {
+		prog.Log("Building serialized schema...")
+		if err := createSerializedSchema(conn, opts.SchemaRoots, prog); err != nil {
+			return err
+		}
+	}
+
 	// Git history for diff-aware analysis
-	if len(gitHistory) > 0 {
+	if opts.Phases.Enabled("git_history") && len(opts.GitHistory) > 0 {
 		prog.Log("Running git history analysis...")
-		if err := applyGitHistory(conn, gitHistory, prog); err != nil {
+		if err := applyGitHistory(conn, opts.GitHistory, prog); err != nil {
 			return err
 		}
 	}
 
 	// Taint flow state materialization for precise taint analysis
-	prog.Log("Computing taint flow states...")
-	if err := createTaintFlowStates(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("taint_flow_states") {
+		prog.Log("Computing taint flow states...")
+		if err := createTaintFlowStates(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// Index sensitivity for map/array taint tracking
-	prog.Log("Computing index sensitivity...")
-	if err := createIndexSensitivity(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("index_sensitivity") {
+		prog.Log("Computing index sensitivity...")
+		if err := createIndexSensitivity(conn, prog); err != nil {
+			return err
+		}
 	}
 
 	// SCIP-style cross-repository symbol identifiers
-	prog.Log("Building SCIP symbol index...")
-	if err := createSCIPSymbols(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("scip") {
+		prog.Log("Building SCIP symbol index...")
+		if err := createSCIPSymbols(conn, opts.Modules, prog); err != nil {
+			return err
+		}
 	}
 
 	// Communication patterns: Honda session types, protocol detection, duality
-	prog.Log("Building communication patterns...")
-	if err := createCommunicationPatterns(conn, prog); err != nil {
-		return err
+	if opts.Phases.Enabled("comm_patterns") {
+		prog.Log("Building communication patterns...")
+		if err := createCommunicationPatterns(conn, opts.Profiles, prog); err != nil {
+			return err
+		}
 	}
 
 	// Honda 2008 corrections: subtyping, acyclic deps, association relation
-	prog.Log("Applying Honda 2008 corrections (Scalas & Yoshida 2019, Yoshida & Hou 2024)...")
-	if err := createSessionTypeCorrections(conn, prog); err != nil {
-		return err
-	}
-
-	if validate {
-		if err := runValidation(conn, prog); err != nil {
+	if opts.Phases.Enabled("session_corrections") {
+		prog.Log("Applying Honda 2008 corrections (Scalas & Yoshida 2019, Yoshida & Hou 2024)...")
+		if err := createSessionTypeCorrections(conn, prog); err != nil {
 			return err
 		}
 	}
 
+	// Drop documentation rows for tables and views of skipped phases
+	if err := sqlitex.ExecuteTransient(conn,
+		`DELETE FROM schema_docs WHERE category IN ('table', 'view')
+		   AND name NOT IN (SELECT name FROM sqlite_master)`, nil); err != nil {
+		return fmt.Errorf("prune schema docs: %w", err)
+	}
+
+	if err := createPhaseTable(conn, opts.Phases, issues); err != nil {
+		return err
+	}
+
 	// Report file size
 	info, _ := os.Stat(path)
 	if info != nil {
@@ -320,6 +509,60 @@ func WriteDB(path string, cpg *CPG, escapeResults []EscapeResult, gitHistory []G
 		prog.Log("Wrote %s (%d MB)", path, mb)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if opts.Validate || opts.ValidateReport != "" {
+		return runValidation(conn, path, opts.Phases, opts.ValidateReport, prog)
+	}
+	return nil
+}
+
+// createPhaseTable records which optional phases ran, so consumers can tell
+// an empty table from a skipped phase, and which of them ran degraded
+// because an external tool failed or timed out.
+func createPhaseTable(conn *sqlite.Conn, phases *PhaseSet, issues []PhaseIssue) error {
+	if err := sqlitex.ExecuteScript(conn, `
+CREATE TABLE phases (
+    name TEXT PRIMARY KEY,
+    status TEXT NOT NULL CHECK (status IN ('ran', 'degraded', 'skipped')),
+    requires TEXT,
+    description TEXT,
+    reason TEXT
+);
+CREATE TABLE phase_issues (
+    phase TEXT NOT NULL,
+    module TEXT,
+    reason TEXT NOT NULL
+);
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('table', 'phases', 'Optional generation phases and whether they ran (see -phases / -skip-phases); a degraded phase ran with incomplete input, and reason says why', 'SELECT name, status, reason FROM phases WHERE status != ''ran'''),
+('table', 'phase_issues', 'One row per external tool failure behind a degraded phase: go build for escape, git for git_history, per module path (NULL: the whole phase)', 'SELECT * FROM phase_issues WHERE phase = ''escape''');`, nil); err != nil {
+		return fmt.Errorf("phases: %w", err)
+	}
+	byPhase := make(map[string][]PhaseIssue)
+	for _, is := range issues {
+		byPhase[is.Phase] = append(byPhase[is.Phase], is)
+		if err := sqlitex.Execute(conn,
+			`INSERT INTO phase_issues (phase, module, reason) VALUES (?, ?, ?)`,
+			&sqlitex.ExecOptions{Args: []any{is.Phase, nullIfEmpty(is.Module), is.Reason}}); err != nil {
+			return fmt.Errorf("insert phase issue: %w", err)
+		}
+	}
+	for _, p := range phaseRegistry {
+		status, reason := "ran", ""
+		switch {
+		case !phases.Enabled(p.Name):
+			status = "skipped"
+		case len(byPhase[p.Name]) > 0:
+			status, reason = "degraded", summarizeIssues(byPhase[p.Name])
+		}
+		if err := sqlitex.Execute(conn,
+			`INSERT INTO phases (name, status, requires, description, reason) VALUES (?, ?, ?, ?, ?)`,
+			&sqlitex.ExecOptions{Args: []any{p.Name, status, strings.Join(p.Requires, ","), p.Description, nullIfEmpty(reason)}}); err != nil {
+			return fmt.Errorf("insert phase %s: %w", p.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -333,6 +576,9 @@ CREATE TABLE nodes (
     line INTEGER,
     col INTEGER,
     end_line INTEGER,
+    end_col INTEGER,
+    start_offset INTEGER,
+    end_offset INTEGER,
     package TEXT,
     parent_function TEXT,
     type_info TEXT,
@@ -360,31 +606,61 @@ CREATE TABLE metrics (
     loc INTEGER,
     num_params INTEGER
 );
+
+CREATE TABLE modules (
+    prefix TEXT PRIMARY KEY,
+    mod_path TEXT NOT NULL,
+    dir TEXT NOT NULL,
+    version TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT 'dir'  -- 'dir' or 'modcache' (module@version spec)
+);
+
+CREATE TABLE file_hashes (
+    file TEXT PRIMARY KEY,
+    package TEXT NOT NULL,
+    pkg_path TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+
+CREATE TABLE escape_annotations (
+    module TEXT NOT NULL,
+    file TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    col INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    detail TEXT
+);
 `
-	return sqlitex.ExecuteScript(conn, ddl, nil)
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return err
+	}
+	return createSnapshotTables(conn)
 }
 
 func createIndexes(conn *sqlite.Conn) error {
 	indexes := `
-CREATE INDEX idx_nodes_kind ON nodes(kind);
-CREATE INDEX idx_nodes_package ON nodes(package);
-CREATE INDEX idx_nodes_file ON nodes(file);
-CREATE INDEX idx_nodes_parent ON nodes(parent_function);
-CREATE INDEX idx_edges_source ON edges(source, kind);
-CREATE INDEX idx_edges_target ON edges(target, kind);
-CREATE INDEX idx_edges_kind ON edges(kind);
+CREATE INDEX IF NOT EXISTS idx_nodes_kind ON nodes(kind);
+CREATE INDEX IF NOT EXISTS idx_nodes_package ON nodes(package);
+CREATE INDEX IF NOT EXISTS idx_nodes_file ON nodes(file);
+CREATE INDEX IF NOT EXISTS idx_nodes_parent ON nodes(parent_function);
+CREATE INDEX IF NOT EXISTS idx_nodes_span ON nodes(file, start_offset, end_offset);
+CREATE INDEX IF NOT EXISTS idx_edges_source ON edges(source, kind);
+CREATE INDEX IF NOT EXISTS idx_edges_target ON edges(target, kind);
+CREATE INDEX IF NOT EXISTS idx_edges_kind ON edges(kind);
+CREATE INDEX IF NOT EXISTS idx_escape_pos ON escape_annotations(file, line);
 `
 	return sqlitex.ExecuteScript(conn, indexes, nil)
 }
 
-func insertNodes(conn *sqlite.Conn, nodes []Node, prog *Progress) error {
-	stmt, err := conn.Prepare(`INSERT OR IGNORE INTO nodes (id, kind, name, file, line, col, end_line, package, parent_function, type_info, properties) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+func insertNodes(conn *sqlite.Conn, nodes iter.Seq[Node], prog *Progress) error {
+	stmt, err := conn.Prepare(`INSERT OR IGNORE INTO nodes (id, kind, name, file, line, col, end_line, end_col, start_offset, end_offset, package, parent_function, type_info, properties) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("prepare node insert: %w", err)
 	}
 	defer func() { _ = stmt.Finalize() }()
 
-	for i, n := range nodes {
+	var count int
+	for n := range nodes {
 		stmt.BindText(1, n.ID)
 		stmt.BindText(2, n.Kind)
 		stmt.BindText(3, n.Name)
@@ -392,33 +668,36 @@ func insertNodes(conn *sqlite.Conn, nodes []Node, prog *Progress) error {
 		bindIntOrNull(stmt, 5, n.Line)
 		bindIntOrNull(stmt, 6, n.Col)
 		bindIntOrNull(stmt, 7, n.EndLine)
-		bindTextOrNull(stmt, 8, n.Package)
-		bindTextOrNull(stmt, 9, n.ParentFunction)
-		bindTextOrNull(stmt, 10, n.TypeInfo)
-		bindTextOrNull(stmt, 11, PropsJSON(n.Properties))
+		bindIntOrNull(stmt, 8, n.EndCol)
+		bindSpan(stmt, 9, n)
+		bindTextOrNull(stmt, 11, n.Package)
+		bindTextOrNull(stmt, 12, n.ParentFunction)
+		bindTextOrNull(stmt, 13, n.TypeInfo)
+		bindTextOrNull(stmt, 14, PropsJSON(n.Properties))
 
 		if _, err := stmt.Step(); err != nil {
 			return fmt.Errorf("insert node %s: %w", n.ID, err)
 		}
 		_ = stmt.Reset()
 
-		if (i+1)%batchSize == 0 {
-			prog.Verbose("  inserted %d/%d nodes", i+1, len(nodes))
+		if count++; count%batchSize == 0 {
+			prog.Verbose("  inserted %d nodes", count)
 		}
 	}
 
-	prog.Log("Inserted %d nodes", len(nodes))
+	prog.Log("Inserted %d nodes", count)
 	return nil
 }
 
-func insertEdges(conn *sqlite.Conn, edges []Edge, prog *Progress) error {
+func insertEdges(conn *sqlite.Conn, edges iter.Seq[Edge], prog *Progress) error {
 	stmt, err := conn.Prepare(`INSERT INTO edges (source, target, kind, properties) VALUES (?, ?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("prepare edge insert: %w", err)
 	}
 	defer func() { _ = stmt.Finalize() }()
 
-	for i, e := range edges {
+	var count int
+	for e := range edges {
 		stmt.BindText(1, e.Source)
 		stmt.BindText(2, e.Target)
 		stmt.BindText(3, e.Kind)
@@ -429,22 +708,23 @@ func insertEdges(conn *sqlite.Conn, edges []Edge, prog *Progress) error {
 		}
 		_ = stmt.Reset()
 
-		if (i+1)%batchSize == 0 {
-			prog.Verbose("  inserted %d/%d edges", i+1, len(edges))
+		if count++; count%batchSize == 0 {
+			prog.Verbose("  inserted %d edges", count)
 		}
 	}
 
-	prog.Log("Inserted %d edges", len(edges))
+	prog.Log("Inserted %d edges", count)
 	return nil
 }
 
-func insertSources(conn *sqlite.Conn, sources map[string]string, prog *Progress) error {
+func insertSources(conn *sqlite.Conn, sources iter.Seq2[string, string], prog *Progress) error {
 	stmt, err := conn.Prepare(`INSERT OR IGNORE INTO sources (file, content, package) VALUES (?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("prepare source insert: %w", err)
 	}
 	defer func() { _ = stmt.Finalize() }()
 
+	var count int
 	for file, content := range sources {
 		stmt.BindText(1, file)
 		stmt.BindText(2, content)
@@ -456,9 +736,10 @@ func insertSources(conn *sqlite.Conn, sources map[string]string, prog *Progress)
 			return fmt.Errorf("insert source %s: %w", file, err)
 		}
 		_ = stmt.Reset()
+		count++
 	}
 
-	prog.Log("Inserted %d source files", len(sources))
+	prog.Log("Inserted %d source files", count)
 	return nil
 }
 
@@ -469,7 +750,8 @@ func insertMetrics(conn *sqlite.Conn, metrics map[string]*Metrics, prog *Progres
 	}
 	defer func() { _ = stmt.Finalize() }()
 
-	for _, m := range metrics {
+	for _, id := range slices.Sorted(maps.Keys(metrics)) {
+		m := metrics[id]
 		stmt.BindText(1, m.FunctionID)
 		stmt.BindInt64(2, int64(m.CyclomaticComplexity))
 		stmt.BindInt64(3, int64(m.FanIn))
@@ -487,51 +769,65 @@ func insertMetrics(conn *sqlite.Conn, metrics map[string]*Metrics, prog *Progres
 	return nil
 }
 
-func runValidation(conn *sqlite.Conn, prog *Progress) error {
-	prog.Log("Running validation queries...")
-
-	// Check for orphan edges (edges referencing non-existent nodes)
-	var orphanCount int64
-	if err := sqlitex.ExecuteTransient(conn,
-		`SELECT COUNT(*) FROM edges WHERE source NOT IN (SELECT id FROM nodes) OR target NOT IN (SELECT id FROM nodes)`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				orphanCount = stmt.ColumnInt64(0)
-				return nil
-			},
-		}); err != nil {
-		return err
+func insertFileHashes(conn *sqlite.Conn, ms *ModuleSet, hashes map[string]FileHash) error {
+	stmt, err := conn.Prepare(`INSERT OR REPLACE INTO file_hashes (file, package, pkg_path, hash) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare file hash insert: %w", err)
 	}
-	if orphanCount > 0 {
-		prog.Log("  WARNING: %d orphan edges (referencing non-existent nodes)", orphanCount)
-	} else {
-		prog.Log("  OK: zero orphan edges")
+	defer func() { _ = stmt.Finalize() }()
+
+	for _, file := range slices.Sorted(maps.Keys(hashes)) {
+		h := hashes[file]
+		stmt.BindText(1, file)
+		stmt.BindText(2, ms.RelPkg(h.PkgPath))
+		stmt.BindText(3, h.PkgPath)
+		stmt.BindText(4, h.Hash)
+		if _, err := stmt.Step(); err != nil {
+			return fmt.Errorf("insert file hash %s: %w", file, err)
+		}
+		_ = stmt.Reset()
 	}
+	return nil
+}
 
-	// Node count per kind
-	if err := sqlitex.ExecuteTransient(conn,
-		`SELECT kind, COUNT(*) FROM nodes GROUP BY kind ORDER BY COUNT(*) DESC`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				prog.Log("  nodes: %s = %d", stmt.ColumnText(0), stmt.ColumnInt64(1))
-				return nil
-			},
-		}); err != nil {
-		return err
+// insertModules replaces the modules table with the analyzed module set.
+func insertModules(conn *sqlite.Conn, mods []ModuleInfo) error {
+	if err := sqlitex.ExecuteTransient(conn, `DELETE FROM modules`, nil); err != nil {
+		return fmt.Errorf("clear modules: %w", err)
+	}
+	for _, m := range mods {
+		source := "dir"
+		if m.Cached {
+			source = "modcache"
+		}
+		if err := sqlitex.Execute(conn,
+			`INSERT INTO modules (prefix, mod_path, dir, version, source) VALUES (?, ?, ?, ?, ?)`,
+			&sqlitex.ExecOptions{Args: []any{m.Prefix, m.ModPath, m.Dir, m.Version, source}}); err != nil {
+			return fmt.Errorf("insert module %s: %w", m.ModPath, err)
+		}
 	}
+	return nil
+}
 
-	// Edge count per kind
-	if err := sqlitex.ExecuteTransient(conn,
-		`SELECT kind, COUNT(*) FROM edges GROUP BY kind ORDER BY COUNT(*) DESC`,
-		&sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				prog.Log("  edges: %s = %d", stmt.ColumnText(0), stmt.ColumnInt64(1))
-				return nil
-			},
-		}); err != nil {
-		return err
+func insertEscapeAnnotations(conn *sqlite.Conn, results []EscapeResult) error {
+	stmt, err := conn.Prepare(`INSERT INTO escape_annotations (module, file, line, col, kind, detail) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare escape insert: %w", err)
 	}
+	defer func() { _ = stmt.Finalize() }()
 
+	for _, r := range results {
+		stmt.BindText(1, r.Module)
+		stmt.BindText(2, r.RelFile)
+		stmt.BindInt64(3, int64(r.Line))
+		stmt.BindInt64(4, int64(r.Col))
+		stmt.BindText(5, r.Kind)
+		bindTextOrNull(stmt, 6, r.Detail)
+		if _, err := stmt.Step(); err != nil {
+			return fmt.Errorf("insert escape annotation %s:%d: %w", r.RelFile, r.Line, err)
+		}
+		_ = stmt.Reset()
+	}
 	return nil
 }
 
@@ -553,6 +849,18 @@ func bindIntOrNull(stmt *sqlite.Stmt, param, val int) {
 	}
 }
 
+// bindSpan binds n's start and end byte offsets to param and param+1, or
+// NULLs when n has no span. A span may start at offset 0.
+func bindSpan(stmt *sqlite.Stmt, param int, n Node) {
+	if n.EndOffset == 0 {
+		stmt.BindNull(param)
+		stmt.BindNull(param + 1)
+		return
+	}
+	stmt.BindInt64(param, int64(n.StartOffset))
+	stmt.BindInt64(param+1, int64(n.EndOffset))
+}
+
 // createFTS builds an FTS5 virtual table for full-text search on source code.
 func createFTS(conn *sqlite.Conn) error {
 	fts := `
@@ -622,6 +930,35 @@ CREATE INDEX idx_edge_props_key_value ON edge_properties(key, value);
 	return sqlitex.ExecuteScript(conn, ddl, nil)
 }
 
+// createThresholds records the finding thresholds used for this database;
+// the threshold-based findings in createAnalysisViews read them from here.
+func createThresholds(conn *sqlite.Conn, th Thresholds) error {
+	if err := sqlitex.ExecuteScript(conn, `
+CREATE TABLE thresholds (
+    name TEXT PRIMARY KEY,
+    value INTEGER NOT NULL,
+    description TEXT
+);`, nil); err != nil {
+		return fmt.Errorf("thresholds: %w", err)
+	}
+	for _, t := range []struct {
+		name  string
+		value int
+		desc  string
+	}{
+		{"complexity", th.Complexity, "complexity finding: cyclomatic complexity at or above"},
+		{"function_lines", th.FunctionLines, "size finding: function LOC at or above"},
+		{"nesting_depth", th.NestingDepth, "nesting finding: control-structure depth at or above"},
+		{"hub_fan", th.HubFan, "hub finding: fan-in and fan-out both at or above"},
+	} {
+		if err := sqlitex.Execute(conn, `INSERT INTO thresholds (name, value, description) VALUES (?, ?, ?)`,
+			&sqlitex.ExecOptions{Args: []any{t.name, t.value, t.desc}}); err != nil {
+			return fmt.Errorf("insert threshold %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
 // createAnalysisViews creates SQL views and a queries table for program analysis.
 func createAnalysisViews(conn *sqlite.Conn) error {
 	ddl := `
@@ -742,6 +1079,13 @@ CREATE VIEW v_function_io AS
   JOIN nodes p ON p.id = e.target AND p.kind IN ('parameter', 'result')
   WHERE f.kind = 'function';
 
+-- Generated files kept by -skip-generated=false, for leaving them out of
+-- findings and metrics
+CREATE VIEW v_generated_files AS
+  SELECT file, package, id AS file_id
+  FROM nodes
+  WHERE kind = 'file' AND json_extract(properties, '$.is_generated') = 1;
+
 -- Pre-computed findings for the viewer
 CREATE TABLE findings (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -760,7 +1104,7 @@ INSERT INTO findings (category, severity, node_id, file, line, message, details)
     n.name || ' has cyclomatic complexity ' || m.cyclomatic_complexity,
     json_object('complexity', m.cyclomatic_complexity, 'package', n.package)
   FROM nodes n JOIN metrics m ON n.id = m.function_id
-  WHERE m.cyclomatic_complexity >= 15;
+  WHERE m.cyclomatic_complexity >= (SELECT value FROM thresholds WHERE name = 'complexity');
 
 -- Very large functions
 INSERT INTO findings (category, severity, node_id, file, line, message, details)
@@ -768,7 +1112,7 @@ INSERT INTO findings (category, severity, node_id, file, line, message, details)
     n.name || ' is ' || m.loc || ' lines long',
     json_object('loc', m.loc, 'package', n.package)
   FROM nodes n JOIN metrics m ON n.id = m.function_id
-  WHERE m.loc >= 100;
+  WHERE m.loc >= (SELECT value FROM thresholds WHERE name = 'function_lines');
 
 -- Deeply nested control structures
 INSERT INTO findings (category, severity, node_id, file, line, message, details)
@@ -777,7 +1121,7 @@ INSERT INTO findings (category, severity, node_id, file, line, message, details)
     json_object('depth', CAST(np.value AS INTEGER), 'kind', n.kind)
   FROM node_properties np
   JOIN nodes n ON np.node_id = n.id
-  WHERE np.key = 'nesting_depth' AND CAST(np.value AS INTEGER) >= 8
+  WHERE np.key = 'nesting_depth' AND CAST(np.value AS INTEGER) >= (SELECT value FROM thresholds WHERE name = 'nesting_depth')
     AND n.kind IN ('if', 'for', 'switch', 'select');
 
 -- Hub functions (high fan-in + fan-out)
@@ -786,7 +1130,8 @@ INSERT INTO findings (category, severity, node_id, file, line, message, details)
     n.name || ': fan_in=' || m.fan_in || ' fan_out=' || m.fan_out,
     json_object('fan_in', m.fan_in, 'fan_out', m.fan_out, 'package', n.package)
   FROM nodes n JOIN metrics m ON n.id = m.function_id
-  WHERE m.fan_in >= 10 AND m.fan_out >= 10;
+  WHERE m.fan_in >= (SELECT value FROM thresholds WHERE name = 'hub_fan')
+    AND m.fan_out >= (SELECT value FROM thresholds WHERE name = 'hub_fan');
 
 -- Dead stores: local variables with no outgoing DFG edges (assigned but never read)
 INSERT INTO findings (category, severity, node_id, file, line, message, details)
@@ -796,7 +1141,8 @@ INSERT INTO findings (category, severity, node_id, file, line, message, details)
   FROM nodes n
   WHERE n.kind = 'local' AND n.parent_function IS NOT NULL
     AND NOT EXISTS (SELECT 1 FROM edges e WHERE e.source = n.id AND e.kind = 'dfg')
-    AND n.name != '_';
+    AND n.name != '_'
+    AND COALESCE(json_extract(n.properties, '$.decl'), '') != 'const'; -- folded, never stored
 
 -- Unused parameters: function parameters with no outgoing DFG edges
 INSERT INTO findings (category, severity, node_id, file, line, message, details)
@@ -845,6 +1191,13 @@ CREATE TABLE queries (
     sql TEXT NOT NULL
 );
 
+INSERT INTO queries (name, description, sql) VALUES
+('handwritten_metrics',
+ 'Function metrics without functions declared in generated files',
+ 'SELECT n.package, n.name, n.file, m.* FROM metrics m JOIN nodes n ON n.id = m.function_id
+WHERE COALESCE(json_extract(n.properties, ''$.is_generated''), 0) = 0
+ORDER BY m.cyclomatic_complexity DESC');
+
 INSERT INTO queries (name, description, sql) VALUES
 ('backward_slice',
  'Backward program slice: find all nodes that contribute to a given node via data flow',
@@ -1034,7 +1387,8 @@ INSERT INTO queries (name, description, sql) VALUES
 // computeEOG creates Evaluation Order Graph edges within call expressions.
 // For a call f(a, b, c), Go evaluates arguments left-to-right: a → b → c → f().
 // EOG edges connect consecutive arguments and the last argument to the call node.
-func computeEOG(conn *sqlite.Conn, prog *Progress) error {
+// An incremental update only adds the edges of stale call sites.
+func computeEOG(conn *sqlite.Conn, incremental bool, prog *Progress) error {
 	// Step 1: Connect consecutive arguments (arg[i] → arg[i+1])
 	if err := sqlitex.ExecuteTransient(conn,
 		`INSERT OR IGNORE INTO edges (source, target, kind, properties)
@@ -1043,7 +1397,8 @@ func computeEOG(conn *sqlite.Conn, prog *Progress) error {
 		 JOIN edges dst ON src.source = dst.source AND dst.kind = 'argument'
 		 WHERE src.kind = 'argument'
 		   AND CAST(json_extract(dst.properties, '$.index') AS INTEGER) =
-		       CAST(json_extract(src.properties, '$.index') AS INTEGER) + 1`,
+		       CAST(json_extract(src.properties, '$.index') AS INTEGER) + 1`+
+			staleCallSites("src.source", incremental),
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error { return nil },
 		}); err != nil {
@@ -1063,7 +1418,8 @@ func computeEOG(conn *sqlite.Conn, prog *Progress) error {
 		 WHERE la.idx = (
 		   SELECT MAX(CAST(json_extract(e2.properties, '$.index') AS INTEGER))
 		   FROM edges e2 WHERE e2.kind = 'argument' AND e2.source = la.call_id
-		 )`,
+		 )`+
+			staleCallSites("la.call_id", incremental),
 		&sqlitex.ExecOptions{
 			ResultFunc: func(stmt *sqlite.Stmt) error { return nil },
 		}); err != nil {
@@ -1078,6 +1434,18 @@ func computeEOG(conn *sqlite.Conn, prog *Progress) error {
 	return nil
 }
 
+// staleCallSites returns the SQL condition that limits a per-call-site edge
+// derivation to the call nodes in col that belong to a package in
+// temp.stale_pkgs, or no condition outside an incremental update. Argument
+// nodes always belong to the package of their call, so the heuristic DFG and
+// EOG edges of every other call site are unchanged.
+func staleCallSites(col string, incremental bool) string {
+	if !incremental {
+		return ""
+	}
+	return "\n\t\t   AND " + col + " IN (SELECT id FROM nodes WHERE package IN (SELECT package FROM temp.stale_pkgs))"
+}
+
 // createAdditionalAnalysis adds extra views, findings, and queries for the viewer.
 func createAdditionalAnalysis(conn *sqlite.Conn, prog *Progress) error {
 	ddl := `
@@ -1283,38 +1651,14 @@ INSERT INTO queries (name, description, sql) VALUES
 	return nil
 }
 
-// applyEscapeAnalysis maps compiler escape annotations to CPG nodes via position matching.
-func applyEscapeAnalysis(conn *sqlite.Conn, results []EscapeResult, prog *Progress) error {
-	// Create temp table for batch matching
-	if err := sqlitex.ExecuteTransient(conn,
-		`CREATE TEMP TABLE escape_info (file TEXT, line INTEGER, col INTEGER, kind TEXT, detail TEXT)`,
-		nil); err != nil {
-		return err
-	}
-
-	stmt, err := conn.Prepare(`INSERT INTO escape_info VALUES (?, ?, ?, ?, ?)`)
-	if err != nil {
-		return err
-	}
-	for _, r := range results {
-		stmt.BindText(1, r.RelFile)
-		stmt.BindInt64(2, int64(r.Line))
-		stmt.BindInt64(3, int64(r.Col))
-		stmt.BindText(4, r.Kind)
-		stmt.BindText(5, r.Detail)
-		if _, err := stmt.Step(); err != nil {
-			_ = stmt.Finalize()
-			return err
-		}
-		_ = stmt.Reset()
-	}
-	_ = stmt.Finalize()
-
+// applyEscapeAnalysis maps compiler escape annotations (persisted in the
+// escape_annotations base table) to CPG nodes via position matching.
+func applyEscapeAnalysis(conn *sqlite.Conn, prog *Progress) error {
 	// Match "inlineable" annotations to function nodes
 	if err := sqlitex.ExecuteTransient(conn,
 		`INSERT INTO node_properties (node_id, key, value)
 		 SELECT DISTINCT n.id, 'inlineable', 'true'
-		 FROM escape_info ei
+		 FROM escape_annotations ei
 		 JOIN nodes n ON n.file = ei.file AND n.line = ei.line
 		 WHERE ei.kind = 'inlineable' AND n.kind = 'function'`,
 		&sqlitex.ExecOptions{
@@ -1328,7 +1672,7 @@ func applyEscapeAnalysis(conn *sqlite.Conn, results []EscapeResult, prog *Progre
 	if err := sqlitex.ExecuteTransient(conn,
 		`INSERT INTO node_properties (node_id, key, value)
 		 SELECT DISTINCT n.id, 'heap_escapes', 'true'
-		 FROM escape_info ei
+		 FROM escape_annotations ei
 		 JOIN nodes n ON n.file = ei.file AND n.line = ei.line
 		 WHERE ei.kind IN ('leaking_param', 'moved_to_heap', 'escapes_to_heap')
 		   AND n.kind IN ('parameter', 'local', 'function')`,
@@ -1343,7 +1687,7 @@ func applyEscapeAnalysis(conn *sqlite.Conn, results []EscapeResult, prog *Progre
 	if err := sqlitex.ExecuteTransient(conn,
 		`INSERT INTO node_properties (node_id, key, value)
 		 SELECT DISTINCT n.id, 'heap_escapes', 'false'
-		 FROM escape_info ei
+		 FROM escape_annotations ei
 		 JOIN nodes n ON n.file = ei.file AND n.line = ei.line
 		 WHERE ei.kind = 'does_not_escape'
 		   AND n.kind IN ('parameter', 'local')
@@ -1358,9 +1702,6 @@ func applyEscapeAnalysis(conn *sqlite.Conn, results []EscapeResult, prog *Progre
 	}
 	notEscaping := conn.Changes()
 
-	// Drop temp table
-	_ = sqlitex.ExecuteTransient(conn, `DROP TABLE IF EXISTS escape_info`, nil)
-
 	prog.Log("Escape: %d inlineable functions, %d heap-escaping, %d stack-bound",
 		inlineable, escaping, notEscaping)
 	return nil
@@ -1632,7 +1973,8 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 ('node_kind', 'field', 'Struct field or interface method', NULL),
 ('node_kind', 'composite_lit', 'Struct/slice/map literal', NULL),
 ('node_kind', 'basic_block', 'SSA basic block (for CFG edges)', NULL),
-('node_kind', 'type_param', 'Generic type parameter (Go 1.18+)', NULL),
+('node_kind', 'type_param', 'Generic type parameter (Go 1.18+); type_info is its constraint', NULL),
+('node_kind', 'instantiation', 'Generic function or method instantiated with type arguments, in the package whose call sites instantiate it', 'b::a.Sum[int]'),
 ('node_kind', 'import', 'Import declaration', NULL),
 ('node_kind', 'doc', 'Doc comment', NULL),
 ('node_kind', 'label', 'Label for goto/break/continue', NULL),
@@ -1648,7 +1990,10 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 ('edge_kind', 'pdom', 'Post-dominator tree edge', NULL),
 ('edge_kind', 'dfg', 'Data flow: definition→use (intra-procedural)', 'Properties: {"heuristic":true} for external calls'),
 ('edge_kind', 'call', 'Caller function→callee function', 'Properties: {"dynamic":true} for interface dispatch'),
-('edge_kind', 'call_site', 'Call AST node→callee function', NULL),
+('edge_kind', 'call_site', 'Call AST node→callee function', 'Properties: {"instance":"b::a.Sum[int]"} when the callee is a generic instantiation'),
+('edge_kind', 'instantiates', 'Instantiation→its generic function; call and call_site edges target the generic function itself', 'Properties: {"type_args":["int"]}'),
+('edge_kind', 'constraint', 'Type parameter→named interface in its constraint', NULL),
+('edge_kind', 'field_type', 'Struct field→declaration of the named type it holds, through pointers, slices, arrays, and map values', 'Properties: {"wrap":"[]*"} for a []*T field'),
 ('edge_kind', 'param_in', 'Actual argument→formal parameter (inter-procedural)', 'Properties: {"index": N}'),
 ('edge_kind', 'param_out', 'Callee function→call site (return value flow)', NULL),
 ('edge_kind', 'implements', 'Concrete type→interface it implements', NULL),
@@ -1673,10 +2018,11 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 INSERT INTO schema_docs (category, name, description, example) VALUES
 ('node_property', 'receiver', 'Receiver type for methods', '*Manager'),
 ('node_property', 'generic', 'Function or type has type parameters', 'true'),
+('node_property', 'type_args', 'Type arguments of an instantiation', '["int"]'),
 ('node_property', 'external', 'External stub node (not in analyzed code)', 'true'),
 ('node_property', 'snippet', 'Code snippet for the node', 'if err != nil {'),
 ('node_property', 'nesting_depth', 'Depth of control structure nesting', '5'),
-('node_property', 'is_generated', 'File is generated (.pb.go)', 'true'),
+('node_property', 'is_generated', 'File, function, or type declared in generated code: a "// Code generated ... DO NOT EDIT." header or a generator file name (.pb.go, zz_generated*, goyacc .y.go); only present with -skip-generated=false', 'true'),
 ('node_property', 'returns_error', 'Function returns error type', 'true'),
 ('node_property', 'returns_nilable', 'Function returns pointer/slice/map/chan', 'true'),
 ('node_property', 'nullable', 'Parameter accepts nil (pointer/slice/map/chan/interface)', 'true'),
@@ -1685,7 +2031,8 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 ('node_property', 'context_param', 'Parameter is context.Context', 'true'),
 ('node_property', 'context_derivation', 'Call derives new context', 'WithCancel'),
 ('node_property', 'sync_kind', 'Call is sync primitive', 'mutex_lock'),
-('node_property', 'struct_tag', 'Struct field tag', 'json:"name,omitempty"'),
+('node_property', 'tag', 'Struct field tag, without backticks', 'yaml:"name" json:"name,omitempty"'),
+('node_property', 'tags', 'Struct field tag parsed per key: name, omitempty and inline flags, other options', '[{"key":"yaml","name":"name"},{"key":"json","name":"name","omitempty":true}]'),
 ('node_property', 'inlineable', 'Function can be inlined by compiler', 'true'),
 ('node_property', 'heap_escapes', 'Variable escapes to heap (GC pressure)', 'true/false'),
 ('node_property', 'taint_role', 'Security taint classification', 'source/sink/barrier/propagator'),
@@ -1693,9 +2040,10 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 
 -- Tables
 INSERT INTO schema_docs (category, name, description, example) VALUES
-('table', 'nodes', 'All CPG nodes (AST + SSA)', 'SELECT * FROM nodes WHERE kind=''function'' AND package=''scrape'''),
+('table', 'nodes', 'All CPG nodes (AST + SSA); line and col locate the node by name or operator, start_offset and end_offset (byte offsets into sources.content, end exclusive) and end_line and end_col span its full syntax; no span on package, basic_block, and external stub nodes', 'SELECT * FROM nodes WHERE kind=''function'' AND package=''scrape'''),
 ('table', 'edges', 'All CPG edges (AST, CFG, DFG, call, type)', 'SELECT * FROM edges WHERE kind=''call'' AND source=:func_id'),
 ('table', 'sources', 'Source file contents', 'SELECT content FROM sources WHERE file=''scrape/manager.go'''),
+('table', 'orphan_edges', 'Edges removed from edges because their source or target node does not exist (missing: source, target, or both); empty in a sound graph', 'SELECT kind, missing, COUNT(*) FROM orphan_edges GROUP BY 1, 2'),
 ('table', 'metrics', 'Function-level metrics', 'SELECT * FROM metrics ORDER BY cyclomatic_complexity DESC'),
 ('table', 'findings', 'Pre-computed analysis findings', 'SELECT * FROM findings WHERE category=''complexity'''),
 ('table', 'queries', 'Parameterized CTE queries for analysis', 'SELECT name, description FROM queries'),
@@ -1705,7 +2053,11 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 ('table', 'edge_properties', 'Vertical edge property table', 'SELECT * FROM edge_properties WHERE key=''dynamic'''),
 ('table', 'stats_overview', 'Summary statistics for the entire CPG', 'SELECT * FROM stats_overview'),
 ('table', 'stats_packages', 'Per-package statistics', 'SELECT * FROM stats_packages ORDER BY functions DESC'),
-('table', 'sources_fts', 'FTS5 full-text search on source code', 'SELECT file FROM sources_fts WHERE content MATCH ''mutex''');
+('table', 'sources_fts', 'FTS5 full-text search on source code', 'SELECT file FROM sources_fts WHERE content MATCH ''mutex'''),
+('table', 'thresholds', 'Finding thresholds in effect for this database (from the config file or defaults)', 'SELECT * FROM thresholds'),
+('table', 'modules', 'Analyzed Go modules: node ID prefix (empty for the primary), module path, directory, version, and source (dir, or modcache for a module@version spec read from the module cache)', 'SELECT * FROM modules'),
+('table', 'file_hashes', 'SHA-256 of every analyzed source file; drives -incremental change detection', 'SELECT pkg_path, COUNT(*) FROM file_hashes GROUP BY pkg_path'),
+('table', 'escape_annotations', 'Raw escape analysis decisions from go build -gcflags=-m, per module', 'SELECT * FROM escape_annotations WHERE kind = ''moved_to_heap'' LIMIT 20');
 
 -- Views
 INSERT INTO schema_docs (category, name, description, example) VALUES
@@ -1716,6 +2068,7 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 ('view', 'v_package_deps', 'Aggregated cross-package call edges', NULL),
 ('view', 'v_file_deps', 'File-level dependency graph', NULL),
 ('view', 'v_function_io', 'Parameters and return values per function', NULL),
+('view', 'v_generated_files', 'Generated files in the graph (kept with -skip-generated=false); empty by default', 'SELECT * FROM findings WHERE file NOT IN (SELECT file FROM v_generated_files)'),
 ('view', 'v_api_surface', 'Exported functions and types per package', NULL),
 ('view', 'v_method_sets', 'Methods grouped by receiver type', NULL),
 ('view', 'v_error_handling', 'Error-returning functions with metrics', NULL),
@@ -2376,9 +2729,9 @@ INSERT INTO dashboard_overview (key, value) VALUES
   ('total_interfaces', (SELECT COUNT(*) FROM node_properties WHERE key = 'type_kind' AND value = 'interface')),
   ('total_nodes', (SELECT COUNT(*) FROM nodes)),
   ('total_edges', (SELECT COUNT(*) FROM edges)),
-  ('total_loc', (SELECT SUM(loc) FROM metrics)),
-  ('avg_complexity', (SELECT ROUND(AVG(cyclomatic_complexity), 1) FROM metrics WHERE cyclomatic_complexity > 0)),
-  ('max_complexity', (SELECT MAX(cyclomatic_complexity) FROM metrics)),
+  ('total_loc', (SELECT COALESCE(SUM(loc), 0) FROM metrics)),
+  ('avg_complexity', (SELECT COALESCE(ROUND(AVG(cyclomatic_complexity), 1), 0) FROM metrics WHERE cyclomatic_complexity > 0)),
+  ('max_complexity', (SELECT COALESCE(MAX(cyclomatic_complexity), 0) FROM metrics)),
   ('total_findings', (SELECT COUNT(*) FROM findings)),
   ('total_call_edges', (SELECT COUNT(*) FROM edges WHERE kind = 'call')),
   ('total_dfg_edges', (SELECT COUNT(*) FROM edges WHERE kind = 'dfg')),
@@ -2464,11 +2817,11 @@ CREATE TABLE error_chains (
 	// Top functions by complexity
 	if err := sqlitex.ExecuteTransient(conn, `
 INSERT INTO dashboard_top_functions
-  SELECT 'complexity', ROW_NUMBER() OVER (ORDER BY m.cyclomatic_complexity DESC), m.function_id,
+  SELECT 'complexity', ROW_NUMBER() OVER (ORDER BY m.cyclomatic_complexity DESC, m.function_id), m.function_id,
     n.name, n.package, n.file, m.cyclomatic_complexity
   FROM metrics m JOIN nodes n ON n.id = m.function_id
   WHERE m.cyclomatic_complexity > 0
-  ORDER BY m.cyclomatic_complexity DESC LIMIT 50`,
+  ORDER BY m.cyclomatic_complexity DESC, m.function_id LIMIT 50`,
 		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error { return nil }}); err != nil {
 		return fmt.Errorf("top complexity: %w", err)
 	}
@@ -2476,11 +2829,11 @@ INSERT INTO dashboard_top_functions
 	// Top by LOC
 	if err := sqlitex.ExecuteTransient(conn, `
 INSERT INTO dashboard_top_functions
-  SELECT 'loc', ROW_NUMBER() OVER (ORDER BY m.loc DESC), m.function_id,
+  SELECT 'loc', ROW_NUMBER() OVER (ORDER BY m.loc DESC, m.function_id), m.function_id,
     n.name, n.package, n.file, m.loc
   FROM metrics m JOIN nodes n ON n.id = m.function_id
   WHERE m.loc > 0
-  ORDER BY m.loc DESC LIMIT 50`,
+  ORDER BY m.loc DESC, m.function_id LIMIT 50`,
 		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error { return nil }}); err != nil {
 		return fmt.Errorf("top loc: %w", err)
 	}
@@ -2488,11 +2841,11 @@ INSERT INTO dashboard_top_functions
 	// Top by fan-in (most called)
 	if err := sqlitex.ExecuteTransient(conn, `
 INSERT INTO dashboard_top_functions
-  SELECT 'fan_in', ROW_NUMBER() OVER (ORDER BY m.fan_in DESC), m.function_id,
+  SELECT 'fan_in', ROW_NUMBER() OVER (ORDER BY m.fan_in DESC, m.function_id), m.function_id,
     n.name, n.package, n.file, m.fan_in
   FROM metrics m JOIN nodes n ON n.id = m.function_id
   WHERE m.fan_in > 0
-  ORDER BY m.fan_in DESC LIMIT 50`,
+  ORDER BY m.fan_in DESC, m.function_id LIMIT 50`,
 		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error { return nil }}); err != nil {
 		return fmt.Errorf("top fan_in: %w", err)
 	}
@@ -2500,11 +2853,11 @@ INSERT INTO dashboard_top_functions
 	// Top by fan-out (calls the most)
 	if err := sqlitex.ExecuteTransient(conn, `
 INSERT INTO dashboard_top_functions
-  SELECT 'fan_out', ROW_NUMBER() OVER (ORDER BY m.fan_out DESC), m.function_id,
+  SELECT 'fan_out', ROW_NUMBER() OVER (ORDER BY m.fan_out DESC, m.function_id), m.function_id,
     n.name, n.package, n.file, m.fan_out
   FROM metrics m JOIN nodes n ON n.id = m.function_id
   WHERE m.fan_out > 0
-  ORDER BY m.fan_out DESC LIMIT 50`,
+  ORDER BY m.fan_out DESC, m.function_id LIMIT 50`,
 		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error { return nil }}); err != nil {
 		return fmt.Errorf("top fan_out: %w", err)
 	}
@@ -2519,8 +2872,8 @@ INSERT INTO dashboard_hotspots
     ROUND(
       (CAST(m.cyclomatic_complexity AS REAL) / MAX((SELECT MAX(cyclomatic_complexity) FROM metrics), 1)) * 30 +
       (CAST(m.loc AS REAL) / MAX((SELECT MAX(loc) FROM metrics), 1)) * 20 +
-      (CAST(m.fan_in AS REAL) / MAX((SELECT MAX(fan_in) FROM metrics WHERE fan_in > 0), 1)) * 25 +
-      (CAST(COALESCE(fc.cnt, 0) AS REAL) / MAX((SELECT MAX(c) FROM (SELECT COUNT(*) as c FROM findings GROUP BY node_id)), 1)) * 25
+      (CAST(COALESCE(m.fan_in, 0) AS REAL) / MAX(COALESCE((SELECT MAX(fan_in) FROM metrics WHERE fan_in > 0), 1), 1)) * 25 +
+      (CAST(COALESCE(fc.cnt, 0) AS REAL) / MAX(COALESCE((SELECT MAX(c) FROM (SELECT COUNT(*) as c FROM findings GROUP BY node_id)), 1), 1)) * 25
     , 2)
   FROM metrics m
   JOIN nodes n ON n.id = m.function_id
@@ -2720,7 +3073,7 @@ INSERT INTO dashboard_file_heatmap
     ROUND(
       (CAST(SUM(COALESCE(m.cyclomatic_complexity, 0)) AS REAL) / MAX((SELECT MAX(cyclomatic_complexity) FROM metrics), 1)) * 40 +
       (CAST(SUM(COALESCE(m.loc, 0)) AS REAL) / MAX((SELECT MAX(loc) FROM metrics), 1)) * 30 +
-      (CAST(COALESCE(ff.cnt, 0) AS REAL) / MAX((SELECT MAX(c) FROM (SELECT COUNT(*) as c FROM findings GROUP BY node_id)), 1)) * 30
+      (CAST(COALESCE(ff.cnt, 0) AS REAL) / MAX(COALESCE((SELECT MAX(c) FROM (SELECT COUNT(*) as c FROM findings GROUP BY node_id)), 1), 1)) * 30
     , 2)
   FROM nodes n
   LEFT JOIN metrics m ON m.function_id = n.id
@@ -2736,7 +3089,7 @@ INSERT INTO dashboard_file_heatmap
 		return fmt.Errorf("file heatmap: %w", err)
 	}
 
-	// Package dependency graph (filtered to Prometheus-internal packages only)
+	// Package dependency graph (filtered to packages of the analyzed modules)
 	if err := sqlitex.ExecuteTransient(conn, `
 INSERT INTO dashboard_package_graph
   SELECT source_package, target_package, call_count
@@ -3133,7 +3486,11 @@ INSERT INTO queries (name, description, sql) VALUES
   ('xref_lookup', 'Find all usages of a symbol by its definition ID',
    'SELECT use_file, use_line, use_kind FROM xrefs WHERE def_id = :id ORDER BY use_file, use_line'),
   ('go_patterns', 'Go-specific construct usage per package (goroutines, channels, errors, etc.)',
-   'SELECT * FROM go_pattern_summary ORDER BY goroutine_count DESC')`,
+   'SELECT * FROM go_pattern_summary ORDER BY goroutine_count DESC'),
+  ('node_source', 'Exact source text of a node, cut from sources by its byte offsets',
+   'SELECT n.file, n.line, n.col, n.end_line, n.end_col, CAST(substr(CAST(s.content AS BLOB), n.start_offset + 1, n.end_offset - n.start_offset) AS TEXT) AS text FROM nodes n JOIN sources s ON s.file = n.file WHERE n.id = :id'),
+  ('nodes_at_offset', 'Nodes whose span covers a byte offset of a file, innermost first',
+   'SELECT id, kind, name, start_offset, end_offset FROM nodes WHERE file = :file AND start_offset <= :offset AND end_offset > :offset ORDER BY end_offset - start_offset, start_offset DESC')`,
 		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error { return nil }}); err != nil {
 		return fmt.Errorf("navigation queries: %w", err)
 	}
@@ -3439,8 +3796,11 @@ INSERT INTO queries (name, description, sql) VALUES
 }
 
 // createSCIPSymbols generates SCIP (Source Code Intelligence Protocol) compatible
-// symbol identifiers for cross-repository code navigation.
-func createSCIPSymbols(conn *sqlite.Conn, prog *Progress) error {
+// symbol identifiers for cross-repository code navigation. Module path and
+// version come from the modules table, so symbols of every analyzed module
+// carry their own module coordinates. External functions get the coordinates
+// of the dependency that provides them (see externalSCIPSymbols).
+func createSCIPSymbols(conn *sqlite.Conn, ms *ModuleSet, prog *Progress) error {
 	ddl := `
 CREATE TABLE scip_symbols (
     node_id TEXT PRIMARY KEY,
@@ -3450,49 +3810,67 @@ CREATE TABLE scip_symbols (
     display_name TEXT
 );
 
--- Functions: scip-go gomod github.com/prometheus/prometheus v0 package/name().
+-- Scheme and module-relative package for every node package. The owning
+-- module is the longest matching prefix; the primary module (prefix '')
+-- matches everything else.
+CREATE TEMP TABLE scip_pkg AS
+SELECT p.package AS package,
+  'scip-go gomod ' || m.mod_path || ' ' || m.version || ' ' AS scheme,
+  CASE WHEN m.prefix = '' THEN p.package
+       WHEN p.package = m.prefix THEN 'main'
+       ELSE SUBSTR(p.package, LENGTH(m.prefix) + 2)
+  END AS rel
+FROM (SELECT DISTINCT package FROM nodes WHERE package IS NOT NULL AND id NOT LIKE 'ext::%') p
+JOIN modules m ON m.prefix = (
+  SELECT m2.prefix FROM modules m2
+  WHERE m2.prefix = '' OR p.package = m2.prefix OR p.package LIKE m2.prefix || '/%'
+  ORDER BY LENGTH(m2.prefix) DESC LIMIT 1);
+
+-- Functions: scip-go gomod <module> <version> package/name().
 INSERT INTO scip_symbols (node_id, scip_id, kind, package, display_name)
 SELECT n.id,
-  'scip-go gomod github.com/prometheus/prometheus v0 ' ||
-  REPLACE(n.package, '/', '.') || '/' || n.name || '().',
+  sp.scheme || REPLACE(sp.rel, '/', '.') || '/' || n.name || '().',
   'function', n.package, n.name
 FROM nodes n
+JOIN scip_pkg sp ON sp.package = n.package
 WHERE n.kind = 'function'
   AND n.name NOT LIKE '%.%'
-  AND n.package IS NOT NULL AND n.name != '';
+  AND n.name != ''
+  AND n.id NOT LIKE 'ext::%';
 
--- Methods: scip-go gomod github.com/prometheus/prometheus v0 package/Type#Method().
+-- Methods: scip-go gomod <module> <version> package/Type#Method().
 INSERT INTO scip_symbols (node_id, scip_id, kind, package, display_name)
 SELECT n.id,
-  'scip-go gomod github.com/prometheus/prometheus v0 ' ||
-  REPLACE(n.package, '/', '.') || '/' ||
+  sp.scheme || REPLACE(sp.rel, '/', '.') || '/' ||
   REPLACE(REPLACE(SUBSTR(n.name, 1, INSTR(n.name, '.') - 1), '(*', ''), ')', '') ||
   '#' || SUBSTR(n.name, INSTR(n.name, '.') + 1) || '().',
   'method', n.package, n.name
 FROM nodes n
+JOIN scip_pkg sp ON sp.package = n.package
 WHERE n.kind = 'function'
   AND n.name LIKE '%.%'
-  AND n.package IS NOT NULL;
+  AND n.id NOT LIKE 'ext::%';
 
--- Types: scip-go gomod github.com/prometheus/prometheus v0 package/TypeName#
+-- Types: scip-go gomod <module> <version> package/TypeName#
 INSERT OR IGNORE INTO scip_symbols (node_id, scip_id, kind, package, display_name)
 SELECT n.id,
-  'scip-go gomod github.com/prometheus/prometheus v0 ' ||
-  REPLACE(n.package, '/', '.') || '/' || n.name || '#',
+  sp.scheme || REPLACE(sp.rel, '/', '.') || '/' || n.name || '#',
   'type', n.package, n.name
 FROM nodes n
+JOIN scip_pkg sp ON sp.package = n.package
 WHERE n.kind = 'type_decl'
-  AND n.package IS NOT NULL AND n.name != '';
+  AND n.name != '';
 
--- Packages: scip-go gomod github.com/prometheus/prometheus v0 package/
+-- Packages: scip-go gomod <module> <version> package/
 INSERT OR IGNORE INTO scip_symbols (node_id, scip_id, kind, package, display_name)
 SELECT n.id,
-  'scip-go gomod github.com/prometheus/prometheus v0 ' ||
-  REPLACE(n.package, '/', '.') || '/',
+  sp.scheme || REPLACE(sp.rel, '/', '.') || '/',
   'package', n.package, n.name
 FROM nodes n
-WHERE n.kind = 'package'
-  AND n.package IS NOT NULL;
+JOIN scip_pkg sp ON sp.package = n.package
+WHERE n.kind = 'package';
+
+DROP TABLE temp.scip_pkg;
 
 CREATE INDEX idx_scip_kind ON scip_symbols(kind);
 CREATE INDEX idx_scip_pkg ON scip_symbols(package);
@@ -3507,6 +3885,9 @@ INSERT INTO queries (name, description, sql) VALUES
 	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
 		return fmt.Errorf("scip symbols: %w", err)
 	}
+	if err := externalSCIPSymbols(conn, ms); err != nil {
+		return fmt.Errorf("scip symbols: %w", err)
+	}
 
 	var total int
 	sqlitex.ExecuteTransient(conn, "SELECT COUNT(*) FROM scip_symbols",
@@ -3526,10 +3907,88 @@ INSERT INTO queries (name, description, sql) VALUES
 	return nil
 }
 
+// externalSCIPSymbols adds SCIP symbols for the external function stubs of
+// the call graph. A standard library package belongs to
+// github.com/golang/go/src at the primary module's Go version; any other
+// package to the longest module path the analyzed modules require, at the
+// required version or its replacement's (see ModuleSet.Requirements). Closures and packages of unknown modules get no symbol.
+func externalSCIPSymbols(conn *sqlite.Conn, ms *ModuleSet) error {
+	deps, goVersion := ms.Requirements()
+
+	type stub struct{ id, pkg, fullName string }
+	var stubs []stub
+	if err := sqlitex.ExecuteTransient(conn,
+		`SELECT id, package, json_extract(properties, '$.full_name') FROM nodes
+		 WHERE kind = 'function' AND id LIKE 'ext::%' AND package IS NOT NULL ORDER BY id`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			stubs = append(stubs, stub{stmt.ColumnText(0), stmt.ColumnText(1), stmt.ColumnText(2)})
+			return nil
+		}}); err != nil {
+		return fmt.Errorf("read external functions: %w", err)
+	}
+
+	stmt, err := conn.Prepare(`INSERT OR IGNORE INTO scip_symbols (node_id, scip_id, kind, package, display_name) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare external symbol insert: %w", err)
+	}
+	defer func() { _ = stmt.Finalize() }()
+
+	for _, s := range stubs {
+		mod, version, rel := externalModule(s.pkg, deps, goVersion)
+		if mod == "" || strings.Contains(s.fullName, "$") {
+			continue
+		}
+		// full_name is "pkg.Func" or "(*pkg.Type).Method", with type
+		// arguments on instantiations.
+		display := strings.Replace(s.fullName, s.pkg+".", "", 1)
+		kind, descriptor := "function", display
+		if recv, method, ok := strings.Cut(display, ")."); ok && strings.HasPrefix(recv, "(") {
+			typ, _, _ := strings.Cut(strings.TrimLeft(recv, "(*"), "[")
+			kind, descriptor = "method", typ+"#"+method
+		}
+		descriptor, _, _ = strings.Cut(descriptor, "[")
+		stmt.BindText(1, s.id)
+		stmt.BindText(2, "scip-go gomod "+mod+" "+version+" "+strings.ReplaceAll(rel, "/", ".")+"/"+descriptor+"().")
+		stmt.BindText(3, kind)
+		stmt.BindText(4, s.pkg)
+		stmt.BindText(5, display)
+		if _, err := stmt.Step(); err != nil {
+			return fmt.Errorf("insert external symbol %s: %w", s.id, err)
+		}
+		_ = stmt.Reset()
+	}
+	return nil
+}
+
+// externalModule returns the module coordinates of an external package and
+// its module-relative path, or an empty module when they are unknown.
+func externalModule(pkg string, deps map[string]string, goVersion string) (mod, version, rel string) {
+	if first, _, _ := strings.Cut(pkg, "/"); !strings.Contains(first, ".") {
+		if goVersion == "" {
+			return "", "", ""
+		}
+		return "github.com/golang/go/src", goVersion, pkg
+	}
+	for path, v := range deps {
+		if (pkg == path || strings.HasPrefix(pkg, path+"/")) && len(path) > len(mod) {
+			mod, version = path, v
+		}
+	}
+	switch {
+	case mod == "":
+		return "", "", ""
+	case pkg == mod:
+		return mod, version, "main"
+	}
+	return mod, version, pkg[len(mod)+1:]
+}
+
 // createCommunicationPatterns builds Honda session type-inspired protocol
-// analysis connecting Prometheus with its ecosystem services (adapter, alertmanager, etc.).
+// analysis. The tables, conformance checks, and views are generic; protocol
+// definitions and endpoint detection come from the selected profiles (e.g. the
+// prometheus profile connects Prometheus with adapter, Alertmanager, etc.).
 // Inspired by Honda 1998 (binary session types) and Honda 2008 (multiparty asynchronous session types).
-func createCommunicationPatterns(conn *sqlite.Conn, prog *Progress) error {
+func createCommunicationPatterns(conn *sqlite.Conn, profiles []Profile, prog *Progress) error {
 	ddl := `
 -- ═══════════════════════════════════════════════════════════════════
 -- Communication Patterns — Honda Session Type Analysis
@@ -3635,505 +4094,34 @@ CREATE TABLE comm_graph (
     PRIMARY KEY (source_component, target_component, protocol_id)
 );
 
--- ═══════════════════════════════════════════════════════════════════
--- Protocol Definitions
--- ═══════════════════════════════════════════════════════════════════
-
-INSERT INTO comm_protocols VALUES
--- Prometheus ↔ Targets
-('scrape', 'Target Scrape',
- 'Prometheus HTTP-scrapes metrics from monitored targets at configured intervals',
- '!HTTP_GET{/metrics}; ?text{exposition_format}; end',
- '?HTTP_GET{/metrics}; !text{exposition_format}; end',
- 'http', 'text/plain', 'request_response', 1),
-
--- Prometheus → Remote Storage
-('remote_write', 'Remote Write',
- 'Prometheus forwards time series samples to remote storage via HTTP POST with snappy-compressed protobuf',
- '!HTTP_POST{protobuf(WriteRequest)}; ?HTTP{status_code}; end',
- '?HTTP_POST{protobuf(WriteRequest)}; !HTTP{status_code}; end',
- 'http', 'protobuf+snappy', 'request_response', 1),
-
--- Prometheus ← Remote Storage
-('remote_read', 'Remote Read',
- 'Prometheus queries remote storage for historical samples via protobuf request/response',
- '!HTTP_POST{protobuf(ReadRequest)}; ?HTTP{protobuf(ReadResponse)}; end',
- '?HTTP_POST{protobuf(ReadRequest)}; !HTTP{protobuf(ReadResponse)}; end',
- 'http', 'protobuf+snappy', 'request_response', 1),
-
--- Prometheus → Alertmanager
-('alertmanager_notify', 'Alertmanager Notification',
- 'Prometheus sends firing/resolved alerts to Alertmanager instances via JSON POST',
- '!HTTP_POST{json(Alert[])}; ?HTTP{status_code}; end',
- '?HTTP_POST{json(Alert[])}; !HTTP{status_code}; end',
- 'http', 'json', 'request_response', 1),
-
--- Adapter → Prometheus: instant query
-('adapter_query', 'Adapter Instant Query',
- 'prometheus-adapter queries Prometheus /api/v1/query for point-in-time metric values',
- '!HTTP{verb, /api/v1/query, query=PromQL, time, timeout}; ?JSON{status, data:QueryResult}; end',
- '?HTTP{verb, /api/v1/query, query=PromQL, time, timeout}; !JSON{status, data:QueryResult}; end',
- 'http', 'json', 'request_response', 1),
-
--- Adapter → Prometheus: range query
-('adapter_query_range', 'Adapter Range Query',
- 'prometheus-adapter queries Prometheus /api/v1/query_range for time series data over an interval',
- '!HTTP{verb, /api/v1/query_range, query, start, end, step, timeout}; ?JSON{status, data:QueryResult}; end',
- '?HTTP{verb, /api/v1/query_range, query, start, end, step, timeout}; !JSON{status, data:QueryResult}; end',
- 'http', 'json', 'request_response', 1),
-
--- Adapter → Prometheus: series metadata
-('adapter_series', 'Adapter Series Discovery',
- 'prometheus-adapter queries Prometheus /api/v1/series to discover available metric names and labels',
- '!HTTP{verb, /api/v1/series, match[], start, end}; ?JSON{status, data:Series[]}; end',
- '?HTTP{verb, /api/v1/series, match[], start, end}; !JSON{status, data:Series[]}; end',
- 'http', 'json', 'request_response', 1),
-
--- Kubernetes → Adapter: custom metrics
-('k8s_custom_metrics', 'Kubernetes Custom Metrics API',
- 'Kubernetes API server (HPA) queries adapter for pod/object custom metrics',
- '!HTTP_GET{/apis/custom.metrics.k8s.io/v1beta2/*}; ?JSON{CustomMetricValueList}; end',
- '?HTTP_GET{/apis/custom.metrics.k8s.io/v1beta2/*}; !JSON{CustomMetricValueList}; end',
- 'http', 'json', 'request_response', 1),
-
--- Kubernetes → Adapter: external metrics
-('k8s_external_metrics', 'Kubernetes External Metrics API',
- 'Kubernetes API server (HPA) queries adapter for cluster-external metrics',
- '!HTTP_GET{/apis/external.metrics.k8s.io/v1beta1/*}; ?JSON{ExternalMetricValueList}; end',
- '?HTTP_GET{/apis/external.metrics.k8s.io/v1beta1/*}; !JSON{ExternalMetricValueList}; end',
- 'http', 'json', 'request_response', 1),
-
--- Kubernetes → Adapter: resource metrics
-('k8s_resource_metrics', 'Kubernetes Resource Metrics API',
- 'Kubernetes API server queries adapter for CPU/memory resource metrics (replaces metrics-server)',
- '!HTTP_GET{/apis/metrics.k8s.io/v1beta1/*}; ?JSON{PodMetrics|NodeMetrics}; end',
- '?HTTP_GET{/apis/metrics.k8s.io/v1beta1/*}; !JSON{PodMetrics|NodeMetrics}; end',
- 'http', 'json', 'request_response', 1),
-
--- Prometheus ← Discovery Providers
-('discovery', 'Service Discovery',
- 'Prometheus discovers scrape targets from external providers (Kubernetes, Consul, DNS, EC2, etc.)',
- '!API{provider_specific_query}; ?JSON{TargetGroup[]}; end',
- '?API{provider_specific_query}; !JSON{TargetGroup[]}; end',
- 'http', 'json', 'request_response', 1),
-
--- Prometheus ← other Prometheus (federation)
-('federation', 'Prometheus Federation',
- 'Hierarchical Prometheus scrapes another Prometheus /federate endpoint with PromQL matchers',
- '!HTTP_GET{/federate, match[]}; ?text{exposition_format}; end',
- '?HTTP_GET{/federate, match[]}; !text{exposition_format}; end',
- 'http', 'text/plain', 'request_response', 1),
-
--- External → Prometheus (OTLP ingestion)
-('otlp_ingest', 'OTLP Metrics Ingestion',
- 'External OTLP-compatible services push metrics to Prometheus via OTLP HTTP receiver',
- '!HTTP_POST{protobuf(ExportMetricsServiceRequest)}; ?HTTP{ExportMetricsServiceResponse}; end',
- '?HTTP_POST{protobuf(ExportMetricsServiceRequest)}; !HTTP{ExportMetricsServiceResponse}; end',
- 'http', 'protobuf', 'request_response', 1),
-
--- External → Prometheus (PromQL API)
-('promql_api', 'PromQL Query API',
- 'External clients (Grafana, scripts, etc.) query Prometheus PromQL HTTP API',
- '!HTTP{GET|POST, /api/v1/query|query_range, query=PromQL}; ?JSON{status, data}; end',
- '?HTTP{GET|POST, /api/v1/query|query_range, query=PromQL}; !JSON{status, data}; end',
- 'http', 'json', 'request_response', 1);
-
--- ═══════════════════════════════════════════════════════════════════
--- Participants
--- ═══════════════════════════════════════════════════════════════════
-
-INSERT INTO comm_participants VALUES
-('scrape', 'prometheus', 'client', 'Scrape manager pulls metrics from targets'),
-('scrape', 'target', 'server', 'Monitored service exposes /metrics endpoint'),
-('remote_write', 'prometheus', 'client', 'Queue manager batches and sends samples'),
-('remote_write', 'remote_storage', 'server', 'Remote write receiver (Thanos, Cortex, Mimir, etc.)'),
-('remote_read', 'prometheus', 'client', 'Querier fans out read requests to remote storage'),
-('remote_read', 'remote_storage', 'server', 'Remote read provider returns stored samples'),
-('alertmanager_notify', 'prometheus', 'client', 'Notifier manager sends alert batches'),
-('alertmanager_notify', 'alertmanager', 'server', 'Alertmanager receives and groups alerts'),
-('adapter_query', 'adapter', 'client', 'prometheus-adapter queries instant metric values'),
-('adapter_query', 'prometheus', 'server', 'Prometheus evaluates PromQL and returns results'),
-('adapter_query_range', 'adapter', 'client', 'prometheus-adapter queries time-range metric values'),
-('adapter_query_range', 'prometheus', 'server', 'Prometheus evaluates range PromQL queries'),
-('adapter_series', 'adapter', 'client', 'prometheus-adapter discovers available series'),
-('adapter_series', 'prometheus', 'server', 'Prometheus returns matching series metadata'),
-('k8s_custom_metrics', 'kubernetes', 'client', 'Kubernetes HPA queries custom metrics for scaling'),
-('k8s_custom_metrics', 'adapter', 'server', 'Adapter translates Kubernetes metric requests to PromQL'),
-('k8s_external_metrics', 'kubernetes', 'client', 'Kubernetes HPA queries external metrics'),
-('k8s_external_metrics', 'adapter', 'server', 'Adapter provides external metric values from Prometheus'),
-('k8s_resource_metrics', 'kubernetes', 'client', 'Kubernetes scheduler/HPA queries resource metrics'),
-('k8s_resource_metrics', 'adapter', 'server', 'Adapter provides CPU/memory metrics from Prometheus'),
-('discovery', 'prometheus', 'client', 'Discovery manager polls providers for target groups'),
-('discovery', 'provider', 'server', 'Cloud/infra API returns target lists'),
-('federation', 'prometheus_global', 'client', 'Global Prometheus scrapes shard /federate endpoints'),
-('federation', 'prometheus', 'server', 'Shard Prometheus serves federated metrics'),
-('otlp_ingest', 'external_service', 'client', 'OTLP-instrumented service pushes metrics'),
-('otlp_ingest', 'prometheus', 'server', 'OTLP write handler receives and converts metrics'),
-('promql_api', 'external_client', 'client', 'Grafana, scripts, or other consumers'),
-('promql_api', 'prometheus', 'server', 'Web API evaluates PromQL and returns JSON'),
-('adapter_query', 'client_golang', 'contract', 'API contract: httpAPI.Query defines the /api/v1/query client interface'),
-('adapter_query_range', 'client_golang', 'contract', 'API contract: httpAPI.QueryRange defines the /api/v1/query_range client interface'),
-('adapter_series', 'client_golang', 'contract', 'API contract: httpAPI.Series defines the /api/v1/series client interface'),
-('promql_api', 'client_golang', 'contract', 'API contract: v1.API interface defines the full Prometheus HTTP API surface');
-
--- ═══════════════════════════════════════════════════════════════════
--- Session Type Steps (formalized message sequences)
--- ═══════════════════════════════════════════════════════════════════
-
--- Scrape protocol steps
-INSERT INTO comm_session_steps VALUES
-('scrape', 1, 'client', '!', 'HTTP GET /metrics', 'none', 'Prometheus sends HTTP GET to target /metrics endpoint'),
-('scrape', 2, 'server', '!', 'text/plain exposition', 'text/plain', 'Target responds with metrics in exposition format'),
-('scrape', 3, 'client', '?', 'text/plain exposition', 'text/plain', 'Prometheus receives and parses exposition data');
-
--- Remote write protocol steps
-INSERT INTO comm_session_steps VALUES
-('remote_write', 1, 'client', '!', 'protobuf WriteRequest', 'protobuf+snappy', 'Prometheus sends snappy-compressed protobuf WriteRequest'),
-('remote_write', 2, 'server', '!', 'HTTP status', 'none', 'Remote storage acknowledges with HTTP status code'),
-('remote_write', 3, 'client', '?', 'HTTP status', 'none', 'Prometheus checks status for retry logic');
-
--- Adapter query steps
-INSERT INTO comm_session_steps VALUES
-('adapter_query', 1, 'client', '!', 'HTTP query=PromQL&time=T', 'form', 'Adapter sends PromQL instant query with timestamp'),
-('adapter_query', 2, 'server', '!', 'JSON APIResponse{data:QueryResult}', 'json', 'Prometheus evaluates PromQL, returns vector/scalar/matrix'),
-('adapter_query', 3, 'client', '?', 'JSON APIResponse{data:QueryResult}', 'json', 'Adapter unmarshals QueryResult into custom metrics');
-
--- Adapter series discovery steps
-INSERT INTO comm_session_steps VALUES
-('adapter_series', 1, 'client', '!', 'HTTP match[]=selector&start=T&end=T', 'form', 'Adapter sends series selector match parameters'),
-('adapter_series', 2, 'server', '!', 'JSON APIResponse{data:Series[]}', 'json', 'Prometheus returns matching series with label sets'),
-('adapter_series', 3, 'client', '?', 'JSON APIResponse{data:Series[]}', 'json', 'Adapter processes series for metric naming and listing');
-
--- ═══════════════════════════════════════════════════════════════════
--- Endpoint Detection (from CPG nodes)
--- ═══════════════════════════════════════════════════════════════════
-
--- Prometheus server endpoints: scrape loop (client role in scrape protocol)
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'scrape', 'prometheus', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'scrape'
-  AND (n.name LIKE '*scrapeLoop.run%' OR n.name LIKE '*scrapeLoop.scrapeAndReport%');
-
--- Remote write: queue manager sending
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'remote_write', 'prometheus', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'storage/remote'
-  AND (n.name LIKE '*QueueManager.sendBatch%' OR n.name LIKE '*QueueManager.Start%'
-       OR n.name LIKE '%Client.Store%');
-
--- Remote write: server handler
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'remote_write', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/write', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'storage/remote'
-  AND n.name LIKE '*writeHandler%';
-
--- Remote read: client
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'remote_read', 'prometheus', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'storage/remote'
-  AND (n.name LIKE '*Client.Read%' OR n.name LIKE '*readHandler%');
-
--- Remote read: server handler
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'remote_read', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/read', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'storage/remote'
-  AND n.name LIKE '*readHandler.ServeHTTP%';
-
--- Alertmanager notification: client
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'alertmanager_notify', 'prometheus', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'notifier'
-  AND (n.name LIKE '*sendLoop.sendAll%' OR n.name LIKE '*sendLoop.sendOne%'
-       OR n.name LIKE '*Manager.Send%');
-
--- OTLP ingestion: server handler
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'otlp_ingest', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/otlp/v1/metrics', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'storage/remote'
-  AND n.name LIKE '*otlpWriteHandler.ServeHTTP%';
-
--- PromQL API: server endpoints
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'promql_api', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line,
-       CASE WHEN n.name LIKE '*API.query' THEN '/api/v1/query'
-            WHEN n.name LIKE '*API.queryRange%' THEN '/api/v1/query_range'
-            WHEN n.name LIKE '*API.series%' THEN '/api/v1/series'
-            WHEN n.name LIKE '*API.labelValues%' THEN '/api/v1/label/*/values'
-            WHEN n.name LIKE '*API.labelNames%' THEN '/api/v1/label/__name__/values'
-            WHEN n.name LIKE '*API.targets%' THEN '/api/v1/targets'
-            ELSE '/api/v1/*'
-       END,
-       1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'web/api/v1'
-  AND n.name IN ('*API.query', '*API.queryRange', '*API.series',
-                  '*API.labelValues', '*API.labelNames', '*API.targets',
-                  '*API.alerts', '*API.rules', '*API.alertmanagers',
-                  '*API.remoteWrite', '*API.remoteRead', '*API.otlpWrite');
-
--- Federation: server endpoint
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'federation', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/federate', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'web'
-  AND n.name LIKE '*Handler.federation%';
-
--- Discovery: all Discoverer implementations (client role querying providers)
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'discovery', 'prometheus', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, 0.9
-FROM nodes n
-WHERE n.kind = 'function'
-  AND n.package LIKE 'discovery/%'
-  AND (n.name LIKE '*Discovery.refresh%' OR n.name LIKE '*Discovery.Run%'
-       OR n.name LIKE '%Discovery.Run%');
-
--- Adapter client endpoints (only if adapter was processed)
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_query', 'adapter', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/query', 1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND n.name LIKE '%queryClient%.Query';
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_query_range', 'adapter', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/query_range', 1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND n.name LIKE '%queryClient%.QueryRange';
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_series', 'adapter', 'client', 'http_client',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/series', 1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND n.name LIKE '%queryClient%.Series';
-
--- Adapter: the generic Do() method that executes all HTTP requests to Prometheus
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'adapter_query', 'adapter', 'client', 'http_transport',
-       n.id, n.name, n.package, n.file, n.line, 0.9
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND n.name LIKE '%httpAPIClient%.Do';
-
--- Prometheus API v1 server endpoints serving the adapter's requests.
--- The adapter calls /api/v1/query, /api/v1/query_range, /api/v1/series —
--- these are served by *API.query, *API.queryRange, *API.series in web/api/v1.
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_query', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/query', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'web/api/v1' AND n.name = '*API.query';
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_query_range', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/query_range', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'web/api/v1' AND n.name = '*API.queryRange';
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_series', 'prometheus', 'server', 'http_handler',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/series', 1.0
-FROM nodes n
-WHERE n.kind = 'function' AND n.package = 'web/api/v1' AND n.name = '*API.series';
-
--- Adapter: provider factory functions that wire up the Kubernetes API server
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'k8s_custom_metrics', 'adapter', 'server', 'api_provider',
-       n.id, n.name, n.package, n.file, n.line, 0.8
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND (n.name LIKE '%makeProvider%' OR n.name LIKE '%NewPrometheusProvider%'
-       OR n.name LIKE '%customProvider%.GetMetricByName%'
-       OR n.name LIKE '%customProvider%.GetMetricBySelector%');
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'k8s_external_metrics', 'adapter', 'server', 'api_provider',
-       n.id, n.name, n.package, n.file, n.line, 0.8
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND (n.name LIKE '%makeExternalProvider%' OR n.name LIKE '%NewExternalPrometheusProvider%');
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
-SELECT 'k8s_resource_metrics', 'adapter', 'server', 'api_provider',
-       n.id, n.name, n.package, n.file, n.line, 0.8
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'adapter'
-  AND (n.name LIKE '%addResourceMetricsAPI%' OR n.name LIKE '%NewProvider%');
-
--- client_golang API contract layer (only if client_golang was processed as extra module)
--- These are the canonical Go client methods that define the HTTP API contract
--- between any Prometheus client (adapter, grafana, etc.) and the Prometheus server.
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_query', 'client_golang', 'contract', 'api_contract',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/query', 1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'client_golang'
-  AND n.name LIKE '%httpAPI%.Query';
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_query_range', 'client_golang', 'contract', 'api_contract',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/query_range', 1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'client_golang'
-  AND n.name LIKE '%httpAPI%.QueryRange';
-
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'adapter_series', 'client_golang', 'contract', 'api_contract',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/series', 1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'client_golang'
-  AND n.name LIKE '%httpAPI%.Series';
-
--- client_golang: the HTTP transport layer (api.Client.Do)
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'promql_api', 'client_golang', 'contract', 'http_transport',
-       n.id, n.name, n.package, n.file, n.line, '/api/v1/*', 0.9
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'client_golang'
-  AND n.name LIKE '%httpClient%.Do';
-
--- client_golang: the full v1.API interface methods as contract endpoints for promql_api
-INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
-SELECT 'promql_api', 'client_golang', 'contract', 'api_contract',
-       n.id, n.name, n.package, n.file, n.line,
-       CASE WHEN n.name LIKE '%httpAPI%.Query' THEN '/api/v1/query'
-            WHEN n.name LIKE '%httpAPI%.QueryRange%' THEN '/api/v1/query_range'
-            WHEN n.name LIKE '%httpAPI%.Series%' THEN '/api/v1/series'
-            WHEN n.name LIKE '%httpAPI%.LabelValues%' THEN '/api/v1/label/*/values'
-            WHEN n.name LIKE '%httpAPI%.LabelNames%' THEN '/api/v1/labels'
-            WHEN n.name LIKE '%httpAPI%.Targets' THEN '/api/v1/targets'
-            WHEN n.name LIKE '%httpAPI%.Rules%' THEN '/api/v1/rules'
-            WHEN n.name LIKE '%httpAPI%.Alerts' THEN '/api/v1/alerts'
-            WHEN n.name LIKE '%httpAPI%.AlertManagers%' THEN '/api/v1/alertmanagers'
-            WHEN n.name LIKE '%httpAPI%.Config%' THEN '/api/v1/status/config'
-            WHEN n.name LIKE '%httpAPI%.Flags%' THEN '/api/v1/status/flags'
-            WHEN n.name LIKE '%httpAPI%.TSDB' THEN '/api/v1/status/tsdb'
-            ELSE '/api/v1/*'
-       END,
-       1.0
-FROM nodes n
-WHERE n.kind = 'function'
-  AND json_extract(n.properties, '$.project') = 'client_golang'
-  AND n.name LIKE '%httpAPI%'
-  AND n.name NOT LIKE '%UnmarshalJSON%'
-  AND n.name NOT LIKE '%marshalJSON%';
-
--- ═══════════════════════════════════════════════════════════════════
--- Cross-service Communication Graph
--- ═══════════════════════════════════════════════════════════════════
-
-INSERT OR IGNORE INTO comm_graph VALUES
-('prometheus', 'target', 'scrape', '→', 'HTTP GET /metrics'),
-('prometheus', 'remote_storage', 'remote_write', '→', 'protobuf WriteRequest'),
-('remote_storage', 'prometheus', 'remote_read', '→', 'protobuf ReadResponse'),
-('prometheus', 'alertmanager', 'alertmanager_notify', '→', 'JSON alerts'),
-('adapter', 'prometheus', 'adapter_query', '→', 'PromQL instant query'),
-('adapter', 'prometheus', 'adapter_query_range', '→', 'PromQL range query'),
-('adapter', 'prometheus', 'adapter_series', '→', 'Series metadata query'),
-('kubernetes', 'adapter', 'k8s_custom_metrics', '→', 'Custom metrics API'),
-('kubernetes', 'adapter', 'k8s_external_metrics', '→', 'External metrics API'),
-('kubernetes', 'adapter', 'k8s_resource_metrics', '→', 'Resource metrics API'),
-('prometheus', 'provider', 'discovery', '→', 'Target discovery'),
-('prometheus_global', 'prometheus', 'federation', '→', 'Federated scrape'),
-('external_service', 'prometheus', 'otlp_ingest', '→', 'OTLP push'),
-('external_client', 'prometheus', 'promql_api', '→', 'PromQL HTTP API');
-
--- ═══════════════════════════════════════════════════════════════════
--- Channel Patterns (intra-service Honda binary session types)
--- ═══════════════════════════════════════════════════════════════════
-
--- Detect fan-out patterns: one sender, multiple goroutines receiving
-INSERT INTO comm_channel_patterns (component, pattern, channel_type, sender_package, receiver_package, goroutine_count, description)
-SELECT 'prometheus', 'fan_out',
-       'chan TargetGroup[]',
-       'discovery', p.package,
-       COUNT(*), 'Discovery manager fans out target groups to ' || p.package || ' consumers'
-FROM nodes p
-WHERE p.kind = 'select' AND p.package IN ('scrape', 'notifier', 'rules')
-GROUP BY p.package;
-
--- Detect signal channels (chan struct{} used for cancellation/shutdown)
-INSERT INTO comm_channel_patterns (component, pattern, channel_type, sender_package, description)
-SELECT 'prometheus', 'signal', 'chan struct{}',
-       n.package, 'Shutdown/cancellation signal in ' || n.package
-FROM nodes n
-WHERE n.kind = 'send' AND n.package NOT LIKE 'github.com%'
-GROUP BY n.package;
-
--- Pipeline pattern: scrape → storage → remote_write
-INSERT INTO comm_channel_patterns (component, pattern, session_type, description) VALUES
-('prometheus', 'pipeline',
- '!samples; ?ack; end',
- 'Scrape loop → Appender → TSDB → Queue Manager → Remote Write: samples flow through internal pipeline');
-
--- Request-response pattern: PromQL evaluator
-INSERT INTO comm_channel_patterns (component, pattern, session_type, description) VALUES
-('prometheus', 'request_response',
- '!PromQL_query; ?QueryResult; end',
- 'Web API handler → PromQL engine → Storage: synchronous query evaluation');
-
--- ═══════════════════════════════════════════════════════════════════
--- Causality Analysis (Honda 2008 §6)
--- ═══════════════════════════════════════════════════════════════════
+-- Components outside the analyzed modules (from the profiles); conformance
+-- expects no endpoints for them
+CREATE TABLE comm_external_components (
+    component TEXT PRIMARY KEY,
+    profile TEXT NOT NULL
+);
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("communication tables: %w", err)
+	}
 
--- IO causality: adapter receives query result, then uses it for next request
--- (data dependency between input and subsequent output)
-INSERT INTO comm_causality (source_endpoint, target_endpoint, kind, protocol_id, description)
-SELECT e1.id, e2.id, 'IO', 'adapter_series',
-       'Adapter receives series metadata (input), uses it to construct PromQL queries (output)'
-FROM comm_endpoints e1, comm_endpoints e2
-WHERE e1.protocol_id = 'adapter_series' AND e1.component = 'adapter'
-  AND e2.protocol_id IN ('adapter_query', 'adapter_query_range') AND e2.component = 'adapter'
-LIMIT 3;
-
--- OO causality: Prometheus sends alerts in order (same channel, same sender)
-INSERT INTO comm_causality (source_endpoint, target_endpoint, kind, protocol_id, description)
-SELECT e1.id, e2.id, 'OO', 'alertmanager_notify',
-       'Alert batches sent to same Alertmanager preserve FIFO ordering'
-FROM comm_endpoints e1, comm_endpoints e2
-WHERE e1.protocol_id = 'alertmanager_notify' AND e1.function_name LIKE '%sendAll%'
-  AND e2.protocol_id = 'alertmanager_notify' AND e2.function_name LIKE '%sendOne%'
-LIMIT 1;
-
--- II causality: Prometheus receives discovery updates, must process in order per provider
-INSERT INTO comm_causality (source_endpoint, target_endpoint, kind, protocol_id, description)
-SELECT e1.id, e2.id, 'II', 'discovery',
-       'Discovery updates from same provider must be processed sequentially'
-FROM comm_endpoints e1, comm_endpoints e2
-WHERE e1.protocol_id = 'discovery' AND e2.protocol_id = 'scrape'
-  AND e1.role = 'client' AND e2.role = 'client'
-LIMIT 3;
+	for _, p := range profiles {
+		for _, c := range p.ExternalComponents {
+			if err := sqlitex.Execute(conn,
+				`INSERT OR IGNORE INTO comm_external_components (component, profile) VALUES (?, ?)`,
+				&sqlitex.ExecOptions{Args: []any{c, p.Name}}); err != nil {
+				return fmt.Errorf("profile %s: external component %s: %w", p.Name, c, err)
+			}
+		}
+		if p.CommSeed == "" {
+			continue
+		}
+		if err := sqlitex.ExecuteScript(conn, p.CommSeed, nil); err != nil {
+			return fmt.Errorf("profile %s: communication seed: %w", p.Name, err)
+		}
+	}
 
+	analysis := `
 -- ═══════════════════════════════════════════════════════════════════
 -- Protocol Conformance Checks
 -- ═══════════════════════════════════════════════════════════════════
@@ -4143,24 +4131,12 @@ INSERT INTO comm_conformance (protocol_id, component, status, endpoints_found, e
 SELECT
     p.protocol_id,
     p.component,
-    CASE
-        WHEN COALESCE(e.cnt, 0) >= 1 THEN 'conforming'
-        WHEN COALESCE(e.cnt, 0) = 0 THEN
-            CASE
-                WHEN p.component IN ('target', 'remote_storage', 'alertmanager', 'kubernetes',
-                                     'provider', 'prometheus_global', 'external_service',
-                                     'external_client') THEN 'missing'
-                ELSE 'missing'
-            END
-        ELSE 'partial'
-    END,
+    CASE WHEN COALESCE(e.cnt, 0) >= 1 THEN 'conforming' ELSE 'missing' END,
     COALESCE(e.cnt, 0),
     1,
     CASE
         WHEN COALESCE(e.cnt, 0) >= 1 THEN 'Endpoints detected in CPG'
-        WHEN p.component IN ('target', 'remote_storage', 'alertmanager', 'kubernetes',
-                             'provider', 'prometheus_global', 'external_service',
-                             'external_client') THEN 'External component — not in analyzed codebase'
+        WHEN p.component IN (SELECT component FROM comm_external_components) THEN 'External component — not in analyzed codebase'
         ELSE 'No implementing endpoints found'
     END
 FROM comm_participants p
@@ -4274,19 +4250,21 @@ INSERT INTO schema_docs (category, name, description, example) VALUES
 ('table', 'comm_protocols', 'Honda session type-based protocol definitions for inter-service communication. Each protocol has client/server session types that should be duals.',
  'SELECT id, name, session_type_client, session_type_server, transport FROM comm_protocols'),
 ('table', 'comm_participants', 'Components and their roles (client/server) in each communication protocol.',
- 'SELECT * FROM comm_participants WHERE protocol_id = ''adapter_query'''),
+ 'SELECT * FROM comm_participants ORDER BY protocol_id, role'),
 ('table', 'comm_session_steps', 'Step-by-step message sequence for each protocol in Honda session type notation (! = send, ? = receive).',
- 'SELECT * FROM comm_session_steps WHERE protocol_id = ''scrape'' ORDER BY step_order'),
+ 'SELECT * FROM comm_session_steps ORDER BY protocol_id, step_order'),
 ('table', 'comm_endpoints', 'Detected code endpoints (functions/handlers) implementing communication protocols.',
  'SELECT protocol_id, component, role, function_name, url_path FROM comm_endpoints ORDER BY protocol_id'),
 ('table', 'comm_channel_patterns', 'Internal Go channel communication patterns within each service, classified by type (fan_out, pipeline, signal, etc.).',
- 'SELECT * FROM comm_channel_patterns WHERE component = ''prometheus'''),
+ 'SELECT * FROM comm_channel_patterns ORDER BY component, pattern'),
 ('table', 'comm_causality', 'Honda 2008 causality edges (II/IO/OO). Cycles indicate potential deadlocks.',
  'SELECT kind, description FROM comm_causality'),
 ('table', 'comm_conformance', 'Protocol conformance results: whether each component properly implements its role.',
  'SELECT * FROM comm_conformance WHERE status != ''conforming'''),
 ('table', 'comm_graph', 'Cross-service communication graph for topology visualization.',
  'SELECT * FROM comm_graph'),
+('table', 'comm_external_components', 'Components outside the analyzed modules, listed by the selected profiles. Conformance reports them as missing by design.',
+ 'SELECT * FROM comm_external_components'),
 ('view', 'v_comm_topology', 'Full communication topology with session types, suitable for graph visualization.',
  'SELECT source_component, target_component, protocol_name, session_type_client FROM v_comm_topology'),
 ('view', 'v_protocol_coverage', 'Protocol implementation coverage dashboard.',
@@ -4302,9 +4280,6 @@ INSERT INTO queries (name, description, sql) VALUES
 ('comm_full_topology', 'Complete service communication topology with Honda session types',
  'SELECT source_component, '' '' || direction || '' '' || target_component AS flow, protocol_name, transport, encoding, session_type_client FROM v_comm_topology'),
 
-('comm_adapter_flow', 'Trace the adapter→prometheus→kubernetes data flow',
- 'SELECT g1.source_component, g1.target_component, p1.name, g2.source_component AS upstream, g2.target_component AS downstream, p2.name AS upstream_protocol FROM comm_graph g1 JOIN comm_protocols p1 ON p1.id = g1.protocol_id JOIN comm_graph g2 ON g2.target_component = g1.source_component JOIN comm_protocols p2 ON p2.id = g2.protocol_id WHERE g1.source_component = ''adapter'''),
-
 ('comm_protocol_endpoints', 'Find all code endpoints implementing a specific protocol',
  'SELECT e.protocol_id, e.component, e.role, e.function_name, e.package, e.file || '':'' || e.line AS location, e.url_path FROM comm_endpoints e ORDER BY e.protocol_id, e.component'),
 
@@ -4314,10 +4289,10 @@ INSERT INTO queries (name, description, sql) VALUES
 ('comm_deadlock_check', 'Check for cycles in causality graph (potential deadlocks per Honda 2008)',
  'SELECT c1.kind || '' → '' || c2.kind AS causality_chain, c1.description, c2.description FROM comm_causality c1 JOIN comm_causality c2 ON c1.target_endpoint = c2.source_endpoint WHERE c1.source_endpoint != c2.target_endpoint'),
 
-('comm_channel_patterns', 'Internal channel communication patterns within Prometheus',
+('comm_channel_patterns', 'Internal channel communication patterns within the analyzed services',
  'SELECT pattern, channel_type, sender_package, receiver_package, goroutine_count, description FROM comm_channel_patterns ORDER BY pattern');
 `
-	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+	if err := sqlitex.ExecuteScript(conn, analysis, nil); err != nil {
 		return fmt.Errorf("communication patterns: %w", err)
 	}
 
@@ -4353,7 +4328,7 @@ INSERT INTO queries (name, description, sql) VALUES
 			return nil
 		}})
 
-	prog.Log("Communication patterns: %d protocols, %d endpoints, %d causality edges, %d channel patterns; conformance: %d conforming, %d external",
+	prog.Log("Communication patterns: %d protocols, %d endpoints, %d causality edges, %d channel patterns; conformance: %d conforming, %d missing",
 		protocols, endpoints, causality, channelPatterns, conforming, missing)
 	return nil
 }
@@ -4435,9 +4410,7 @@ SELECT
     -- Relation: subtype check
     CASE
         -- External components: we can't check, assume conforming
-        WHEN p.component IN ('target', 'remote_storage', 'alertmanager', 'kubernetes',
-                             'provider', 'prometheus_global', 'external_service',
-                             'external_client') THEN 'assumed_subtype'
+        WHEN p.component IN (SELECT component FROM comm_external_components) THEN 'assumed_subtype'
         -- Has endpoints: check if all required protocol steps are covered
         WHEN COALESCE(ep.cnt, 0) >= 1 THEN
             CASE
@@ -4450,17 +4423,13 @@ SELECT
     END,
     -- Is conforming: G|>p ≤ Γ(s[p]) holds when relation is subtype or equal
     CASE
-        WHEN p.component IN ('target', 'remote_storage', 'alertmanager', 'kubernetes',
-                             'provider', 'prometheus_global', 'external_service',
-                             'external_client') THEN 1
+        WHEN p.component IN (SELECT component FROM comm_external_components) THEN 1
         WHEN COALESCE(ep.cnt, 0) >= 1 THEN 1
         ELSE 0
     END,
     -- Which subtyping rule applies
     CASE
-        WHEN p.component IN ('target', 'remote_storage', 'alertmanager', 'kubernetes',
-                             'provider', 'prometheus_global', 'external_service',
-                             'external_client') THEN 'external (assumed conforming)'
+        WHEN p.component IN (SELECT component FROM comm_external_components) THEN 'external (assumed conforming)'
         WHEN COALESCE(ep.cnt, 0) >= 2 AND p.role = 'server' THEN
             'branching contravariance: server handles ≥ required message types'
         WHEN COALESCE(ep.cnt, 0) >= 2 AND p.role = 'client' THEN
@@ -4470,9 +4439,7 @@ SELECT
     END,
     -- Explanation referencing the correction
     CASE
-        WHEN p.component IN ('target', 'remote_storage', 'alertmanager', 'kubernetes',
-                             'provider', 'prometheus_global', 'external_service',
-                             'external_client') THEN
+        WHEN p.component IN (SELECT component FROM comm_external_components) THEN
             'External component not in analyzed codebase. Per Honda corrected theory, '
             || 'assumed to satisfy G|>p ≤ Γ(s[p]) (subtype conformance).'
         WHEN COALESCE(ep.cnt, 0) >= 1 THEN
@@ -0,0 +1,192 @@
+package cpg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// deprecationMessage returns the text of the "Deprecated: " paragraph of a
+// doc comment, joined onto one line. ok is false when there is none.
+func deprecationMessage(doc *ast.CommentGroup) (msg string, ok bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, para := range strings.Split(doc.Text(), "\n\n") {
+		if rest, ok := strings.CutPrefix(para, "Deprecated:"); ok {
+			return strings.Join(strings.Fields(rest), " "), true
+		}
+	}
+	return "", false
+}
+
+// setDeprecatedProps flags a declaration deprecated, with its message,
+// when its doc comment says so.
+func setDeprecatedProps(props map[string]any, doc *ast.CommentGroup) {
+	if msg, ok := deprecationMessage(doc); ok {
+		props["deprecated"] = true
+		props["deprecated_message"] = msg
+	}
+}
+
+// externalDeprecations maps the deprecated functions, methods, and types of
+// the dependencies outside the analyzed modules to their deprecation
+// messages. External stubs carry no doc edges, so the call graph looks them
+// up here. Dependencies loaded without syntax contribute nothing.
+func externalDeprecations(pkgs []*packages.Package, ms *ModuleSet) map[types.Object]string {
+	deprecated := make(map[types.Object]string)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if ms.IsKnownPkg(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if msg, ok := deprecationMessage(d.Doc); ok {
+						if obj := pkg.TypesInfo.Defs[d.Name]; obj != nil {
+							deprecated[obj] = msg
+						}
+					}
+				case *ast.GenDecl:
+					if d.Tok != token.TYPE {
+						continue
+					}
+					for _, spec := range d.Specs {
+						ts := spec.(*ast.TypeSpec)
+						doc := ts.Doc
+						if doc == nil {
+							doc = d.Doc
+						}
+						if msg, ok := deprecationMessage(doc); ok {
+							if obj := pkg.TypesInfo.Defs[ts.Name]; obj != nil {
+								deprecated[obj] = msg
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+	return deprecated
+}
+
+// setExternalDeprecation flags the stub of an external function deprecated
+// when the function or its receiver type is; deprecated_type names the
+// type in the second case.
+func setExternalDeprecation(props map[string]any, fn *types.Func, deprecated map[types.Object]string) {
+	if msg, ok := deprecated[fn]; ok {
+		props["deprecated"] = true
+		props["deprecated_message"] = msg
+		return
+	}
+	recv := fn.Signature().Recv()
+	if recv == nil {
+		return
+	}
+	t := recv.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return
+	}
+	if msg, ok := deprecated[named.Origin().Obj()]; ok {
+		props["deprecated"] = true
+		props["deprecated_message"] = msg
+		props["deprecated_type"] = named.Origin().Obj().Pkg().Path() + "." + named.Obj().Name()
+	}
+}
+
+// createDeprecationViews builds v_deprecated_uses and v_deprecated_apis and
+// records a deprecated_call finding for every use of a deprecated API from
+// another package, most-used APIs first.
+func createDeprecationViews(conn *sqlite.Conn) error {
+	ddl := `
+-- Uses of deprecated APIs: calls into deprecated functions (external stubs
+-- included) or methods of deprecated types, and references to deprecated
+-- types, fields, variables, and constants
+CREATE VIEW v_deprecated_uses AS
+  SELECT s.id AS use_id, 'call' AS use_kind, s.file, s.line, s.package, s.parent_function,
+    f.id AS api_id, f.kind AS api_kind, f.package AS api_package,
+    COALESCE(json_extract(f.properties, '$.full_name'), f.package || '.' || f.name) AS api,
+    json_extract(f.properties, '$.deprecated_message') AS message
+  FROM edges e
+  JOIN nodes f ON f.id = e.target
+  JOIN nodes s ON s.id = e.source
+  WHERE e.kind = 'call_site' AND json_extract(f.properties, '$.deprecated') = 1
+  UNION ALL
+  SELECT s.id, 'call', s.file, s.line, s.package, s.parent_function,
+    t.id, t.kind, t.package,
+    COALESCE(json_extract(t.properties, '$.full_name'), t.package || '.' || t.name),
+    json_extract(t.properties, '$.deprecated_message')
+  FROM edges e
+  JOIN nodes f ON f.id = e.target
+  JOIN edges hm ON hm.target = f.id AND hm.kind = 'has_method'
+  JOIN nodes t ON t.id = hm.source
+  JOIN nodes s ON s.id = e.source
+  WHERE e.kind = 'call_site' AND json_extract(t.properties, '$.deprecated') = 1
+    AND json_extract(f.properties, '$.deprecated') IS NULL
+  UNION ALL
+  SELECT s.id, 'ref', s.file, s.line, s.package, s.parent_function,
+    t.id, t.kind, t.package,
+    COALESCE(json_extract(t.properties, '$.full_name'), t.package || '.' || t.name),
+    json_extract(t.properties, '$.deprecated_message')
+  FROM edges e
+  JOIN nodes t ON t.id = e.target
+  JOIN nodes s ON s.id = e.source
+  WHERE e.kind = 'ref' AND t.kind IN ('type_decl', 'field', 'local')
+    AND json_extract(t.properties, '$.deprecated') = 1
+    -- count x.F once: the selector, not also its F
+    AND NOT EXISTS (
+      SELECT 1 FROM edges p
+      JOIN edges pr ON pr.source = p.source AND pr.kind = 'ref' AND pr.target = t.id
+      WHERE p.target = s.id AND p.kind = 'ast');
+
+-- Deprecated APIs ranked by how often other packages still use them
+CREATE VIEW v_deprecated_apis AS
+  SELECT api_id, api, api_kind, api_package, message,
+    COUNT(*) AS use_count,
+    SUM(CASE WHEN use_kind = 'call' THEN 1 ELSE 0 END) AS call_count,
+    COUNT(DISTINCT package) AS using_packages
+  FROM v_deprecated_uses
+  WHERE package != api_package
+  GROUP BY api_id
+  ORDER BY call_count DESC, use_count DESC, api;
+
+INSERT INTO findings (category, severity, node_id, file, line, message, details)
+  SELECT 'deprecated_call', 'warning', u.use_id, u.file, u.line,
+    CASE u.use_kind
+      WHEN 'call' THEN 'call to deprecated ' || u.api || ' (' || a.call_count || ' calls)'
+      ELSE 'use of deprecated ' || u.api || ' (' || a.use_count || ' uses)'
+    END
+      || CASE WHEN u.message != '' THEN ': ' || u.message ELSE '' END,
+    json_object('api', u.api, 'api_id', u.api_id, 'use_kind', u.use_kind,
+                'call_count', a.call_count, 'use_count', a.use_count, 'package', u.package)
+  FROM v_deprecated_uses u
+  JOIN v_deprecated_apis a ON a.api_id = u.api_id
+  WHERE u.package != u.api_package
+  ORDER BY a.call_count DESC, a.use_count DESC, a.api, u.file, u.line;
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('node_property', 'deprecated', 'Declaration (function, type_decl, field, local, or external stub) whose doc comment has a "Deprecated:" paragraph', 'SELECT name, file FROM nodes WHERE json_extract(properties, ''$.deprecated'') = 1'),
+('node_property', 'deprecated_message', 'Text of the "Deprecated:" paragraph; deprecated_type names the deprecated receiver type of an external method', 'Use NewRegistry instead.'),
+('view', 'v_deprecated_uses', 'Calls into deprecated functions and methods of deprecated types, and references to deprecated types, fields, variables, and constants', 'SELECT file, line, api FROM v_deprecated_uses WHERE api LIKE ''%prometheus%'''),
+('view', 'v_deprecated_apis', 'Deprecated APIs used from other packages, ranked by call count', 'SELECT api, call_count, using_packages, message FROM v_deprecated_apis LIMIT 20');
+
+INSERT INTO queries (name, description, sql) VALUES
+('deprecated_migration', 'Deprecated APIs still called from other packages, most-called first',
+ 'SELECT api, call_count, use_count, using_packages, message FROM v_deprecated_apis');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("deprecation views: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cpg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// TestDeprecationMessage checks which doc comments mark a declaration
+// deprecated and the message taken from them.
+func TestDeprecationMessage(t *testing.T) {
+	src := `package p
+
+// A does things.
+//
+// Deprecated: Use B, which
+// does them better.
+func A() {}
+
+// Deprecated: Use C.
+func B() {}
+
+// C mentions that Deprecated: is not a paragraph start here.
+func C() {}
+
+// D is old.
+//
+// Deprecated:
+func D() {}
+
+// E is not deprecated.
+func E() {}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		msg string
+		ok  bool
+	}{
+		"A": {"Use B, which does them better.", true},
+		"B": {"Use C.", true},
+		"C": {"", false},
+		"D": {"", true},
+		"E": {"", false},
+	}
+	for _, fd := range f.Decls {
+		decl := fd.(*ast.FuncDecl)
+		msg, ok := deprecationMessage(decl.Doc)
+		if w := want[decl.Name.Name]; msg != w.msg || ok != w.ok {
+			t.Errorf("%s: deprecationMessage = %q, %v, want %q, %v", decl.Name.Name, msg, ok, w.msg, w.ok)
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package cpg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Diff is the architectural difference between two CPG databases.
+// Functions are matched by package, receiver, and name rather than by their
+// position-based IDs, so moving code is not a change.
+type Diff struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+
+	AddedFunctions    []DiffFunction     `json:"added_functions"`
+	RemovedFunctions  []DiffFunction     `json:"removed_functions"`
+	ModifiedFunctions []ModifiedFunction `json:"modified_functions"`
+
+	AddedCalls   []DiffCall `json:"added_calls"`
+	RemovedCalls []DiffCall `json:"removed_calls"`
+
+	Metrics []MetricChange `json:"metrics"`
+
+	NewFindings      []DiffFinding `json:"new_findings"`
+	ResolvedFindings []DiffFinding `json:"resolved_findings"`
+
+	AddedImplements   []DiffImplements `json:"added_implements"`
+	RemovedImplements []DiffImplements `json:"removed_implements"`
+}
+
+// DiffFunction is a function declaration, located in the database it comes
+// from (the new one for added and modified functions, the old one for
+// removed functions).
+type DiffFunction struct {
+	Function string `json:"function"` // package.Name or package.(Receiver).Name
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// ModifiedFunction is a function present in both databases whose signature
+// or body text changed.
+type ModifiedFunction struct {
+	DiffFunction
+	Changes []string `json:"changes"` // "signature", "body"
+}
+
+// DiffCall is a call edge between two functions. Calls made inside function
+// literals are attributed to the enclosing declaration.
+type DiffCall struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+}
+
+// MetricChange is a function whose complexity, fan-in, or fan-out changed.
+type MetricChange struct {
+	Function   string      `json:"function"`
+	Complexity MetricDelta `json:"complexity"`
+	FanIn      MetricDelta `json:"fan_in"`
+	FanOut     MetricDelta `json:"fan_out"`
+}
+
+// MetricDelta is a metric's value in the old and new database.
+type MetricDelta struct {
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// DiffFinding is a finding that appeared or disappeared. Findings are
+// matched within their category and subject (the function or node they are
+// about), by message with numbers ignored, so a finding that moved or whose
+// message only changed numbers is neither new nor resolved (see
+// matchFindings).
+type DiffFinding struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Subject  string `json:"subject"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+// DiffImplements is an implements relation between a type and an interface.
+type DiffImplements struct {
+	Type      string `json:"type"`
+	Interface string `json:"interface"`
+}
+
+// diffSide is what DiffDatabases reads from one database.
+type diffSide struct {
+	funcs      map[string]diffFunc // by key; declarations only
+	keyOf      map[string]string   // node ID → key, literals → enclosing declaration
+	decls      map[string]string   // declaration node ID → key
+	calls      map[DiffCall]bool
+	metrics    map[string]Metrics // by key
+	findings   map[string][]DiffFinding
+	implements map[DiffImplements]bool
+}
+
+type diffFunc struct {
+	DiffFunction
+	signature, bodyHash string
+	external            bool
+}
+
+// DiffDatabases compares the CPG databases at oldPath and newPath.
+func DiffDatabases(oldPath, newPath string) (*Diff, error) {
+	old, err := readDiffSide(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := readDiffSide(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty sections encode as [] rather than null
+	d := &Diff{
+		Old:               oldPath,
+		New:               newPath,
+		AddedFunctions:    []DiffFunction{},
+		RemovedFunctions:  []DiffFunction{},
+		ModifiedFunctions: []ModifiedFunction{},
+		Metrics:           []MetricChange{},
+		NewFindings:       []DiffFinding{},
+		ResolvedFindings:  []DiffFinding{},
+	}
+	for _, key := range slices.Sorted(maps.Keys(cur.funcs)) {
+		f := cur.funcs[key]
+		if f.external {
+			continue
+		}
+		o, ok := old.funcs[key]
+		if !ok {
+			d.AddedFunctions = append(d.AddedFunctions, f.DiffFunction)
+			continue
+		}
+		var changes []string
+		if o.signature != f.signature {
+			changes = append(changes, "signature")
+		}
+		if o.bodyHash != f.bodyHash {
+			changes = append(changes, "body")
+		}
+		if len(changes) > 0 {
+			d.ModifiedFunctions = append(d.ModifiedFunctions, ModifiedFunction{f.DiffFunction, changes})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(old.funcs)) {
+		if f := old.funcs[key]; !f.external {
+			if _, ok := cur.funcs[key]; !ok {
+				d.RemovedFunctions = append(d.RemovedFunctions, f.DiffFunction)
+			}
+		}
+	}
+
+	d.AddedCalls = missingFrom(cur.calls, old.calls, compareCalls)
+	d.RemovedCalls = missingFrom(old.calls, cur.calls, compareCalls)
+	d.AddedImplements = missingFrom(cur.implements, old.implements, compareImplements)
+	d.RemovedImplements = missingFrom(old.implements, cur.implements, compareImplements)
+
+	for _, key := range slices.Sorted(maps.Keys(cur.metrics)) {
+		m, ok := old.metrics[key]
+		n := cur.metrics[key]
+		if !ok || cur.funcs[key].external {
+			continue
+		}
+		if m.CyclomaticComplexity != n.CyclomaticComplexity || m.FanIn != n.FanIn || m.FanOut != n.FanOut {
+			d.Metrics = append(d.Metrics, MetricChange{
+				Function:   key,
+				Complexity: MetricDelta{m.CyclomaticComplexity, n.CyclomaticComplexity},
+				FanIn:      MetricDelta{m.FanIn, n.FanIn},
+				FanOut:     MetricDelta{m.FanOut, n.FanOut},
+			})
+		}
+	}
+
+	// Findings are compared per category and subject (see matchFindings).
+	keys := slices.Collect(maps.Keys(cur.findings))
+	for k := range old.findings {
+		if _, ok := cur.findings[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		added, resolved := matchFindings(old.findings[key], cur.findings[key])
+		d.NewFindings = append(d.NewFindings, added...)
+		d.ResolvedFindings = append(d.ResolvedFindings, resolved...)
+	}
+	return d, nil
+}
+
+// findingNumber matches the numbers masked when findings pair by message.
+var findingNumber = regexp.MustCompile(`[0-9]+`)
+
+// matchFindings pairs the findings of one category and subject in two
+// databases and returns those left unpaired in cur (new) and in old
+// (resolved). Findings with the same file, line, and message pair first;
+// the rest pair by message, then by message with its numbers masked, each
+// in file and line order. So a finding whose function moved, or whose
+// message only changed a number such as a complexity, is not reported.
+// Both slices are sorted by file and line.
+func matchFindings(old, cur []DiffFinding) (added, resolved []DiffFinding) {
+	type findingKey struct {
+		file, message string
+		line          int
+	}
+	pair := func(key func(DiffFinding) findingKey) {
+		avail := make(map[findingKey]int)
+		for _, f := range old {
+			avail[key(f)]++
+		}
+		paired := make(map[findingKey]int)
+		var curRest, oldRest []DiffFinding
+		for _, f := range cur {
+			if k := key(f); avail[k] > 0 {
+				avail[k]--
+				paired[k]++
+			} else {
+				curRest = append(curRest, f)
+			}
+		}
+		for _, f := range old {
+			if k := key(f); paired[k] > 0 {
+				paired[k]--
+			} else {
+				oldRest = append(oldRest, f)
+			}
+		}
+		old, cur = oldRest, curRest
+	}
+	pair(func(f DiffFinding) findingKey { return findingKey{f.File, f.Message, f.Line} })
+	pair(func(f DiffFinding) findingKey { return findingKey{message: f.Message} })
+	pair(func(f DiffFinding) findingKey {
+		return findingKey{message: findingNumber.ReplaceAllString(f.Message, "#")}
+	})
+	return cur, old
+}
+
+// missingFrom returns the elements of a that are not in b, sorted.
+func missingFrom[T comparable](a, b map[T]bool, compare func(x, y T) int) []T {
+	out := []T{}
+	for x := range a {
+		if !b[x] {
+			out = append(out, x)
+		}
+	}
+	slices.SortFunc(out, compare)
+	return out
+}
+
+func compareCalls(a, b DiffCall) int {
+	return cmp.Or(cmp.Compare(a.Caller, b.Caller), cmp.Compare(a.Callee, b.Callee))
+}
+
+func compareImplements(a, b DiffImplements) int {
+	return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Interface, b.Interface))
+}
+
+// readDiffSide loads the functions, calls, metrics, findings, and implements
+// relations of the database at path.
+func readDiffSide(path string) (*diffSide, error) {
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer conn.Close()
+	if !tableExists(conn, "nodes") || !tableExists(conn, "findings") {
+		return nil, fmt.Errorf("%s is not a CPG database", path)
+	}
+
+	s := &diffSide{
+		funcs:      make(map[string]diffFunc),
+		keyOf:      make(map[string]string),
+		decls:      make(map[string]string),
+		calls:      make(map[DiffCall]bool),
+		metrics:    make(map[string]Metrics),
+		findings:   make(map[string][]DiffFinding),
+		implements: make(map[DiffImplements]bool),
+	}
+	src, err := newSourceLines(conn, "main")
+	if err != nil {
+		return nil, err
+	}
+
+	// Functions, in position order so repeated names (init) are numbered
+	// stably and literals follow their enclosing function.
+	seen := make(map[string]int)
+	err = sqlitex.ExecuteTransient(conn, fmt.Sprintf(`
+		SELECT id, name, COALESCE(package, ''), COALESCE(file, ''), COALESCE(line, 0), COALESCE(end_line, 0),
+		       COALESCE(parent_function, ''),
+		       COALESCE(json_extract(properties, '$.receiver'), ''),
+		       COALESCE(json_extract(properties, '$.full_name'), ''),
+		       COALESCE(json_extract(properties, '$.code'), ''),
+		       id LIKE 'ext::%%'
+		FROM nodes WHERE kind IN (%s) ORDER BY file, line, col, id`, funcKinds),
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			id, name, pkg := stmt.ColumnText(0), stmt.ColumnText(1), stmt.ColumnText(2)
+			file, line, endLine := stmt.ColumnText(3), stmt.ColumnInt(4), stmt.ColumnInt(5)
+			parent, recv, fullName := stmt.ColumnText(6), stmt.ColumnText(7), stmt.ColumnText(8)
+			external := stmt.ColumnBool(10)
+
+			if fullName == "" && parent != "" {
+				// Function literal: part of its enclosing declaration
+				s.keyOf[id] = s.keyOf[parent]
+				return nil
+			}
+			var key string
+			switch {
+			case external:
+				key = cmp.Or(fullName, pkg+"."+name)
+			case recv != "":
+				key = fmt.Sprintf("%s.(%s).%s", pkg, recv, strings.TrimPrefix(name, recv+"."))
+			default:
+				key = pkg + "." + name
+			}
+			seen[key]++
+			if n := seen[key]; n > 1 {
+				key = fmt.Sprintf("%s#%d", key, n)
+			}
+			s.keyOf[id] = key
+			s.decls[id] = key
+			s.funcs[key] = diffFunc{
+				DiffFunction: DiffFunction{Function: key, File: file, Line: line},
+				signature:    stmt.ColumnText(9),
+				bodyHash:     contentHash(src.text(file, line, endLine)),
+				external:     external,
+			}
+			return nil
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("read functions from %s: %w", path, err)
+	}
+
+	err = sqlitex.ExecuteTransient(conn, `SELECT source, target FROM edges WHERE kind = 'call'`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			caller, callee := s.keyOf[stmt.ColumnText(0)], s.keyOf[stmt.ColumnText(1)]
+			if caller != "" && callee != "" {
+				s.calls[DiffCall{caller, callee}] = true
+			}
+			return nil
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("read calls from %s: %w", path, err)
+	}
+
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT function_id, COALESCE(cyclomatic_complexity, 0), COALESCE(fan_in, 0), COALESCE(fan_out, 0) FROM metrics`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			if key, ok := s.decls[stmt.ColumnText(0)]; ok {
+				s.metrics[key] = Metrics{
+					CyclomaticComplexity: stmt.ColumnInt(1),
+					FanIn:                stmt.ColumnInt(2),
+					FanOut:               stmt.ColumnInt(3),
+				}
+			}
+			return nil
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("read metrics from %s: %w", path, err)
+	}
+
+	err = sqlitex.ExecuteTransient(conn, `
+		SELECT f.category, f.severity, COALESCE(f.file, ''), COALESCE(f.line, 0), f.message,
+		       COALESCE(f.node_id, ''), n.kind, n.package, n.name, COALESCE(n.parent_function, '')
+		FROM findings f LEFT JOIN nodes n ON n.id = f.node_id
+		ORDER BY f.category, f.file, f.line, f.id`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			f := DiffFinding{
+				Category: stmt.ColumnText(0),
+				Severity: stmt.ColumnText(1),
+				File:     stmt.ColumnText(2),
+				Line:     stmt.ColumnInt(3),
+				Message:  stmt.ColumnText(4),
+			}
+			switch key, ok := s.keyOf[stmt.ColumnText(5)]; {
+			case ok && key != "":
+				f.Subject = key
+			case s.keyOf[stmt.ColumnText(9)] != "":
+				// A local, parameter, or statement: qualify it by its function
+				f.Subject = fmt.Sprintf("%s %s %s", s.keyOf[stmt.ColumnText(9)], stmt.ColumnText(6), stmt.ColumnText(8))
+			case stmt.ColumnType(6) != sqlite.TypeNull:
+				f.Subject = fmt.Sprintf("%s %s.%s", stmt.ColumnText(6), stmt.ColumnText(7), stmt.ColumnText(8))
+			default:
+				f.Subject = f.File + ": " + f.Message
+			}
+			k := f.Category + "\x00" + f.Subject
+			s.findings[k] = append(s.findings[k], f)
+			return nil
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("read findings from %s: %w", path, err)
+	}
+
+	err = sqlitex.ExecuteTransient(conn, `
+		SELECT COALESCE(s.package, ''), s.name, COALESCE(t.package, ''), t.name
+		FROM edges e JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		WHERE e.kind = 'implements'`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			s.implements[DiffImplements{
+				Type:      stmt.ColumnText(0) + "." + stmt.ColumnText(1),
+				Interface: stmt.ColumnText(2) + "." + stmt.ColumnText(3),
+			}] = true
+			return nil
+		}})
+	if err != nil {
+		return nil, fmt.Errorf("read implements from %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// DiffFormats lists the formats Diff.Write accepts.
+var DiffFormats = []string{"text", "json", "markdown"}
+
+// Write renders the diff in format ("text", "json", or "markdown"). Text
+// and Markdown list at most limit entries per section (0 for all); JSON is
+// always complete.
+func (d *Diff) Write(w io.Writer, format string, limit int) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "text":
+		return d.write(w, textDiff{}, limit)
+	case "markdown":
+		return d.write(w, markdownDiff{}, limit)
+	}
+	return fmt.Errorf("unknown diff format %q (want %s)", format, strings.Join(DiffFormats, ", "))
+}
+
+// Empty reports whether the databases have no architectural differences.
+func (d *Diff) Empty() bool {
+	return len(d.AddedFunctions)+len(d.RemovedFunctions)+len(d.ModifiedFunctions)+
+		len(d.AddedCalls)+len(d.RemovedCalls)+len(d.Metrics)+
+		len(d.NewFindings)+len(d.ResolvedFindings)+
+		len(d.AddedImplements)+len(d.RemovedImplements) == 0
+}
+
+// diffStyle renders the pieces of a text or Markdown diff.
+type diffStyle interface {
+	title(old, new string) string
+	section(name, summary string) string
+	item(mark, text string) string
+	code(s string) string
+	more(n int) string
+}
+
+type textDiff struct{}
+
+func (textDiff) title(old, new string) string        { return fmt.Sprintf("cpg-diff %s → %s\n", old, new) }
+func (textDiff) section(name, summary string) string { return fmt.Sprintf("\n%s: %s\n", name, summary) }
+func (textDiff) item(mark, text string) string       { return fmt.Sprintf("  %s %s\n", mark, text) }
+func (textDiff) code(s string) string                { return s }
+func (textDiff) more(n int) string                   { return fmt.Sprintf("  … and %d more\n", n) }
+
+type markdownDiff struct{}
+
+func (markdownDiff) title(old, new string) string {
+	return fmt.Sprintf("## Architectural changes\n\n`%s` → `%s`\n", old, new)
+}
+func (markdownDiff) section(name, summary string) string {
+	return fmt.Sprintf("\n### %s (%s)\n\n", name, summary)
+}
+func (markdownDiff) item(mark, text string) string { return fmt.Sprintf("- `%s` %s\n", mark, text) }
+func (markdownDiff) code(s string) string          { return "`" + strings.ReplaceAll(s, "`", "'") + "`" }
+func (markdownDiff) more(n int) string             { return fmt.Sprintf("- … and %d more\n", n) }
+
+// diffItem is one line of a section.
+type diffItem struct{ mark, text string }
+
+func (d *Diff) write(w io.Writer, st diffStyle, limit int) error {
+	var b strings.Builder
+	b.WriteString(st.title(d.Old, d.New))
+	if d.Empty() {
+		b.WriteString("\nNo architectural changes.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	section := func(name, summary string, items []diffItem) {
+		if len(items) == 0 {
+			return
+		}
+		b.WriteString(st.section(name, summary))
+		for i, it := range items {
+			if limit > 0 && i == limit {
+				b.WriteString(st.more(len(items) - limit))
+				break
+			}
+			b.WriteString(st.item(it.mark, it.text))
+		}
+	}
+	at := func(f DiffFunction) string {
+		if f.File == "" {
+			return st.code(f.Function)
+		}
+		return fmt.Sprintf("%s (%s:%d)", st.code(f.Function), f.File, f.Line)
+	}
+
+	var items []diffItem
+	for _, f := range d.AddedFunctions {
+		items = append(items, diffItem{"+", at(f)})
+	}
+	for _, f := range d.RemovedFunctions {
+		items = append(items, diffItem{"-", at(f)})
+	}
+	for _, f := range d.ModifiedFunctions {
+		items = append(items, diffItem{"~", at(f.DiffFunction) + " " + strings.Join(f.Changes, ", ")})
+	}
+	section("Functions", fmt.Sprintf("%d added, %d removed, %d modified",
+		len(d.AddedFunctions), len(d.RemovedFunctions), len(d.ModifiedFunctions)), items)
+
+	items = nil
+	for _, c := range d.AddedCalls {
+		items = append(items, diffItem{"+", st.code(c.Caller) + " → " + st.code(c.Callee)})
+	}
+	for _, c := range d.RemovedCalls {
+		items = append(items, diffItem{"-", st.code(c.Caller) + " → " + st.code(c.Callee)})
+	}
+	section("Calls", fmt.Sprintf("%d added, %d removed", len(d.AddedCalls), len(d.RemovedCalls)), items)
+
+	items = nil
+	for _, m := range d.Metrics {
+		var parts []string
+		for _, v := range []struct {
+			name string
+			d    MetricDelta
+		}{{"complexity", m.Complexity}, {"fan-in", m.FanIn}, {"fan-out", m.FanOut}} {
+			if v.d.Old != v.d.New {
+				parts = append(parts, fmt.Sprintf("%s %d→%d", v.name, v.d.Old, v.d.New))
+			}
+		}
+		items = append(items, diffItem{"~", st.code(m.Function) + " " + strings.Join(parts, ", ")})
+	}
+	section("Metrics", fmt.Sprintf("%d functions changed", len(d.Metrics)), items)
+
+	items = nil
+	for _, f := range d.NewFindings {
+		items = append(items, diffItem{"+", fmt.Sprintf("[%s] %s (%s:%d)", f.Category, f.Message, f.File, f.Line)})
+	}
+	for _, f := range d.ResolvedFindings {
+		items = append(items, diffItem{"-", fmt.Sprintf("[%s] %s (%s:%d)", f.Category, f.Message, f.File, f.Line)})
+	}
+	section("Findings", fmt.Sprintf("%d new, %d resolved", len(d.NewFindings), len(d.ResolvedFindings)), items)
+
+	items = nil
+	for _, r := range d.AddedImplements {
+		items = append(items, diffItem{"+", st.code(r.Type) + " implements " + st.code(r.Interface)})
+	}
+	for _, r := range d.RemovedImplements {
+		items = append(items, diffItem{"-", st.code(r.Type) + " implements " + st.code(r.Interface)})
+	}
+	section("Implements", fmt.Sprintf("%d added, %d removed", len(d.AddedImplements), len(d.RemovedImplements)), items)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,118 @@
+package cpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestDiff generates the basic fixture before and after editBasicFixture
+// and diffs the databases.
+func TestDiff(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	root := filepath.Join(copyFixtures(t), "basic")
+	oldDB, _ := generateFixture(t, root, nil)
+	editBasicFixture(t, root)
+	newDB, _ := generateFixture(t, root, nil)
+
+	if d, err := DiffDatabases(oldDB, oldDB); err != nil {
+		t.Fatal(err)
+	} else if !d.Empty() {
+		t.Errorf("diff of a database with itself is not empty: %+v", d)
+	}
+
+	d, err := DiffDatabases(oldDB, newDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var funcs []string
+	for _, f := range d.AddedFunctions {
+		funcs = append(funcs, "+"+f.Function)
+	}
+	for _, f := range d.RemovedFunctions {
+		funcs = append(funcs, "-"+f.Function)
+	}
+	for _, f := range d.ModifiedFunctions {
+		funcs = append(funcs, "~"+f.Function+" "+strings.Join(f.Changes, ","))
+	}
+	if want := []string{"+b.Helper", "~b.Area body"}; !slices.Equal(funcs, want) {
+		t.Errorf("function changes = %q, want %q", funcs, want)
+	}
+	if want := []DiffCall{{"b.Area", "a.Old"}}; !slices.Equal(d.AddedCalls, want) || len(d.RemovedCalls) != 0 {
+		t.Errorf("calls added %v, removed %v; want added %v", d.AddedCalls, d.RemovedCalls, want)
+	}
+	var fanIn bool
+	for _, m := range d.Metrics {
+		if m.Function == "a.Old" {
+			fanIn = m.FanIn.New == m.FanIn.Old+1
+		}
+	}
+	if !fanIn {
+		t.Errorf("metrics changes %+v do not include a.Old's fan-in going up by one", d.Metrics)
+	}
+
+	for _, format := range DiffFormats {
+		var buf bytes.Buffer
+		if err := d.Write(&buf, format, 10); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !strings.Contains(buf.String(), "b.Helper") {
+			t.Errorf("%s output does not mention b.Helper:\n%s", format, buf.String())
+		}
+		if format == "json" {
+			var back Diff
+			if err := json.Unmarshal(buf.Bytes(), &back); err != nil {
+				t.Errorf("json output does not decode: %v", err)
+			}
+		}
+	}
+}
+
+// TestMatchFindings checks that findings pair by file, line, and message
+// before pairing by message alone and then by message with numbers ignored.
+func TestMatchFindings(t *testing.T) {
+	f := func(line int, msg string) DiffFinding {
+		return DiffFinding{Category: "c", Subject: "s", File: "a.go", Line: line, Message: msg}
+	}
+	for _, tc := range []struct {
+		name                    string
+		old, cur                []DiffFinding
+		wantAdded, wantResolved []DiffFinding
+	}{
+		{
+			name:         "one of two equal messages resolved",
+			old:          []DiffFinding{f(10, "x"), f(20, "x")},
+			cur:          []DiffFinding{f(20, "x")},
+			wantResolved: []DiffFinding{f(10, "x")},
+		},
+		{
+			name:      "moved finding and a new one",
+			old:       []DiffFinding{f(10, "x"), f(20, "y")},
+			cur:       []DiffFinding{f(14, "x"), f(20, "y"), f(30, "z")},
+			wantAdded: []DiffFinding{f(30, "z")},
+		},
+		{
+			name:         "only a number changed",
+			old:          []DiffFinding{f(10, "complexity 16 exceeds 15"), f(30, "x")},
+			cur:          []DiffFinding{f(12, "complexity 17 exceeds 15")},
+			wantResolved: []DiffFinding{f(30, "x")},
+		},
+		{
+			name:         "message changed",
+			old:          []DiffFinding{f(10, "x")},
+			cur:          []DiffFinding{f(10, "y")},
+			wantAdded:    []DiffFinding{f(10, "y")},
+			wantResolved: []DiffFinding{f(10, "x")},
+		},
+	} {
+		added, resolved := matchFindings(tc.old, tc.cur)
+		if !slices.Equal(added, tc.wantAdded) || !slices.Equal(resolved, tc.wantResolved) {
+			t.Errorf("%s: added %v, resolved %v; want %v, %v", tc.name, added, resolved, tc.wantAdded, tc.wantResolved)
+		}
+	}
+}
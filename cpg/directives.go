@@ -0,0 +1,396 @@
+package cpg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// parseDirective splits a comment into a directive name and its arguments:
+// "//go:embed a b" is ("go:embed", "a b"), "//nolint:errcheck // why" is
+// ("nolint", "errcheck // why"), and "// +build linux" is ("+build",
+// "linux"). Directives follow the "//tool:name" form go/ast recognizes: no
+// space after the slashes, lower-case letters and digits around the colon.
+func parseDirective(text string) (name, args string, ok bool) {
+	rest, ok := strings.CutPrefix(text, "//")
+	if !ok {
+		return "", "", false // block comments carry no directives
+	}
+	if b, ok := strings.CutPrefix(rest, " +build "); ok {
+		return "+build", strings.TrimSpace(b), true
+	}
+	if after, ok := strings.CutPrefix(rest, "nolint"); ok && (after == "" || after[0] == ':' || after[0] == ' ') {
+		return "nolint", strings.TrimSpace(strings.TrimPrefix(after, ":")), true
+	}
+	word, args, _ := strings.Cut(rest, " ")
+	tool, dir, ok := strings.Cut(word, ":")
+	if !ok || !isDirectiveWord(tool) || !isDirectiveWord(dir) {
+		return "", "", false
+	}
+	return word, strings.TrimSpace(args), true
+}
+
+func isDirectiveWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// directiveProps returns the structured properties of a directive next to
+// its raw args: the command and generator of go:generate, the patterns of
+// go:embed, local and target of go:linkname, the linters and reason of
+// nolint, and the constraint of go:build and +build.
+func directiveProps(name, args string) map[string]any {
+	props := map[string]any{"args": args}
+	switch name {
+	case "go:generate":
+		props["command"] = args
+		fields := strings.Fields(args)
+		if len(fields) > 0 {
+			gen := fields[0]
+			if gen == "go" && len(fields) > 2 && fields[1] == "run" {
+				gen = fields[2]
+			}
+			props["generator"] = gen
+		}
+	case "go:embed":
+		props["patterns"] = embedPatterns(args)
+	case "go:linkname":
+		fields := strings.Fields(args)
+		if len(fields) > 0 {
+			props["local"] = fields[0]
+		}
+		if len(fields) > 1 {
+			props["target"] = fields[1]
+		}
+	case "nolint":
+		linters, reason, _ := strings.Cut(args, "//")
+		list := []string{} // empty: every linter
+		for l := range strings.SplitSeq(strings.TrimSpace(linters), ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				list = append(list, l)
+			}
+		}
+		props["linters"] = list
+		if reason = strings.TrimSpace(reason); reason != "" {
+			props["reason"] = reason
+		}
+	case "go:build", "+build":
+		props["constraint"] = args
+	}
+	return props
+}
+
+// embedPatterns splits go:embed arguments, which may be quoted with double
+// quotes or backquotes to contain spaces.
+func embedPatterns(args string) []string {
+	patterns := []string{}
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		var p string
+		if args[0] == '"' || args[0] == '`' {
+			q, err := strconv.QuotedPrefix(args)
+			if err != nil {
+				break
+			}
+			p, _ = strconv.Unquote(q)
+			args = args[len(q):]
+		} else {
+			p, args, _ = strings.Cut(args, " ")
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// directiveTarget returns the declaration a directive at pos governs: the
+// function, type, var, or const it documents, trails, or lies inside. It
+// returns nil for directives that govern the whole file.
+func directiveTarget(file *ast.File, info *types.Info, pos token.Pos) types.Object {
+	in := func(n ast.Node) bool {
+		return n != nil && n.Pos() <= pos && pos < n.End()
+	}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if (d.Doc != nil && in(d.Doc)) || in(d) {
+				return info.Defs[d.Name]
+			}
+		case *ast.GenDecl:
+			groupDoc := d.Doc != nil && in(d.Doc)
+			if !groupDoc && !in(d) {
+				continue
+			}
+			for _, s := range d.Specs {
+				var ident *ast.Ident
+				var doc, comment *ast.CommentGroup
+				switch s := s.(type) {
+				case *ast.TypeSpec:
+					ident, doc, comment = s.Name, s.Doc, s.Comment
+				case *ast.ValueSpec:
+					if len(s.Names) > 0 {
+						ident = s.Names[0]
+					}
+					doc, comment = s.Doc, s.Comment
+				}
+				if ident == nil {
+					continue
+				}
+				if groupDoc || in(s) || (doc != nil && in(doc)) || (comment != nil && in(comment)) {
+					return info.Defs[ident]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// emitDirectives adds a directive node for every directive comment of a
+// walked file, with an ast edge from the file and an applies_to edge to the
+// declaration it governs (or the file). go:embed directives get an embed
+// edge to an embedded_file node per file their patterns select; go:linkname
+// edges are added by emitLinknameEdges once every package is walked.
+func emitDirectives(out *walkShard, pkg *packages.Package, file *ast.File, v *astVisitor, ms *ModuleSet) {
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			name, args, ok := parseDirective(c.Text)
+			if !ok {
+				continue
+			}
+			line, col := v.pos(c.Pos())
+			if line == 0 {
+				continue
+			}
+			id := StmtID(v.relPkg, BaseName(v.relFile), line, col, "directive")
+			props := directiveProps(name, args)
+			directive := Node{
+				ID:         id,
+				Kind:       "directive",
+				Name:       name,
+				File:       v.relFile,
+				Line:       line,
+				Col:        col,
+				Package:    v.relPkg,
+				Properties: props,
+			}
+			v.setSpan(&directive, c.Pos(), c.End())
+			out.AddNode(directive)
+			out.AddEdge(Edge{Source: v.fileID, Target: id, Kind: "ast"})
+			out.nodeCount++
+			out.edgeCount++
+
+			var target types.Object
+			switch name {
+			case "go:build", "+build":
+			case "go:linkname":
+				if local, ok := props["local"].(string); ok {
+					target = pkg.Types.Scope().Lookup(local)
+				}
+			default:
+				target = directiveTarget(file, pkg.TypesInfo, c.Pos())
+			}
+			if target != nil {
+				out.AddRef(Edge{Source: id, Kind: "applies_to"}, target, false)
+			} else {
+				out.AddEdge(Edge{Source: id, Target: v.fileID, Kind: "applies_to"})
+				out.edgeCount++
+			}
+
+			if name == "go:embed" {
+				for _, p := range props["patterns"].([]string) {
+					for _, abs := range embeddedFiles(pkg, p) {
+						rel := ms.RelFile(abs)
+						if rel == "" {
+							continue
+						}
+						fileID := FileID(rel)
+						embedProps := map[string]any{}
+						if info, err := os.Stat(abs); err == nil {
+							embedProps["size"] = info.Size()
+						}
+						out.AddNode(Node{
+							ID:         fileID,
+							Kind:       "embedded_file",
+							Name:       rel,
+							Package:    v.relPkg,
+							Properties: embedProps,
+						})
+						out.AddEdge(Edge{Source: id, Target: fileID, Kind: "embed", Properties: map[string]any{"pattern": p}})
+						out.edgeCount++
+					}
+				}
+			}
+		}
+	}
+}
+
+// embeddedFiles returns the files of pkg.EmbedFiles a go:embed pattern
+// selects: those it matches, or that lie below a directory it matches.
+func embeddedFiles(pkg *packages.Package, pattern string) []string {
+	pattern = strings.TrimPrefix(pattern, "all:")
+	var files []string
+	for _, abs := range pkg.EmbedFiles {
+		rel, err := filepath.Rel(pkg.Dir, abs)
+		if err != nil {
+			continue
+		}
+		for p := filepath.ToSlash(rel); p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				files = append(files, abs)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// emitLinknameEdges adds a linkname edge from each go:linkname directive
+// with a target to the function or variable it names. Targets outside the
+// analyzed code, typically in the runtime, become external function stubs
+// like the call graph's.
+func emitLinknameEdges(pkgs []*packages.Package, ms *ModuleSet, defLookup *DefLookup, cpg *CPG) int {
+	count := 0
+	for _, pkg := range pkgs {
+		for i, file := range pkg.Syntax {
+			if i >= len(pkg.CompiledGoFiles) {
+				continue
+			}
+			absFile := pkg.CompiledGoFiles[i]
+			relFile := ms.RelFile(absFile)
+			if relFile == "" || ms.SkipFile(absFile, relFile) {
+				continue
+			}
+			for _, cg := range file.Comments {
+				for _, c := range cg.List {
+					name, args, ok := parseDirective(c.Text)
+					if !ok || name != "go:linkname" {
+						continue
+					}
+					fields := strings.Fields(args)
+					if len(fields) < 2 {
+						continue // push form: the symbol is exported under its own name
+					}
+					dot := strings.LastIndex(fields[1], ".")
+					if dot <= 0 {
+						continue
+					}
+					targetPkg, targetName := fields[1][:dot], fields[1][dot+1:]
+					p := pkg.Fset.Position(c.Pos())
+					id := StmtID(ms.RelPkg(pkg.PkgPath), BaseName(relFile), p.Line, p.Column, "directive")
+
+					obj := lookupPackageObject(pkg.Types, targetPkg, targetName)
+					target := defLookup.Get(obj)
+					if target == "" {
+						if _, isVar := obj.(*types.Var); isVar {
+							continue
+						}
+						target = "ext::" + fields[1]
+						stub := Node{
+							ID:      target,
+							Kind:    "function",
+							Name:    targetName,
+							Package: ms.RelPkg(targetPkg),
+							Properties: map[string]any{
+								"external":  true,
+								"full_name": fields[1],
+							},
+						}
+						if obj != nil {
+							stub.TypeInfo = obj.Type().String()
+						}
+						cpg.AddNode(stub)
+					}
+					cpg.AddEdge(Edge{Source: id, Target: target, Kind: "linkname"})
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// lookupPackageObject finds name in the package with the given path among
+// pkg and its transitive imports, or returns nil.
+func lookupPackageObject(pkg *types.Package, pkgPath, name string) types.Object {
+	seen := make(map[*types.Package]bool)
+	var find func(p *types.Package) types.Object
+	find = func(p *types.Package) types.Object {
+		if p == nil || seen[p] {
+			return nil
+		}
+		seen[p] = true
+		if p.Path() == pkgPath {
+			return p.Scope().Lookup(name)
+		}
+		for _, imp := range p.Imports() {
+			if obj := find(imp); obj != nil {
+				return obj
+			}
+		}
+		return nil
+	}
+	return find(pkg)
+}
+
+// createDirectiveViews builds the directive views and their documentation.
+func createDirectiveViews(conn *sqlite.Conn) error {
+	ddl := `
+-- Directives with the declaration (or file) they govern
+CREATE VIEW v_directives AS
+  SELECT d.id AS directive_id, d.name AS directive, d.file, d.line, d.package,
+    json_extract(d.properties, '$.args') AS args,
+    t.id AS target_id, t.kind AS target_kind, t.name AS target_name
+  FROM nodes d
+  LEFT JOIN edges a ON a.source = d.id AND a.kind = 'applies_to'
+  LEFT JOIN nodes t ON t.id = a.target
+  WHERE d.kind = 'directive';
+
+-- go:generate commands, for auditing code generation
+CREATE VIEW v_go_generate AS
+  SELECT d.id AS directive_id, d.file, d.line, d.package,
+    json_extract(d.properties, '$.generator') AS generator,
+    json_extract(d.properties, '$.command') AS command
+  FROM nodes d
+  WHERE d.kind = 'directive' AND d.name = 'go:generate';
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('node_kind', 'directive', 'Compiler or tool directive comment (go:generate, go:embed, go:linkname, go:noinline, go:build, +build, nolint, any //tool:name); name is the directive', 'SELECT name, COUNT(*) FROM nodes WHERE kind = ''directive'' GROUP BY name'),
+('node_kind', 'embedded_file', 'File embedded by a go:embed directive; name is its module-relative path', 'SELECT name, json_extract(properties, ''$.size'') FROM nodes WHERE kind = ''embedded_file'''),
+('edge_kind', 'applies_to', 'Directive→declaration it governs (function, type_decl, local) or its file', NULL),
+('edge_kind', 'embed', 'go:embed directive→embedded_file', 'Properties: {"pattern":"static/*"}'),
+('edge_kind', 'linkname', 'go:linkname directive→the function or variable it links to (an external stub outside the analyzed code)', NULL),
+('node_property', 'args', 'Directive arguments as written', 'errcheck // closed below'),
+('node_property', 'command', 'go:generate command line; generator is its program (the package of go run)', 'stringer -type=Mode'),
+('node_property', 'patterns', 'go:embed patterns', '["static/*","index.html"]'),
+('node_property', 'linters', 'nolint linters; empty for all', '["errcheck"]'),
+('view', 'v_directives', 'Directives with the declaration or file they govern', 'SELECT directive, file, line, target_name FROM v_directives WHERE directive = ''go:linkname'''),
+('view', 'v_go_generate', 'go:generate commands by generator', 'SELECT generator, COUNT(*) FROM v_go_generate GROUP BY generator');
+
+INSERT INTO queries (name, description, sql) VALUES
+('linkname_targets', 'go:linkname directives, the local declaration, and the symbol they link to',
+ 'SELECT d.file, d.line, d.target_name AS local, json_extract(n.properties, ''$.target'') AS symbol, e.target AS target_id FROM v_directives d JOIN nodes n ON n.id = d.directive_id LEFT JOIN edges e ON e.source = d.directive_id AND e.kind = ''linkname'' WHERE d.directive = ''go:linkname'' ORDER BY d.file, d.line'),
+('embedded_files', 'Files embedded with go:embed, by the variable they are embedded into',
+ 'SELECT v.target_name AS variable, v.file, f.name AS embedded, json_extract(f.properties, ''$.size'') AS size FROM v_directives v JOIN edges e ON e.source = v.directive_id AND e.kind = ''embed'' JOIN nodes f ON f.id = e.target ORDER BY v.file, f.name'),
+('nolint_by_linter', 'Suppressed linters and how often',
+ 'SELECT COALESCE(l.value, ''(all)'') AS linter, COUNT(*) AS n FROM nodes d LEFT JOIN json_each(d.properties, ''$.linters'') l WHERE d.kind = ''directive'' AND d.name = ''nolint'' GROUP BY 1 ORDER BY n DESC');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("directive views: %w", err)
+	}
+	return nil
+}
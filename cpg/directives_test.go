@@ -0,0 +1,44 @@
+package cpg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseDirective checks which comments are directives and the
+// structured properties they get.
+func TestParseDirective(t *testing.T) {
+	for _, tc := range []struct {
+		text, name, args string
+		ok               bool
+	}{
+		{"//go:generate stringer -type=Mode", "go:generate", "stringer -type=Mode", true},
+		{"//go:noinline", "go:noinline", "", true},
+		{"//go:build linux && !arm", "go:build", "linux && !arm", true},
+		{"// +build linux", "+build", "linux", true},
+		{"//nolint", "nolint", "", true},
+		{"//nolint:errcheck,gosec // closed below", "nolint", "errcheck,gosec // closed below", true},
+		{"//lint:ignore SA1019 legacy", "lint:ignore", "SA1019 legacy", true},
+		{"// go:generate with a space", "", "", false},
+		{"//nolintish", "", "", false},
+		{"//https://example.com/x", "", "", false},
+		{"/* go:embed x */", "", "", false},
+	} {
+		name, args, ok := parseDirective(tc.text)
+		if name != tc.name || args != tc.args || ok != tc.ok {
+			t.Errorf("parseDirective(%q) = %q, %q, %v, want %q, %q, %v", tc.text, name, args, ok, tc.name, tc.args, tc.ok)
+		}
+	}
+
+	props := directiveProps("nolint", "errcheck, gosec // closed below")
+	if want := []string{"errcheck", "gosec"}; !reflect.DeepEqual(props["linters"], want) || props["reason"] != "closed below" {
+		t.Errorf("nolint props = %v", props)
+	}
+	props = directiveProps("go:generate", "go run ./gen -out x.go")
+	if props["generator"] != "./gen" {
+		t.Errorf("go:generate generator = %v, want ./gen", props["generator"])
+	}
+	if got, want := embedPatterns("static/* \"a b.txt\" `c`"), []string{"static/*", "a b.txt", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("embedPatterns = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package cpg
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EscapeResult holds one escape analysis annotation from the Go compiler.
+type EscapeResult struct {
+	Module  string // module prefix the annotation came from ("" for primary)
+	RelFile string
+	Line    int
+	Col     int
+	Kind    string // "leaking_param", "moved_to_heap", "does_not_escape", "inlineable"
+	Detail  string // variable or function name
+}
+
+// RunEscapeAnalysis runs `go build -gcflags=-m` on each given module directory
+// and parses the compiler's escape analysis decisions. Each build is bounded
+// by timeout (0 for none). A module whose build fails or times out is
+// reported as an issue and contributes what the compiler printed before
+// that; the error is non-nil only when ctx is done.
+func RunEscapeAnalysis(ctx context.Context, mods []ModuleInfo, timeout time.Duration, prog *Progress) ([]EscapeResult, []PhaseIssue, error) {
+	prog.Log("Running Go escape analysis (-gcflags=-m) across %d modules...", len(mods))
+
+	var allResults []EscapeResult
+	var issues []PhaseIssue
+
+	for _, mod := range mods {
+		results, err := runEscapeForDir(ctx, mod.Dir, mod.Prefix, timeout)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			prog.Log("  warning: escape analysis for %s: %v", mod.ModPath, err)
+			issues = append(issues, PhaseIssue{Phase: "escape", Module: mod.ModPath, Reason: err.Error()})
+		}
+		allResults = append(allResults, results...)
+	}
+
+	prog.Log("Escape analysis: %d annotations total", len(allResults))
+	return allResults, issues, nil
+}
+
+func runEscapeForDir(ctx context.Context, dir, prefix string, timeout time.Duration) ([]EscapeResult, error) {
+	tctx, cancel := toolContext(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(tctx, "go", "build", "-gcflags=-m", "./...")
+	cmd.Dir = dir
+	cmd.Env = replaceEnv(os.Environ(), "GOFLAGS", "-buildvcs=false")
+	cmd.Stdout = nil // discard
+	cmd.WaitDelay = toolWaitDelay
+
+	// Stderr goes through an io.Pipe rather than cmd.StderrPipe, so that
+	// WaitDelay can close it when a killed build leaves compilers behind.
+	pr, pw := io.Pipe()
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start go build: %w", err)
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		waitErr <- err
+	}()
+
+	lineRe := regexp.MustCompile(`^(?:\./)?([^:]+):(\d+):(\d+): (.+)$`)
+
+	var results []EscapeResult
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "#") || strings.HasPrefix(text, "/") {
+			continue
+		}
+		m := lineRe.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+
+		file := m[1]
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		msg := m[4]
+
+		var kind, detail string
+		switch {
+		case strings.Contains(msg, "leaking param:"):
+			kind = "leaking_param"
+			if idx := strings.Index(msg, "leaking param:"); idx >= 0 {
+				detail = strings.TrimSpace(msg[idx+len("leaking param:"):])
+			}
+		case strings.Contains(msg, "moved to heap:"):
+			kind = "moved_to_heap"
+			if idx := strings.Index(msg, "moved to heap:"); idx >= 0 {
+				detail = strings.TrimSpace(msg[idx+len("moved to heap:"):])
+			}
+		case strings.Contains(msg, "escapes to heap"):
+			kind = "escapes_to_heap"
+			detail = strings.TrimSuffix(strings.TrimSpace(msg), " escapes to heap")
+		case strings.Contains(msg, "does not escape"):
+			kind = "does_not_escape"
+			detail = strings.TrimSuffix(strings.TrimSpace(msg), " does not escape")
+		case strings.HasPrefix(msg, "can inline "):
+			kind = "inlineable"
+			detail = strings.TrimPrefix(msg, "can inline ")
+		default:
+			continue
+		}
+
+		// Prefix the file path for non-primary modules
+		relFile := file
+		if prefix != "" {
+			relFile = prefix + "/" + file
+		}
+
+		results = append(results, EscapeResult{
+			Module:  prefix,
+			RelFile: relFile,
+			Line:    line,
+			Col:     col,
+			Kind:    kind,
+			Detail:  detail,
+		})
+	}
+
+	_, _ = io.Copy(io.Discard, pr) // after an overlong line
+	var err error
+	if werr := <-waitErr; werr != nil {
+		// go build fails as a whole when one package does not compile; the
+		// annotations printed for the others are still valid.
+		err = toolError(ctx, tctx, timeout, "go build", werr)
+	}
+
+	// The go command prints each package's diagnostics as its compilation
+	// finishes, so the raw order varies from run to run.
+	slices.SortStableFunc(results, func(a, b EscapeResult) int {
+		return cmp.Or(
+			strings.Compare(a.RelFile, b.RelFile),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Col, b.Col),
+			strings.Compare(a.Kind, b.Kind),
+			strings.Compare(a.Detail, b.Detail),
+		)
+	})
+	return results, err
+}
@@ -0,0 +1,208 @@
+package cpg
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// extractFieldAccess emits field_read and field_write edges for the struct
+// field selections in fn: from the declared function (closures count toward
+// the function declaring them) and from the selector node of each access to
+// the field node. FieldAddr results stored through are writes, loaded or
+// otherwise used ones reads; Field selections on struct values are reads.
+// Fields without a node (external types, multi-name fields of skipped files)
+// are left out.
+func extractFieldAccess(fn *ssa.Function, funcNodeID string, fset *token.FileSet, ms *ModuleSet, posLookup *PosLookup, out *graphBuffer) (reads, writes int) {
+	type access struct {
+		field string
+		kind  string
+	}
+	seen := make(map[access]bool)
+	emit := func(instr ssa.Instruction, field *types.Var, kind string) {
+		if field == nil {
+			return
+		}
+		fieldFile, fieldLine, fieldCol := objPos(field, fset, ms)
+		if fieldFile == "" {
+			return
+		}
+		fieldID := posLookup.Get(fieldFile, fieldLine, fieldCol)
+		if fieldID == "" {
+			return
+		}
+		if a := (access{fieldID, kind}); !seen[a] {
+			seen[a] = true
+			out.AddEdge(Edge{Source: funcNodeID, Target: fieldID, Kind: kind})
+			if kind == "field_read" {
+				reads++
+			} else {
+				writes++
+			}
+		}
+		if file, line, col := instrPos(instr, fset, ms); file != "" {
+			if siteID := posLookup.Get(file, line, col); siteID != "" {
+				out.AddEdge(Edge{Source: siteID, Target: fieldID, Kind: kind})
+			}
+		}
+	}
+
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			switch in := instr.(type) {
+			case *ssa.FieldAddr:
+				field := structField(in.X.Type(), in.Field)
+				read, write := addrAccess(in, make(map[ssa.Value]bool))
+				if write {
+					emit(in, field, "field_write")
+				}
+				if read {
+					emit(in, field, "field_read")
+				}
+			case *ssa.Field:
+				emit(in, structField(in.X.Type(), in.Field), "field_read")
+			}
+		}
+	}
+	return reads, writes
+}
+
+// addrAccess reports how the address of a field is used: stored through
+// (a write, also through the address of a nested field or array element),
+// loaded, or otherwise used (a read: x.mu.Lock() takes &x.mu).
+func addrAccess(addr ssa.Value, seen map[ssa.Value]bool) (read, write bool) {
+	if seen[addr] {
+		return false, false
+	}
+	seen[addr] = true
+	refs := addr.Referrers()
+	if refs == nil {
+		return false, false
+	}
+	for _, ref := range *refs {
+		switch r := ref.(type) {
+		case *ssa.Store:
+			if r.Addr == addr {
+				write = true
+			} else {
+				read = true
+			}
+		case *ssa.FieldAddr:
+			rd, wr := addrAccess(r, seen)
+			read, write = read || rd, write || wr
+		case *ssa.IndexAddr:
+			rd, wr := addrAccess(r, seen)
+			read, write = read || rd, write || wr
+		default:
+			read = true
+		}
+	}
+	return read, write
+}
+
+// structField returns field i of the struct t or *t points to, or nil when
+// t is not a struct (a type parameter's core type, for one).
+func structField(t types.Type, i int) *types.Var {
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok || i >= st.NumFields() {
+		return nil
+	}
+	return st.Field(i)
+}
+
+// objPos returns the module-relative position of a declared object, or ""
+// outside the analyzed modules.
+func objPos(obj types.Object, fset *token.FileSet, ms *ModuleSet) (file string, line, col int) {
+	if !obj.Pos().IsValid() {
+		return "", 0, 0
+	}
+	pos := fset.Position(obj.Pos())
+	rel := ms.RelFile(pos.Filename)
+	if rel == "" {
+		return "", 0, 0
+	}
+	return rel, pos.Line, pos.Column
+}
+
+// createFieldAccessViews builds the per-type field access views from the
+// field_read and field_write edges: which methods touch which fields,
+// Henderson-Sellers LCOM per struct, and the fields written from the most
+// functions.
+func createFieldAccessViews(conn *sqlite.Conn) error {
+	ddl := `
+-- Fields each method of a struct type reads or writes
+CREATE VIEW v_method_fields AS
+  SELECT t.id AS type_id, json_extract(t.properties, '$.full_name') AS type_name,
+    m.id AS method_id, m.name AS method, f.id AS field_id, f.name AS field,
+    MAX(a.kind = 'field_read') AS reads, MAX(a.kind = 'field_write') AS writes
+  FROM nodes t
+  JOIN edges hm ON hm.source = t.id AND hm.kind = 'has_method'
+  JOIN nodes m ON m.id = hm.target
+  JOIN edges a ON a.source = m.id AND a.kind IN ('field_read', 'field_write')
+  JOIN edges tf ON tf.source = t.id AND tf.target = a.target AND tf.kind = 'ast'
+  JOIN nodes f ON f.id = a.target
+  WHERE t.kind = 'type_decl'
+  GROUP BY t.id, m.id, f.id;
+
+-- Lack of cohesion of methods (Henderson-Sellers): (mean methods per field
+-- - methods) / (1 - methods), 0 when every method touches every field, 1
+-- when each field is used by one method, above 1 when some fields are used
+-- by none; NULL below two methods
+CREATE VIEW v_type_cohesion AS
+  SELECT t.id AS type_id, json_extract(t.properties, '$.full_name') AS type_name, t.package,
+    mc.methods AS method_count, fc.fields AS field_count,
+    COALESCE(ac.accesses, 0) AS method_field_pairs,
+    CASE WHEN mc.methods > 1
+      THEN ROUND((CAST(COALESCE(ac.accesses, 0) AS REAL) / fc.fields - mc.methods) / (1 - mc.methods), 3)
+    END AS lcom
+  FROM nodes t
+  JOIN (SELECT source AS type_id, COUNT(*) AS methods FROM edges WHERE kind = 'has_method' GROUP BY source) mc
+    ON mc.type_id = t.id
+  JOIN (SELECT e.source AS type_id, COUNT(*) AS fields FROM edges e JOIN nodes f ON f.id = e.target
+        WHERE e.kind = 'ast' AND f.kind = 'field' GROUP BY e.source) fc
+    ON fc.type_id = t.id
+  LEFT JOIN (SELECT type_id, COUNT(*) AS accesses FROM v_method_fields GROUP BY type_id) ac
+    ON ac.type_id = t.id
+  WHERE t.kind = 'type_decl' AND json_extract(t.properties, '$.type_kind') = 'struct';
+
+-- Struct fields by how many functions write them
+CREATE VIEW v_field_writers AS
+  SELECT f.id AS field_id, f.name AS field, f.package, f.file, f.line,
+    json_extract(t.properties, '$.full_name') AS type_name,
+    COUNT(DISTINCT w.source) AS writer_count,
+    COUNT(DISTINCT fn.package) AS writer_packages,
+    (SELECT COUNT(*) FROM edges r JOIN nodes rf ON rf.id = r.source
+     WHERE r.target = f.id AND r.kind = 'field_read' AND rf.kind IN ('function', 'test', 'benchmark', 'fuzz', 'example')) AS reader_count
+  FROM nodes f
+  JOIN edges w ON w.target = f.id AND w.kind = 'field_write'
+  JOIN nodes fn ON fn.id = w.source AND fn.kind IN ('function', 'test', 'benchmark', 'fuzz', 'example')
+  LEFT JOIN edges tf ON tf.target = f.id AND tf.kind = 'ast'
+  LEFT JOIN nodes t ON t.id = tf.source AND t.kind = 'type_decl'
+  WHERE f.kind = 'field'
+  GROUP BY f.id;
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('edge_kind', 'field_read', 'Function→struct field it reads, and selector→field at each read (from SSA Field and loaded FieldAddr; taking the address counts as a read); closures count toward their declaring function', NULL),
+('edge_kind', 'field_write', 'Function→struct field it stores to, and selector→field at each write (from SSA FieldAddr stored through, also via nested fields and array elements)', NULL),
+('view', 'v_method_fields', 'Methods of each struct type and the fields they read or write', 'SELECT method, field, reads, writes FROM v_method_fields WHERE type_name LIKE ''%.Head'''),
+('view', 'v_type_cohesion', 'Struct types with method and field counts and Henderson-Sellers LCOM (0 cohesive, 1 or more not)', 'SELECT type_name, method_count, field_count, lcom FROM v_type_cohesion ORDER BY lcom DESC'),
+('view', 'v_field_writers', 'Struct fields with the number of functions and packages writing them', 'SELECT type_name, field, writer_count FROM v_field_writers ORDER BY writer_count DESC');
+
+INSERT INTO queries (name, description, sql) VALUES
+('least_cohesive_types', 'Struct types whose methods share the fewest fields',
+ 'SELECT type_name, method_count, field_count, lcom FROM v_type_cohesion WHERE lcom IS NOT NULL ORDER BY lcom DESC, method_count DESC LIMIT 50'),
+('widely_mutated_fields', 'Struct fields written from the most functions',
+ 'SELECT type_name, field, file, line, writer_count, writer_packages, reader_count FROM v_field_writers ORDER BY writer_count DESC, writer_packages DESC LIMIT 50');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("field access views: %w", err)
+	}
+	return nil
+}
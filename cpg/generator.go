@@ -0,0 +1,465 @@
+package cpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+)
+
+// Generator builds a Code Property Graph for one Config. It keeps all run
+// state (module set, file filter, progress) to itself, so several
+// generators can run in one process, one after the other or concurrently.
+type Generator struct {
+	cfg   *Config
+	ms    *ModuleSet
+	prog  *Progress
+	cache *Cache // nil without Config.CacheDir
+
+	// graphOnly skips escape analysis and git history, which only feed
+	// derived tables (AddSnapshot).
+	graphOnly bool
+}
+
+// Options configures a Generator beyond its Config.
+type Options struct {
+	Log io.Writer // progress output; nil discards it
+}
+
+// NewGenerator validates cfg and returns a generator for it. cfg must not be
+// modified afterwards.
+func NewGenerator(cfg *Config, opts Options) (*Generator, error) {
+	return NewGeneratorContext(context.Background(), cfg, opts)
+}
+
+// NewGeneratorContext is NewGenerator with a context that bounds resolving
+// module@version specs (see Config.ValidateContext).
+func NewGeneratorContext(ctx context.Context, cfg *Config, opts Options) (*Generator, error) {
+	if err := cfg.ValidateContext(ctx); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	gen := &Generator{
+		cfg:  cfg,
+		ms:   cfg.ModuleSet(),
+		prog: NewProgress(opts.Log, cfg.Output.Verbose),
+	}
+	if cfg.CacheDir != "" {
+		cache, err := OpenCache(cfg.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		gen.cache = cache
+	}
+	return gen, nil
+}
+
+// Sink receives the finished graph. SQLiteSink writes the database cpg-gen
+// produces; embedders can implement Sink to consume the graph directly.
+type Sink interface {
+	Write(ctx context.Context, out *Output) error
+}
+
+// Output is everything one generation hands to its Sink.
+type Output struct {
+	Graph    *CPG
+	Escapes  []EscapeResult
+	Options  DBOptions        // settings for the derived tables
+	Plan     *IncrementalPlan // non-nil when updating the database at Config.Output.Path
+	Progress *Progress
+}
+
+// SQLiteSink writes the graph and its derived tables to a SQLite database,
+// or splices an incremental update into it.
+type SQLiteSink struct {
+	Path string
+}
+
+// Write implements Sink.
+func (s *SQLiteSink) Write(ctx context.Context, out *Output) error {
+	if out.Plan != nil {
+		return UpdateDB(ctx, s.Path, out.Graph, out.Plan, out.Escapes, out.Options, out.Progress)
+	}
+	return WriteDB(ctx, s.Path, out.Graph, out.Escapes, out.Options, out.Progress)
+}
+
+// Generate runs the pipeline and hands the result to sink. It stops between
+// phases, and aborts package loading, external tools, and database writes,
+// once ctx is done; the temporary go.work and a partially written database
+// are removed. In incremental mode an up-to-date database is left alone and
+// sink is not called.
+func (gen *Generator) Generate(ctx context.Context, sink Sink) error {
+	cfg, ms, prog := gen.cfg, gen.ms, gen.prog
+
+	if cfg.file != "" {
+		prog.Log("Using config %s", cfg.file)
+	}
+	prog.Log("Analyzing %d modules: %s", len(ms.Dirs()), moduleNames(ms))
+
+	profiles, err := ResolveProfiles(strings.Join(cfg.Profiles, ","), ms)
+	if err != nil {
+		return err
+	}
+	if len(profiles) > 0 {
+		prog.Log("Profiles: %s", strings.Join(profileNames(profiles), ", "))
+	}
+	if pulled := cfg.phases.Pulled(); len(pulled) > 0 {
+		prog.Log("Adding required phases: %s", strings.Join(pulled, ", "))
+	}
+	if skipped := cfg.phases.Skipped(); len(skipped) > 0 {
+		prog.Log("Skipping phases: %s", strings.Join(skipped, ", "))
+	}
+
+	// Create temporary go.work for unified type universe
+	goworkPath, err := CreateTempGoWork(ms)
+	if err != nil {
+		return err
+	}
+	defer RemoveTempGoWork(goworkPath)
+	prog.Verbose("Created workspace: %s", goworkPath)
+
+	// Phase 1–7: load and analyze each build configuration. With several
+	// platforms the per-platform graphs are merged by node ID and every node
+	// and edge is tagged with the platforms it exists in.
+	cpg, err := cfg.NewGraph()
+	if err != nil {
+		return err
+	}
+	defer cpg.Close()
+	if path, ok := cpg.Streaming(); ok {
+		prog.Log("Streaming graph through %s (spilling every ~%s)", path, formatBytes(cfg.MemoryLimit()/8))
+	}
+	platforms := cfg.BuildPlatforms()
+	var merge *PlatformMerge
+	if len(cfg.Platforms) > 0 {
+		merge = NewPlatformMerge(platforms)
+	}
+	var plan *IncrementalPlan
+	var escapeKeys map[string]string // package cache keys of the first platform
+	if gen.cache != nil {
+		gen.cache.stats = CacheStats{}
+		prog.Log("Using cache %s", cfg.CacheDir)
+	}
+	for i, platform := range platforms {
+		g := cpg
+		if i > 0 {
+			g = NewCPG()
+		}
+
+		if gen.cache != nil {
+			keys, err := gen.analyzeCached(ctx, goworkPath, platform, g)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				escapeKeys = keys
+			}
+			if merge != nil {
+				merge.Merge(cpg, g, platform)
+			}
+			continue
+		}
+
+		// Phase 1: Load packages (all modules, single type universe)
+		loadResult, err := LoadPackages(ctx, ms, goworkPath, platform, prog)
+		if err != nil {
+			return err
+		}
+
+		g.FileHashes = HashPackageFiles(ms, loadResult.Packages)
+
+		// Incremental mode: diff file hashes against the previous run and restrict
+		// the SSA-driven phases to changed packages and their reverse dependencies.
+		// WalkAST still covers every package so position lookups stay complete.
+		if cfg.Output.Incremental {
+			plan, err = PlanIncremental(cfg.Output.Path, ms, loadResult.Packages, g.FileHashes, cfg.phases, prog)
+			if err != nil {
+				return err
+			}
+			if plan != nil && plan.UpToDate() {
+				prog.Log("No changes since last run; %s is up to date.", cfg.Output.Path)
+				return nil
+			}
+			if plan != nil {
+				g.Restrict(plan.Affected)
+			}
+		}
+
+		if err := gen.analyzePackages(ctx, loadResult, g, nil); err != nil {
+			return err
+		}
+
+		if merge != nil {
+			merge.Merge(cpg, g, platform)
+		}
+	}
+	if merge != nil {
+		if len(platforms) > 1 && cfg.PhaseEnabled("metrics") {
+			ComputeFanInOut(cpg) // call edges from every platform
+		}
+		merge.Tag(cpg)
+		perPlatform, common := merge.Counts()
+		for _, p := range platforms {
+			prog.Log("  %s: %d nodes", p.Name(), perPlatform[p.Name()])
+		}
+		prog.Log("Merged %d platforms: %d nodes, %d common to all", len(platforms), cpg.NodeCount(), common)
+	}
+
+	// Add META_DATA node with generator info
+	cpg.AddNode(Node{
+		ID:   "META_DATA",
+		Kind: "meta_data",
+		Name: "CPG Metadata",
+		Properties: map[string]any{
+			"language":       "go",
+			"version":        "1.0",
+			"generator":      "cpg-gen",
+			"root":           ms.PrimaryDir(),
+			"module":         ms.Primary().ModPath,
+			"modules":        len(ms.Dirs()),
+			"profiles":       profileNames(profiles),
+			"skipped_phases": cfg.phases.Skipped(),
+			"platforms":      platformNames(cfg.platforms),
+		},
+	})
+
+	// Phase 7c: Escape analysis from Go compiler (all modules, or only the
+	// modules with changed packages in incremental mode)
+	var escapeResults []EscapeResult
+	var issues []PhaseIssue
+	if cfg.PhaseEnabled("escape") && !gen.graphOnly {
+		escapeMods := ms.Dirs()
+		if plan != nil {
+			escapeMods = plan.Modules
+		}
+		var escapeIssues []PhaseIssue
+		if gen.cache != nil {
+			escapeResults, escapeIssues, err = gen.cache.escapes(ctx, escapeMods, ms, escapeKeys, cfg.escapeTimeout, prog)
+		} else {
+			escapeResults, escapeIssues, err = RunEscapeAnalysis(ctx, escapeMods, cfg.escapeTimeout, prog)
+		}
+		if err != nil {
+			return err
+		}
+		issues = append(issues, escapeIssues...)
+	}
+
+	// Phase 7d: Git history for diff-aware analysis (all modules)
+	opts := DBOptions{
+		Modules:        ms,
+		Profiles:       profiles,
+		Thresholds:     cfg.Thresholds.withDefaults(),
+		Phases:         cfg.phases,
+		Platforms:      cfg.platforms,
+		Validate:       cfg.Output.Validate,
+		ValidateReport: cfg.Output.ValidateReport,
+		SchemaRoots:    cfg.SchemaRoots,
+	}
+	if !gen.graphOnly {
+		if cfg.PhaseEnabled("git_history") {
+			var gitIssues []PhaseIssue
+			opts.GitHistory, gitIssues, err = RunGitHistory(ctx, ms, cfg.gitTimeout, prog)
+			if err != nil {
+				return err
+			}
+			issues = append(issues, gitIssues...)
+		}
+		if primary := ms.Primary(); primary.Cached {
+			opts.Snapshot = SnapshotInfo{Name: primary.Version}
+		} else {
+			opts.Snapshot = DetectSnapshot(ctx, ms.PrimaryDir(), cfg.gitTimeout)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	opts.Issues = issues
+
+	// Phase 8: Write SQLite (or splice into the existing DB)
+	// A failed validation still leaves a complete database, so the run
+	// finishes normally before reporting it.
+	var verr *ValidationError
+	werr := sink.Write(ctx, &Output{Graph: cpg, Escapes: escapeResults, Options: opts, Plan: plan, Progress: prog})
+	if werr != nil && !errors.As(werr, &verr) {
+		return werr
+	}
+
+	if gen.cache != nil {
+		prog.Log("Cache: %s", gen.cache.Stats())
+	}
+	if _, ok := cpg.Streaming(); ok {
+		prog.Verbose("Spilled the graph in %d batches", cpg.SpillBatches())
+	}
+	if len(issues) > 0 {
+		prog.Log("Degraded phases: %s (see phase_issues)", degradedPhases(issues))
+	}
+	prog.Log("Done. %d nodes, %d edges.", cpg.NodeCount(), cpg.EdgeCount())
+	return werr
+}
+
+// analyzeCached fills g for one build configuration, reusing the cached
+// fragment of every package whose key is unchanged, and returns the package
+// keys. When every package hits, nothing is parsed or type-checked.
+// Otherwise packages are loaded as usual, the SSA-driven phases are
+// restricted to the missing packages, and their fragments are stored for the
+// next run.
+func (gen *Generator) analyzeCached(ctx context.Context, goworkPath string, platform Platform, g *CPG) (map[string]string, error) {
+	cfg, ms, prog, cache := gen.cfg, gen.ms, gen.prog, gen.cache
+
+	run, err := runKey(ctx, cfg, ms, goworkPath, platform)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := ListPackages(ctx, ms, goworkPath, platform, prog)
+	if err != nil {
+		return nil, err
+	}
+	hashes := HashPackageFiles(ms, listed)
+	keys := packageKeys(run, listed, hashes)
+
+	var cached []*fragment
+	missing := make(map[string]bool)
+	for _, pkg := range listed {
+		f := &fragment{}
+		if cache.get(keys[pkg.PkgPath], f) {
+			cached = append(cached, f)
+		} else {
+			missing[pkg.PkgPath] = true
+		}
+	}
+	prog.Log("Cache: reusing %d of %d packages", len(cached), len(listed))
+
+	if len(missing) == 0 {
+		g.FileHashes = hashes
+		for _, f := range cached {
+			f.addTo(g)
+		}
+		if cfg.PhaseEnabled("metrics") {
+			ComputeFanInOut(g)
+		}
+		return keys, ctx.Err()
+	}
+
+	loadResult, err := LoadPackages(ctx, ms, goworkPath, platform, prog)
+	if err != nil {
+		return nil, err
+	}
+	g.FileHashes = HashPackageFiles(ms, loadResult.Packages)
+	if len(cached) > 0 {
+		g.Restrict(missing)
+	}
+	if err := gen.analyzePackages(ctx, loadResult, g, cached); err != nil {
+		return nil, err
+	}
+
+	// Files edited while loading would be stored under stale keys.
+	if !maps.Equal(g.FileHashes, hashes) {
+		prog.Log("  warning: files changed during loading; not updating the cache")
+		return keys, nil
+	}
+	frags, ok := partition(g, ms, loadResult.Packages)
+	if !ok {
+		prog.Log("  warning: graph has elements outside every package; not updating the cache")
+		return keys, nil
+	}
+	for _, pkg := range loadResult.Packages {
+		if !missing[pkg.PkgPath] {
+			continue
+		}
+		if err := cache.put(keys[pkg.PkgPath], frags[pkg.PkgPath]); err != nil {
+			prog.Log("  warning: %v", err)
+			break
+		}
+	}
+	return keys, nil
+}
+
+// analyzePackages runs the per-build-configuration phases (AST walk, SSA,
+// flow edges, call graph, types, metrics, test links) over loaded packages,
+// checking for cancellation between phases. Cached fragments are layered in
+// right after the AST walk, so metrics and test links see their edges.
+func (gen *Generator) analyzePackages(ctx context.Context, lr *LoadResult, cpg *CPG, cached []*fragment) error {
+	cfg, ms, prog := gen.cfg, gen.ms, gen.prog
+	workers := cfg.WorkerCount()
+
+	// Phase 2: Walk AST → nodes + AST edges + position lookup
+	posLookup, funcLookup := WalkAST(lr.Packages, lr.Fset, ms, cpg, workers, prog)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, f := range cached {
+		f.addTo(cpg)
+	}
+
+	// Phase 3: Build SSA
+	ssaResult := BuildSSA(lr.Packages, ms, prog)
+
+	steps := []struct {
+		phase string
+		run   func()
+	}{
+		// Phase 4: Extract CFG + DFG from SSA
+		{"cfg", func() { ExtractCFGAndDFG(ssaResult, lr.Fset, ms, posLookup, funcLookup, cpg, workers, prog) }},
+		// Phase 4b: Extract CDG from post-dominator tree
+		{"cdg", func() { ExtractCDG(ssaResult, lr.Fset, ms, funcLookup, cpg, workers, prog) }},
+		// Phase 4c: Extract channel send→receive flow edges
+		{"channel_flow", func() { ExtractChannelFlow(ssaResult, lr.Fset, ms, posLookup, cpg, prog) }},
+		// Phase 4d: Extract panic/recover flow edges
+		{"panic_recover", func() { ExtractPanicRecover(ssaResult, lr.Fset, ms, posLookup, funcLookup, cpg, prog) }},
+		// Phase 5: Build VTA call graph → call edges
+		{"callgraph", func() { BuildCallGraph(ssaResult, lr.Fset, ms, posLookup, funcLookup, cpg, prog) }},
+		// Phase 6: Extract type relationships (implements, embeds)
+		{"types", func() { ExtractTypeRelationships(lr.Packages, lr.Fset, ms, posLookup, cpg, prog) }},
+		// Phase 7: Compute function metrics, then fill fan-in/fan-out from call graph
+		{"metrics", func() {
+			ComputeMetrics(lr.Packages, lr.Fset, ms, funcLookup, cpg, workers, prog)
+			ComputeFanInOut(cpg)
+		}},
+		// Phase 7b: Link test functions to the production code they exercise
+		{"tests", func() { LinkTests(cpg, prog) }},
+	}
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if cfg.PhaseEnabled(step.phase) {
+			step.run()
+		}
+	}
+	return ctx.Err()
+}
+
+// moduleNames returns a human-readable list of module prefixes.
+func moduleNames(ms *ModuleSet) string {
+	names := make([]string, len(ms.Dirs()))
+	for i, m := range ms.Dirs() {
+		if m.Prefix == "" {
+			names[i] = m.ModPath + " (primary)"
+		} else {
+			names[i] = m.Prefix
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// degradedPhases lists the phases with issues and how many modules each
+// affected, e.g. "escape (1 module), git_history (2 modules)".
+func degradedPhases(issues []PhaseIssue) string {
+	var phases []string
+	count := make(map[string]int)
+	for _, is := range issues {
+		if count[is.Phase] == 0 {
+			phases = append(phases, is.Phase)
+		}
+		count[is.Phase]++
+	}
+	for i, p := range phases {
+		unit := "modules"
+		if count[p] == 1 {
+			unit = "module"
+		}
+		phases[i] = fmt.Sprintf("%s (%d %s)", p, count[p], unit)
+	}
+	return strings.Join(phases, ", ")
+}
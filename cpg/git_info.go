@@ -1,10 +1,14 @@
-package main
+package cpg
 
 import (
-	"bufio"
-	"os/exec"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // GitFileHistory holds per-file git change metrics.
@@ -29,29 +33,39 @@ type GitBlameEntry struct {
 }
 
 // RunGitHistory extracts per-file change frequency from `git log --numstat`
-// across all modules in the ModuleSet.
-func RunGitHistory(prog *Progress) []GitFileHistory {
-	prog.Log("Running git log for file history across %d modules...", len(modSet.Dirs()))
+// across all modules in the ModuleSet. Each git command is bounded by
+// timeout (0 for none). A module whose history cannot be read is reported as
+// an issue; the error is non-nil only when ctx is done.
+func RunGitHistory(ctx context.Context, ms *ModuleSet, timeout time.Duration, prog *Progress) ([]GitFileHistory, []PhaseIssue, error) {
+	prog.Log("Running git log for file history across %d modules...", len(ms.Dirs()))
 
 	var allResults []GitFileHistory
+	var issues []PhaseIssue
 
-	for _, mod := range modSet.Dirs() {
-		results := runGitHistoryForDir(mod.Dir, mod.Prefix, prog)
+	for _, mod := range ms.Dirs() {
+		if mod.Cached {
+			continue // module cache copies carry no history
+		}
+		results, err := runGitHistoryForDir(ctx, mod.Dir, mod.Prefix, timeout)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			prog.Log("  warning: git history for %s: %v", mod.ModPath, err)
+			issues = append(issues, PhaseIssue{Phase: "git_history", Module: mod.ModPath, Reason: err.Error()})
+			continue
+		}
 		allResults = append(allResults, results...)
 	}
 
 	prog.Log("Git history: %d files with change data", len(allResults))
-	return allResults
+	return allResults, issues, nil
 }
 
-func runGitHistoryForDir(dir, prefix string, prog *Progress) []GitFileHistory {
-	cmd := exec.Command("git", "log", "--format=%H %aI %aN", "--numstat", "--no-merges", "-n", "500")
-	cmd.Dir = dir
-
-	out, err := cmd.Output()
+func runGitHistoryForDir(ctx context.Context, dir, prefix string, timeout time.Duration) ([]GitFileHistory, error) {
+	out, err := runTool(ctx, timeout, dir, "git", "log", "--format=%H %aI %aN", "--numstat", "--no-merges", "-n", "500")
 	if err != nil {
-		prog.Verbose("Git history for %s: failed: %v", dir, err)
-		return nil
+		return nil, err
 	}
 
 	type fileStats struct {
@@ -123,7 +137,8 @@ func runGitHistoryForDir(dir, prefix string, prog *Progress) []GitFileHistory {
 	}
 
 	var results []GitFileHistory
-	for file, fs := range files {
+	for _, file := range slices.Sorted(maps.Keys(files)) {
+		fs := files[file]
 		results = append(results, GitFileHistory{
 			RelFile:     file,
 			CommitCount: len(fs.commits),
@@ -135,35 +150,34 @@ func runGitHistoryForDir(dir, prefix string, prog *Progress) []GitFileHistory {
 		})
 	}
 
-	return results
+	return results, nil
 }
 
 // RunGitBlame extracts per-function blame data using `git blame --porcelain`.
-// Only samples function declaration lines to keep the data manageable.
-func RunGitBlame(dir string, files []string, prog *Progress) []GitBlameEntry {
+// Only samples function declaration lines to keep the data manageable. Each
+// file's blame is bounded by timeout (0 for none); files that cannot be
+// blamed are skipped and reported together in the error, which is ctx's
+// error instead when ctx is done.
+func RunGitBlame(ctx context.Context, dir string, files []string, timeout time.Duration, prog *Progress) ([]GitBlameEntry, error) {
 	prog.Log("Running git blame for %d files...", len(files))
 
 	var results []GitBlameEntry
+	var errs []error
 	for _, relFile := range files {
-		cmd := exec.Command("git", "blame", "--porcelain", "--", relFile)
-		cmd.Dir = dir
-
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			continue
+		out, err := runTool(ctx, timeout, dir, "git", "blame", "--porcelain", "--", relFile)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-		if err := cmd.Start(); err != nil {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", relFile, err))
 			continue
 		}
 
-		scanner := bufio.NewScanner(stdout)
-		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
 		var currentLine int
 		var currentAuthor, currentDate, currentCommit string
 
-		for scanner.Scan() {
-			text := scanner.Text()
+		for text := range strings.Lines(string(out)) {
+			text = strings.TrimSuffix(text, "\n")
 
 			// Header line: "commit_sha orig_line final_line [num_lines]"
 			if len(text) >= 40 && text[0] != '\t' && !strings.HasPrefix(text, "author") &&
@@ -190,10 +204,11 @@ func RunGitBlame(dir string, files []string, prog *Progress) []GitBlameEntry {
 				})
 			}
 		}
-
-		_ = cmd.Wait()
 	}
 
-	prog.Log("Git blame: %d line entries across %d files", len(results), len(files))
-	return results
+	prog.Log("Git blame: %d line entries across %d files", len(results), len(files)-len(errs))
+	if len(errs) > 0 {
+		prog.Log("  warning: git blame failed for %d files", len(errs))
+	}
+	return results, errors.Join(errs...)
 }
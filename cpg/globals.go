@@ -0,0 +1,254 @@
+package cpg
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// extractGlobalAccess emits global_read and global_write edges from fn to
+// the package-level variables of the analyzed modules it uses. Unlike field
+// accesses they start at the innermost function, closures included, so
+// goroutine-launched closures keep their writes. A write is a store to the
+// variable or into it (a field or array element), or a mutation through the
+// value loaded from it: a map update or delete, or a store into a slice
+// element or a pointed-to struct; writes only of the second kind are marked
+// indirect. Writes in func init() bodies are marked in_init; package
+// initializers are the variables' initializer edges instead.
+func extractGlobalAccess(fn *ssa.Function, funcNodeID string, inInit bool, fset *token.FileSet, ms *ModuleSet, posLookup *PosLookup, out *graphBuffer) (reads, writes int) {
+	type access struct {
+		read, write, direct bool
+	}
+	var order []string
+	accesses := make(map[string]*access)
+	record := func(g *ssa.Global, read, write, direct bool) {
+		if g.Object() == nil || (!read && !write) {
+			return // synthetic (init$guard)
+		}
+		file, line, col := objPos(g.Object(), fset, ms)
+		if file == "" {
+			return
+		}
+		id := posLookup.Get(file, line, col)
+		if id == "" {
+			return
+		}
+		a := accesses[id]
+		if a == nil {
+			a = &access{}
+			accesses[id] = a
+			order = append(order, id)
+		}
+		a.read = a.read || read
+		a.write = a.write || write
+		a.direct = a.direct || (write && direct)
+	}
+
+	var operands []*ssa.Value
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			operands = instr.Operands(operands[:0])
+			for _, op := range operands {
+				g, ok := (*op).(*ssa.Global)
+				if !ok {
+					continue
+				}
+				switch in := instr.(type) {
+				case *ssa.Store:
+					record(g, in.Val == g, in.Addr == g, true)
+				case *ssa.UnOp: // load
+					record(g, true, mutatedThrough(in), false)
+				case *ssa.FieldAddr:
+					read, write := addrAccess(in, make(map[ssa.Value]bool))
+					record(g, read, write, true)
+				case *ssa.IndexAddr:
+					read, write := addrAccess(in, make(map[ssa.Value]bool))
+					record(g, read, write, true)
+				default:
+					record(g, true, false, false)
+				}
+			}
+		}
+	}
+
+	for _, id := range order {
+		a := accesses[id]
+		if a.read {
+			out.AddEdge(Edge{Source: funcNodeID, Target: id, Kind: "global_read"})
+			reads++
+		}
+		if a.write {
+			props := map[string]any{}
+			if !a.direct {
+				props["indirect"] = true
+			}
+			if inInit {
+				props["in_init"] = true
+			}
+			out.AddEdge(Edge{Source: funcNodeID, Target: id, Kind: "global_write", Properties: props})
+			writes++
+		}
+	}
+	return reads, writes
+}
+
+// mutatedThrough reports whether the value loaded from a variable is
+// changed in place: a map update, delete or clear, or a store into a slice
+// element or into the struct a pointer points to.
+func mutatedThrough(v ssa.Value) bool {
+	refs := v.Referrers()
+	if refs == nil {
+		return false
+	}
+	for _, ref := range *refs {
+		switch r := ref.(type) {
+		case *ssa.MapUpdate:
+			if r.Map == v {
+				return true
+			}
+		case *ssa.IndexAddr:
+			if _, write := addrAccess(r, make(map[ssa.Value]bool)); write {
+				return true
+			}
+		case *ssa.FieldAddr:
+			if _, write := addrAccess(r, make(map[ssa.Value]bool)); write {
+				return true
+			}
+		case *ssa.Call:
+			if b, ok := r.Call.Value.(*ssa.Builtin); ok && (b.Name() == "delete" || b.Name() == "clear") && len(r.Call.Args) > 0 && r.Call.Args[0] == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isInitFunc reports whether fn is, or is declared inside, a func init().
+// SSA names those init#1, init#2, ...; plain "init" is the synthetic
+// package initializer.
+func isInitFunc(fn *ssa.Function) bool {
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	return fn.Signature.Recv() == nil && strings.HasPrefix(fn.Name(), "init#")
+}
+
+// createGlobals builds the globals table from the global_read and
+// global_write edges and flags globals written from goroutine-launched code
+// that takes no lock.
+func createGlobals(conn *sqlite.Conn, prog *Progress) error {
+	ddl := `
+-- Package-level variables and the functions that use them
+CREATE TABLE globals (
+    var_id TEXT PRIMARY KEY,
+    package TEXT,
+    name TEXT NOT NULL,
+    file TEXT,
+    line INTEGER,
+    type TEXT,
+    exported INTEGER,
+    initialized INTEGER,        -- declared with an initializer expression
+    mutability TEXT NOT NULL,   -- read_only, init_only, or mutable
+    reader_count INTEGER,
+    writer_count INTEGER,       -- writers outside func init()
+    init_writer_count INTEGER,
+    indirect_writer_count INTEGER, -- writers that only mutate through the value (map, slice, pointer)
+    readers TEXT,               -- JSON array of function names
+    writers TEXT,
+    init_writers TEXT
+);
+
+-- Reads and writes of package-level variables by function name; closures
+-- are named after the function they are declared in
+CREATE VIEW v_global_access AS
+  SELECT e.kind, e.source, e.target, e.properties,
+    CASE WHEN f.name = 'func literal'
+      THEN COALESCE(json_extract(p.properties, '$.full_name'), p.name, '?') || ' (func literal)'
+      ELSE COALESCE(json_extract(f.properties, '$.full_name'), f.name)
+    END AS name
+  FROM edges e
+  JOIN nodes f ON f.id = e.source
+  LEFT JOIN nodes p ON p.id = f.parent_function
+  WHERE e.kind IN ('global_read', 'global_write');
+
+INSERT INTO globals
+  SELECT v.id, v.package, v.name, v.file, v.line, v.type_info,
+    COALESCE(json_extract(v.properties, '$.exported'), 0),
+    EXISTS (SELECT 1 FROM edges i WHERE i.source = v.id AND i.kind = 'initializer'),
+    CASE WHEN w.writers > 0 THEN 'mutable' WHEN w.init_writers > 0 THEN 'init_only' ELSE 'read_only' END,
+    COALESCE(r.readers, 0), COALESCE(w.writers, 0), COALESCE(w.init_writers, 0), COALESCE(w.indirect_writers, 0),
+    COALESCE(r.names, '[]'), COALESCE(w.names, '[]'), COALESCE(w.init_names, '[]')
+  FROM nodes v
+  LEFT JOIN (
+    SELECT e.target, COUNT(DISTINCT e.source) AS readers, json_group_array(DISTINCT e.name) AS names
+    FROM v_global_access e
+    WHERE e.kind = 'global_read'
+    GROUP BY e.target
+  ) r ON r.target = v.id
+  LEFT JOIN (
+    SELECT e.target,
+      COUNT(DISTINCT e.source) FILTER (WHERE json_extract(e.properties, '$.in_init') IS NULL) AS writers,
+      COUNT(DISTINCT e.source) FILTER (WHERE json_extract(e.properties, '$.in_init') = 1) AS init_writers,
+      COUNT(DISTINCT e.source) FILTER (WHERE json_extract(e.properties, '$.indirect') = 1) AS indirect_writers,
+      json_group_array(DISTINCT e.name) FILTER (WHERE json_extract(e.properties, '$.in_init') IS NULL) AS names,
+      json_group_array(DISTINCT e.name) FILTER (WHERE json_extract(e.properties, '$.in_init') = 1) AS init_names
+    FROM v_global_access e
+    WHERE e.kind = 'global_write'
+    GROUP BY e.target
+  ) w ON w.target = v.id
+  WHERE v.kind = 'local' AND v.parent_function IS NULL
+    AND json_extract(v.properties, '$.decl') = 'var';
+
+CREATE INDEX idx_globals_package ON globals(package);
+
+-- Globals written outside func init() from code a go statement reaches
+-- (the launched function and its transitive callees) by a function that
+-- takes no lock and runs nothing under sync.Once
+INSERT INTO findings (category, severity, node_id, file, line, message, details)
+  WITH RECURSIVE spawned(id) AS (
+    SELECT cs.target FROM edges cs JOIN nodes g ON g.id = cs.source AND g.kind = 'go'
+    WHERE cs.kind = 'call_site'
+    UNION
+    SELECT c.target FROM spawned s JOIN edges c ON c.source = s.id AND c.kind = 'call'
+  )
+  SELECT 'unsynced_global_write', 'warning', w.id, w.file, w.line,
+    'global ' || g.name || ' written without a lock in ' || e.name || ', which a go statement reaches',
+    json_object('variable', g.name, 'variable_id', g.var_id, 'package', g.package,
+                'indirect', COALESCE(json_extract(e.properties, '$.indirect'), 0) = 1)
+  FROM globals g
+  JOIN v_global_access e ON e.target = g.var_id AND e.kind = 'global_write'
+    AND json_extract(e.properties, '$.in_init') IS NULL
+  JOIN nodes w ON w.id = e.source
+  WHERE e.source IN (SELECT id FROM spawned)
+    AND NOT EXISTS (
+      SELECT 1 FROM nodes s
+      WHERE s.parent_function = w.id
+        AND json_extract(s.properties, '$.sync_kind') IN ('mutex_lock', 'rwmutex_lock', 'once_do'))
+  ORDER BY g.package, g.name, w.file, w.line;
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('table', 'globals', 'Package-level variables: type, mutability (read_only, init_only, mutable), and the functions reading and writing them, with writes in func init() apart', 'SELECT name, mutability, writer_count, writers FROM globals WHERE mutability = ''mutable'' ORDER BY writer_count DESC'),
+('view', 'v_global_access', 'global_read and global_write edges with the function name (closures as "<function> (func literal)")', 'SELECT name, kind FROM v_global_access WHERE target = :var_id'),
+('edge_kind', 'global_read', 'Function (closures included)→package-level variable it reads', NULL),
+('edge_kind', 'global_write', 'Function (closures included)→package-level variable it assigns, stores into, or mutates through (map update, slice element, pointee)', 'Properties: {"indirect":true,"in_init":true}');
+
+INSERT INTO queries (name, description, sql) VALUES
+('mutable_globals', 'Package-level variables written outside func init(), most writers first',
+ 'SELECT package, name, type, writer_count, writers FROM globals WHERE mutability = ''mutable'' ORDER BY writer_count DESC, reader_count DESC');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("globals: %w", err)
+	}
+	var count int
+	sqlitex.ExecuteTransient(conn, "SELECT COUNT(*) FROM findings WHERE category = 'unsynced_global_write'",
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			count = stmt.ColumnInt(0)
+			return nil
+		}})
+	prog.Log("Globals: %d writes from goroutine-launched code without a lock", count)
+	return nil
+}
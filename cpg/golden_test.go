@@ -0,0 +1,298 @@
+package cpg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/golden from the current output")
+
+type goldenCase struct {
+	name          string
+	primary       string   // fixture directory under testdata/src
+	modules       []string // additional module directories, relative to primary
+	skipTests     bool
+	keepGenerated bool
+}
+
+// goldenCases are generations over the fixture modules in testdata/src.
+// Escape analysis and git history are skipped: their output depends on the
+// compiler version and on the repository the fixtures are checked into.
+var goldenCases = []goldenCase{
+	{name: "basic", primary: "basic", skipTests: true},
+	{name: "basic_tests", primary: "basic", skipTests: false, keepGenerated: true},
+	{name: "multi", primary: "multi/app", modules: []string{"../lib"}, skipTests: true},
+}
+
+// TestGolden generates each fixture twice, with one worker and with four,
+// checks that both databases are byte-for-byte identical, and compares their
+// table contents with testdata/golden/<name>.golden. Run with -update to
+// accept new output.
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := copyFixtures(t)
+			var dbs [2]string
+			for i, workers := range []int{1, 4} {
+				dbs[i], _ = generateGolden(t, root, tc.name, func(cfg *Config) { cfg.Workers = workers })
+			}
+
+			a, err := os.ReadFile(dbs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(dbs[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(a, b) {
+				t.Errorf("databases generated with 1 and 4 workers differ")
+			}
+
+			got := dumpTables(t, dbs[0], root)
+			if *update {
+				golden := filepath.Join("testdata", "golden", tc.name+".golden")
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			compareGolden(t, tc.name, got)
+		})
+	}
+}
+
+// TestGoldenStream generates each fixture with the graph spilled to a
+// staging database and compares the tables with the golden output of the
+// in-memory build.
+func TestGoldenStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := copyFixtures(t)
+			db, _ := generateGolden(t, root, tc.name, func(cfg *Config) {
+				cfg.Memory = MemoryConfig{Stream: true, SpillDir: t.TempDir()}
+			})
+			compareGolden(t, tc.name, dumpTables(t, db, root))
+		})
+	}
+}
+
+// TestGoldenCache generates each fixture twice with one cache directory: the
+// cold run fills the cache, the second takes every package from it. Both
+// must match the golden output of an uncached build.
+func TestGoldenCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := copyFixtures(t)
+			cacheDir := t.TempDir()
+			for _, run := range []string{"cold", "warm"} {
+				db, gen := generateGolden(t, root, tc.name, func(cfg *Config) { cfg.CacheDir = cacheDir })
+				stats := gen.cache.Stats()
+				switch {
+				case run == "cold" && (stats.Hits != 0 || stats.Written == 0):
+					t.Errorf("cold run: %s, want no hits and fragments written", stats)
+				case run == "warm" && (stats.Hits == 0 || stats.Misses != 0):
+					t.Errorf("warm run: %s, want only hits", stats)
+				}
+				if got := dumpTables(t, db, root); got != readGolden(t, tc.name) {
+					t.Errorf("%s run: tables differ from the golden output:\n%s", run, firstDiff(readGolden(t, tc.name), got))
+				}
+			}
+		})
+	}
+}
+
+// generateGolden generates the golden case name from the fixtures copied to
+// root, with the configuration changed by adjust, and returns the database
+// path and the generator.
+func generateGolden(t *testing.T, root, name string, adjust func(*Config)) (string, *Generator) {
+	t.Helper()
+	i := slices.IndexFunc(goldenCases, func(c goldenCase) bool { return c.name == name })
+	tc := goldenCases[i]
+	primary := filepath.Join(root, tc.primary)
+	return generateFixture(t, primary, func(cfg *Config) {
+		skipGenerated := !tc.keepGenerated
+		cfg.SkipTests = &tc.skipTests
+		cfg.SkipGenerated = &skipGenerated
+		cfg.Output.Validate = true
+		for _, m := range tc.modules {
+			cfg.Modules = append(cfg.Modules, ModuleConfig{Dir: filepath.Join(primary, m)})
+		}
+		adjust(cfg)
+	})
+}
+
+// copyFixtures copies testdata/src out of the repository, so module versions
+// are not derived from its git history, and returns the copy.
+func copyFixtures(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS("testdata/src")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// generateFixture generates the module at primary into a new database,
+// skipping tests, escape analysis, and git history (see goldenCases) unless
+// adjust, if not nil, changes the configuration. It returns the database
+// path and the generator.
+func generateFixture(t *testing.T, primary string, adjust func(*Config)) (string, *Generator) {
+	t.Helper()
+	skipTests := true
+	cfg := &Config{
+		Primary:    primary,
+		SkipTests:  &skipTests,
+		SkipPhases: []string{"escape", "git_history"},
+		Output:     OutputConfig{Path: filepath.Join(t.TempDir(), "cpg.db")},
+	}
+	if adjust != nil {
+		adjust(cfg)
+	}
+	gen, err := NewGenerator(cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gen.Generate(context.Background(), &SQLiteSink{Path: cfg.Output.Path}); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Output.Path, gen
+}
+
+// editBasicFixture edits b/b.go of the basic fixture copied to dir: a new
+// function Helper moves Call and Area down, and Area gains a call to a.Old.
+// Moving a function must not count as a change, so only Helper and the
+// body of Area differ afterwards.
+func editBasicFixture(t *testing.T, dir string) {
+	t.Helper()
+	b := filepath.Join(dir, "b", "b.go")
+	src, err := os.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(src), "//go:noinline", "func Helper() int { return 0 }\n\n//go:noinline", 1)
+	edited = strings.Replace(edited, "return a.Total(", "return a.Old() + a.Total(", 1)
+	if err := os.WriteFile(b, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readGolden returns testdata/golden/<name>.golden.
+func readGolden(t *testing.T, name string) string {
+	t.Helper()
+	want, err := os.ReadFile(filepath.Join("testdata", "golden", name+".golden"))
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	return string(want)
+}
+
+// compareGolden reports where got departs from the golden output of name.
+func compareGolden(t *testing.T, name, got string) {
+	t.Helper()
+	if want := readGolden(t, name); got != want {
+		t.Errorf("tables differ from testdata/golden/%s.golden (run with -update to accept):\n%s", name, firstDiff(want, got))
+	}
+}
+
+// dumpTables renders every table of the database at path in storage order,
+// one row per line. SQLite's own tables, the FTS shadow tables, and the
+// static schema_docs and queries tables are skipped; root is replaced by
+// $ROOT, and long text values are replaced by their length and hash.
+func dumpTables(t *testing.T, path, root string) string {
+	t.Helper()
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var tables []string
+	err = sqlitex.ExecuteTransient(conn,
+		`SELECT name FROM sqlite_master
+		 WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'sources_fts%'
+		   AND name NOT IN ('schema_docs', 'queries')
+		 ORDER BY name`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			tables = append(tables, stmt.ColumnText(0))
+			return nil
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	for _, table := range tables {
+		var rows []string
+		err := sqlitex.ExecuteTransient(conn, fmt.Sprintf(`SELECT * FROM %q`, table),
+			&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+				cols := make([]string, stmt.ColumnCount())
+				for i := range cols {
+					cols[i] = dumpValue(stmt, i, root)
+				}
+				rows = append(rows, strings.Join(cols, "|"))
+				return nil
+			}})
+		if err != nil {
+			t.Fatalf("dump %s: %v", table, err)
+		}
+		fmt.Fprintf(&buf, "== %s (%d rows)\n", table, len(rows))
+		for _, r := range rows {
+			buf.WriteString(r + "\n")
+		}
+	}
+	return buf.String()
+}
+
+func dumpValue(stmt *sqlite.Stmt, i int, root string) string {
+	switch stmt.ColumnType(i) {
+	case sqlite.TypeNull:
+		return "NULL"
+	case sqlite.TypeInteger, sqlite.TypeFloat:
+		return stmt.ColumnText(i)
+	}
+	s := strings.ReplaceAll(stmt.ColumnText(i), root, "$ROOT")
+	if len(s) > 160 {
+		return fmt.Sprintf("<%d bytes sha256:%x>", len(s), sha256.Sum256([]byte(s)))
+	}
+	return strconv.Quote(s)
+}
+
+// firstDiff describes the first line where got departs from want.
+func firstDiff(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\nwant: %s\ngot:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -1,4 +1,4 @@
-package main
+package cpg
 
 import (
 	"fmt"
@@ -19,9 +19,10 @@ func StmtID(pkg, file string, line, col int, kind string) string {
 	return fmt.Sprintf("%s::@%s:%d:%d:%s", pkg, file, line, col, kind)
 }
 
-// PkgID generates a node ID for a package.
-func PkgID(pkgPath string) string {
-	return fmt.Sprintf("pkg::%s", modSet.RelPkg(pkgPath))
+// PkgID generates a node ID for a package from its relative import path
+// (ModuleSet.RelPkg).
+func PkgID(relPkg string) string {
+	return fmt.Sprintf("pkg::%s", relPkg)
 }
 
 // FileID generates a node ID for a source file.
@@ -0,0 +1,560 @@
+package cpg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// FileHash records the content hash of one analyzed source file together with
+// the package it belongs to.
+type FileHash struct {
+	PkgPath string // full import path of the owning package
+	Hash    string // hex-encoded SHA-256 of the file content
+}
+
+// HashPackageFiles hashes every compiled Go file that the pipeline analyzes
+// (respecting the module set's file filter), keyed by module-relative path.
+// Skipped files do not contribute to the CPG, so edits to them never trigger
+// re-analysis.
+func HashPackageFiles(ms *ModuleSet, pkgs []*packages.Package) map[string]FileHash {
+	hashes := make(map[string]FileHash)
+	for _, pkg := range pkgs {
+		for _, absFile := range pkg.CompiledGoFiles {
+			relFile := ms.RelFile(absFile)
+			if relFile == "" || ms.SkipFile(absFile, relFile) {
+				continue
+			}
+			content, err := os.ReadFile(absFile)
+			if err != nil {
+				continue
+			}
+			sum := sha256.Sum256(content)
+			hashes[relFile] = FileHash{PkgPath: pkg.PkgPath, Hash: hex.EncodeToString(sum[:])}
+		}
+	}
+	return hashes
+}
+
+// IncrementalPlan describes which packages an -incremental run re-analyzes.
+type IncrementalPlan struct {
+	Changed  map[string]bool   // import paths with edited, added, or removed files
+	Affected map[string]bool   // Changed plus every transitive reverse dependency
+	Removed  map[string]string // import path → relative package for packages that no longer exist
+	Modules  []ModuleInfo      // modules owning a changed package (escape analysis reruns)
+}
+
+// UpToDate reports whether no analyzed file changed since the previous run.
+func (p *IncrementalPlan) UpToDate() bool {
+	return len(p.Changed) == 0
+}
+
+// stalePackages returns the relative package names whose rows are replaced.
+func (p *IncrementalPlan) stalePackages(ms *ModuleSet) []string {
+	seen := make(map[string]bool)
+	for pkgPath := range p.Affected {
+		seen[ms.RelPkg(pkgPath)] = true
+	}
+	for _, rel := range p.Removed {
+		seen[rel] = true
+	}
+	out := make([]string, 0, len(seen))
+	for rel := range seen {
+		out = append(out, rel)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// PlanIncremental compares the current file hashes with the ones stored in the
+// existing database at dbPath and derives the set of packages to re-analyze.
+// It returns a nil plan when there is no usable previous database (missing
+// file, or one generated before file_hashes existed); callers then fall back
+// to a full rebuild. A previous run with a different phase selection also
+// forces a full rebuild, since its base tables hold different edge kinds.
+func PlanIncremental(dbPath string, ms *ModuleSet, pkgs []*packages.Package, current map[string]FileHash, phases *PhaseSet, prog *Progress) (*IncrementalPlan, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		prog.Log("Incremental: %s does not exist, running a full build", dbPath)
+		return nil, nil
+	}
+
+	conn, err := sqlite.OpenConn(dbPath, sqlite.OpenReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dbPath, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if !tableExists(conn, "file_hashes") {
+		prog.Log("Incremental: %s has no file_hashes table, running a full build", dbPath)
+		return nil, nil
+	}
+	if !columnExists(conn, "modules", "source") {
+		prog.Log("Incremental: %s predates modules.source, running a full build", dbPath)
+		return nil, nil
+	}
+	if !columnExists(conn, "nodes", "end_offset") {
+		prog.Log("Incremental: %s predates node spans, running a full build", dbPath)
+		return nil, nil
+	}
+
+	// The phases table is written last, so without it the previous run
+	// was interrupted while building derived tables.
+	if !tableExists(conn, "phases") {
+		prog.Log("Incremental: %s is incomplete (an earlier run was interrupted), running a full build", dbPath)
+		return nil, nil
+	}
+	var storedSkipped []string
+	if err := sqlitex.ExecuteTransient(conn,
+		`SELECT name FROM phases WHERE status = 'skipped' ORDER BY rowid`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				storedSkipped = append(storedSkipped, stmt.ColumnText(0))
+				return nil
+			},
+		}); err != nil {
+		return nil, fmt.Errorf("read phases: %w", err)
+	}
+	if !slices.Equal(storedSkipped, phases.Skipped()) {
+		prog.Log("Incremental: phase selection differs from the previous run, running a full build")
+		return nil, nil
+	}
+
+	type storedFile struct{ pkgPath, relPkg, hash string }
+	stored := make(map[string]storedFile)
+	if err := sqlitex.ExecuteTransient(conn,
+		`SELECT file, pkg_path, package, hash FROM file_hashes`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				stored[stmt.ColumnText(0)] = storedFile{
+					pkgPath: stmt.ColumnText(1),
+					relPkg:  stmt.ColumnText(2),
+					hash:    stmt.ColumnText(3),
+				}
+				return nil
+			},
+		}); err != nil {
+		return nil, fmt.Errorf("read file hashes: %w", err)
+	}
+
+	plan := &IncrementalPlan{
+		Changed: make(map[string]bool),
+		Removed: make(map[string]string),
+	}
+
+	// Edited or new files
+	for file, h := range current {
+		if old, ok := stored[file]; !ok || old.hash != h.Hash || old.pkgPath != h.PkgPath {
+			plan.Changed[h.PkgPath] = true
+		}
+	}
+
+	// Deleted files; a package disappears entirely when none of its files remain
+	livePkgs := make(map[string]bool, len(pkgs))
+	for _, pkg := range pkgs {
+		livePkgs[pkg.PkgPath] = true
+	}
+	for file, old := range stored {
+		if _, ok := current[file]; ok {
+			continue
+		}
+		plan.Changed[old.pkgPath] = true
+		if !livePkgs[old.pkgPath] {
+			plan.Removed[old.pkgPath] = old.relPkg
+		}
+	}
+
+	plan.Affected = reverseDependencies(pkgs, plan.Changed)
+
+	seenMods := make(map[string]bool)
+	for pkgPath := range plan.Changed {
+		if _, gone := plan.Removed[pkgPath]; gone {
+			continue
+		}
+		if m, ok := ms.ModuleOf(pkgPath); ok && !seenMods[m.Dir] {
+			seenMods[m.Dir] = true
+			plan.Modules = append(plan.Modules, m)
+		}
+	}
+
+	prog.Log("Incremental: %d changed packages, %d affected including reverse dependencies, %d removed",
+		len(plan.Changed), len(plan.Affected), len(plan.Removed))
+	return plan, nil
+}
+
+// reverseDependencies returns changed plus every loaded package that
+// transitively imports one of them.
+func reverseDependencies(pkgs []*packages.Package, changed map[string]bool) map[string]bool {
+	importers := make(map[string][]string)
+	for _, pkg := range pkgs {
+		for impPath := range pkg.Imports {
+			importers[impPath] = append(importers[impPath], pkg.PkgPath)
+		}
+	}
+
+	affected := make(map[string]bool, len(changed))
+	queue := make([]string, 0, len(changed))
+	for pkgPath := range changed {
+		affected[pkgPath] = true
+		queue = append(queue, pkgPath)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, imp := range importers[cur] {
+			if !affected[imp] {
+				affected[imp] = true
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return affected
+}
+
+// UpdateDB splices a partial CPG (built with cpg.Restrict(plan.Affected)) into
+// the existing database at path: rows belonging to stale packages are replaced,
+// and fan-in/fan-out are recounted from the merged call edges. Call edges
+// between two unaffected packages are kept as they were.
+//
+// Derived data that belongs to one package is only recomputed for stale
+// packages: heuristic DFG and EOG edges (per call site), the sources_fts
+// index (per file), and orphan_edges. The remaining derived tables are global
+// aggregates and are rebuilt from the updated base tables: their rows depend
+// on fan-in or on edges across packages (findings, risk and hotspot scores,
+// dead code, coupling, file and package dependency graphs), on rankings or
+// totals over the whole graph (stats, dashboards, top-N tables), or on paths
+// through it (error chains, taint flow states, communication patterns).
+//
+// Once ctx is done the running statement is interrupted. The base tables
+// are updated in one transaction, so an interrupted splice leaves the
+// previous database; interrupted after that, the database lacks its derived
+// tables and the next incremental run rebuilds it from scratch.
+func UpdateDB(ctx context.Context, path string, cpg *CPG, plan *IncrementalPlan, escapeResults []EscapeResult, opts DBOptions, prog *Progress) (err error) {
+	prog.Log("Updating SQLite at %s ...", path)
+
+	conn, err := openDB(path)
+	if err != nil {
+		return err
+	}
+	conn.SetInterrupt(ctx.Done())
+	defer func() {
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			prog.Log("Interrupted; %s is incomplete until the next run", path)
+			err = ctx.Err()
+		}
+	}()
+
+	stalePkgs := plan.stalePackages(opts.Modules)
+	stale := make(map[string]bool, len(stalePkgs))
+	for _, rel := range stalePkgs {
+		stale[rel] = true
+	}
+
+	// Fresh rows: everything the restricted pipeline produced for stale packages,
+	// plus external stubs (deduplicated on insert) and the metadata node.
+	var nodes []Node
+	fresh := make(map[string]bool)
+	for n := range cpg.SortedNodes() {
+		switch {
+		case stale[n.Package] && !strings.HasPrefix(n.ID, "ext::"):
+			fresh[n.ID] = true
+			nodes = append(nodes, n)
+		case strings.HasPrefix(n.ID, "ext::"), n.ID == "META_DATA":
+			nodes = append(nodes, n)
+		}
+	}
+	var edges []Edge
+	for e := range cpg.SortedEdges() {
+		if fresh[e.Source] || fresh[e.Target] {
+			edges = append(edges, e)
+		}
+	}
+	sources := func(yield func(file, content string) bool) {
+		for file, content := range cpg.AllSources() {
+			if h, ok := cpg.FileHashes[file]; ok && plan.Affected[h.PkgPath] {
+				if !yield(file, content) {
+					return
+				}
+			}
+		}
+	}
+	metrics := make(map[string]*Metrics)
+	for id, m := range cpg.Metrics {
+		if fresh[id] || strings.HasPrefix(id, "ext::") {
+			metrics[id] = m
+		}
+	}
+
+	if err := cpg.Err(); err != nil {
+		return err
+	}
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+
+	if err := deleteStaleRows(conn, stalePkgs, plan.Modules, prog); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertNodes(conn, slices.Values(nodes), prog); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertEdges(conn, slices.Values(edges), prog); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertSources(conn, sources, prog); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertMetrics(conn, metrics, prog); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertFileHashes(conn, opts.Modules, cpg.FileHashes); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := indexStaleSources(conn); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertEscapeAnnotations(conn, escapeResults); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := insertModules(conn, opts.Modules.Dirs()); err != nil {
+		endFn(&err)
+		return err
+	}
+	if err := recountFanInOut(conn); err != nil {
+		endFn(&err)
+		return err
+	}
+
+	endFn(&err)
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	if err := updateBaseSnapshot(conn, opts.Snapshot, prog); err != nil {
+		return err
+	}
+
+	prog.Log("Dropping derived tables...")
+	if err := dropDerived(conn); err != nil {
+		return err
+	}
+	return buildDerived(ctx, conn, path, opts, true, prog)
+}
+
+// deleteStaleRows removes base-table rows owned by stale packages together
+// with their heuristic DFG and EOG edges, full-text index entries, and orphan
+// edges, and escape annotations of the modules whose escape analysis was
+// rerun.
+func deleteStaleRows(conn *sqlite.Conn, stalePkgs []string, mods []ModuleInfo, prog *Progress) error {
+	if err := sqlitex.ExecuteScript(conn, `
+DROP TABLE IF EXISTS temp.stale_pkgs;
+DROP TABLE IF EXISTS temp.stale_nodes;
+CREATE TEMP TABLE stale_pkgs (package TEXT PRIMARY KEY);
+CREATE TEMP TABLE stale_nodes (id TEXT PRIMARY KEY);
+`, nil); err != nil {
+		return fmt.Errorf("stale temp tables: %w", err)
+	}
+	for _, rel := range stalePkgs {
+		if err := sqlitex.Execute(conn, `INSERT OR IGNORE INTO stale_pkgs (package) VALUES (?)`,
+			&sqlitex.ExecOptions{Args: []any{rel}}); err != nil {
+			return err
+		}
+	}
+	for _, m := range mods {
+		if err := sqlitex.Execute(conn, `DELETE FROM escape_annotations WHERE module = ?`,
+			&sqlitex.ExecOptions{Args: []any{m.Prefix}}); err != nil {
+			return err
+		}
+	}
+
+	if err := sqlitex.ExecuteScript(conn, `
+INSERT INTO stale_nodes (id)
+  SELECT id FROM nodes
+  WHERE package IN (SELECT package FROM stale_pkgs) AND id NOT LIKE 'ext::%';
+INSERT OR IGNORE INTO stale_nodes (id) VALUES ('META_DATA');
+`, nil); err != nil {
+		return fmt.Errorf("stale nodes: %w", err)
+	}
+	// An external-content FTS5 index drops a row given its indexed values,
+	// so stale files leave it before their sources rows do.
+	if tableExists(conn, "sources_fts") {
+		if err := sqlitex.ExecuteScript(conn, `
+INSERT INTO sources_fts (sources_fts, rowid, file, content, package)
+  SELECT 'delete', rowid, file, content, package FROM sources WHERE file IN (
+    SELECT file FROM file_hashes WHERE package IN (SELECT package FROM stale_pkgs));
+`, nil); err != nil {
+			return fmt.Errorf("delete stale fts rows: %w", err)
+		}
+	}
+	if tableExists(conn, "orphan_edges") {
+		if err := sqlitex.ExecuteScript(conn, `
+DELETE FROM orphan_edges WHERE source IN (SELECT id FROM stale_nodes) OR target IN (SELECT id FROM stale_nodes);
+`, nil); err != nil {
+			return fmt.Errorf("delete stale orphan edges: %w", err)
+		}
+	}
+
+	// Heuristic DFG and EOG edges connect argument nodes of one call, so
+	// those of stale call sites go with the nodes.
+	if err := sqlitex.ExecuteScript(conn, `
+DELETE FROM edges WHERE source IN (SELECT id FROM stale_nodes) OR target IN (SELECT id FROM stale_nodes);
+DELETE FROM metrics WHERE function_id IN (SELECT id FROM stale_nodes);
+DELETE FROM nodes WHERE id IN (SELECT id FROM stale_nodes);
+DELETE FROM sources WHERE file IN (
+  SELECT file FROM file_hashes WHERE package IN (SELECT package FROM stale_pkgs));
+DELETE FROM file_hashes;
+`, nil); err != nil {
+		return fmt.Errorf("delete stale rows: %w", err)
+	}
+
+	var staleNodes int64
+	_ = sqlitex.ExecuteTransient(conn, `SELECT COUNT(*) FROM stale_nodes`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				staleNodes = stmt.ColumnInt64(0)
+				return nil
+			},
+		})
+	prog.Log("Removed %d stale nodes across %d packages", staleNodes, len(stalePkgs))
+	return nil
+}
+
+// indexStaleSources adds the fresh sources rows of stale packages to
+// sources_fts, when the fts phase created it.
+func indexStaleSources(conn *sqlite.Conn) error {
+	if !tableExists(conn, "sources_fts") {
+		return nil
+	}
+	if err := sqlitex.ExecuteScript(conn, `
+INSERT INTO sources_fts (rowid, file, content, package)
+  SELECT rowid, file, content, package FROM sources WHERE file IN (
+    SELECT file FROM file_hashes WHERE package IN (SELECT package FROM stale_pkgs));
+`, nil); err != nil {
+		return fmt.Errorf("index stale sources: %w", err)
+	}
+	return nil
+}
+
+// recountFanInOut recomputes fan-in/fan-out for every metrics row from the
+// merged call edges, adding minimal rows for call endpoints that have none
+// (mirroring ComputeFanInOut) and dropping rows whose function vanished.
+func recountFanInOut(conn *sqlite.Conn) error {
+	return sqlitex.ExecuteScript(conn, `
+INSERT OR IGNORE INTO metrics (function_id, cyclomatic_complexity, fan_in, fan_out, loc, num_params)
+  SELECT DISTINCT target, 0, 0, 0, 0, 0 FROM edges WHERE kind = 'call';
+INSERT OR IGNORE INTO metrics (function_id, cyclomatic_complexity, fan_in, fan_out, loc, num_params)
+  SELECT DISTINCT source, 0, 0, 0, 0, 0 FROM edges WHERE kind = 'call';
+DELETE FROM metrics WHERE function_id NOT IN (SELECT id FROM nodes);
+UPDATE metrics SET
+  fan_in = (SELECT COUNT(*) FROM edges e WHERE e.kind = 'call' AND e.target = metrics.function_id),
+  fan_out = (SELECT COUNT(*) FROM edges e WHERE e.kind = 'call' AND e.source = metrics.function_id);
+`, nil)
+}
+
+// baseTables are the tables written directly from the in-memory CPG. Every
+// other table and view is derived and rebuilt by buildDerived, except the
+// per-package ones in keptTables.
+var baseTables = map[string]bool{
+	"nodes":              true,
+	"edges":              true,
+	"sources":            true,
+	"metrics":            true,
+	"modules":            true,
+	"file_hashes":        true,
+	"escape_annotations": true,
+	"snapshots":          true,
+	"snapshot_nodes":     true,
+	"snapshot_edges":     true,
+}
+
+// keptTables are derived tables that deleteStaleRows and indexStaleSources
+// update per package, so dropDerived leaves them (and the FTS5 shadow tables
+// named sources_fts_*) in place.
+var keptTables = map[string]bool{
+	"sources_fts":  true,
+	"orphan_edges": true,
+}
+
+// dropDerived drops every view and every table that is neither a base table
+// nor kept, so buildDerived can recreate them against the updated base tables.
+func dropDerived(conn *sqlite.Conn) error {
+	var views, tables []string
+	if err := sqlitex.ExecuteTransient(conn,
+		`SELECT type, name FROM sqlite_master
+		 WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+		 ORDER BY name`,
+		&sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				name := stmt.ColumnText(1)
+				if baseTables[name] || keptTables[name] || strings.HasPrefix(name, "sources_fts_") {
+					return nil
+				}
+				if stmt.ColumnText(0) == "view" {
+					views = append(views, name)
+				} else {
+					tables = append(tables, name)
+				}
+				return nil
+			},
+		}); err != nil {
+		return fmt.Errorf("list derived tables: %w", err)
+	}
+
+	var script strings.Builder
+	for _, v := range views {
+		fmt.Fprintf(&script, "DROP VIEW IF EXISTS %q;\n", v)
+	}
+	for _, t := range tables {
+		fmt.Fprintf(&script, "DROP TABLE IF EXISTS %q;\n", t)
+	}
+	if err := sqlitex.ExecuteScript(conn, script.String(), nil); err != nil {
+		return fmt.Errorf("drop derived tables: %w", err)
+	}
+	return nil
+}
+
+// tableExists reports whether a table or view named name exists.
+func tableExists(conn *sqlite.Conn, name string) bool {
+	var found bool
+	_ = sqlitex.Execute(conn, `SELECT 1 FROM sqlite_master WHERE name = ? AND type IN ('table', 'view')`,
+		&sqlitex.ExecOptions{
+			Args: []any{name},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				return nil
+			},
+		})
+	return found
+}
+
+func columnExists(conn *sqlite.Conn, table, column string) bool {
+	var found bool
+	_ = sqlitex.Execute(conn, `SELECT 1 FROM pragma_table_info(?) WHERE name = ?`,
+		&sqlitex.ExecOptions{
+			Args: []any{table, column},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				found = true
+				return nil
+			},
+		})
+	return found
+}
@@ -0,0 +1,362 @@
+package cpg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// LoadResult holds the output of package loading.
+type LoadResult struct {
+	Packages []*packages.Package
+	Fset     *token.FileSet
+}
+
+// CreateTempGoWork writes a temporary go.work file that includes all modules
+// in the ModuleSet. Returns the path to the temp file (caller must
+// RemoveTempGoWork).
+//
+// Sub-modules (nested go.mod files) are discovered automatically. When two
+// directories declare the same module path (e.g. alertmanager/internal/tools
+// and prometheus/internal/tools both declare
+// "github.com/prometheus/prometheus/internal/tools"), only the first
+// directory found is included to avoid Go workspace "appears multiple times"
+// errors. First-wins semantics match the module ordering in the ModuleSet.
+func CreateTempGoWork(ms *ModuleSet) (string, error) {
+	var buf strings.Builder
+	buf.WriteString("go 1.25.7\n\nuse (\n")
+
+	// seenModPaths tracks declared module paths → directory to prevent
+	// duplicate module paths in the workspace (which Go rejects).
+	seenModPaths := make(map[string]string)
+
+	// Collect top-level module dirs for dedup against discovered sub-modules.
+	topDirs := make(map[string]bool, len(ms.Dirs()))
+	for _, m := range ms.Dirs() {
+		buf.WriteString("\t" + m.Dir + "\n")
+		topDirs[m.Dir] = true
+		if mp, err := ReadModulePath(m.Dir); err == nil {
+			seenModPaths[mp] = m.Dir
+		}
+	}
+
+	// Walk ALL module directories (not just primary) to find nested sub-modules
+	// with their own go.mod. Deduplicate against already-listed top-level dirs
+	// and against already-seen module paths (two different directories can
+	// declare the same module path, e.g. across repos with shared tooling).
+	for _, m := range ms.Dirs() {
+		for _, d := range findSubModules(m.Dir) {
+			if topDirs[d] {
+				continue
+			}
+			if mp, err := ReadModulePath(d); err == nil {
+				if prev, dup := seenModPaths[mp]; dup {
+					// Skip: another directory already provides this module path.
+					_ = prev // could log: "skipping %s (duplicate of %s)", d, prev
+					continue
+				}
+				seenModPaths[mp] = d
+			}
+			buf.WriteString("\t" + d + "\n")
+			topDirs[d] = true // prevent duplicates across module walks
+		}
+	}
+
+	buf.WriteString(")\n")
+
+	f, err := os.CreateTemp("", "cpg-workspace-*.work")
+	if err != nil {
+		return "", fmt.Errorf("create temp go.work: %w", err)
+	}
+	if _, err := f.WriteString(buf.String()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write go.work: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// RemoveTempGoWork removes a go.work file from CreateTempGoWork together
+// with the go.work.sum the go command may have written next to it.
+func RemoveTempGoWork(path string) {
+	_ = os.Remove(path)
+	_ = os.Remove(path + ".sum")
+}
+
+// findSubModules walks dir looking for directories with go.mod (excluding dir itself).
+func findSubModules(dir string) []string {
+	var dirs []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // skip errors
+		}
+		if info.IsDir() {
+			// Skip vendor, testdata, and hidden dirs
+			base := filepath.Base(path)
+			if base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "go.mod" && path != filepath.Join(dir, "go.mod") {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	return dirs
+}
+
+// LoadPackages loads all Go packages from all modules via a workspace under
+// the given build configuration, filtering to only packages belonging to
+// known modules.
+func LoadPackages(ctx context.Context, ms *ModuleSet, goworkPath string, platform Platform, prog *Progress) (*LoadResult, error) {
+	if platform.GOOS != "" {
+		prog.Log("Loading packages via workspace (%d modules, %s)...", len(ms.Dirs()), platform.Name())
+	} else {
+		prog.Log("Loading packages via workspace (%d modules)...", len(ms.Dirs()))
+	}
+
+	fset := token.NewFileSet()
+	filtered, errCount, err := loadFiltered(ctx, ms, goworkPath, platform, fset,
+		packages.NeedName|
+			packages.NeedFiles|
+			packages.NeedCompiledGoFiles|
+			packages.NeedImports|
+			packages.NeedDeps|
+			packages.NeedTypes|
+			packages.NeedSyntax|
+			packages.NeedTypesInfo|
+			packages.NeedTypesSizes|
+			packages.NeedEmbedFiles, prog)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count files and LOC (respecting skip filters)
+	var fileCount, loc int
+	for _, pkg := range filtered {
+		for i, f := range pkg.CompiledGoFiles {
+			if ms.SkipFile(f, ms.RelFile(f)) {
+				continue
+			}
+			fileCount++
+			if i < len(pkg.Syntax) {
+				end := fset.Position(pkg.Syntax[i].End())
+				loc += end.Line
+			}
+		}
+	}
+
+	prog.Log("Loaded %d packages (%d files, ~%dk LOC)", len(filtered), fileCount, loc/1000)
+	if errCount > 0 {
+		prog.Log("  %d packages had type-check errors (continuing)", errCount)
+	}
+
+	return &LoadResult{
+		Packages: filtered,
+		Fset:     fset,
+	}, nil
+}
+
+// ListPackages lists the same packages LoadPackages would load, with their
+// files and imports but without parsing or type-checking them. It is enough
+// to hash files and compute cache keys.
+func ListPackages(ctx context.Context, ms *ModuleSet, goworkPath string, platform Platform, prog *Progress) ([]*packages.Package, error) {
+	pkgs, _, err := loadFiltered(ctx, ms, goworkPath, platform, token.NewFileSet(),
+		packages.NeedName|packages.NeedFiles|packages.NeedCompiledGoFiles|packages.NeedImports, prog)
+	if err != nil {
+		return nil, err
+	}
+	prog.Verbose("Listed %d packages", len(pkgs))
+	return pkgs, nil
+}
+
+// loadFiltered runs packages.Load with mode over every module and keeps the
+// packages that belong to known modules, returning how many have errors.
+func loadFiltered(ctx context.Context, ms *ModuleSet, goworkPath string, platform Platform, fset *token.FileSet, mode packages.LoadMode, prog *Progress) ([]*packages.Package, int, error) {
+	cfg := &packages.Config{
+		Context:    ctx,
+		Mode:       mode,
+		Dir:        ms.PrimaryDir(),
+		Fset:       fset,
+		Tests:      !ms.files.SkipTests,
+		Env:        platform.env(workspaceEnv(os.Environ(), goworkPath)),
+		BuildFlags: platform.buildFlags(),
+	}
+
+	initial, err := packages.Load(cfg, ms.LoadPatterns()...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("packages.Load: %w", err)
+	}
+
+	// With Tests enabled, go/packages returns each tested package twice: the
+	// plain package and its test variant "p [p.test]", which adds the
+	// in-package _test.go files. Keep only the test variant (a superset), the
+	// external "p_test [p.test]" packages, and drop the synthesized ".test"
+	// main packages.
+	hasTestVariant := make(map[string]bool)
+	for _, pkg := range initial {
+		if pkg.ForTest != "" && pkg.PkgPath == pkg.ForTest {
+			hasTestVariant[pkg.PkgPath] = true
+		}
+	}
+
+	// Filter to known module packages only
+	filtered := make([]*packages.Package, 0, len(initial))
+	var errCount int
+	for _, pkg := range initial {
+		if !ms.IsKnownPkg(pkg.PkgPath) {
+			continue
+		}
+		if strings.HasSuffix(pkg.PkgPath, ".test") && pkg.Name == "main" {
+			continue
+		}
+		if pkg.ForTest == "" && hasTestVariant[pkg.PkgPath] {
+			continue
+		}
+		if len(pkg.Errors) > 0 {
+			errCount++
+			prog.Verbose("  warning: %s has %d errors: %v", pkg.PkgPath, len(pkg.Errors), pkg.Errors[0])
+		}
+		filtered = append(filtered, pkg)
+	}
+	return filtered, errCount, nil
+}
+
+// FileFilter selects the module files a generation analyzes.
+type FileFilter struct {
+	SkipTests     bool     // skip _test.go files and test packages
+	SkipGenerated bool     // skip generated files (see IsGeneratedFile)
+	Include       []string // module-relative globs; empty means all files
+	Exclude       []string // module-relative globs; checked after Include
+}
+
+// workspaceEnv returns environ for go commands run in the workspace at
+// goworkPath. A -mod flag in GOFLAGS, such as the -mod=mod often set along
+// with a local module proxy, is dropped because workspace mode rejects it;
+// modules missing from the cache are still downloaded through GOPROXY.
+func workspaceEnv(environ []string, goworkPath string) []string {
+	environ = replaceEnv(environ, "GOWORK", goworkPath)
+	for _, e := range environ {
+		flags, ok := strings.CutPrefix(e, "GOFLAGS=")
+		if !ok {
+			continue
+		}
+		kept := slices.DeleteFunc(strings.Fields(flags), func(f string) bool {
+			return strings.HasPrefix(f, "-mod=") || strings.HasPrefix(f, "--mod=")
+		})
+		return replaceEnv(environ, "GOFLAGS", strings.Join(kept, " "))
+	}
+	return environ
+}
+
+// replaceEnv returns a copy of environ with key set to val, replacing any
+// existing entry for key. This avoids duplicate env vars which have
+// platform-dependent behavior (last-wins on Linux, first-wins on some BSDs).
+func replaceEnv(environ []string, key, val string) []string {
+	prefix := key + "="
+	result := make([]string, 0, len(environ)+1)
+	for _, e := range environ {
+		if !strings.HasPrefix(e, prefix) {
+			result = append(result, e)
+		}
+	}
+	return append(result, prefix+val)
+}
+
+// Skip returns true for test files and for files outside the
+// include/exclude globs. path is module-relative. Generated files are
+// recognized by their content, see ModuleSet.SkipFile.
+func (f FileFilter) Skip(path string) bool {
+	base := BaseName(path)
+	if f.SkipTests && strings.HasSuffix(base, "_test.go") {
+		return true
+	}
+	if len(f.Include) > 0 && !matchAnyGlob(f.Include, path) {
+		return true
+	}
+	return matchAnyGlob(f.Exclude, path)
+}
+
+// SkipFile reports whether the file at absPath, with module-relative path
+// relPath, is filtered out of the analysis.
+func (ms *ModuleSet) SkipFile(absPath, relPath string) bool {
+	if ms.files.Skip(relPath) {
+		return true
+	}
+	return ms.files.SkipGenerated && ms.IsGenerated(absPath)
+}
+
+// IsGenerated reports whether the file at absPath is generated code (see
+// IsGeneratedFile). Results are cached, as every phase asks about each file.
+func (ms *ModuleSet) IsGenerated(absPath string) bool {
+	if v, ok := ms.generated.Load(absPath); ok {
+		return v.(bool)
+	}
+	gen := IsGeneratedFile(absPath)
+	ms.generated.Store(absPath, gen)
+	return gen
+}
+
+// generatedHeader is the marker of generated Go files
+// (https://go.dev/s/generatedcode).
+var generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// generatedNames are base-name globs of generator output that may lack the
+// standard header: Kubernetes code generators, goyacc, protoc, and the
+// common *_generated.go convention.
+var generatedNames = []string{"zz_generated*.go", "*.y.go", "y.go", "*.pb.go", "*_generated.go"}
+
+// IsGeneratedFile reports whether the Go file at absPath is generated: it
+// carries the standard "// Code generated ... DO NOT EDIT." comment before
+// its package clause, or has a well-known generator output name.
+func IsGeneratedFile(absPath string) bool {
+	if matchAnyGlob(generatedNames, filepath.Base(absPath)) {
+		return true
+	}
+	f, err := os.Open(absPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	inBlock := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case inBlock:
+			inBlock = !strings.Contains(line, "*/")
+		case generatedHeader.MatchString(line):
+			return true
+		case line == "" || strings.HasPrefix(line, "//"):
+		case strings.HasPrefix(line, "/*"):
+			inBlock = !strings.Contains(line[2:], "*/")
+		default:
+			return false // the package clause or other code
+		}
+	}
+	return false
+}
+
+// matchAnyGlob reports whether path matches one of patterns.
+func matchAnyGlob(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, path) {
+			return true
+		}
+	}
+	return false
+}
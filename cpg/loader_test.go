@@ -0,0 +1,60 @@
+package cpg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFileFilter checks generated-file detection and the include/exclude
+// glob forms.
+func TestFileFilter(t *testing.T) {
+	dir := t.TempDir()
+	for name, want := range map[string]struct {
+		src       string
+		generated bool
+	}{
+		"plain.go":            {"// Package a does things.\npackage a\n", false},
+		"header.go":           {"// Copyright 2024 The Authors.\n\n// Code generated by stringer -type=Mode; DO NOT EDIT.\n\npackage a\n", true},
+		"block.go":            {"/*\nLicense text.\n*/\n\n// Code generated by mockgen. DO NOT EDIT.\npackage a\n", true},
+		"late.go":             {"package a\n\n// Code generated by hand. DO NOT EDIT.\n", false},
+		"zz_generated.api.go": {"package a\n", true},
+		"parser.y.go":         {"package a\n", true},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(want.src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := IsGeneratedFile(path); got != want.generated {
+			t.Errorf("IsGeneratedFile(%s) = %v, want %v", name, got, want.generated)
+		}
+	}
+
+	f := FileFilter{
+		SkipTests: true,
+		Exclude:   []string{"web/ui", "documentation/examples/", "**/mock_*.go"},
+	}
+	for path, skip := range map[string]bool{
+		"web/ui/ui.go":                          true,
+		"web/web.go":                            false,
+		"documentation/examples/remote/main.go": true,
+		"tsdb/mock_db.go":                       true,
+		"tsdb/db.go":                            false,
+		"tsdb/db_test.go":                       true,
+	} {
+		if got := f.Skip(path); got != skip {
+			t.Errorf("Skip(%s) = %v, want %v", path, got, skip)
+		}
+	}
+	f = FileFilter{Include: []string{"tsdb", "cmd/*/main.go"}}
+	for path, skip := range map[string]bool{
+		"tsdb/chunks/chunk.go":   false,
+		"cmd/prometheus/main.go": false,
+		"cmd/prometheus/flag.go": true,
+		"web/web.go":             true,
+	} {
+		if got := f.Skip(path); got != skip {
+			t.Errorf("Skip(%s) with include = %v, want %v", path, got, skip)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// moduleDownloadTimeout bounds `go mod download` for a module@version that
+// is not in the module cache yet.
+const moduleDownloadTimeout = 5 * time.Minute
+
+// IsModuleSpec reports whether s is a module@version spec such as
+// "github.com/prometheus/alertmanager@v0.27.0" rather than a directory.
+// The module path must be valid and its first element must look like a
+// domain name, so a local directory containing "@" is not mistaken for one.
+func IsModuleSpec(s string) bool {
+	path, version, ok := strings.Cut(s, "@")
+	if !ok || version == "" || module.CheckPath(path) != nil {
+		return false
+	}
+	first, _, _ := strings.Cut(path, "/")
+	return strings.Contains(first, ".")
+}
+
+// resolveModuleSpec returns the directory and exact version of a
+// module@version spec. A canonical version that is already extracted in the
+// module cache (GOMODCACHE) is used as is, without network access.
+// Otherwise `go mod download` fetches it through GOPROXY, which may be a
+// local file:// proxy, and resolves queries such as @latest. Cancelling ctx
+// stops the download.
+func resolveModuleSpec(parent context.Context, spec string) (dir, modPath, version string, err error) {
+	modPath, version, _ = strings.Cut(spec, "@")
+	ctx, cancel := context.WithTimeout(parent, moduleDownloadTimeout)
+	defer cancel()
+
+	if isCanonicalVersion(version) {
+		if dir, ok := cachedModuleDir(ctx, modPath, version); ok {
+			return dir, modPath, version, nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json", spec)
+	cmd.Dir = os.TempDir() // outside any module or workspace
+	cmd.Env = replaceEnv(os.Environ(), "GOWORK", "off")
+	cmd.WaitDelay = toolWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, runErr := cmd.Output()
+	var info struct{ Path, Version, Dir, Error string }
+	if jsonErr := json.Unmarshal(out, &info); jsonErr != nil || info.Error != "" || info.Dir == "" {
+		switch {
+		case info.Error != "":
+			return "", "", "", fmt.Errorf("download %s: %s", spec, info.Error)
+		case parent.Err() != nil:
+			return "", "", "", parent.Err()
+		case ctx.Err() != nil:
+			return "", "", "", fmt.Errorf("download %s: timed out after %s", spec, moduleDownloadTimeout)
+		case runErr != nil:
+			return "", "", "", fmt.Errorf("download %s: %v: %s", spec, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return "", "", "", fmt.Errorf("download %s: unexpected go mod download output", spec)
+	}
+	return info.Dir, info.Path, info.Version, nil
+}
+
+// isCanonicalVersion reports whether v names exactly one module version, so
+// the module cache can be consulted without resolving it first.
+func isCanonicalVersion(v string) bool {
+	v = strings.TrimSuffix(v, "+incompatible")
+	return semver.IsValid(v) && semver.Canonical(v) == v
+}
+
+// cachedModuleDir returns the extracted module cache directory of
+// modPath@version, if it is complete.
+func cachedModuleDir(ctx context.Context, modPath, version string) (string, bool) {
+	out, err := runTool(ctx, 0, os.TempDir(), "go", "env", "GOMODCACHE")
+	if err != nil {
+		return "", false
+	}
+	escPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", false
+	}
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", false
+	}
+	dir := filepath.Join(strings.TrimSpace(string(out)), escPath+"@"+escVersion)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	if _, err := os.Stat(dir + ".partial"); err == nil {
+		return "", false // extraction was interrupted
+	}
+	return dir, true
+}
@@ -0,0 +1,89 @@
+package cpg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestModuleSpecs checks which -modules entries are taken from the module
+// cache and which SCIP coordinates external packages get.
+func TestModuleSpecs(t *testing.T) {
+	for s, want := range map[string]bool{
+		"github.com/prometheus/alertmanager@v0.27.0": true,
+		"golang.org/x/mod@latest":                    true,
+		"../client_golang":                           false,
+		"/tmp/build@2":                               false,
+		"mymodule@v1.0.0":                            false, // no domain: a local directory
+		"github.com/prometheus/alertmanager@":        false,
+	} {
+		if got := IsModuleSpec(s); got != want {
+			t.Errorf("IsModuleSpec(%q) = %v, want %v", s, got, want)
+		}
+	}
+
+	deps := map[string]string{
+		"github.com/prometheus/common":        "v0.55.0",
+		"github.com/prometheus/common/sigv4":  "v0.1.0",
+		"github.com/prometheus/client_golang": "v1.20.0",
+	}
+	for _, tc := range []struct{ pkg, mod, version, rel string }{
+		{"net/http", "github.com/golang/go/src", "go1.23.0", "net/http"},
+		{"github.com/prometheus/common/model", "github.com/prometheus/common", "v0.55.0", "model"},
+		{"github.com/prometheus/common/sigv4", "github.com/prometheus/common/sigv4", "v0.1.0", "main"},
+		{"github.com/prometheus/client_golang/prometheus/promhttp", "github.com/prometheus/client_golang", "v1.20.0", "prometheus/promhttp"},
+		{"github.com/prometheus/client_model/go", "", "", ""},
+	} {
+		mod, version, rel := externalModule(tc.pkg, deps, "go1.23.0")
+		if mod != tc.mod || version != tc.version || rel != tc.rel {
+			t.Errorf("externalModule(%q) = %q %q %q, want %q %q %q", tc.pkg, mod, version, rel, tc.mod, tc.version, tc.rel)
+		}
+	}
+
+	// Replace directives override the required version; a local replacement
+	// has no version and drops the dependency.
+	dir := t.TempDir()
+	gomod := `module example.com/app
+
+go 1.23.0
+
+require (
+	github.com/prometheus/common v0.55.0
+	github.com/prometheus/client_golang v1.20.0
+	github.com/prometheus/client_model v0.6.0
+)
+
+replace github.com/prometheus/common => github.com/example/common v0.56.1
+
+replace github.com/prometheus/client_golang v1.19.0 => github.com/example/client_golang v1.19.1
+
+replace github.com/prometheus/client_model => ../client_model
+`
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ms := NewModuleSet(ModuleInfo{Dir: dir, ModPath: "example.com/app"}, nil, FileFilter{})
+	got, goVersion := ms.Requirements()
+	want := map[string]string{
+		"github.com/prometheus/common":        "v0.56.1",
+		"github.com/prometheus/client_golang": "v1.20.0", // replaces another version only
+	}
+	if goVersion != "go1.23.0" || len(got) != len(want) {
+		t.Errorf("Requirements() = %v %q, want %v %q", got, goVersion, want, "go1.23.0")
+	}
+	for path, v := range want {
+		if got[path] != v {
+			t.Errorf("Requirements()[%q] = %q, want %q", path, got[path], v)
+		}
+	}
+
+	// Interrupting a run cancels a module download.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg := &Config{Primary: "golang.org/x/mod@v0.999.0"}
+	if err := cfg.ValidateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ValidateContext(cancelled) = %v, want %v", err, context.Canceled)
+	}
+}
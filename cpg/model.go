@@ -0,0 +1,373 @@
+package cpg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Node represents a vertex in the Code Property Graph.
+type Node struct {
+	ID             string
+	Kind           string
+	Name           string
+	File           string // relative to repo root
+	Line, Col      int
+	EndLine        int
+	EndCol         int    // column just past the node's source
+	StartOffset    int    // byte offset of the node's source in File
+	EndOffset      int    // byte offset just past it; 0 when the node has no span
+	Package        string // relative import path
+	ParentFunction string // node ID of enclosing function, or ""
+	TypeInfo       string
+	Properties     map[string]any
+}
+
+// Edge represents a directed edge in the Code Property Graph.
+type Edge struct {
+	Source     string
+	Target     string
+	Kind       string
+	Properties map[string]any
+}
+
+// Metrics holds computed metrics for a single function.
+type Metrics struct {
+	FunctionID           string
+	CyclomaticComplexity int
+	FanIn                int
+	FanOut               int
+	LOC                  int
+	NumParams            int
+}
+
+// edgeKey is the deduplication key for edges.
+type edgeKey struct {
+	Source, Target, Kind string
+}
+
+// CPG accumulates the Code Property Graph before it is written to SQLite.
+//
+// A CPG from NewCPG keeps everything in memory. A streaming CPG from
+// NewStreamingCPG buffers nodes, edges, and sources only until their
+// estimated size exceeds its budget and then spills them to a staging
+// database, so memory stays bounded however large the graph grows. Phases
+// add through AddNode, AddEdge, and AddSource and read back through
+// AllNodes, AllEdges, AllSources, and the Update methods, which see buffered
+// and spilled elements alike.
+type CPG struct {
+	nodes    []Node
+	edges    []Edge
+	nodeSeen map[string]struct{}
+	edgeSeen map[edgeKey]struct{}
+	sources  map[string]string   // file → content
+	Metrics  map[string]*Metrics // function_id → metrics
+
+	FileHashes map[string]FileHash // file → content hash, for -incremental
+
+	// scope restricts the per-function extraction phases to a set of package
+	// import paths (incremental mode). nil means every package is in scope.
+	scope map[string]bool
+
+	// Streaming mode: spill is nil for an in-memory CPG. buffered is the
+	// estimated size of nodes, edges, and sources not yet spilled.
+	spill    *spillStore
+	budget   int64
+	buffered int64
+	err      error // first spill error, reported by Err
+}
+
+// NewCPG creates an empty in-memory CPG ready for population.
+func NewCPG() *CPG {
+	return &CPG{
+		nodeSeen: make(map[string]struct{}),
+		edgeSeen: make(map[edgeKey]struct{}),
+		sources:  make(map[string]string),
+		Metrics:  make(map[string]*Metrics),
+	}
+}
+
+// NewStreamingCPG creates an empty CPG that spills to a staging database in
+// dir whenever roughly budget bytes of nodes, edges, and sources are
+// buffered. The caller must Close it to remove the staging database.
+func NewStreamingCPG(dir string, budget int64) (*CPG, error) {
+	spill, err := openSpillStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	g := NewCPG()
+	g.spill, g.budget = spill, budget
+	return g, nil
+}
+
+// Streaming reports whether g spills to disk, and where.
+func (g *CPG) Streaming() (path string, ok bool) {
+	if g.spill == nil {
+		return "", false
+	}
+	return g.spill.path, true
+}
+
+// SpillBatches returns how many batches a streaming CPG has spilled so far.
+func (g *CPG) SpillBatches() int {
+	if g.spill == nil {
+		return 0
+	}
+	return g.spill.batches
+}
+
+// Restrict limits SSA-derived extraction to the given package import paths.
+// WalkAST still covers every package so position and definition lookups
+// remain complete for cross-package edges.
+func (g *CPG) Restrict(pkgPaths map[string]bool) {
+	g.scope = pkgPaths
+}
+
+// InScope reports whether pkgPath should be (re-)analyzed in this run.
+func (g *CPG) InScope(pkgPath string) bool {
+	return g.scope == nil || g.scope[pkgPath]
+}
+
+// AddNode appends a node, deduplicating by ID (first wins).
+func (g *CPG) AddNode(n Node) {
+	if _, dup := g.nodeSeen[n.ID]; dup {
+		return
+	}
+	g.nodeSeen[n.ID] = struct{}{}
+	g.nodes = append(g.nodes, n)
+	g.grow(nodeSize(&n))
+}
+
+// AddEdge appends an edge if no edge with the same (source, target, kind) already exists.
+func (g *CPG) AddEdge(e Edge) {
+	k := edgeKey{e.Source, e.Target, e.Kind}
+	if _, dup := g.edgeSeen[k]; dup {
+		return
+	}
+	g.edgeSeen[k] = struct{}{}
+	g.edges = append(g.edges, e)
+	g.grow(edgeSize(&e))
+}
+
+// AddSource records the content of a module-relative file (first wins).
+func (g *CPG) AddSource(file, content string) {
+	if _, dup := g.sources[file]; dup {
+		return
+	}
+	g.sources[file] = content
+	g.grow(int64(64 + len(file) + len(content)))
+}
+
+// grow accounts for a newly buffered element and spills once the buffer
+// exceeds the budget.
+func (g *CPG) grow(size int64) {
+	if g.spill == nil {
+		return
+	}
+	if g.buffered += size; g.buffered >= g.budget {
+		g.Flush()
+	}
+}
+
+// Flush writes buffered nodes, edges, and sources to the staging database
+// and empties the buffers. It is a no-op for an in-memory CPG. Elements that
+// duplicate spilled ones are dropped by the staging tables' unique keys;
+// since batches are flushed in order, the first occurrence still wins.
+func (g *CPG) Flush() {
+	if g.spill == nil || g.err != nil {
+		return
+	}
+	if len(g.nodes) > 0 || len(g.edges) > 0 || len(g.sources) > 0 {
+		if err := g.spill.write(g.nodes, g.edges, g.sources); err != nil {
+			g.err = fmt.Errorf("spill: %w", err)
+			return
+		}
+	}
+	g.nodes, g.edges = nil, nil
+	g.nodeSeen = make(map[string]struct{})
+	g.edgeSeen = make(map[edgeKey]struct{})
+	g.sources = make(map[string]string)
+	g.buffered = 0
+}
+
+// Err returns the first error encountered while spilling or reading back a
+// streaming CPG. Once set, the graph is incomplete and must not be written.
+func (g *CPG) Err() error {
+	return g.err
+}
+
+// Close removes a streaming CPG's staging database.
+func (g *CPG) Close() error {
+	if g.spill == nil {
+		return nil
+	}
+	err := g.spill.close()
+	g.spill = nil
+	return err
+}
+
+// NodeCount returns the number of distinct nodes.
+func (g *CPG) NodeCount() int {
+	if g.spill == nil {
+		return len(g.nodes)
+	}
+	g.Flush()
+	return g.spill.nodes
+}
+
+// EdgeCount returns the number of distinct edges.
+func (g *CPG) EdgeCount() int {
+	if g.spill == nil {
+		return len(g.edges)
+	}
+	g.Flush()
+	return g.spill.edges
+}
+
+// AllNodes yields every node in the order it was first added.
+func (g *CPG) AllNodes() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		if g.spill == nil {
+			for _, n := range g.nodes {
+				if !yield(n) {
+					return
+				}
+			}
+			return
+		}
+		g.Flush()
+		g.spill.scanNodes(&g.err, false, func(n *Node) (bool, bool) { return yield(*n), false })
+	}
+}
+
+// AllEdges yields every edge in the order it was first added.
+func (g *CPG) AllEdges() iter.Seq[Edge] {
+	return func(yield func(Edge) bool) {
+		if g.spill == nil {
+			for _, e := range g.edges {
+				if !yield(e) {
+					return
+				}
+			}
+			return
+		}
+		g.Flush()
+		g.spill.scanEdges(&g.err, false, func(e *Edge) (bool, bool) { return yield(*e), false })
+	}
+}
+
+// SortedNodes yields every node ordered by ID. Databases are written in this
+// order, so their contents do not depend on the order phases, workers, or a
+// cache happened to add nodes in.
+func (g *CPG) SortedNodes() iter.Seq[Node] {
+	return func(yield func(Node) bool) {
+		if g.spill == nil {
+			order := make([]int32, len(g.nodes))
+			for i := range order {
+				order[i] = int32(i)
+			}
+			slices.SortFunc(order, func(a, b int32) int { return strings.Compare(g.nodes[a].ID, g.nodes[b].ID) })
+			for _, i := range order {
+				if !yield(g.nodes[i]) {
+					return
+				}
+			}
+			return
+		}
+		g.Flush()
+		g.spill.scanNodes(&g.err, true, func(n *Node) (bool, bool) { return yield(*n), false })
+	}
+}
+
+// SortedEdges yields every edge ordered by source, target, and kind.
+func (g *CPG) SortedEdges() iter.Seq[Edge] {
+	return func(yield func(Edge) bool) {
+		if g.spill == nil {
+			order := make([]int32, len(g.edges))
+			for i := range order {
+				order[i] = int32(i)
+			}
+			slices.SortFunc(order, func(a, b int32) int {
+				x, y := &g.edges[a], &g.edges[b]
+				return cmp.Or(strings.Compare(x.Source, y.Source), strings.Compare(x.Target, y.Target), strings.Compare(x.Kind, y.Kind))
+			})
+			for _, i := range order {
+				if !yield(g.edges[i]) {
+					return
+				}
+			}
+			return
+		}
+		g.Flush()
+		g.spill.scanEdges(&g.err, true, func(e *Edge) (bool, bool) { return yield(*e), false })
+	}
+}
+
+// AllSources yields every source file and its content, ordered by file.
+func (g *CPG) AllSources() iter.Seq2[string, string] {
+	return func(yield func(file, content string) bool) {
+		if g.spill == nil {
+			for _, file := range slices.Sorted(maps.Keys(g.sources)) {
+				if !yield(file, g.sources[file]) {
+					return
+				}
+			}
+			return
+		}
+		g.Flush()
+		g.spill.scanSources(&g.err, yield)
+	}
+}
+
+// UpdateNodes calls fn for every node; fn returns true if it modified the
+// node. fn must not change the node's ID.
+func (g *CPG) UpdateNodes(fn func(n *Node) bool) {
+	if g.spill == nil {
+		for i := range g.nodes {
+			fn(&g.nodes[i])
+		}
+		return
+	}
+	g.Flush()
+	g.spill.scanNodes(&g.err, false, func(n *Node) (bool, bool) { return true, fn(n) })
+}
+
+// UpdateEdges calls fn for every edge; fn returns true if it modified the
+// edge's properties. fn must not change the source, target, or kind.
+func (g *CPG) UpdateEdges(fn func(e *Edge) bool) {
+	if g.spill == nil {
+		for i := range g.edges {
+			fn(&g.edges[i])
+		}
+		return
+	}
+	g.Flush()
+	g.spill.scanEdges(&g.err, false, func(e *Edge) (bool, bool) { return true, fn(e) })
+}
+
+// nodeSize and edgeSize estimate the memory an element holds while buffered,
+// including its dedup map entry.
+func nodeSize(n *Node) int64 {
+	return int64(256 + 2*len(n.ID) + len(n.Kind) + len(n.Name) + len(n.File) + len(n.Package) +
+		len(n.ParentFunction) + len(n.TypeInfo) + 64*len(n.Properties))
+}
+
+func edgeSize(e *Edge) int64 {
+	return int64(160 + 2*(len(e.Source)+len(e.Target)+len(e.Kind)) + 64*len(e.Properties))
+}
+
+// PropsJSON marshals a properties map to JSON string, or "" if empty.
+func PropsJSON(m map[string]any) string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
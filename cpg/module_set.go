@@ -0,0 +1,265 @@
+package cpg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// ModuleInfo describes one Go module in the analysis set.
+type ModuleInfo struct {
+	ModPath string // module path from go.mod, e.g. "github.com/prometheus/prometheus"
+	Dir     string // absolute path to module root
+	Prefix  string // node ID prefix: "" for primary, "adapter", "client_golang", etc.
+	Version string // module version used in SCIP symbols, e.g. "v2.53.0" or "v0"
+	Cached  bool   // read-only copy in the module cache, from a module@version spec
+}
+
+// ReadModulePath returns the module path declared in dir/go.mod.
+func ReadModulePath(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", fmt.Errorf("read go.mod: %w", err)
+	}
+	modPath := modfile.ModulePath(data)
+	if modPath == "" {
+		return "", fmt.Errorf("%s: no module directive", filepath.Join(dir, "go.mod"))
+	}
+	return modPath, nil
+}
+
+// Requirements returns the dependency versions the analyzed modules require
+// in their go.mod files, keyed by module path, and the Go version of the
+// primary module (its toolchain directive, else its go directive). A
+// dependency required by several modules gets the highest version, the one
+// minimal version selection picks for the workspace. Replace directives then
+// apply: a dependency replaced by another module version gets that version,
+// and one replaced by a local directory is dropped, since it has none.
+func (ms *ModuleSet) Requirements() (deps map[string]string, goVersion string) {
+	deps = make(map[string]string)
+	var replaces []*modfile.Replace
+	for i, m := range ms.modules {
+		gomod := filepath.Join(m.Dir, "go.mod")
+		data, err := os.ReadFile(gomod)
+		if err != nil {
+			continue
+		}
+		// ParseLax ignores replace directives; fall back to it only when
+		// the strict parser rejects the file.
+		f, err := modfile.Parse(gomod, data, nil)
+		if err != nil {
+			if f, err = modfile.ParseLax(gomod, data, nil); err != nil {
+				continue
+			}
+		}
+		for _, r := range f.Require {
+			if v, ok := deps[r.Mod.Path]; !ok || semver.Compare(r.Mod.Version, v) > 0 {
+				deps[r.Mod.Path] = r.Mod.Version
+			}
+		}
+		replaces = append(replaces, f.Replace...)
+		if i == 0 {
+			switch {
+			case f.Toolchain != nil:
+				goVersion = f.Toolchain.Name
+			case f.Go != nil:
+				goVersion = "go" + f.Go.Version
+			}
+		}
+	}
+	for _, r := range replaces {
+		v, ok := deps[r.Old.Path]
+		if !ok || r.Old.Version != "" && r.Old.Version != v {
+			continue
+		}
+		if r.New.Version == "" {
+			delete(deps, r.Old.Path)
+		} else {
+			deps[r.Old.Path] = r.New.Version
+		}
+	}
+	return deps, goVersion
+}
+
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// DerivePrefix returns the node ID prefix for an extra module: the last
+// element of its module path, skipping a major-version suffix, so
+// "github.com/prometheus/client_golang" yields "client_golang" and
+// "github.com/foo/bar/v2" yields "bar".
+func DerivePrefix(modPath string) string {
+	base := path.Base(modPath)
+	if majorVersionSuffix.MatchString(base) {
+		base = path.Base(path.Dir(modPath))
+	}
+	return base
+}
+
+// DetectVersion returns the nearest git tag (or abbreviated commit) of the
+// checkout at dir, falling back to "v0" outside a git repository or when git
+// takes longer than DefaultGitTimeout.
+func DetectVersion(dir string) string {
+	out, err := runTool(context.Background(), DefaultGitTimeout, dir, "git", "describe", "--tags", "--always")
+	if err != nil {
+		return "v0"
+	}
+	if v := strings.TrimSpace(string(out)); v != "" {
+		return v
+	}
+	return "v0"
+}
+
+// ModuleSet holds all modules under analysis and the filter selecting which
+// of their files are analyzed. It provides path resolution that replaces the
+// old single-module promDir + isPrometheusPkg approach. Each generation
+// builds its own and passes it to every phase.
+type ModuleSet struct {
+	modules   []ModuleInfo
+	files     FileFilter
+	generated sync.Map // absolute file path → bool, see IsGenerated
+}
+
+// NewModuleSet builds a ModuleSet from a primary module and optional extras.
+// The primary module always has an empty Prefix.
+func NewModuleSet(primary ModuleInfo, extras []ModuleInfo, files FileFilter) *ModuleSet {
+	ms := &ModuleSet{
+		modules: make([]ModuleInfo, 0, 1+len(extras)),
+		files:   files,
+	}
+	ms.modules = append(ms.modules, primary)
+	ms.modules = append(ms.modules, extras...)
+	return ms
+}
+
+// IsKnownPkg returns true if pkgPath belongs to any module in the set.
+func (ms *ModuleSet) IsKnownPkg(pkgPath string) bool {
+	for _, m := range ms.modules {
+		if pkgPath == m.ModPath || strings.HasPrefix(pkgPath, m.ModPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RelPkg strips the module prefix from a full import path and prepends the
+// module's Prefix. Prometheus (Prefix:"") yields "scrape"; adapter (Prefix:"adapter")
+// yields "adapter/pkg/client".
+//
+// When module paths are nested (e.g., "github.com/foo" and "github.com/foo/bar"),
+// we prefer the longest matching ModPath to avoid the parent claiming child packages.
+func (ms *ModuleSet) RelPkg(fullPath string) string {
+	bestResult := ""
+	bestModLen := -1
+	matched := false
+
+	for _, m := range ms.modules {
+		if fullPath == m.ModPath && len(m.ModPath) > bestModLen {
+			bestModLen = len(m.ModPath)
+			matched = true
+			if m.Prefix == "" {
+				bestResult = "main"
+			} else {
+				bestResult = m.Prefix
+			}
+		} else if rel, ok := strings.CutPrefix(fullPath, m.ModPath+"/"); ok && len(m.ModPath) > bestModLen {
+			bestModLen = len(m.ModPath)
+			matched = true
+			if m.Prefix == "" {
+				bestResult = rel
+			} else {
+				bestResult = m.Prefix + "/" + rel
+			}
+		}
+	}
+
+	if matched {
+		return bestResult
+	}
+	return fullPath
+}
+
+// RelFile converts an absolute file path to a module-relative path with prefix.
+// Returns "" for files outside all known modules (replaces the ".." prefix check).
+//
+// When module directories are nested (e.g., /project and /project/vendor/lib),
+// we prefer the most specific match (longest Dir) to avoid the parent module
+// claiming files that belong to a child module.
+func (ms *ModuleSet) RelFile(absPath string) string {
+	bestRel := ""
+	bestPrefix := ""
+	bestDirLen := -1
+
+	for _, m := range ms.modules {
+		rel, err := filepath.Rel(m.Dir, absPath)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(rel, "..") {
+			continue
+		}
+		// Prefer the module with the longest Dir path (most specific match).
+		if len(m.Dir) > bestDirLen {
+			bestDirLen = len(m.Dir)
+			bestRel = rel
+			bestPrefix = m.Prefix
+		}
+	}
+
+	if bestDirLen < 0 {
+		return ""
+	}
+	if bestPrefix == "" {
+		return bestRel
+	}
+	return bestPrefix + "/" + bestRel
+}
+
+// ModuleOf returns the module that owns pkgPath, preferring the longest
+// matching ModPath when module paths are nested.
+func (ms *ModuleSet) ModuleOf(pkgPath string) (ModuleInfo, bool) {
+	var best ModuleInfo
+	found := false
+	for _, m := range ms.modules {
+		if pkgPath != m.ModPath && !strings.HasPrefix(pkgPath, m.ModPath+"/") {
+			continue
+		}
+		if !found || len(m.ModPath) > len(best.ModPath) {
+			best = m
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Primary returns the first (primary) module.
+func (ms *ModuleSet) Primary() ModuleInfo {
+	return ms.modules[0]
+}
+
+// PrimaryDir returns the first (primary) module's directory.
+func (ms *ModuleSet) PrimaryDir() string {
+	return ms.modules[0].Dir
+}
+
+// Dirs returns all module infos for operations that need to iterate modules
+// (escape analysis, git history).
+func (ms *ModuleSet) Dirs() []ModuleInfo {
+	return ms.modules
+}
+
+// LoadPatterns returns the "dir/..." patterns for packages.Load.
+func (ms *ModuleSet) LoadPatterns() []string {
+	patterns := make([]string, len(ms.modules))
+	for i, m := range ms.modules {
+		patterns[i] = m.ModPath + "/..."
+	}
+	return patterns
+}
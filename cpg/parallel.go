@@ -0,0 +1,222 @@
+package cpg
+
+import (
+	"go/token"
+	"go/types"
+	"runtime"
+	"sort"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// DefaultWorkers is the worker count used when none is configured.
+func DefaultWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// forEachOrdered runs work(i) for every i in [0, n) on up to workers
+// goroutines and hands each result to merge in index order on the calling
+// goroutine. Merging in input order keeps the CPG's first-wins deduplication
+// exactly as in a serial run, so the output does not depend on scheduling.
+// At most 2×workers results are buffered ahead of the merge.
+func forEachOrdered[T any](n, workers int, work func(i int) T, merge func(i int, r T)) {
+	if workers <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			merge(i, work(i))
+		}
+		return
+	}
+
+	results := make([]chan T, n)
+	for i := range results {
+		results[i] = make(chan T, 1)
+	}
+	window := make(chan struct{}, 2*workers)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := 0; i < n; i++ {
+			window <- struct{}{}
+			next <- i
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				results[i] <- work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		r := <-results[i]
+		results[i] = nil
+		merge(i, r)
+		<-window
+	}
+}
+
+// graphBuffer collects the nodes and edges produced by one unit of sharded
+// work (a package or a function) until it is merged into the CPG.
+type graphBuffer struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+func (b *graphBuffer) AddNode(n Node) { b.Nodes = append(b.Nodes, n) }
+func (b *graphBuffer) AddEdge(e Edge) { b.Edges = append(b.Edges, e) }
+
+// Merge adds the buffered nodes and edges to g in the order they were produced.
+func (g *CPG) Merge(b *graphBuffer) {
+	for _, n := range b.Nodes {
+		g.AddNode(n)
+	}
+	for _, e := range b.Edges {
+		g.AddEdge(e)
+	}
+}
+
+// walkShard is the per-package output of WalkAST. Besides nodes it keeps an
+// ordered log of edges, declaration registrations, and reference edges whose
+// target is looked up by declaration. The log is replayed in package order so
+// a reference resolves exactly when it would in a serial walk: to
+// declarations seen earlier in the walk, and not to later ones.
+type walkShard struct {
+	nodes   []Node
+	edges   []Edge
+	ops     []walkOp
+	pos     []lookupEntry // posLookup.Set calls, in order
+	funcs   []lookupEntry // funcLookup.Set calls, in order
+	sources []lookupEntry // file → content (id holds the content)
+	initIDs []string
+
+	nodeCount, edgeCount, skippedFiles int
+}
+
+type walkOpKind uint8
+
+const (
+	opEdge walkOpKind = iota // edges[edge]
+	opRef                    // edges[edge] with Target = defLookup.Get(obj)
+	opDef                    // defLookup.Set(obj, id)
+)
+
+type walkOp struct {
+	kind   walkOpKind
+	edge   int
+	obj    types.Object
+	id     string
+	noSelf bool // opRef: drop the edge when the target is the source
+}
+
+type lookupEntry struct {
+	file      string
+	line, col int
+	id        string
+}
+
+func (s *walkShard) AddNode(n Node) { s.nodes = append(s.nodes, n) }
+
+func (s *walkShard) AddEdge(e Edge) {
+	s.ops = append(s.ops, walkOp{kind: opEdge, edge: len(s.edges)})
+	s.edges = append(s.edges, e)
+}
+
+// AddRef records an edge to obj's declaration, resolved at replay.
+func (s *walkShard) AddRef(e Edge, obj types.Object, noSelf bool) {
+	if obj == nil {
+		return
+	}
+	s.ops = append(s.ops, walkOp{kind: opRef, edge: len(s.edges), obj: obj, noSelf: noSelf})
+	s.edges = append(s.edges, e)
+}
+
+func (s *walkShard) SetDef(obj types.Object, id string) {
+	if obj != nil {
+		s.ops = append(s.ops, walkOp{kind: opDef, obj: obj, id: id})
+	}
+}
+
+func (s *walkShard) SetPos(file string, line, col int, id string) {
+	s.pos = append(s.pos, lookupEntry{file, line, col, id})
+}
+
+func (s *walkShard) SetFunc(file string, line, col int, id string) {
+	s.funcs = append(s.funcs, lookupEntry{file, line, col, id})
+}
+
+// replay applies the shard to the CPG and lookups and returns the number of
+// reference edges that resolved.
+func (s *walkShard) replay(cpg *CPG, posLookup *PosLookup, funcLookup *FuncLookup, defLookup *DefLookup) int {
+	for _, n := range s.nodes {
+		cpg.AddNode(n)
+	}
+	for _, src := range s.sources {
+		cpg.AddSource(src.file, src.id)
+	}
+	for _, p := range s.pos {
+		posLookup.Set(p.file, p.line, p.col, p.id)
+	}
+	for _, f := range s.funcs {
+		funcLookup.Set(f.file, f.line, f.col, f.id)
+	}
+	var refs int
+	for _, op := range s.ops {
+		switch op.kind {
+		case opEdge:
+			cpg.AddEdge(s.edges[op.edge])
+		case opRef:
+			e := s.edges[op.edge]
+			if e.Target = defLookup.Get(op.obj); e.Target == "" || (op.noSelf && e.Target == e.Source) {
+				continue
+			}
+			cpg.AddEdge(e)
+			refs++
+		case opDef:
+			defLookup.Set(op.obj, op.id)
+		}
+	}
+	return refs
+}
+
+// funcKey orders SSA functions by file position, then by full name to
+// separate generic instantiations that share a position.
+type funcKey struct {
+	file   string
+	offset int
+	name   string
+}
+
+func keyOf(fn *ssa.Function, fset *token.FileSet) funcKey {
+	k := funcKey{name: fn.String()}
+	if pos := fn.Pos(); pos.IsValid() {
+		p := fset.Position(pos)
+		k.file, k.offset = p.Filename, p.Offset
+	}
+	return k
+}
+
+func (a funcKey) less(b funcKey) bool {
+	if a.file != b.file {
+		return a.file < b.file
+	}
+	if a.offset != b.offset {
+		return a.offset < b.offset
+	}
+	return a.name < b.name
+}
+
+// sortFuncs returns the module functions of an SSA program in a stable order
+// so the per-function phases produce the same graph on every run.
+func sortFuncs(all map[*ssa.Function]bool, fset *token.FileSet, ms *ModuleSet) []*ssa.Function {
+	var fns []*ssa.Function
+	keys := make(map[*ssa.Function]funcKey)
+	for fn := range all {
+		if fn.Pkg == nil || fn.Synthetic != "" || !ms.IsKnownPkg(fn.Pkg.Pkg.Path()) {
+			continue
+		}
+		fns = append(fns, fn)
+		keys[fn] = keyOf(fn, fset)
+	}
+	sort.Slice(fns, func(i, j int) bool { return keys[fns[i]].less(keys[fns[j]]) })
+	return fns
+}
@@ -0,0 +1,180 @@
+package cpg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Phase describes one optional stage of generation. Package loading, AST
+// walking, SSA construction, and the core derived tables (node/edge
+// properties, findings, indexes, schema docs) always run; everything listed
+// here can be selected with -phases or dropped with -skip-phases.
+type Phase struct {
+	Name        string
+	Description string
+	Requires    []string // phases whose output this phase reads
+}
+
+// phaseRegistry lists every optional phase in execution order. Pipeline
+// phases fill the CPG in Generator.Generate; derived phases build tables in
+// buildDerived. escape and git_history span both: they shell out during the
+// pipeline and materialize their tables during derivation.
+var phaseRegistry = []Phase{
+	// Pipeline
+	{Name: "cfg", Description: "SSA control flow (cfg) and data flow (dfg) edges"},
+	{Name: "cdg", Description: "Control dependence edges from the post-dominator tree", Requires: []string{"cfg"}},
+	{Name: "channel_flow", Description: "Channel send→receive flow edges"},
+	{Name: "panic_recover", Description: "Panic/recover flow edges"},
+	{Name: "callgraph", Description: "VTA call graph (call edges, external stubs)"},
+	{Name: "types", Description: "Type relationships (implements, embeds, alias_of)"},
+	{Name: "metrics", Description: "Function metrics (complexity, LOC, fan-in/fan-out)"},
+	{Name: "tests", Description: "tests edges from test functions to the production code they reach, untested-complexity findings", Requires: []string{"callgraph"}},
+	{Name: "escape", Description: "Go compiler escape analysis (go build -gcflags=-m) and escape annotations"},
+	{Name: "git_history", Description: "Per-file git churn and churn-weighted hotspots", Requires: []string{"file_deps"}},
+
+	// Derived
+	{Name: "eog", Description: "Evaluation order edges"},
+	{Name: "fts", Description: "FTS5 full-text index over sources"},
+	{Name: "globals", Description: "Package-level variable table and unsynced goroutine write findings", Requires: []string{"cfg", "callgraph"}},
+	{Name: "taint_model", Description: "Taint sources, sinks, and barriers (taint_specs, taint_role properties)"},
+	{Name: "additional_analysis", Description: "API surface, method sets, error handling views"},
+	{Name: "advanced_analysis", Description: "Package stability and control-flow profiles"},
+	{Name: "cohesion_patterns", Description: "Package cohesion, concurrency profile, impact views"},
+	{Name: "dashboard", Description: "Dashboard summary tables"},
+	{Name: "graph_intelligence", Description: "Top-N functions, hotspots, package coupling, error chains"},
+	{Name: "file_deps", Description: "File heatmap, package graph, function detail", Requires: []string{"graph_intelligence"}},
+	{Name: "type_system", Description: "Interface implementation map, type hierarchy, method sets", Requires: []string{"types"}},
+	{Name: "navigation", Description: "Symbol index, file outline, xrefs, Go pattern summary"},
+	{Name: "field_access", Description: "Per-type method-field, cohesion (LCOM), and field writer views", Requires: []string{"cfg"}},
+	{Name: "serialized_schema", Description: "Parsed struct tags and the config key paths reachable from root config types"},
+	{Name: "taint_flow_states", Description: "Materialized taint propagation from sources", Requires: []string{"cfg", "taint_model"}},
+	{Name: "index_sensitivity", Description: "Container-typed taint tracking", Requires: []string{"taint_flow_states"}},
+	{Name: "scip", Description: "SCIP symbol identifiers"},
+	{Name: "comm_patterns", Description: "Communication protocols, endpoints, conformance (session types)"},
+	{Name: "session_corrections", Description: "Honda 2008 corrections: subtyping, acyclic causality, association", Requires: []string{"comm_patterns"}},
+}
+
+// Phases returns the optional phases in execution order.
+func Phases() []Phase {
+	return slices.Clone(phaseRegistry)
+}
+
+// PhaseNames returns the names of all optional phases in execution order.
+func PhaseNames() []string {
+	names := make([]string, len(phaseRegistry))
+	for i, p := range phaseRegistry {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func lookupPhase(name string) (Phase, bool) {
+	for _, p := range phaseRegistry {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Phase{}, false
+}
+
+// PhaseSet is the resolved selection of optional phases. A nil *PhaseSet
+// enables everything.
+type PhaseSet struct {
+	enabled map[string]bool
+	pulled  []string // phases added only because a requested phase requires them
+}
+
+// ResolvePhases computes the enabled phases. With an empty only list every
+// phase starts enabled; otherwise only the listed phases plus their
+// transitive requirements are. Skipped phases are then removed together with
+// every phase that depends on them. Asking for a phase while skipping one it
+// requires is an error.
+func ResolvePhases(only, skip []string) (*PhaseSet, error) {
+	var unknown []string
+	for _, name := range slices.Concat(only, skip) {
+		if _, ok := lookupPhase(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown phase(s) %s (known: %s)",
+			strings.Join(unknown, ", "), strings.Join(PhaseNames(), ", "))
+	}
+
+	ps := &PhaseSet{enabled: make(map[string]bool)}
+	if len(only) == 0 {
+		for _, p := range phaseRegistry {
+			ps.enabled[p.Name] = true
+		}
+	} else {
+		var pull func(name string)
+		pull = func(name string) {
+			if ps.enabled[name] {
+				return
+			}
+			ps.enabled[name] = true
+			if !slices.Contains(only, name) {
+				ps.pulled = append(ps.pulled, name)
+			}
+			p, _ := lookupPhase(name)
+			for _, dep := range p.Requires {
+				pull(dep)
+			}
+		}
+		for _, name := range only {
+			pull(name)
+		}
+	}
+
+	for _, name := range skip {
+		for _, p := range phaseRegistry {
+			if ps.enabled[p.Name] && ps.requires(p.Name, name) && slices.Contains(only, p.Name) {
+				return nil, fmt.Errorf("phase %s requires %s, which is skipped", p.Name, name)
+			}
+		}
+	}
+	for _, name := range skip {
+		for _, p := range phaseRegistry {
+			if p.Name == name || ps.requires(p.Name, name) {
+				delete(ps.enabled, p.Name)
+			}
+		}
+	}
+	return ps, nil
+}
+
+// requires reports whether phase transitively requires dep.
+func (ps *PhaseSet) requires(phase, dep string) bool {
+	p, _ := lookupPhase(phase)
+	for _, r := range p.Requires {
+		if r == dep || ps.requires(r, dep) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether the named phase should run.
+func (ps *PhaseSet) Enabled(name string) bool {
+	return ps == nil || ps.enabled[name]
+}
+
+// Skipped returns the disabled phases in execution order.
+func (ps *PhaseSet) Skipped() []string {
+	out := []string{}
+	for _, p := range phaseRegistry {
+		if !ps.Enabled(p.Name) {
+			out = append(out, p.Name)
+		}
+	}
+	return out
+}
+
+// Pulled returns phases enabled only as requirements of requested phases.
+func (ps *PhaseSet) Pulled() []string {
+	if ps == nil {
+		return nil
+	}
+	return ps.pulled
+}
@@ -0,0 +1,94 @@
+package cpg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestResolvePhases checks that requested phases pull in their requirements,
+// skipped phases take their dependents with them, and conflicting or
+// unknown selections are rejected.
+func TestResolvePhases(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		only, skip []string
+		enabled    []string // exactly these, in execution order; nil with all
+		pulled     []string
+		disabled   []string // with an empty only list: exactly these are off
+		err        string
+	}{
+		{name: "all"},
+		{
+			name:    "requirements pulled in",
+			only:    []string{"index_sensitivity"},
+			enabled: []string{"cfg", "taint_model", "taint_flow_states", "index_sensitivity"},
+			pulled:  []string{"taint_flow_states", "cfg", "taint_model"},
+		},
+		{
+			name:    "requested requirement not pulled",
+			only:    []string{"cdg", "cfg"},
+			enabled: []string{"cfg", "cdg"},
+		},
+		{
+			name:     "skip cascades to dependents",
+			skip:     []string{"cfg"},
+			disabled: []string{"cfg", "cdg", "globals", "field_access", "taint_flow_states", "index_sensitivity"},
+		},
+		{
+			name:     "skip cascades transitively",
+			skip:     []string{"graph_intelligence"},
+			disabled: []string{"git_history", "graph_intelligence", "file_deps"},
+		},
+		{
+			name:    "skip an unrequested requirement",
+			only:    []string{"taint_model", "eog"},
+			skip:    []string{"cfg"},
+			enabled: []string{"eog", "taint_model"},
+		},
+		{
+			name: "requested phase requires a skipped one",
+			only: []string{"cdg"},
+			skip: []string{"cfg"},
+			err:  "phase cdg requires cfg, which is skipped",
+		},
+		{
+			name: "unknown names",
+			only: []string{"cfg", "bogus"},
+			skip: []string{"nope"},
+			err:  "unknown phase(s) bogus, nope",
+		},
+	} {
+		ps, err := ResolvePhases(tc.only, tc.skip)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: err = %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		var enabled []string
+		for _, name := range PhaseNames() {
+			if ps.Enabled(name) {
+				enabled = append(enabled, name)
+			}
+		}
+		want := tc.enabled
+		if want == nil {
+			for _, name := range PhaseNames() {
+				if !slices.Contains(tc.disabled, name) {
+					want = append(want, name)
+				}
+			}
+		}
+		if !slices.Equal(enabled, want) {
+			t.Errorf("%s: enabled %q, want %q", tc.name, enabled, want)
+		}
+		if !slices.Equal(ps.Pulled(), tc.pulled) {
+			t.Errorf("%s: pulled %q, want %q", tc.name, ps.Pulled(), tc.pulled)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package cpg
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Platform is one build configuration packages are loaded under. The zero
+// value is the host configuration (GOOS/GOARCH from the environment, no
+// extra tags).
+type Platform struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+var platformWord = regexp.MustCompile(`^[a-z0-9_.]+$`)
+
+// ParsePlatform parses "goos/goarch" optionally followed by ":tag1+tag2",
+// e.g. "linux/amd64", "windows/arm64", "linux/amd64:netgo+osusergo".
+func ParsePlatform(spec string) (Platform, error) {
+	target, tags, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	goos, goarch, ok := strings.Cut(target, "/")
+	if !ok || !platformWord.MatchString(goos) || !platformWord.MatchString(goarch) {
+		return Platform{}, fmt.Errorf("invalid platform %q (want goos/goarch or goos/goarch:tag1+tag2)", spec)
+	}
+	p := Platform{GOOS: goos, GOARCH: goarch}
+	if tags != "" {
+		for _, t := range strings.Split(tags, "+") {
+			if !platformWord.MatchString(t) {
+				return Platform{}, fmt.Errorf("invalid build tag %q in platform %q", t, spec)
+			}
+			p.Tags = append(p.Tags, t)
+		}
+	}
+	return p, nil
+}
+
+// Name is the canonical spelling used in node and edge properties.
+func (p Platform) Name() string {
+	if p.GOOS == "" {
+		return "host"
+	}
+	name := p.GOOS + "/" + p.GOARCH
+	if len(p.Tags) > 0 {
+		name += ":" + strings.Join(p.Tags, "+")
+	}
+	return name
+}
+
+// platformNames returns the names of platforms (never nil, for JSON).
+func platformNames(platforms []Platform) []string {
+	names := make([]string, len(platforms))
+	for i, p := range platforms {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// env returns environ adjusted for cross-loading: GOOS/GOARCH set and cgo
+// disabled unless the target matches the host, since cgo cross toolchains
+// are rarely installed and go/packages fails hard without them.
+func (p Platform) env(environ []string) []string {
+	if p.GOOS == "" {
+		return environ
+	}
+	environ = replaceEnv(environ, "GOOS", p.GOOS)
+	environ = replaceEnv(environ, "GOARCH", p.GOARCH)
+	if os.Getenv("CGO_ENABLED") == "" && (p.GOOS != runtime.GOOS || p.GOARCH != runtime.GOARCH) {
+		environ = replaceEnv(environ, "CGO_ENABLED", "0")
+	}
+	return environ
+}
+
+// buildFlags returns the go command flags selecting p's build tags.
+func (p Platform) buildFlags() []string {
+	if len(p.Tags) == 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(p.Tags, ",")}
+}
+
+// PlatformMerge folds the graphs built for each platform into one, keyed by
+// node ID and (source, target, kind) edge key, and remembers which platforms
+// each element was seen in. Position-based IDs make the merge exact: a
+// declaration in a file shared by every platform gets the same ID in every
+// graph, while _windows.go or //go:build-gated files only appear in the
+// graphs whose configuration selects them.
+type PlatformMerge struct {
+	names []string
+	nodes map[string][]string
+	edges map[edgeKey][]string
+}
+
+// NewPlatformMerge prepares a merge over the given platforms, in order.
+func NewPlatformMerge(platforms []Platform) *PlatformMerge {
+	m := &PlatformMerge{
+		nodes: make(map[string][]string),
+		edges: make(map[edgeKey][]string),
+	}
+	for _, p := range platforms {
+		m.names = append(m.names, p.Name())
+	}
+	return m
+}
+
+// Merge adds src, built for platform, into dst. dst may be src itself for
+// the first platform, in which case only the membership is recorded.
+func (m *PlatformMerge) Merge(dst, src *CPG, platform Platform) {
+	name := platform.Name()
+	for n := range src.AllNodes() {
+		m.nodes[n.ID] = append(m.nodes[n.ID], name)
+		if dst != src {
+			dst.AddNode(n)
+		}
+	}
+	for e := range src.AllEdges() {
+		k := edgeKey{e.Source, e.Target, e.Kind}
+		m.edges[k] = append(m.edges[k], name)
+		if dst != src {
+			dst.AddEdge(e)
+		}
+	}
+	if dst == src {
+		return
+	}
+	for file, content := range src.AllSources() {
+		dst.AddSource(file, content)
+	}
+	for id, metrics := range src.Metrics {
+		if _, ok := dst.Metrics[id]; !ok {
+			dst.Metrics[id] = metrics
+		}
+	}
+	for file, h := range src.FileHashes {
+		if _, ok := dst.FileHashes[file]; !ok {
+			dst.FileHashes[file] = h
+		}
+	}
+}
+
+// Tag sets a "platforms" property on every node and edge of g listing the
+// platforms it exists in. Property maps are copied because extractors share
+// them between elements.
+func (m *PlatformMerge) Tag(g *CPG) {
+	g.UpdateNodes(func(n *Node) bool {
+		n.Properties = maps.Clone(n.Properties)
+		if n.Properties == nil {
+			n.Properties = map[string]any{}
+		}
+		n.Properties["platforms"] = m.nodes[n.ID]
+		return true
+	})
+	g.UpdateEdges(func(e *Edge) bool {
+		e.Properties = maps.Clone(e.Properties)
+		if e.Properties == nil {
+			e.Properties = map[string]any{}
+		}
+		e.Properties["platforms"] = m.edges[edgeKey{e.Source, e.Target, e.Kind}]
+		return true
+	})
+}
+
+// Counts returns how many nodes exist in each platform and in all of them.
+func (m *PlatformMerge) Counts() (perPlatform map[string]int, common int) {
+	perPlatform = make(map[string]int, len(m.names))
+	for _, names := range m.nodes {
+		for _, name := range names {
+			perPlatform[name]++
+		}
+		if len(names) == len(m.names) {
+			common++
+		}
+	}
+	return perPlatform, common
+}
+
+// createPlatformTables records the analyzed build configurations and adds a
+// view for filtering the graph by platform.
+func createPlatformTables(conn *sqlite.Conn, platforms []Platform) error {
+	ddl := `
+CREATE TABLE platforms (
+    name TEXT PRIMARY KEY,
+    goos TEXT NOT NULL,
+    goarch TEXT NOT NULL,
+    tags TEXT NOT NULL,
+    node_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE VIEW v_node_platforms AS
+SELECT n.id AS node_id, n.kind, n.name, n.file, p.value AS platform
+FROM nodes n, json_each(n.properties, '$.platforms') p;
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('table', 'platforms', 'Build configurations (GOOS/GOARCH/tags) the graph was merged from; empty for a host-only run', 'SELECT * FROM platforms'),
+('view', 'v_node_platforms', 'One row per node and platform it exists in (from the platforms property)', 'SELECT * FROM v_node_platforms WHERE platform = ''windows/amd64'''),
+('node_property', 'platforms', 'Nodes and edges: JSON array of platform names the element exists in (multi-platform runs only)', 'SELECT * FROM nodes WHERE json_array_length(properties, ''$.platforms'') = 1');
+
+INSERT INTO queries (name, description, sql) VALUES
+('platform_specific_functions', 'Functions that exist only under some of the analyzed platforms',
+ 'SELECT n.name, n.package, n.file, json_extract(n.properties, ''$.platforms'') AS platforms FROM nodes n WHERE n.kind = ''function'' AND json_array_length(n.properties, ''$.platforms'') < (SELECT COUNT(*) FROM platforms) ORDER BY n.file, n.line'),
+('nodes_for_platform', 'Nodes that exist under one platform',
+ 'SELECT n.* FROM nodes n WHERE EXISTS (SELECT 1 FROM json_each(n.properties, ''$.platforms'') WHERE value = :platform)');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("platforms: %w", err)
+	}
+	for _, p := range platforms {
+		if err := sqlitex.Execute(conn, `INSERT INTO platforms (name, goos, goarch, tags) VALUES (?, ?, ?, ?)`,
+			&sqlitex.ExecOptions{Args: []any{p.Name(), p.GOOS, p.GOARCH, strings.Join(p.Tags, ",")}}); err != nil {
+			return fmt.Errorf("insert platform %s: %w", p.Name(), err)
+		}
+	}
+	return sqlitex.ExecuteTransient(conn, `
+UPDATE platforms SET node_count = (
+  SELECT COUNT(*) FROM v_node_platforms v WHERE v.platform = platforms.name
+)`, nil)
+}
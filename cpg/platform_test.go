@@ -0,0 +1,57 @@
+package cpg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/sqlite"
+)
+
+// TestPlatforms generates a module with a file per GOOS and a build-tagged
+// file for two platforms, and checks that each function is attributed to
+// the platforms whose build includes its file.
+func TestPlatforms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	root := t.TempDir()
+	for name, src := range map[string]string{
+		"go.mod":          "module example.com/plat\n\ngo 1.25\n",
+		"plat.go":         "package plat\n\nfunc Common() string { return name() }\n",
+		"plat_linux.go":   "package plat\n\nfunc name() string { return \"linux\" }\n\nfunc OnlyLinux() {}\n",
+		"plat_windows.go": "package plat\n\nfunc name() string { return \"windows\" }\n",
+		"netgo.go":        "//go:build netgo\n\npackage plat\n\nfunc OnlyNetgo() {}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, _ := generateFixture(t, root, func(cfg *Config) {
+		cfg.Platforms = []string{"linux/amd64", "windows/amd64:netgo"}
+	})
+
+	conn, err := sqlite.OpenConn(db, sqlite.OpenReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	got := make(map[string]string)
+	query(t, conn, `SELECT file || ':' || name, GROUP_CONCAT(platform, ' ') FROM (
+		SELECT file, name, platform FROM v_node_platforms WHERE kind = 'function' ORDER BY platform
+	) GROUP BY file, name`, nil, func(stmt *sqlite.Stmt) {
+		got[stmt.ColumnText(0)] = stmt.ColumnText(1)
+	})
+	for fn, want := range map[string]string{
+		"plat.go:Common":          "linux/amd64 windows/amd64:netgo",
+		"plat_linux.go:name":      "linux/amd64",
+		"plat_linux.go:OnlyLinux": "linux/amd64",
+		"plat_windows.go:name":    "windows/amd64:netgo",
+		"netgo.go:OnlyNetgo":      "windows/amd64:netgo",
+	} {
+		if got[fn] != want {
+			t.Errorf("%s platforms = %q, want %q", fn, got[fn], want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cpg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile bundles project-specific seed data that is layered on top of the
+// generic derived tables. The generator itself is module-agnostic; profiles
+// carry knowledge about a particular code base (its wire protocols, the
+// functions implementing them, its internal channel patterns).
+type Profile struct {
+	Name        string
+	Description string
+
+	// Matches reports whether the profile applies to the analyzed modules.
+	// Used to pick profiles when -profiles is not given.
+	Matches func(ms *ModuleSet) bool
+
+	// CommSeed is SQL populating comm_protocols, comm_participants,
+	// comm_session_steps, comm_endpoints, comm_graph, comm_channel_patterns,
+	// and comm_causality, and adding profile-specific queries. It runs before
+	// conformance is computed.
+	CommSeed string
+
+	// ExternalComponents are participants of the profile's protocols that
+	// are not part of the analyzed modules, such as scrape targets.
+	// Conformance expects no endpoints for them.
+	ExternalComponents []string
+}
+
+// profileRegistry lists every built-in profile.
+var profileRegistry = []Profile{
+	{
+		Name:        "prometheus",
+		Description: "Prometheus ecosystem protocols (scrape, remote read/write, Alertmanager, prometheus-adapter, client_golang)",
+		Matches: func(ms *ModuleSet) bool {
+			return ms.Primary().ModPath == "github.com/prometheus/prometheus"
+		},
+		CommSeed:           prometheusCommSeed,
+		ExternalComponents: prometheusExternalComponents,
+	},
+}
+
+// ProfileNames returns the names of all built-in profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, len(profileRegistry))
+	for i, p := range profileRegistry {
+		names[i] = p.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveProfiles turns a -profiles value into the profiles to apply. An
+// empty spec selects every profile whose Matches accepts the module set;
+// "none" selects nothing; otherwise spec is a comma-separated list of names.
+func ResolveProfiles(spec string, ms *ModuleSet) ([]Profile, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "":
+		var out []Profile
+		for _, p := range profileRegistry {
+			if p.Matches != nil && p.Matches(ms) {
+				out = append(out, p)
+			}
+		}
+		return out, nil
+	case "none":
+		return nil, nil
+	}
+
+	var out []Profile
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		found := false
+		for _, p := range profileRegistry {
+			if p.Name == name {
+				out = append(out, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(ProfileNames(), ", "))
+		}
+	}
+	return out, nil
+}
+
+// profileNames returns the names of profiles for logging and metadata.
+func profileNames(profiles []Profile) []string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	return names
+}
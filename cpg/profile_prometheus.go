@@ -0,0 +1,517 @@
+package cpg
+
+// prometheusCommSeed seeds the comm_* tables with the Prometheus ecosystem
+// protocols: targets, remote storage, Alertmanager, service discovery,
+// federation, OTLP ingestion, prometheus-adapter, and the client_golang API
+// contract. Endpoint detection matches Prometheus package and function names.
+const prometheusCommSeed = `
+-- ═══════════════════════════════════════════════════════════════════
+-- Protocol Definitions
+-- ═══════════════════════════════════════════════════════════════════
+
+INSERT INTO comm_protocols VALUES
+-- Prometheus ↔ Targets
+('scrape', 'Target Scrape',
+ 'Prometheus HTTP-scrapes metrics from monitored targets at configured intervals',
+ '!HTTP_GET{/metrics}; ?text{exposition_format}; end',
+ '?HTTP_GET{/metrics}; !text{exposition_format}; end',
+ 'http', 'text/plain', 'request_response', 1),
+
+-- Prometheus → Remote Storage
+('remote_write', 'Remote Write',
+ 'Prometheus forwards time series samples to remote storage via HTTP POST with snappy-compressed protobuf',
+ '!HTTP_POST{protobuf(WriteRequest)}; ?HTTP{status_code}; end',
+ '?HTTP_POST{protobuf(WriteRequest)}; !HTTP{status_code}; end',
+ 'http', 'protobuf+snappy', 'request_response', 1),
+
+-- Prometheus ← Remote Storage
+('remote_read', 'Remote Read',
+ 'Prometheus queries remote storage for historical samples via protobuf request/response',
+ '!HTTP_POST{protobuf(ReadRequest)}; ?HTTP{protobuf(ReadResponse)}; end',
+ '?HTTP_POST{protobuf(ReadRequest)}; !HTTP{protobuf(ReadResponse)}; end',
+ 'http', 'protobuf+snappy', 'request_response', 1),
+
+-- Prometheus → Alertmanager
+('alertmanager_notify', 'Alertmanager Notification',
+ 'Prometheus sends firing/resolved alerts to Alertmanager instances via JSON POST',
+ '!HTTP_POST{json(Alert[])}; ?HTTP{status_code}; end',
+ '?HTTP_POST{json(Alert[])}; !HTTP{status_code}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Adapter → Prometheus: instant query
+('adapter_query', 'Adapter Instant Query',
+ 'prometheus-adapter queries Prometheus /api/v1/query for point-in-time metric values',
+ '!HTTP{verb, /api/v1/query, query=PromQL, time, timeout}; ?JSON{status, data:QueryResult}; end',
+ '?HTTP{verb, /api/v1/query, query=PromQL, time, timeout}; !JSON{status, data:QueryResult}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Adapter → Prometheus: range query
+('adapter_query_range', 'Adapter Range Query',
+ 'prometheus-adapter queries Prometheus /api/v1/query_range for time series data over an interval',
+ '!HTTP{verb, /api/v1/query_range, query, start, end, step, timeout}; ?JSON{status, data:QueryResult}; end',
+ '?HTTP{verb, /api/v1/query_range, query, start, end, step, timeout}; !JSON{status, data:QueryResult}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Adapter → Prometheus: series metadata
+('adapter_series', 'Adapter Series Discovery',
+ 'prometheus-adapter queries Prometheus /api/v1/series to discover available metric names and labels',
+ '!HTTP{verb, /api/v1/series, match[], start, end}; ?JSON{status, data:Series[]}; end',
+ '?HTTP{verb, /api/v1/series, match[], start, end}; !JSON{status, data:Series[]}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Kubernetes → Adapter: custom metrics
+('k8s_custom_metrics', 'Kubernetes Custom Metrics API',
+ 'Kubernetes API server (HPA) queries adapter for pod/object custom metrics',
+ '!HTTP_GET{/apis/custom.metrics.k8s.io/v1beta2/*}; ?JSON{CustomMetricValueList}; end',
+ '?HTTP_GET{/apis/custom.metrics.k8s.io/v1beta2/*}; !JSON{CustomMetricValueList}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Kubernetes → Adapter: external metrics
+('k8s_external_metrics', 'Kubernetes External Metrics API',
+ 'Kubernetes API server (HPA) queries adapter for cluster-external metrics',
+ '!HTTP_GET{/apis/external.metrics.k8s.io/v1beta1/*}; ?JSON{ExternalMetricValueList}; end',
+ '?HTTP_GET{/apis/external.metrics.k8s.io/v1beta1/*}; !JSON{ExternalMetricValueList}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Kubernetes → Adapter: resource metrics
+('k8s_resource_metrics', 'Kubernetes Resource Metrics API',
+ 'Kubernetes API server queries adapter for CPU/memory resource metrics (replaces metrics-server)',
+ '!HTTP_GET{/apis/metrics.k8s.io/v1beta1/*}; ?JSON{PodMetrics|NodeMetrics}; end',
+ '?HTTP_GET{/apis/metrics.k8s.io/v1beta1/*}; !JSON{PodMetrics|NodeMetrics}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Prometheus ← Discovery Providers
+('discovery', 'Service Discovery',
+ 'Prometheus discovers scrape targets from external providers (Kubernetes, Consul, DNS, EC2, etc.)',
+ '!API{provider_specific_query}; ?JSON{TargetGroup[]}; end',
+ '?API{provider_specific_query}; !JSON{TargetGroup[]}; end',
+ 'http', 'json', 'request_response', 1),
+
+-- Prometheus ← other Prometheus (federation)
+('federation', 'Prometheus Federation',
+ 'Hierarchical Prometheus scrapes another Prometheus /federate endpoint with PromQL matchers',
+ '!HTTP_GET{/federate, match[]}; ?text{exposition_format}; end',
+ '?HTTP_GET{/federate, match[]}; !text{exposition_format}; end',
+ 'http', 'text/plain', 'request_response', 1),
+
+-- External → Prometheus (OTLP ingestion)
+('otlp_ingest', 'OTLP Metrics Ingestion',
+ 'External OTLP-compatible services push metrics to Prometheus via OTLP HTTP receiver',
+ '!HTTP_POST{protobuf(ExportMetricsServiceRequest)}; ?HTTP{ExportMetricsServiceResponse}; end',
+ '?HTTP_POST{protobuf(ExportMetricsServiceRequest)}; !HTTP{ExportMetricsServiceResponse}; end',
+ 'http', 'protobuf', 'request_response', 1),
+
+-- External → Prometheus (PromQL API)
+('promql_api', 'PromQL Query API',
+ 'External clients (Grafana, scripts, etc.) query Prometheus PromQL HTTP API',
+ '!HTTP{GET|POST, /api/v1/query|query_range, query=PromQL}; ?JSON{status, data}; end',
+ '?HTTP{GET|POST, /api/v1/query|query_range, query=PromQL}; !JSON{status, data}; end',
+ 'http', 'json', 'request_response', 1);
+
+-- ═══════════════════════════════════════════════════════════════════
+-- Participants
+-- ═══════════════════════════════════════════════════════════════════
+
+INSERT INTO comm_participants VALUES
+('scrape', 'prometheus', 'client', 'Scrape manager pulls metrics from targets'),
+('scrape', 'target', 'server', 'Monitored service exposes /metrics endpoint'),
+('remote_write', 'prometheus', 'client', 'Queue manager batches and sends samples'),
+('remote_write', 'remote_storage', 'server', 'Remote write receiver (Thanos, Cortex, Mimir, etc.)'),
+('remote_read', 'prometheus', 'client', 'Querier fans out read requests to remote storage'),
+('remote_read', 'remote_storage', 'server', 'Remote read provider returns stored samples'),
+('alertmanager_notify', 'prometheus', 'client', 'Notifier manager sends alert batches'),
+('alertmanager_notify', 'alertmanager', 'server', 'Alertmanager receives and groups alerts'),
+('adapter_query', 'adapter', 'client', 'prometheus-adapter queries instant metric values'),
+('adapter_query', 'prometheus', 'server', 'Prometheus evaluates PromQL and returns results'),
+('adapter_query_range', 'adapter', 'client', 'prometheus-adapter queries time-range metric values'),
+('adapter_query_range', 'prometheus', 'server', 'Prometheus evaluates range PromQL queries'),
+('adapter_series', 'adapter', 'client', 'prometheus-adapter discovers available series'),
+('adapter_series', 'prometheus', 'server', 'Prometheus returns matching series metadata'),
+('k8s_custom_metrics', 'kubernetes', 'client', 'Kubernetes HPA queries custom metrics for scaling'),
+('k8s_custom_metrics', 'adapter', 'server', 'Adapter translates Kubernetes metric requests to PromQL'),
+('k8s_external_metrics', 'kubernetes', 'client', 'Kubernetes HPA queries external metrics'),
+('k8s_external_metrics', 'adapter', 'server', 'Adapter provides external metric values from Prometheus'),
+('k8s_resource_metrics', 'kubernetes', 'client', 'Kubernetes scheduler/HPA queries resource metrics'),
+('k8s_resource_metrics', 'adapter', 'server', 'Adapter provides CPU/memory metrics from Prometheus'),
+('discovery', 'prometheus', 'client', 'Discovery manager polls providers for target groups'),
+('discovery', 'provider', 'server', 'Cloud/infra API returns target lists'),
+('federation', 'prometheus_global', 'client', 'Global Prometheus scrapes shard /federate endpoints'),
+('federation', 'prometheus', 'server', 'Shard Prometheus serves federated metrics'),
+('otlp_ingest', 'external_service', 'client', 'OTLP-instrumented service pushes metrics'),
+('otlp_ingest', 'prometheus', 'server', 'OTLP write handler receives and converts metrics'),
+('promql_api', 'external_client', 'client', 'Grafana, scripts, or other consumers'),
+('promql_api', 'prometheus', 'server', 'Web API evaluates PromQL and returns JSON'),
+('adapter_query', 'client_golang', 'contract', 'API contract: httpAPI.Query defines the /api/v1/query client interface'),
+('adapter_query_range', 'client_golang', 'contract', 'API contract: httpAPI.QueryRange defines the /api/v1/query_range client interface'),
+('adapter_series', 'client_golang', 'contract', 'API contract: httpAPI.Series defines the /api/v1/series client interface'),
+('promql_api', 'client_golang', 'contract', 'API contract: v1.API interface defines the full Prometheus HTTP API surface');
+
+-- ═══════════════════════════════════════════════════════════════════
+-- Session Type Steps (formalized message sequences)
+-- ═══════════════════════════════════════════════════════════════════
+
+-- Scrape protocol steps
+INSERT INTO comm_session_steps VALUES
+('scrape', 1, 'client', '!', 'HTTP GET /metrics', 'none', 'Prometheus sends HTTP GET to target /metrics endpoint'),
+('scrape', 2, 'server', '!', 'text/plain exposition', 'text/plain', 'Target responds with metrics in exposition format'),
+('scrape', 3, 'client', '?', 'text/plain exposition', 'text/plain', 'Prometheus receives and parses exposition data');
+
+-- Remote write protocol steps
+INSERT INTO comm_session_steps VALUES
+('remote_write', 1, 'client', '!', 'protobuf WriteRequest', 'protobuf+snappy', 'Prometheus sends snappy-compressed protobuf WriteRequest'),
+('remote_write', 2, 'server', '!', 'HTTP status', 'none', 'Remote storage acknowledges with HTTP status code'),
+('remote_write', 3, 'client', '?', 'HTTP status', 'none', 'Prometheus checks status for retry logic');
+
+-- Adapter query steps
+INSERT INTO comm_session_steps VALUES
+('adapter_query', 1, 'client', '!', 'HTTP query=PromQL&time=T', 'form', 'Adapter sends PromQL instant query with timestamp'),
+('adapter_query', 2, 'server', '!', 'JSON APIResponse{data:QueryResult}', 'json', 'Prometheus evaluates PromQL, returns vector/scalar/matrix'),
+('adapter_query', 3, 'client', '?', 'JSON APIResponse{data:QueryResult}', 'json', 'Adapter unmarshals QueryResult into custom metrics');
+
+-- Adapter series discovery steps
+INSERT INTO comm_session_steps VALUES
+('adapter_series', 1, 'client', '!', 'HTTP match[]=selector&start=T&end=T', 'form', 'Adapter sends series selector match parameters'),
+('adapter_series', 2, 'server', '!', 'JSON APIResponse{data:Series[]}', 'json', 'Prometheus returns matching series with label sets'),
+('adapter_series', 3, 'client', '?', 'JSON APIResponse{data:Series[]}', 'json', 'Adapter processes series for metric naming and listing');
+
+-- ═══════════════════════════════════════════════════════════════════
+-- Endpoint Detection (from CPG nodes)
+-- ═══════════════════════════════════════════════════════════════════
+
+-- Prometheus server endpoints: scrape loop (client role in scrape protocol)
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'scrape', 'prometheus', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'scrape'
+  AND (n.name LIKE '*scrapeLoop.run%' OR n.name LIKE '*scrapeLoop.scrapeAndReport%');
+
+-- Remote write: queue manager sending
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'remote_write', 'prometheus', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'storage/remote'
+  AND (n.name LIKE '*QueueManager.sendBatch%' OR n.name LIKE '*QueueManager.Start%'
+       OR n.name LIKE '%Client.Store%');
+
+-- Remote write: server handler
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'remote_write', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/write', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'storage/remote'
+  AND n.name LIKE '*writeHandler%';
+
+-- Remote read: client
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'remote_read', 'prometheus', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'storage/remote'
+  AND (n.name LIKE '*Client.Read%' OR n.name LIKE '*readHandler%');
+
+-- Remote read: server handler
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'remote_read', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/read', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'storage/remote'
+  AND n.name LIKE '*readHandler.ServeHTTP%';
+
+-- Alertmanager notification: client
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'alertmanager_notify', 'prometheus', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'notifier'
+  AND (n.name LIKE '*sendLoop.sendAll%' OR n.name LIKE '*sendLoop.sendOne%'
+       OR n.name LIKE '*Manager.Send%');
+
+-- OTLP ingestion: server handler
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'otlp_ingest', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/otlp/v1/metrics', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'storage/remote'
+  AND n.name LIKE '*otlpWriteHandler.ServeHTTP%';
+
+-- PromQL API: server endpoints
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'promql_api', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line,
+       CASE WHEN n.name LIKE '*API.query' THEN '/api/v1/query'
+            WHEN n.name LIKE '*API.queryRange%' THEN '/api/v1/query_range'
+            WHEN n.name LIKE '*API.series%' THEN '/api/v1/series'
+            WHEN n.name LIKE '*API.labelValues%' THEN '/api/v1/label/*/values'
+            WHEN n.name LIKE '*API.labelNames%' THEN '/api/v1/label/__name__/values'
+            WHEN n.name LIKE '*API.targets%' THEN '/api/v1/targets'
+            ELSE '/api/v1/*'
+       END,
+       1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'web/api/v1'
+  AND n.name IN ('*API.query', '*API.queryRange', '*API.series',
+                  '*API.labelValues', '*API.labelNames', '*API.targets',
+                  '*API.alerts', '*API.rules', '*API.alertmanagers',
+                  '*API.remoteWrite', '*API.remoteRead', '*API.otlpWrite');
+
+-- Federation: server endpoint
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'federation', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/federate', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'web'
+  AND n.name LIKE '*Handler.federation%';
+
+-- Discovery: all Discoverer implementations (client role querying providers)
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'discovery', 'prometheus', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, 0.9
+FROM nodes n
+WHERE n.kind = 'function'
+  AND n.package LIKE 'discovery/%'
+  AND (n.name LIKE '*Discovery.refresh%' OR n.name LIKE '*Discovery.Run%'
+       OR n.name LIKE '%Discovery.Run%');
+
+-- Adapter client endpoints (only if adapter was processed)
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_query', 'adapter', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/query', 1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND n.name LIKE '%queryClient%.Query';
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_query_range', 'adapter', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/query_range', 1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND n.name LIKE '%queryClient%.QueryRange';
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_series', 'adapter', 'client', 'http_client',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/series', 1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND n.name LIKE '%queryClient%.Series';
+
+-- Adapter: the generic Do() method that executes all HTTP requests to Prometheus
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'adapter_query', 'adapter', 'client', 'http_transport',
+       n.id, n.name, n.package, n.file, n.line, 0.9
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND n.name LIKE '%httpAPIClient%.Do';
+
+-- Prometheus API v1 server endpoints serving the adapter's requests.
+-- The adapter calls /api/v1/query, /api/v1/query_range, /api/v1/series —
+-- these are served by *API.query, *API.queryRange, *API.series in web/api/v1.
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_query', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/query', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'web/api/v1' AND n.name = '*API.query';
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_query_range', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/query_range', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'web/api/v1' AND n.name = '*API.queryRange';
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_series', 'prometheus', 'server', 'http_handler',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/series', 1.0
+FROM nodes n
+WHERE n.kind = 'function' AND n.package = 'web/api/v1' AND n.name = '*API.series';
+
+-- Adapter: provider factory functions that wire up the Kubernetes API server
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'k8s_custom_metrics', 'adapter', 'server', 'api_provider',
+       n.id, n.name, n.package, n.file, n.line, 0.8
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND (n.name LIKE '%makeProvider%' OR n.name LIKE '%NewPrometheusProvider%'
+       OR n.name LIKE '%customProvider%.GetMetricByName%'
+       OR n.name LIKE '%customProvider%.GetMetricBySelector%');
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'k8s_external_metrics', 'adapter', 'server', 'api_provider',
+       n.id, n.name, n.package, n.file, n.line, 0.8
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND (n.name LIKE '%makeExternalProvider%' OR n.name LIKE '%NewExternalPrometheusProvider%');
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, confidence)
+SELECT 'k8s_resource_metrics', 'adapter', 'server', 'api_provider',
+       n.id, n.name, n.package, n.file, n.line, 0.8
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'adapter'
+  AND (n.name LIKE '%addResourceMetricsAPI%' OR n.name LIKE '%NewProvider%');
+
+-- client_golang API contract layer (only if client_golang was processed as extra module)
+-- These are the canonical Go client methods that define the HTTP API contract
+-- between any Prometheus client (adapter, grafana, etc.) and the Prometheus server.
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_query', 'client_golang', 'contract', 'api_contract',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/query', 1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'client_golang'
+  AND n.name LIKE '%httpAPI%.Query';
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_query_range', 'client_golang', 'contract', 'api_contract',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/query_range', 1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'client_golang'
+  AND n.name LIKE '%httpAPI%.QueryRange';
+
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'adapter_series', 'client_golang', 'contract', 'api_contract',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/series', 1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'client_golang'
+  AND n.name LIKE '%httpAPI%.Series';
+
+-- client_golang: the HTTP transport layer (api.Client.Do)
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'promql_api', 'client_golang', 'contract', 'http_transport',
+       n.id, n.name, n.package, n.file, n.line, '/api/v1/*', 0.9
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'client_golang'
+  AND n.name LIKE '%httpClient%.Do';
+
+-- client_golang: the full v1.API interface methods as contract endpoints for promql_api
+INSERT INTO comm_endpoints (protocol_id, component, role, endpoint_type, function_id, function_name, package, file, line, url_path, confidence)
+SELECT 'promql_api', 'client_golang', 'contract', 'api_contract',
+       n.id, n.name, n.package, n.file, n.line,
+       CASE WHEN n.name LIKE '%httpAPI%.Query' THEN '/api/v1/query'
+            WHEN n.name LIKE '%httpAPI%.QueryRange%' THEN '/api/v1/query_range'
+            WHEN n.name LIKE '%httpAPI%.Series%' THEN '/api/v1/series'
+            WHEN n.name LIKE '%httpAPI%.LabelValues%' THEN '/api/v1/label/*/values'
+            WHEN n.name LIKE '%httpAPI%.LabelNames%' THEN '/api/v1/labels'
+            WHEN n.name LIKE '%httpAPI%.Targets' THEN '/api/v1/targets'
+            WHEN n.name LIKE '%httpAPI%.Rules%' THEN '/api/v1/rules'
+            WHEN n.name LIKE '%httpAPI%.Alerts' THEN '/api/v1/alerts'
+            WHEN n.name LIKE '%httpAPI%.AlertManagers%' THEN '/api/v1/alertmanagers'
+            WHEN n.name LIKE '%httpAPI%.Config%' THEN '/api/v1/status/config'
+            WHEN n.name LIKE '%httpAPI%.Flags%' THEN '/api/v1/status/flags'
+            WHEN n.name LIKE '%httpAPI%.TSDB' THEN '/api/v1/status/tsdb'
+            ELSE '/api/v1/*'
+       END,
+       1.0
+FROM nodes n
+WHERE n.kind = 'function'
+  AND json_extract(n.properties, '$.project') = 'client_golang'
+  AND n.name LIKE '%httpAPI%'
+  AND n.name NOT LIKE '%UnmarshalJSON%'
+  AND n.name NOT LIKE '%marshalJSON%';
+
+-- ═══════════════════════════════════════════════════════════════════
+-- Cross-service Communication Graph
+-- ═══════════════════════════════════════════════════════════════════
+
+INSERT OR IGNORE INTO comm_graph VALUES
+('prometheus', 'target', 'scrape', '→', 'HTTP GET /metrics'),
+('prometheus', 'remote_storage', 'remote_write', '→', 'protobuf WriteRequest'),
+('remote_storage', 'prometheus', 'remote_read', '→', 'protobuf ReadResponse'),
+('prometheus', 'alertmanager', 'alertmanager_notify', '→', 'JSON alerts'),
+('adapter', 'prometheus', 'adapter_query', '→', 'PromQL instant query'),
+('adapter', 'prometheus', 'adapter_query_range', '→', 'PromQL range query'),
+('adapter', 'prometheus', 'adapter_series', '→', 'Series metadata query'),
+('kubernetes', 'adapter', 'k8s_custom_metrics', '→', 'Custom metrics API'),
+('kubernetes', 'adapter', 'k8s_external_metrics', '→', 'External metrics API'),
+('kubernetes', 'adapter', 'k8s_resource_metrics', '→', 'Resource metrics API'),
+('prometheus', 'provider', 'discovery', '→', 'Target discovery'),
+('prometheus_global', 'prometheus', 'federation', '→', 'Federated scrape'),
+('external_service', 'prometheus', 'otlp_ingest', '→', 'OTLP push'),
+('external_client', 'prometheus', 'promql_api', '→', 'PromQL HTTP API');
+
+-- ═══════════════════════════════════════════════════════════════════
+-- Channel Patterns (intra-service Honda binary session types)
+-- ═══════════════════════════════════════════════════════════════════
+
+-- Detect fan-out patterns: one sender, multiple goroutines receiving
+INSERT INTO comm_channel_patterns (component, pattern, channel_type, sender_package, receiver_package, goroutine_count, description)
+SELECT 'prometheus', 'fan_out',
+       'chan TargetGroup[]',
+       'discovery', p.package,
+       COUNT(*), 'Discovery manager fans out target groups to ' || p.package || ' consumers'
+FROM nodes p
+WHERE p.kind = 'select' AND p.package IN ('scrape', 'notifier', 'rules')
+GROUP BY p.package;
+
+-- Detect signal channels (chan struct{} used for cancellation/shutdown)
+INSERT INTO comm_channel_patterns (component, pattern, channel_type, sender_package, description)
+SELECT 'prometheus', 'signal', 'chan struct{}',
+       n.package, 'Shutdown/cancellation signal in ' || n.package
+FROM nodes n
+WHERE n.kind = 'send' AND n.package NOT LIKE 'github.com%'
+GROUP BY n.package;
+
+-- Pipeline pattern: scrape → storage → remote_write
+INSERT INTO comm_channel_patterns (component, pattern, session_type, description) VALUES
+('prometheus', 'pipeline',
+ '!samples; ?ack; end',
+ 'Scrape loop → Appender → TSDB → Queue Manager → Remote Write: samples flow through internal pipeline');
+
+-- Request-response pattern: PromQL evaluator
+INSERT INTO comm_channel_patterns (component, pattern, session_type, description) VALUES
+('prometheus', 'request_response',
+ '!PromQL_query; ?QueryResult; end',
+ 'Web API handler → PromQL engine → Storage: synchronous query evaluation');
+
+-- ═══════════════════════════════════════════════════════════════════
+-- Causality Analysis (Honda 2008 §6)
+-- ═══════════════════════════════════════════════════════════════════
+
+-- IO causality: adapter receives query result, then uses it for next request
+-- (data dependency between input and subsequent output)
+INSERT INTO comm_causality (source_endpoint, target_endpoint, kind, protocol_id, description)
+SELECT e1.id, e2.id, 'IO', 'adapter_series',
+       'Adapter receives series metadata (input), uses it to construct PromQL queries (output)'
+FROM comm_endpoints e1, comm_endpoints e2
+WHERE e1.protocol_id = 'adapter_series' AND e1.component = 'adapter'
+  AND e2.protocol_id IN ('adapter_query', 'adapter_query_range') AND e2.component = 'adapter'
+LIMIT 3;
+
+-- OO causality: Prometheus sends alerts in order (same channel, same sender)
+INSERT INTO comm_causality (source_endpoint, target_endpoint, kind, protocol_id, description)
+SELECT e1.id, e2.id, 'OO', 'alertmanager_notify',
+       'Alert batches sent to same Alertmanager preserve FIFO ordering'
+FROM comm_endpoints e1, comm_endpoints e2
+WHERE e1.protocol_id = 'alertmanager_notify' AND e1.function_name LIKE '%sendAll%'
+  AND e2.protocol_id = 'alertmanager_notify' AND e2.function_name LIKE '%sendOne%'
+LIMIT 1;
+
+-- II causality: Prometheus receives discovery updates, must process in order per provider
+INSERT INTO comm_causality (source_endpoint, target_endpoint, kind, protocol_id, description)
+SELECT e1.id, e2.id, 'II', 'discovery',
+       'Discovery updates from same provider must be processed sequentially'
+FROM comm_endpoints e1, comm_endpoints e2
+WHERE e1.protocol_id = 'discovery' AND e2.protocol_id = 'scrape'
+  AND e1.role = 'client' AND e2.role = 'client'
+LIMIT 3;
+
+INSERT INTO queries (name, description, sql) VALUES
+('comm_adapter_flow', 'Trace the adapter→prometheus→kubernetes data flow',
+ 'SELECT g1.source_component, g1.target_component, p1.name, g2.source_component AS upstream, g2.target_component AS downstream, p2.name AS upstream_protocol FROM comm_graph g1 JOIN comm_protocols p1 ON p1.id = g1.protocol_id JOIN comm_graph g2 ON g2.target_component = g1.source_component JOIN comm_protocols p2 ON p2.id = g2.protocol_id WHERE g1.source_component = ''adapter''');
+`
+
+// prometheusExternalComponents are the participants of the Prometheus
+// protocols that live outside the analyzed modules.
+var prometheusExternalComponents = []string{
+	"target", "remote_storage", "alertmanager", "kubernetes",
+	"provider", "prometheus_global", "external_service", "external_client",
+}
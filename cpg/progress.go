@@ -1,20 +1,24 @@
-package main
+package cpg
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"time"
 )
 
-// Progress reports pipeline progress to stderr with elapsed time.
+// Progress reports pipeline progress with elapsed time.
 type Progress struct {
+	w       io.Writer
 	start   time.Time
 	verbose bool
 }
 
-// NewProgress creates a progress reporter.
-func NewProgress(verbose bool) *Progress {
-	return &Progress{start: time.Now(), verbose: verbose}
+// NewProgress creates a progress reporter writing to w (nil discards).
+func NewProgress(w io.Writer, verbose bool) *Progress {
+	if w == nil {
+		w = io.Discard
+	}
+	return &Progress{w: w, start: time.Now(), verbose: verbose}
 }
 
 // Log prints a progress message with elapsed time prefix.
@@ -23,7 +27,7 @@ func (p *Progress) Log(format string, args ...any) {
 	mins := int(elapsed.Minutes())
 	secs := int(elapsed.Seconds()) % 60
 	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stderr, "[%02d:%02d] %s\n", mins, secs, msg)
+	fmt.Fprintf(p.w, "[%02d:%02d] %s\n", mins, secs, msg)
 }
 
 // Verbose prints only when verbose mode is enabled.
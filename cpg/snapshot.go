@@ -0,0 +1,704 @@
+package cpg
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// SnapshotInfo identifies the source tree a snapshot was generated from.
+type SnapshotInfo struct {
+	Name        string // label, unique per database: a tag, describe output, or as given
+	Revision    string // full commit hash; "" outside git
+	CommittedAt string // committer date, ISO 8601
+	Dirty       bool   // the working tree had uncommitted changes
+}
+
+// workingTree names the base snapshot of a tree that is not in git.
+const workingTree = "working-tree"
+
+// derivedEdges matches the edges buildDerived adds to the edges table. They
+// are left out of snapshots, which are recorded from the pipeline's graph.
+const derivedEdges = `(kind = 'eog' OR (kind = 'dfg' AND COALESCE(properties, '') LIKE '%"heuristic":true%'))`
+
+// DetectSnapshot describes the checkout at dir: its commit, commit date, and
+// `git describe` name, marked -dirty when the tree under dir has uncommitted
+// changes. Outside git the name is "working-tree". Each git command is
+// bounded by timeout (0 for none).
+func DetectSnapshot(ctx context.Context, dir string, timeout time.Duration) SnapshotInfo {
+	rev, err := gitOutput(ctx, timeout, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return SnapshotInfo{Name: workingTree}
+	}
+	info := SnapshotInfo{Name: rev[:12], Revision: rev}
+	if date, err := gitOutput(ctx, timeout, dir, "show", "-s", "--format=%cI", "HEAD"); err == nil {
+		info.CommittedAt = date
+	}
+	if name, err := gitOutput(ctx, timeout, dir, "describe", "--tags", "--always"); err == nil {
+		info.Name = name
+	}
+	if status, err := gitOutput(ctx, timeout, dir, "status", "--porcelain", "--", "."); err == nil && status != "" {
+		info.Dirty = true
+		info.Name += "-dirty"
+	}
+	return info
+}
+
+// gitOutput runs git in dir and returns its trimmed standard output.
+func gitOutput(ctx context.Context, timeout time.Duration, dir string, args ...string) (string, error) {
+	out, err := runTool(ctx, timeout, dir, "git", args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// exportRevision writes the tree of revision rev of the git repository
+// containing dir into dest with `git archive`, leaving the repository and
+// its working tree untouched. It returns the repository's top-level
+// directory and the revision's commit. Each git command, including the
+// archive, is bounded by timeout (0 for none).
+func exportRevision(ctx context.Context, timeout time.Duration, dir, rev, dest string) (string, SnapshotInfo, error) {
+	top, err := gitOutput(ctx, timeout, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", SnapshotInfo{}, fmt.Errorf("%s is not in a git repository: %w", dir, err)
+	}
+	commit, err := gitOutput(ctx, timeout, top, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", SnapshotInfo{}, fmt.Errorf("resolve %s: %w", rev, err)
+	}
+	info := SnapshotInfo{Name: rev, Revision: commit}
+	if date, err := gitOutput(ctx, timeout, top, "show", "-s", "--format=%cI", commit); err == nil {
+		info.CommittedAt = date
+	}
+
+	tctx, cancel := toolContext(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(tctx, "git", "archive", "--format=tar", commit)
+	cmd.Dir = top
+	cmd.WaitDelay = toolWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", SnapshotInfo{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", SnapshotInfo{}, fmt.Errorf("git archive: %w", err)
+	}
+	extractErr := untar(stdout, dest)
+	_, _ = io.Copy(io.Discard, stdout) // let git finish after an extraction error
+	if err := cmd.Wait(); err != nil {
+		if err := toolError(ctx, tctx, timeout, "git archive", err); tctx.Err() != nil {
+			return "", SnapshotInfo{}, err
+		}
+		return "", SnapshotInfo{}, fmt.Errorf("git archive %s: %w: %s", rev, err, strings.TrimSpace(stderr.String()))
+	}
+	if extractErr != nil {
+		return "", SnapshotInfo{}, fmt.Errorf("extract %s: %w", rev, extractErr)
+	}
+	return top, info, nil
+}
+
+// untar extracts the directories, regular files, and symlinks of a tar
+// stream into dir.
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("entry %q is outside the archive", hdr.Name)
+		}
+		target := filepath.Join(dir, hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// AddSnapshot adds the graph of git revision rev of the primary module's
+// repository to the existing database at Config.Output.Path, as a snapshot
+// called name (default: rev). The revision is exported to a temporary
+// directory and analyzed with the same configuration; additional modules in
+// the same repository are taken from the export, others as they are on disk.
+// The database's own graph and derived tables are left unchanged.
+func (gen *Generator) AddSnapshot(ctx context.Context, rev, name string) error {
+	cfg, ms, prog := gen.cfg, gen.ms, gen.prog
+	if cfg.Output.Path == "" {
+		return fmt.Errorf("add snapshot: output path required")
+	}
+	if _, err := os.Stat(cfg.Output.Path); err != nil {
+		return fmt.Errorf("add snapshot: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp(cfg.Memory.SpillDir, "cpg-snapshot-")
+	if err != nil {
+		return fmt.Errorf("add snapshot: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	prog.Log("Exporting %s of %s ...", rev, ms.PrimaryDir())
+	top, info, err := exportRevision(ctx, cfg.gitTimeout, ms.PrimaryDir(), rev, tmp)
+	if err != nil {
+		return fmt.Errorf("add snapshot: %w", err)
+	}
+	if name != "" {
+		info.Name = name
+	}
+	top, _ = filepath.EvalSymlinks(top)
+	exported := func(dir string) (string, bool) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = real
+		}
+		rel, err := filepath.Rel(top, dir)
+		if err != nil || !filepath.IsLocal(rel) && rel != "." {
+			return dir, false
+		}
+		return filepath.Join(tmp, rel), true
+	}
+
+	// The snapshot keeps the module names of the base graph, so node IDs
+	// line up across snapshots.
+	sub := *cfg
+	sub.Output = OutputConfig{Path: cfg.Output.Path, Verbose: cfg.Output.Verbose}
+	sub.Primary, _ = exported(ms.PrimaryDir())
+	sub.Modules = slices.Clone(cfg.Modules)
+	for i, mod := range ms.Dirs()[1:] {
+		dir, ok := exported(mod.Dir)
+		if !ok {
+			prog.Log("Module %s is outside %s; analyzing its working tree", mod.Prefix, top)
+		}
+		sub.Modules[i].Dir = dir
+		sub.Modules[i].Name = mod.Prefix
+	}
+	if err := sub.ValidateContext(ctx); err != nil {
+		return fmt.Errorf("add snapshot %s:\n%w", rev, err)
+	}
+
+	sg := &Generator{cfg: &sub, ms: sub.ModuleSet(), prog: prog, cache: gen.cache, graphOnly: true}
+	return sg.Generate(ctx, &SnapshotSink{Path: cfg.Output.Path, Info: info})
+}
+
+// SnapshotSink adds the graph to an existing database as a snapshot, next to
+// the graph the database was generated from (see Generator.AddSnapshot).
+// Only snapshots, snapshot_nodes, and snapshot_edges change.
+type SnapshotSink struct {
+	Path string
+	Info SnapshotInfo
+}
+
+// Write implements Sink.
+func (s *SnapshotSink) Write(ctx context.Context, out *Output) error {
+	prog := out.Progress
+	conn, err := openDB(s.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	conn.SetInterrupt(ctx.Done())
+	if !tableExists(conn, "snapshots") {
+		return fmt.Errorf("%s has no snapshots table; regenerate it first", s.Path)
+	}
+	var exists bool
+	if err := sqlitex.Execute(conn, `SELECT 1 FROM snapshots WHERE name = ?`, &sqlitex.ExecOptions{
+		Args: []any{s.Info.Name},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			exists = true
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("snapshot %q already exists in %s", s.Info.Name, s.Path)
+	}
+
+	// The base graph is recorded the first time another snapshot joins it.
+	if err := recordBaseSnapshot(conn, false, prog); err != nil {
+		return err
+	}
+
+	// Stage the graph in a database of its own, so nodes, edges, and sources
+	// are read back the same way as the base graph's.
+	stage := s.Path + ".snapshot"
+	removeDB(stage)
+	defer removeDB(stage)
+	if err := writeStage(stage, out.Graph, prog); err != nil {
+		return err
+	}
+	if err := sqlitex.Execute(conn, `ATTACH DATABASE ? AS snap`, &sqlitex.ExecOptions{Args: []any{stage}}); err != nil {
+		return fmt.Errorf("attach snapshot stage: %w", err)
+	}
+	defer func() { _ = sqlitex.ExecuteTransient(conn, `DETACH DATABASE snap`, nil) }()
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	if err = sqlitex.Execute(conn,
+		`INSERT INTO snapshots (name, revision, committed_at, dirty, is_base) VALUES (?, ?, ?, ?, 0)`,
+		&sqlitex.ExecOptions{Args: []any{s.Info.Name, nullIfEmpty(s.Info.Revision), nullIfEmpty(s.Info.CommittedAt), s.Info.Dirty}}); err != nil {
+		endFn(&err)
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+	id := conn.LastInsertRowID()
+	nodes, edges, err := recordSnapshot(conn, "snap", id)
+	endFn(&err)
+	if err != nil {
+		return err
+	}
+	prog.Log("Added snapshot %s (%s): %d nodes, %d edges", s.Info.Name, cmp.Or(s.Info.Revision, "no revision"), nodes, edges)
+	return nil
+}
+
+// writeStage writes the graph's nodes, edges, and sources to a new database
+// at path.
+func writeStage(path string, g *CPG, prog *Progress) error {
+	conn, err := openDB(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := createTables(conn); err != nil {
+		return err
+	}
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	if err = insertNodes(conn, g.SortedNodes(), prog); err == nil {
+		if err = insertEdges(conn, g.SortedEdges(), prog); err == nil {
+			if err = insertSources(conn, g.AllSources(), prog); err == nil {
+				err = g.Err()
+			}
+		}
+	}
+	endFn(&err)
+	return err
+}
+
+// removeDB removes a SQLite database file and its WAL files.
+func removeDB(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		_ = os.Remove(path + suffix)
+	}
+}
+
+// createSnapshotTables creates the snapshot base tables unless they exist,
+// as in databases written before snapshots were recorded.
+func createSnapshotTables(conn *sqlite.Conn) error {
+	ddl := `
+CREATE TABLE IF NOT EXISTS snapshots (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    revision TEXT,
+    committed_at TEXT,
+    dirty INTEGER NOT NULL DEFAULT 0,
+    is_base INTEGER NOT NULL DEFAULT 0,
+    node_count INTEGER,
+    edge_count INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS snapshot_nodes (
+    snapshot_id INTEGER NOT NULL,
+    id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    file TEXT,
+    line INTEGER,
+    package TEXT,
+    parent_function TEXT,
+    key TEXT,
+    hash TEXT NOT NULL,
+    PRIMARY KEY (snapshot_id, id)
+);
+CREATE INDEX IF NOT EXISTS idx_snapshot_nodes_key ON snapshot_nodes(snapshot_id, key);
+
+CREATE TABLE IF NOT EXISTS snapshot_edges (
+    snapshot_id INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    target TEXT NOT NULL,
+    kind TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_snapshot_edges_source ON snapshot_edges(snapshot_id, source, kind);
+CREATE INDEX IF NOT EXISTS idx_snapshot_edges_kind ON snapshot_edges(snapshot_id, kind);
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("snapshot tables: %w", err)
+	}
+	return nil
+}
+
+// insertBaseSnapshot records the snapshot a full write produces: the tree
+// the database's own graph was generated from.
+func insertBaseSnapshot(conn *sqlite.Conn, info SnapshotInfo) error {
+	if info.Name == "" {
+		info.Name = workingTree
+	}
+	if err := sqlitex.Execute(conn,
+		`INSERT INTO snapshots (name, revision, committed_at, dirty, is_base) VALUES (?, ?, ?, ?, 1)`,
+		&sqlitex.ExecOptions{Args: []any{info.Name, nullIfEmpty(info.Revision), nullIfEmpty(info.CommittedAt), info.Dirty}}); err != nil {
+		return fmt.Errorf("insert base snapshot: %w", err)
+	}
+	return nil
+}
+
+// updateBaseSnapshot re-describes the base snapshot after an incremental
+// update (adding the snapshot tables to older databases) and, once it has
+// been recorded for comparison with other snapshots, re-records its nodes
+// and edges.
+func updateBaseSnapshot(conn *sqlite.Conn, info SnapshotInfo, prog *Progress) error {
+	if err := createSnapshotTables(conn); err != nil {
+		return err
+	}
+	if info.Name == "" {
+		info.Name = workingTree
+	}
+	if err := sqlitex.Execute(conn,
+		`UPDATE snapshots SET name = ?, revision = ?, committed_at = ?, dirty = ? WHERE is_base = 1`,
+		&sqlitex.ExecOptions{Args: []any{info.Name, nullIfEmpty(info.Revision), nullIfEmpty(info.CommittedAt), info.Dirty}}); err != nil {
+		return fmt.Errorf("update base snapshot: %w", err)
+	}
+	if conn.Changes() == 0 {
+		return insertBaseSnapshot(conn, info)
+	}
+	return recordBaseSnapshot(conn, true, prog)
+}
+
+// recordBaseSnapshot copies the base graph into snapshot_nodes and
+// snapshot_edges. Unless refresh is set, a base snapshot that is already
+// recorded is left alone; with refresh, only a recorded one is redone.
+func recordBaseSnapshot(conn *sqlite.Conn, refresh bool, prog *Progress) (err error) {
+	var id int64
+	var recorded bool
+	if err := sqlitex.ExecuteTransient(conn,
+		`SELECT id, EXISTS (SELECT 1 FROM snapshot_nodes n WHERE n.snapshot_id = s.id) FROM snapshots s WHERE is_base = 1`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			id, recorded = stmt.ColumnInt64(0), stmt.ColumnBool(1)
+			return nil
+		}}); err != nil {
+		return fmt.Errorf("base snapshot: %w", err)
+	}
+	if id == 0 || recorded != refresh {
+		return nil
+	}
+
+	endFn, err := sqlitex.ImmediateTransaction(conn)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer endFn(&err)
+	for _, table := range []string{"snapshot_nodes", "snapshot_edges"} {
+		if err := sqlitex.Execute(conn, fmt.Sprintf(`DELETE FROM %s WHERE snapshot_id = ?`, table),
+			&sqlitex.ExecOptions{Args: []any{id}}); err != nil {
+			return fmt.Errorf("clear base snapshot: %w", err)
+		}
+	}
+	nodes, edges, err := recordSnapshot(conn, "main", id)
+	if err != nil {
+		return err
+	}
+	prog.Log("Recorded base snapshot: %d nodes, %d edges", nodes, edges)
+	return nil
+}
+
+// snapshotFunc is a function declaration read while recording a snapshot.
+type snapshotFunc struct {
+	id, kind, name, file, pkg, parent, fullName string
+	line, endLine                               int
+}
+
+// recordSnapshot copies the nodes and pipeline edges of the graph in schema
+// (main, or an attached stage) into snapshot_nodes and snapshot_edges under
+// snapshot id, and sets the snapshot's counts. Edges to missing nodes are
+// skipped, as buildDerived drops them from the base graph.
+//
+// Every node gets a content hash that ignores positions: for a function,
+// the hash of its source text; for any other node, the hash of its kind,
+// name, and type together with its enclosing function's hash. A node with
+// the same ID and hash in two snapshots is unchanged. Functions and types
+// also get a position-independent key (full name, "$n" for the nth function
+// literal of a function, "#n" for the nth declaration of a repeated name),
+// which matches them across snapshots even when lines move.
+func recordSnapshot(conn *sqlite.Conn, schema string, id int64) (nodes, edges int64, err error) {
+	// Functions, ordered so that an enclosing function precedes its literals.
+	var funcs []snapshotFunc
+	if err := sqlitex.ExecuteTransient(conn, fmt.Sprintf(
+		`SELECT id, kind, name, COALESCE(file, ''), COALESCE(line, 0), COALESCE(end_line, 0),
+		        COALESCE(package, ''), COALESCE(parent_function, ''),
+		        COALESCE(json_extract(properties, '$.full_name'), '')
+		 FROM %s.nodes WHERE kind IN (%s) ORDER BY file, line, col, id`, schema, funcKinds),
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			funcs = append(funcs, snapshotFunc{
+				id: stmt.ColumnText(0), kind: stmt.ColumnText(1), name: stmt.ColumnText(2),
+				file: stmt.ColumnText(3), line: stmt.ColumnInt(4), endLine: stmt.ColumnInt(5),
+				pkg: stmt.ColumnText(6), parent: stmt.ColumnText(7), fullName: stmt.ColumnText(8),
+			})
+			return nil
+		}}); err != nil {
+		return 0, 0, fmt.Errorf("read snapshot functions: %w", err)
+	}
+
+	src, err := newSourceLines(conn, schema)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	keys := make(map[string]string)
+	hashes := make(map[string]string)
+	seen := make(map[string]int)
+	unique := func(key string) string {
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			return fmt.Sprintf("%s#%d", key, n)
+		}
+		return key
+	}
+	for _, f := range funcs {
+		key := f.fullName
+		if key == "" {
+			// Function literal: numbered within its enclosing function
+			key = cmp.Or(keys[f.parent], f.pkg) + "$"
+			seen[key]++
+			key = fmt.Sprintf("%s%d", key, seen[key])
+		} else {
+			key = unique(key)
+		}
+		keys[f.id] = key
+		hashes[f.id] = contentHash(f.kind, f.name, src.text(f.file, f.line, f.endLine))
+	}
+
+	// Types: package- or function-qualified names
+	if err := sqlitex.ExecuteTransient(conn, fmt.Sprintf(
+		`SELECT id, name, COALESCE(package, ''), COALESCE(parent_function, '')
+		 FROM %s.nodes WHERE kind = 'type_decl' ORDER BY file, line, col, id`, schema),
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			scope := stmt.ColumnText(2)
+			if parent := stmt.ColumnText(3); parent != "" {
+				scope = keys[parent]
+			}
+			keys[stmt.ColumnText(0)] = unique(scope + "." + stmt.ColumnText(1))
+			return nil
+		}}); err != nil {
+		return 0, 0, fmt.Errorf("read snapshot types: %w", err)
+	}
+
+	insert, err := conn.Prepare(`INSERT INTO snapshot_nodes (snapshot_id, id, kind, name, file, line, package, parent_function, key, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := sqlitex.ExecuteTransient(conn, fmt.Sprintf(
+		`SELECT id, kind, name, file, line, package, parent_function, COALESCE(type_info, '')
+		 FROM %s.nodes ORDER BY id`, schema),
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			nid, parent := stmt.ColumnText(0), stmt.ColumnText(6)
+			hash, ok := hashes[nid]
+			if !ok {
+				hash = contentHash(stmt.ColumnText(1), stmt.ColumnText(2), stmt.ColumnText(7), hashes[parent])
+			}
+			insert.BindInt64(1, id)
+			insert.BindText(2, nid)
+			insert.BindText(3, stmt.ColumnText(1))
+			insert.BindText(4, stmt.ColumnText(2))
+			bindTextOrNull(insert, 5, stmt.ColumnText(3))
+			bindIntOrNull(insert, 6, stmt.ColumnInt(4))
+			bindTextOrNull(insert, 7, stmt.ColumnText(5))
+			bindTextOrNull(insert, 8, parent)
+			bindTextOrNull(insert, 9, keys[nid])
+			insert.BindText(10, hash)
+			if _, err := insert.Step(); err != nil {
+				return fmt.Errorf("insert snapshot node %s: %w", nid, err)
+			}
+			nodes++
+			return insert.Reset()
+		}}); err != nil {
+		return 0, 0, err
+	}
+
+	if err := sqlitex.Execute(conn, fmt.Sprintf(
+		`INSERT INTO snapshot_edges (snapshot_id, source, target, kind)
+		 SELECT ?, source, target, kind FROM %[1]s.edges
+		 WHERE NOT %[2]s AND source IN (SELECT id FROM %[1]s.nodes) AND target IN (SELECT id FROM %[1]s.nodes)
+		 ORDER BY source, target, kind`, schema, derivedEdges),
+		&sqlitex.ExecOptions{Args: []any{id}}); err != nil {
+		return 0, 0, fmt.Errorf("insert snapshot edges: %w", err)
+	}
+	edges = int64(conn.Changes())
+
+	if err := sqlitex.Execute(conn, `UPDATE snapshots SET node_count = ?, edge_count = ? WHERE id = ?`,
+		&sqlitex.ExecOptions{Args: []any{nodes, edges, id}}); err != nil {
+		return 0, 0, fmt.Errorf("update snapshot counts: %w", err)
+	}
+	return nodes, edges, nil
+}
+
+// sourceLines reads line ranges from a sources table, keeping the lines of
+// the last file read, so callers should visit functions grouped by file.
+type sourceLines struct {
+	stmt  *sqlite.Stmt
+	file  string
+	lines []string
+}
+
+func newSourceLines(conn *sqlite.Conn, schema string) (*sourceLines, error) {
+	stmt, err := conn.Prepare(fmt.Sprintf(`SELECT content FROM %s.sources WHERE file = ?`, schema))
+	if err != nil {
+		return nil, err
+	}
+	return &sourceLines{stmt: stmt}, nil
+}
+
+// text returns lines from through to (1-based, inclusive) of file, or ""
+// when the file or range is unknown.
+func (s *sourceLines) text(file string, from, to int) string {
+	if file != s.file {
+		s.file, s.lines = file, nil
+		s.stmt.BindText(1, file)
+		if row, err := s.stmt.Step(); err == nil && row {
+			s.lines = strings.SplitAfter(s.stmt.ColumnText(0), "\n")
+		}
+		_ = s.stmt.Reset()
+	}
+	if from < 1 || to < from || to > len(s.lines) {
+		return ""
+	}
+	return strings.Join(s.lines[from-1:to], "")
+}
+
+// contentHash returns a short hex digest of its parts.
+func contentHash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// createSnapshotViews documents the snapshot tables and adds the views and
+// queries that compare snapshots.
+func createSnapshotViews(conn *sqlite.Conn) error {
+	ddl := `
+CREATE VIEW v_snapshot_functions AS
+SELECT n.snapshot_id, s.name AS snapshot, n.key, n.id, n.name, n.package, n.file, n.line, n.hash
+FROM snapshot_nodes n JOIN snapshots s ON s.id = n.snapshot_id
+WHERE n.kind IN ('function', 'test', 'benchmark', 'fuzz', 'example');
+
+CREATE VIEW v_snapshot_calls AS
+SELECT DISTINCT e.snapshot_id, s.name AS snapshot, src.key AS caller, dst.key AS callee
+FROM snapshot_edges e
+JOIN snapshots s ON s.id = e.snapshot_id
+JOIN snapshot_nodes src ON src.snapshot_id = e.snapshot_id AND src.id = e.source
+JOIN snapshot_nodes dst ON dst.snapshot_id = e.snapshot_id AND dst.id = e.target
+WHERE e.kind = 'call';
+
+CREATE VIEW v_snapshot_edges AS
+SELECT e.snapshot_id, s.name AS snapshot, e.kind, e.source, src.name AS source_name, src.key AS source_key,
+       e.target, dst.name AS target_name, dst.key AS target_key
+FROM snapshot_edges e
+JOIN snapshots s ON s.id = e.snapshot_id
+JOIN snapshot_nodes src ON src.snapshot_id = e.snapshot_id AND src.id = e.source
+JOIN snapshot_nodes dst ON dst.snapshot_id = e.snapshot_id AND dst.id = e.target;
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('table', 'snapshots', 'Source trees recorded in this database: the base snapshot the nodes/edges tables were generated from (is_base = 1) and any added with -snapshot REV. node_count/edge_count are set once recorded', 'SELECT * FROM snapshots ORDER BY committed_at'),
+('table', 'snapshot_nodes', 'Nodes per snapshot. key matches functions and types across snapshots regardless of position; the same id and hash in two snapshots means the node is unchanged. The base snapshot is recorded when the first other snapshot is added', 'SELECT * FROM snapshot_nodes WHERE snapshot_id = 2 AND kind = ''function'''),
+('table', 'snapshot_edges', 'Edges per snapshot, without the edges derived while writing (eog, heuristic dfg)', 'SELECT * FROM snapshot_edges WHERE snapshot_id = 2 AND kind = ''call'''),
+('view', 'v_snapshot_functions', 'Function declarations per snapshot with their position-independent key and body hash', 'SELECT * FROM v_snapshot_functions WHERE snapshot = ''v2.53.0'''),
+('view', 'v_snapshot_calls', 'Call graph per snapshot between function keys', 'SELECT * FROM v_snapshot_calls WHERE snapshot = ''v2.53.0'' AND caller LIKE ''%scrape%'''),
+('view', 'v_snapshot_edges', 'Edges per snapshot with the names and keys of both endpoints', 'SELECT * FROM v_snapshot_edges WHERE snapshot_id = 2 AND kind = ''ref''');
+
+INSERT INTO queries (name, description, sql) VALUES
+('snapshot_list', 'Snapshots in this database, oldest commit first',
+ 'SELECT id, name, revision, committed_at, dirty, is_base, node_count, edge_count FROM snapshots ORDER BY committed_at, id'),
+('snapshot_function_changes', 'Functions added, removed, or modified between snapshots :old and :new (by name)',
+ 'WITH o AS (SELECT * FROM v_snapshot_functions WHERE snapshot = :old), n AS (SELECT * FROM v_snapshot_functions WHERE snapshot = :new)
+SELECT ''added'' AS change, n.key, n.package, n.file, n.line FROM n WHERE n.key NOT IN (SELECT key FROM o)
+UNION ALL SELECT ''removed'', o.key, o.package, o.file, o.line FROM o WHERE o.key NOT IN (SELECT key FROM n)
+UNION ALL SELECT ''modified'', n.key, n.package, n.file, n.line FROM n JOIN o ON o.key = n.key WHERE o.hash != n.hash
+ORDER BY 1, 2'),
+('snapshot_call_changes', 'call edges added or removed between snapshots :old and :new, by function key',
+ 'WITH o AS (SELECT caller, callee FROM v_snapshot_calls WHERE snapshot = :old), n AS (SELECT caller, callee FROM v_snapshot_calls WHERE snapshot = :new)
+SELECT ''added'' AS change, caller, callee FROM (SELECT * FROM n EXCEPT SELECT * FROM o)
+UNION ALL SELECT ''removed'', caller, callee FROM (SELECT * FROM o EXCEPT SELECT * FROM n)
+ORDER BY 1, 2, 3'),
+('snapshot_unchanged_nodes', 'Nodes with the same ID and content hash in snapshots :old and :new',
+ 'SELECT n.id, n.kind, n.name, n.file, n.line FROM snapshot_nodes n
+JOIN snapshot_nodes o ON o.id = n.id AND o.hash = n.hash
+WHERE n.snapshot_id = (SELECT id FROM snapshots WHERE name = :new) AND o.snapshot_id = (SELECT id FROM snapshots WHERE name = :old)'),
+('snapshot_callers_of', 'Direct callers of function :key in snapshot :snapshot',
+ 'SELECT caller FROM v_snapshot_calls WHERE snapshot = :snapshot AND callee = :key ORDER BY caller'),
+('snapshot_call_chain', 'Functions reachable from function :key in snapshot :snapshot (up to depth 10)',
+ 'WITH RECURSIVE chain(key, depth) AS (
+  SELECT :key, 0
+  UNION
+  SELECT c.callee, ch.depth + 1 FROM chain ch JOIN v_snapshot_calls c ON c.caller = ch.key
+  WHERE c.snapshot = :snapshot AND ch.depth < 10
+)
+SELECT key, MIN(depth) AS depth FROM chain GROUP BY key ORDER BY depth, key'),
+('snapshot_nodes_as_of', 'Nodes of kind :kind in snapshot :snapshot_id (see snapshot_list), as the nodes table held them at that revision',
+ 'SELECT id, name, package, file, line, parent_function, key FROM snapshot_nodes WHERE snapshot_id = :snapshot_id AND kind = :kind ORDER BY file, line, id'),
+('snapshot_edges_as_of', 'Edges of kind :kind in snapshot :snapshot_id, with endpoint names',
+ 'SELECT source, source_name, target, target_name FROM v_snapshot_edges WHERE snapshot_id = :snapshot_id AND kind = :kind ORDER BY source, target'),
+('snapshot_functions_as_of', 'Functions in snapshot :snapshot_id with their key, position, and body hash',
+ 'SELECT key, package, file, line, hash FROM v_snapshot_functions WHERE snapshot_id = :snapshot_id ORDER BY key'),
+('snapshot_callees_as_of', 'Direct callees of function :key in snapshot :snapshot_id',
+ 'SELECT callee FROM v_snapshot_calls WHERE snapshot_id = :snapshot_id AND caller = :key ORDER BY callee');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("snapshot views: %w", err)
+	}
+	return nil
+}
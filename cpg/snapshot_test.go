@@ -0,0 +1,147 @@
+package cpg
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// TestSnapshot commits the basic fixture to a git repository, changes it
+// with editBasicFixture in a second commit, generates the database from the
+// second commit, and adds the first as a snapshot.
+func TestSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := filepath.Join(copyFixtures(t), "basic")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+
+	editBasicFixture(t, root)
+	git("commit", "-q", "-am", "v2")
+
+	db, gen := generateFixture(t, root, nil)
+	ctx := context.Background()
+	if err := gen.AddSnapshot(ctx, "v1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := gen.AddSnapshot(ctx, "v1", ""); err == nil {
+		t.Error("adding snapshot v1 twice succeeded")
+	}
+
+	conn, err := sqlite.OpenConn(db, sqlite.OpenReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var names []string
+	query(t, conn, `SELECT name || ':' || is_base FROM snapshots ORDER BY id`, nil, func(stmt *sqlite.Stmt) {
+		names = append(names, stmt.ColumnText(0))
+	})
+	if len(names) != 2 || !strings.HasPrefix(names[0], "v1-1-g") || names[1] != "v1:0" {
+		t.Fatalf("snapshots = %q, want the base (v1-1-g…) and v1", names)
+	}
+
+	params := map[string]any{":old": "v1", ":new": strings.TrimSuffix(names[0], ":1")}
+	var changes []string
+	query(t, conn, savedQuery(t, conn, "snapshot_function_changes"), params, func(stmt *sqlite.Stmt) {
+		changes = append(changes, stmt.ColumnText(0)+" "+stmt.ColumnText(1))
+	})
+	if want := []string{"added b.Helper", "modified b.Area"}; !slices.Equal(changes, want) {
+		t.Errorf("function changes = %q, want %q", changes, want)
+	}
+
+	var calls []string
+	query(t, conn, savedQuery(t, conn, "snapshot_call_changes"), params, func(stmt *sqlite.Stmt) {
+		calls = append(calls, stmt.ColumnText(0)+" "+stmt.ColumnText(1)+" -> "+stmt.ColumnText(2))
+	})
+	if want := []string{"added b.Area -> a.Old"}; !slices.Equal(calls, want) {
+		t.Errorf("call changes = %q, want %q", calls, want)
+	}
+
+	// The older snapshot reads as the graph was at v1.
+	ids := make(map[string]int64)
+	query(t, conn, `SELECT name, id FROM snapshots`, nil, func(stmt *sqlite.Stmt) {
+		ids[stmt.ColumnText(0)] = stmt.ColumnInt64(1)
+	})
+	asOf := func(name string, params map[string]any) []string {
+		var rows []string
+		query(t, conn, savedQuery(t, conn, name), params, func(stmt *sqlite.Stmt) {
+			rows = append(rows, stmt.ColumnText(0))
+		})
+		return rows
+	}
+	for _, tc := range []struct {
+		snapshot   string
+		helper     bool
+		areaCallee bool
+	}{
+		{"v1", false, false},
+		{strings.TrimSuffix(names[0], ":1"), true, true},
+	} {
+		id := ids[tc.snapshot]
+		funcs := asOf("snapshot_functions_as_of", map[string]any{":snapshot_id": id})
+		if got := slices.Contains(funcs, "b.Helper"); got != tc.helper {
+			t.Errorf("snapshot %s has b.Helper = %v, want %v", tc.snapshot, got, tc.helper)
+		}
+		nodes := asOf("snapshot_nodes_as_of", map[string]any{":snapshot_id": id, ":kind": "function"})
+		if len(nodes) != len(funcs) {
+			t.Errorf("snapshot %s: %d function nodes, %d functions", tc.snapshot, len(nodes), len(funcs))
+		}
+		callees := asOf("snapshot_callees_as_of", map[string]any{":snapshot_id": id, ":key": "b.Area"})
+		if got := slices.Contains(callees, "a.Old"); got != tc.areaCallee {
+			t.Errorf("snapshot %s: b.Area calls a.Old = %v, want %v (callees %q)", tc.snapshot, got, tc.areaCallee, callees)
+		}
+		calls := asOf("snapshot_edges_as_of", map[string]any{":snapshot_id": id, ":kind": "call"})
+		if len(calls) == 0 {
+			t.Errorf("snapshot %s has no call edges", tc.snapshot)
+		}
+	}
+}
+
+// savedQuery returns the SQL of a row in the queries table.
+func savedQuery(t *testing.T, conn *sqlite.Conn, name string) string {
+	t.Helper()
+	var sql string
+	query(t, conn, `SELECT sql FROM queries WHERE name = :name`, map[string]any{":name": name}, func(stmt *sqlite.Stmt) {
+		sql = stmt.ColumnText(0)
+	})
+	if sql == "" {
+		t.Fatalf("no query %s", name)
+	}
+	return sql
+}
+
+func query(t *testing.T, conn *sqlite.Conn, sql string, params map[string]any, fn func(*sqlite.Stmt)) {
+	t.Helper()
+	err := sqlitex.Execute(conn, sql, &sqlitex.ExecOptions{
+		Named: params,
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			fn(stmt)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,439 @@
+package cpg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// spillStore is the on-disk half of a streaming CPG: a scratch SQLite
+// database that receives buffered nodes, edges, and sources in batches.
+// Deduplication moves to its unique keys, and the seq columns preserve the
+// order elements were first added, so reading back yields exactly what an
+// in-memory CPG would hold. The database is throwaway, so it runs without a
+// journal or fsync.
+type spillStore struct {
+	path         string
+	conn         *sqlite.Conn
+	nodes, edges int // rows stored
+	batches      int
+}
+
+// spillPage is how many rows are read back (and updated) at a time.
+const spillPage = 10000
+
+const spillSchema = `
+CREATE TABLE nodes (
+    seq INTEGER PRIMARY KEY,
+    id TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL,
+    name TEXT NOT NULL,
+    file TEXT,
+    line INTEGER,
+    col INTEGER,
+    end_line INTEGER,
+    end_col INTEGER,
+    start_offset INTEGER,
+    end_offset INTEGER,
+    package TEXT,
+    parent_function TEXT,
+    type_info TEXT,
+    properties TEXT
+);
+
+CREATE TABLE edges (
+    seq INTEGER PRIMARY KEY,
+    source TEXT NOT NULL,
+    target TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    properties TEXT,
+    UNIQUE (source, target, kind)
+);
+
+CREATE TABLE sources (
+    file TEXT PRIMARY KEY,
+    content TEXT NOT NULL
+);
+`
+
+// openSpillStore creates an empty staging database in dir ("" for the
+// system temp directory).
+func openSpillStore(dir string) (*spillStore, error) {
+	f, err := os.CreateTemp(dir, "cpg-spill-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("create spill db: %w", err)
+	}
+	path := f.Name()
+	_ = f.Close()
+
+	conn, err := sqlite.OpenConn(path, sqlite.OpenCreate, sqlite.OpenReadWrite)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("open spill db: %w", err)
+	}
+	s := &spillStore{path: path, conn: conn}
+	for _, pragma := range []string{
+		"PRAGMA journal_mode = OFF",
+		"PRAGMA synchronous = OFF",
+		"PRAGMA cache_size = -32000",
+	} {
+		if err := sqlitex.ExecuteTransient(conn, pragma, nil); err != nil {
+			s.close()
+			return nil, fmt.Errorf("spill db: %w", err)
+		}
+	}
+	if err := sqlitex.ExecuteScript(conn, spillSchema, nil); err != nil {
+		s.close()
+		return nil, fmt.Errorf("spill db schema: %w", err)
+	}
+	return s, nil
+}
+
+// close closes and removes the staging database.
+func (s *spillStore) close() error {
+	err := s.conn.Close()
+	if rmErr := os.Remove(s.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// write appends one batch in a single transaction. Rows whose key is already
+// stored are ignored, which keeps the earlier (first-added) copy.
+func (s *spillStore) write(nodes []Node, edges []Edge, sources map[string]string) (err error) {
+	endFn, err := sqlitex.ImmediateTransaction(s.conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+	s.batches++
+
+	stmt, err := s.conn.Prepare(`INSERT OR IGNORE INTO nodes (id, kind, name, file, line, col, end_line, end_col, start_offset, end_offset, package, parent_function, type_info, properties) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		stmt.BindText(1, n.ID)
+		bindNodeColumns(stmt, 2, &n)
+		if _, err := stmt.Step(); err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		s.nodes += s.conn.Changes()
+		_ = stmt.Reset()
+	}
+
+	stmt, err = s.conn.Prepare(`INSERT OR IGNORE INTO edges (source, target, kind, properties) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	for _, e := range edges {
+		stmt.BindText(1, e.Source)
+		stmt.BindText(2, e.Target)
+		stmt.BindText(3, e.Kind)
+		bindTextOrNull(stmt, 4, PropsJSON(e.Properties))
+		if _, err := stmt.Step(); err != nil {
+			return fmt.Errorf("edge %s→%s: %w", e.Source, e.Target, err)
+		}
+		s.edges += s.conn.Changes()
+		_ = stmt.Reset()
+	}
+
+	stmt, err = s.conn.Prepare(`INSERT OR IGNORE INTO sources (file, content) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	for file, content := range sources {
+		stmt.BindText(1, file)
+		stmt.BindText(2, content)
+		if _, err := stmt.Step(); err != nil {
+			return fmt.Errorf("source %s: %w", file, err)
+		}
+		_ = stmt.Reset()
+	}
+	return nil
+}
+
+// bindNodeColumns binds every node column except the ID, starting at
+// parameter i.
+func bindNodeColumns(stmt *sqlite.Stmt, i int, n *Node) {
+	stmt.BindText(i, n.Kind)
+	stmt.BindText(i+1, n.Name)
+	bindTextOrNull(stmt, i+2, n.File)
+	bindIntOrNull(stmt, i+3, n.Line)
+	bindIntOrNull(stmt, i+4, n.Col)
+	bindIntOrNull(stmt, i+5, n.EndLine)
+	bindIntOrNull(stmt, i+6, n.EndCol)
+	bindSpan(stmt, i+7, *n)
+	bindTextOrNull(stmt, i+9, n.Package)
+	bindTextOrNull(stmt, i+10, n.ParentFunction)
+	bindTextOrNull(stmt, i+11, n.TypeInfo)
+	bindTextOrNull(stmt, i+12, PropsJSON(n.Properties))
+}
+
+// scanNodes reads nodes back in seq order (or by ID when sorted is set), a
+// page at a time, and calls fn on each. fn reports whether to continue and
+// whether it modified the node; modified nodes are written back. Errors are
+// stored in *errp.
+func (s *spillStore) scanNodes(errp *error, sorted bool, fn func(n *Node) (cont, changed bool)) {
+	query := `SELECT seq, id, kind, name, file, line, col, end_line, end_col, start_offset, end_offset, package, parent_function, type_info, properties
+		FROM nodes WHERE seq > ? ORDER BY seq LIMIT ?`
+	var last any = int64(0)
+	if sorted {
+		query = `SELECT seq, id, kind, name, file, line, col, end_line, end_col, start_offset, end_offset, package, parent_function, type_info, properties
+		FROM nodes WHERE id > ? ORDER BY id LIMIT ?`
+		last = ""
+	}
+	for *errp == nil {
+		var seqs []int64
+		var page []Node
+		err := sqlitex.Execute(s.conn, query,
+			&sqlitex.ExecOptions{
+				Args: []any{last, spillPage},
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					props, err := decodeProps(stmt.ColumnText(14))
+					if err != nil {
+						return fmt.Errorf("node %s: %w", stmt.ColumnText(1), err)
+					}
+					seqs = append(seqs, stmt.ColumnInt64(0))
+					page = append(page, Node{
+						ID:             stmt.ColumnText(1),
+						Kind:           stmt.ColumnText(2),
+						Name:           stmt.ColumnText(3),
+						File:           stmt.ColumnText(4),
+						Line:           stmt.ColumnInt(5),
+						Col:            stmt.ColumnInt(6),
+						EndLine:        stmt.ColumnInt(7),
+						EndCol:         stmt.ColumnInt(8),
+						StartOffset:    stmt.ColumnInt(9),
+						EndOffset:      stmt.ColumnInt(10),
+						Package:        stmt.ColumnText(11),
+						ParentFunction: stmt.ColumnText(12),
+						TypeInfo:       stmt.ColumnText(13),
+						Properties:     props,
+					})
+					return nil
+				},
+			})
+		if err != nil {
+			*errp = fmt.Errorf("spill: read nodes: %w", err)
+			return
+		}
+		if len(page) == 0 {
+			return
+		}
+		if sorted {
+			last = page[len(page)-1].ID
+		} else {
+			last = seqs[len(seqs)-1]
+		}
+
+		var changed []int
+		cont := true
+		for i := range page {
+			var ch bool
+			if cont, ch = fn(&page[i]); ch {
+				changed = append(changed, i)
+			}
+			if !cont {
+				break
+			}
+		}
+		if len(changed) > 0 {
+			if err := s.rewrite(`UPDATE nodes SET kind = ?, name = ?, file = ?, line = ?, col = ?, end_line = ?, end_col = ?, start_offset = ?, end_offset = ?, package = ?, parent_function = ?, type_info = ?, properties = ? WHERE seq = ?`,
+				changed, func(stmt *sqlite.Stmt, i int) {
+					bindNodeColumns(stmt, 1, &page[i])
+					stmt.BindInt64(14, seqs[i])
+				}); err != nil {
+				*errp = fmt.Errorf("spill: update nodes: %w", err)
+				return
+			}
+		}
+		if !cont {
+			return
+		}
+	}
+}
+
+// scanEdges is scanNodes for edges, sorted by source, target, and kind when
+// sorted is set; only edge properties are written back.
+func (s *spillStore) scanEdges(errp *error, sorted bool, fn func(e *Edge) (cont, changed bool)) {
+	var lastSeq int64
+	var lastEdge Edge
+	for *errp == nil {
+		var seqs []int64
+		var page []Edge
+		query := `SELECT seq, source, target, kind, properties FROM edges WHERE seq > ? ORDER BY seq LIMIT ?`
+		args := []any{lastSeq, spillPage}
+		if sorted {
+			query = `SELECT seq, source, target, kind, properties FROM edges
+				WHERE (source, target, kind) > (?, ?, ?) ORDER BY source, target, kind LIMIT ?`
+			args = []any{lastEdge.Source, lastEdge.Target, lastEdge.Kind, spillPage}
+		}
+		err := sqlitex.Execute(s.conn, query,
+			&sqlitex.ExecOptions{
+				Args: args,
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					props, err := decodeProps(stmt.ColumnText(4))
+					if err != nil {
+						return fmt.Errorf("edge %s→%s: %w", stmt.ColumnText(1), stmt.ColumnText(2), err)
+					}
+					seqs = append(seqs, stmt.ColumnInt64(0))
+					page = append(page, Edge{
+						Source:     stmt.ColumnText(1),
+						Target:     stmt.ColumnText(2),
+						Kind:       stmt.ColumnText(3),
+						Properties: props,
+					})
+					return nil
+				},
+			})
+		if err != nil {
+			*errp = fmt.Errorf("spill: read edges: %w", err)
+			return
+		}
+		if len(page) == 0 {
+			return
+		}
+		lastSeq, lastEdge = seqs[len(seqs)-1], page[len(page)-1]
+
+		var changed []int
+		cont := true
+		for i := range page {
+			var ch bool
+			if cont, ch = fn(&page[i]); ch {
+				changed = append(changed, i)
+			}
+			if !cont {
+				break
+			}
+		}
+		if len(changed) > 0 {
+			if err := s.rewrite(`UPDATE edges SET properties = ? WHERE seq = ?`,
+				changed, func(stmt *sqlite.Stmt, i int) {
+					bindTextOrNull(stmt, 1, PropsJSON(page[i].Properties))
+					stmt.BindInt64(2, seqs[i])
+				}); err != nil {
+				*errp = fmt.Errorf("spill: update edges: %w", err)
+				return
+			}
+		}
+		if !cont {
+			return
+		}
+	}
+}
+
+// scanSources yields every spilled source file in file order.
+func (s *spillStore) scanSources(errp *error, yield func(file, content string) bool) {
+	last := ""
+	for *errp == nil {
+		var files, contents []string
+		err := sqlitex.Execute(s.conn,
+			`SELECT file, content FROM sources WHERE file > ? ORDER BY file LIMIT ?`,
+			&sqlitex.ExecOptions{
+				Args: []any{last, spillPage / 10},
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					files = append(files, stmt.ColumnText(0))
+					contents = append(contents, stmt.ColumnText(1))
+					return nil
+				},
+			})
+		if err != nil {
+			*errp = fmt.Errorf("spill: read sources: %w", err)
+			return
+		}
+		if len(files) == 0 {
+			return
+		}
+		last = files[len(files)-1]
+		for i := range files {
+			if !yield(files[i], contents[i]) {
+				return
+			}
+		}
+	}
+}
+
+// rewrite runs query once per changed row in a single transaction.
+func (s *spillStore) rewrite(query string, rows []int, bind func(stmt *sqlite.Stmt, i int)) (err error) {
+	endFn, err := sqlitex.ImmediateTransaction(s.conn)
+	if err != nil {
+		return err
+	}
+	defer endFn(&err)
+
+	stmt, err := s.conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	for _, i := range rows {
+		bind(stmt, i)
+		if _, err := stmt.Step(); err != nil {
+			return err
+		}
+		_ = stmt.Reset()
+	}
+	return nil
+}
+
+// decodeProps parses a properties column written by PropsJSON. Numbers are
+// kept as json.Number so they re-encode exactly.
+func decodeProps(s string) (map[string]any, error) {
+	if s == "" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseByteSize parses a memory size such as "512MiB", "8GiB", "2GB", or a
+// plain byte count. "0" and "off" mean no limit and return math.MaxInt64.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" || strings.EqualFold(s, "off") {
+		return math.MaxInt64, nil
+	}
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+	num, scale := s, 1.0
+	for _, u := range units {
+		if len(s) > len(u.suffix) && strings.EqualFold(s[len(s)-len(u.suffix):], u.suffix) {
+			num, scale = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 || v*scale >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512MiB, 8GiB, or off)", s)
+	}
+	return int64(v * scale), nil
+}
+
+// formatBytes renders n for progress output.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%d KiB", n>>10)
+}
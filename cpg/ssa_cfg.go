@@ -1,4 +1,4 @@
-package main
+package cpg
 
 import (
 	"go/token"
@@ -13,10 +13,14 @@ import (
 type SSAResult struct {
 	Prog     *ssa.Program
 	AllFuncs map[*ssa.Function]bool
+	Funcs    []*ssa.Function // non-synthetic module functions in stable order
+	// Deprecated maps deprecated functions and types outside the analyzed
+	// modules to their deprecation messages, for marking external stubs.
+	Deprecated map[types.Object]string
 }
 
 // BuildSSA constructs the SSA representation from loaded packages.
-func BuildSSA(pkgs []*packages.Package, prog *Progress) *SSAResult {
+func BuildSSA(pkgs []*packages.Package, ms *ModuleSet, prog *Progress) *SSAResult {
 	prog.Log("Building SSA...")
 
 	ssaProg, ssaPkgs := ssautil.AllPackages(pkgs, ssa.InstantiateGenerics)
@@ -34,46 +38,38 @@ func BuildSSA(pkgs []*packages.Package, prog *Progress) *SSAResult {
 
 	allFuncs := ssautil.AllFunctions(ssaProg)
 
-	var count int
-	for fn := range allFuncs {
-		if fn.Synthetic != "" {
-			continue
-		}
-		if fn.Pkg == nil {
-			continue
-		}
-		if modSet.IsKnownPkg(fn.Pkg.Pkg.Path()) {
-			count++
-		}
-	}
+	funcs := sortFuncs(allFuncs, ssaProg.Fset, ms)
 
-	prog.Log("Built SSA for %d functions across %d modules", count, len(modSet.Dirs()))
+	prog.Log("Built SSA for %d functions across %d modules", len(funcs), len(ms.Dirs()))
 
 	return &SSAResult{
-		Prog:     ssaProg,
-		AllFuncs: allFuncs,
+		Prog:       ssaProg,
+		AllFuncs:   allFuncs,
+		Funcs:      funcs,
+		Deprecated: externalDeprecations(pkgs, ms),
 	}
 }
 
 // ExtractCFGAndDFG extracts control-flow and data-flow edges from SSA.
+// Functions are processed on up to workers goroutines and merged in order.
 func ExtractCFGAndDFG(
 	ssaResult *SSAResult,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	posLookup *PosLookup,
 	funcLookup *FuncLookup,
 	cpg *CPG,
+	workers int,
 	prog *Progress,
 ) {
 	prog.Log("Extracting CFG + DFG...")
 
-	var cfgEdges, dfgEdges, bbNodes, captureEdges int
-	var ssaPromFuncs, ssaWithBlocks, ssaMatched int
+	var total cfgStats
+	var ssaPromFuncs, ssaWithBlocks, ssaMatched, ssaMissed int
 
-	for fn := range ssaResult.AllFuncs {
-		if fn.Pkg == nil || fn.Synthetic != "" {
-			continue
-		}
-		if !modSet.IsKnownPkg(fn.Pkg.Pkg.Path()) {
+	var fns []*ssa.Function
+	for _, fn := range ssaResult.Funcs {
+		if !cpg.InScope(fn.Pkg.Pkg.Path()) {
 			continue
 		}
 		ssaPromFuncs++
@@ -81,171 +77,222 @@ func ExtractCFGAndDFG(
 			continue
 		}
 		ssaWithBlocks++
+		fns = append(fns, fn)
+	}
 
-		// Find the function's node ID via position
-		funcNodeID := ssaFuncNodeID(fn, fset, funcLookup)
-		if funcNodeID == "" {
-			if ssaWithBlocks-ssaMatched <= 5 {
+	forEachOrdered(len(fns), workers, func(i int) *cfgResult {
+		return extractFuncCFG(fns[i], fset, ms, posLookup, funcLookup)
+	}, func(i int, r *cfgResult) {
+		if !r.matched {
+			if ssaMissed++; ssaMissed <= 5 {
+				fn := fns[i]
 				pos := fn.Pos()
 				if pos.IsValid() {
 					p := fset.Position(pos)
-					rel := modSet.RelFile(p.Filename)
+					rel := ms.RelFile(p.Filename)
 					prog.Verbose("  SSA miss: %s at %s:%d:%d", fn.String(), rel, p.Line, p.Column)
 				} else {
 					prog.Verbose("  SSA miss (no pos): %s", fn.String())
 				}
 			}
-			continue
+			return
 		}
 		ssaMatched++
+		cpg.Merge(&r.out)
+		total.cfgEdges += r.cfgEdges
+		total.dfgEdges += r.dfgEdges
+		total.bbNodes += r.bbNodes
+		total.captureEdges += r.captureEdges
+		total.fieldReads += r.fieldReads
+		total.fieldWrites += r.fieldWrites
+		total.globalReads += r.globalReads
+		total.globalWrites += r.globalWrites
+	})
+
+	prog.Log("SSA: %d module funcs, %d with blocks, %d matched to AST", ssaPromFuncs, ssaWithBlocks, ssaMatched)
+	prog.Log("Created %d basic_block nodes, %d CFG edges, %d DFG edges, %d capture edges, %d field_read and %d field_write edges, %d global_read and %d global_write edges",
+		total.bbNodes, total.cfgEdges, total.dfgEdges, total.captureEdges, total.fieldReads, total.fieldWrites, total.globalReads, total.globalWrites)
+}
 
-		// Closure capture edges: FuncLit → captured variables from enclosing scope.
-		// Go closures always capture by reference (the closure and the enclosing
-		// scope share the same variable). This is annotated as capture_kind so
-		// downstream analysis can correctly model mutation semantics.
-		if fn.Parent() != nil && len(fn.FreeVars) > 0 {
-			for _, fv := range fn.FreeVars {
-				fvPos := fv.Pos()
-				if !fvPos.IsValid() {
-					continue
-				}
-				p := fset.Position(fvPos)
-				relFile := modSet.RelFile(p.Filename)
-				if relFile == "" {
-					continue
-				}
-				varID := posLookup.Get(relFile, p.Line, p.Column)
-				if varID != "" {
-					cpg.AddEdge(Edge{
-						Source: funcNodeID, Target: varID, Kind: "capture",
-						Properties: map[string]any{
-							"var_name":     fv.Name(),
-							"capture_kind": "by_reference",
-						},
-					})
-					captureEdges++
-				}
-			}
-		}
+type cfgStats struct {
+	cfgEdges, dfgEdges, bbNodes, captureEdges int
+	fieldReads, fieldWrites                   int
+	globalReads, globalWrites                 int
+}
 
-		// Create basic block nodes and CFG edges
-		blockIDs := make([]string, len(fn.Blocks))
-		for i, block := range fn.Blocks {
-			bbID := BlockID(funcNodeID, i)
-			blockIDs[i] = bbID
-
-			// Determine position from first instruction with valid pos
-			line, col, file := blockPos(block, fset)
-
-			cpg.AddNode(Node{
-				ID:             bbID,
-				Kind:           "basic_block",
-				Name:           block.Comment,
-				File:           file,
-				Line:           line,
-				Col:            col,
-				Package:        modSet.RelPkg(fn.Pkg.Pkg.Path()),
-				ParentFunction: funcNodeID,
-				Properties: map[string]any{
-					"index": i,
-				},
-			})
-			bbNodes++
-		}
+type cfgResult struct {
+	out     graphBuffer
+	matched bool // function node found in the AST
+	cfgStats
+}
 
-		// CFG entry edge: function → first block
-		cpg.AddEdge(Edge{
-			Source: funcNodeID, Target: blockIDs[0],
-			Kind:       "cfg",
-			Properties: map[string]any{"label": "entry"},
-		})
-		cfgEdges++
+// extractFuncCFG builds basic blocks, CFG, DFG, capture, field access, and
+// global access edges for one function into a buffer.
+func extractFuncCFG(fn *ssa.Function, fset *token.FileSet, ms *ModuleSet, posLookup *PosLookup, funcLookup *FuncLookup) *cfgResult {
+	r := &cfgResult{}
+	out := &r.out
 
-		// CFG exit edges: terminal blocks (no successors) → function
-		for i, block := range fn.Blocks {
-			if len(block.Succs) == 0 {
-				cpg.AddEdge(Edge{
-					Source: blockIDs[i], Target: funcNodeID,
-					Kind:       "cfg",
-					Properties: map[string]any{"label": "exit"},
+	// Find the function's node ID via position
+	funcNodeID := ssaFuncNodeID(fn, fset, ms, funcLookup)
+	if funcNodeID == "" {
+		return r
+	}
+	r.matched = true
+
+	// Closure capture edges: FuncLit → captured variables from enclosing scope.
+	// Go closures always capture by reference (the closure and the enclosing
+	// scope share the same variable). This is annotated as capture_kind so
+	// downstream analysis can correctly model mutation semantics.
+	if fn.Parent() != nil && len(fn.FreeVars) > 0 {
+		for _, fv := range fn.FreeVars {
+			fvPos := fv.Pos()
+			if !fvPos.IsValid() {
+				continue
+			}
+			p := fset.Position(fvPos)
+			relFile := ms.RelFile(p.Filename)
+			if relFile == "" {
+				continue
+			}
+			varID := posLookup.Get(relFile, p.Line, p.Column)
+			if varID != "" {
+				out.AddEdge(Edge{
+					Source: funcNodeID, Target: varID, Kind: "capture",
+					Properties: map[string]any{
+						"var_name":     fv.Name(),
+						"capture_kind": "by_reference",
+					},
 				})
-				cfgEdges++
+				r.captureEdges++
 			}
 		}
+	}
 
-		// CFG edges between basic blocks
-		for i, block := range fn.Blocks {
-			for j, succ := range block.Succs {
-				props := map[string]any{}
-				// Label branch edges for If terminators
-				if len(block.Instrs) > 0 {
-					if _, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If); ok {
-						if j == 0 {
-							props["label"] = "true"
-						} else {
-							props["label"] = "false"
-						}
+	// Create basic block nodes and CFG edges
+	blockIDs := make([]string, len(fn.Blocks))
+	for i, block := range fn.Blocks {
+		bbID := BlockID(funcNodeID, i)
+		blockIDs[i] = bbID
+
+		// Determine position from first instruction with valid pos
+		line, col, file := blockPos(block, fset, ms)
+
+		out.AddNode(Node{
+			ID:             bbID,
+			Kind:           "basic_block",
+			Name:           block.Comment,
+			File:           file,
+			Line:           line,
+			Col:            col,
+			Package:        ms.RelPkg(fn.Pkg.Pkg.Path()),
+			ParentFunction: funcNodeID,
+			Properties: map[string]any{
+				"index": i,
+			},
+		})
+		r.bbNodes++
+	}
+
+	// CFG entry edge: function → first block
+	out.AddEdge(Edge{
+		Source: funcNodeID, Target: blockIDs[0],
+		Kind:       "cfg",
+		Properties: map[string]any{"label": "entry"},
+	})
+	r.cfgEdges++
+
+	// CFG exit edges: terminal blocks (no successors) → function
+	for i, block := range fn.Blocks {
+		if len(block.Succs) == 0 {
+			out.AddEdge(Edge{
+				Source: blockIDs[i], Target: funcNodeID,
+				Kind:       "cfg",
+				Properties: map[string]any{"label": "exit"},
+			})
+			r.cfgEdges++
+		}
+	}
+
+	// CFG edges between basic blocks
+	for i, block := range fn.Blocks {
+		for j, succ := range block.Succs {
+			props := map[string]any{}
+			// Label branch edges for If terminators
+			if len(block.Instrs) > 0 {
+				if _, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If); ok {
+					if j == 0 {
+						props["label"] = "true"
+					} else {
+						props["label"] = "false"
 					}
 				}
-				cpg.AddEdge(Edge{
-					Source:     blockIDs[i],
-					Target:     blockIDs[succ.Index],
-					Kind:       "cfg",
-					Properties: props,
-				})
-				cfgEdges++
 			}
+			out.AddEdge(Edge{
+				Source:     blockIDs[i],
+				Target:     blockIDs[succ.Index],
+				Kind:       "cfg",
+				Properties: props,
+			})
+			r.cfgEdges++
 		}
+	}
 
-		// DFG edges: definition → use (intra-procedural)
-		for _, block := range fn.Blocks {
-			for _, instr := range block.Instrs {
-				val, ok := instr.(ssa.Value)
-				if !ok {
-					continue
-				}
-				refs := val.Referrers()
-				if refs == nil {
-					continue
-				}
+	// DFG edges: definition → use (intra-procedural)
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			val, ok := instr.(ssa.Value)
+			if !ok {
+				continue
+			}
+			refs := val.Referrers()
+			if refs == nil {
+				continue
+			}
 
-				defFile, defLine, defCol := instrPos(instr, fset)
-				if defFile == "" {
+			defFile, defLine, defCol := instrPos(instr, fset, ms)
+			if defFile == "" {
+				continue
+			}
+			defNodeID := posLookup.Get(defFile, defLine, defCol)
+			if defNodeID == "" {
+				continue
+			}
+
+			for _, ref := range *refs {
+				useFile, useLine, useCol := instrPos(ref, fset, ms)
+				if useFile == "" {
 					continue
 				}
-				defNodeID := posLookup.Get(defFile, defLine, defCol)
-				if defNodeID == "" {
+				useNodeID := posLookup.Get(useFile, useLine, useCol)
+				if useNodeID == "" || useNodeID == defNodeID {
 					continue
 				}
 
-				for _, ref := range *refs {
-					useFile, useLine, useCol := instrPos(ref, fset)
-					if useFile == "" {
-						continue
-					}
-					useNodeID := posLookup.Get(useFile, useLine, useCol)
-					if useNodeID == "" || useNodeID == defNodeID {
-						continue
-					}
-
-					props := map[string]any{}
-					if name := ssaValueName(val); name != "" {
-						props["var_name"] = name
-					}
-					cpg.AddEdge(Edge{
-						Source:     defNodeID,
-						Target:     useNodeID,
-						Kind:       "dfg",
-						Properties: props,
-					})
-					dfgEdges++
+				props := map[string]any{}
+				if name := ssaValueName(val); name != "" {
+					props["var_name"] = name
 				}
+				out.AddEdge(Edge{
+					Source:     defNodeID,
+					Target:     useNodeID,
+					Kind:       "dfg",
+					Properties: props,
+				})
+				r.dfgEdges++
 			}
 		}
 	}
 
-	prog.Log("SSA: %d Prometheus funcs, %d with blocks, %d matched to AST", ssaPromFuncs, ssaWithBlocks, ssaMatched)
-	prog.Log("Created %d basic_block nodes, %d CFG edges, %d DFG edges, %d capture edges", bbNodes, cfgEdges, dfgEdges, captureEdges)
+	// Field accesses belong to the outermost declared function
+	ownerID := funcNodeID
+	for p := fn.Parent(); p != nil; p = p.Parent() {
+		if id := ssaFuncNodeID(p, fset, ms, funcLookup); id != "" {
+			ownerID = id
+		}
+	}
+	r.fieldReads, r.fieldWrites = extractFieldAccess(fn, ownerID, fset, ms, posLookup, out)
+	r.globalReads, r.globalWrites = extractGlobalAccess(fn, funcNodeID, isInitFunc(fn), fset, ms, posLookup, out)
+	return r
 }
 
 // ExtractChannelFlow finds channel send→receive pairs by tracking MakeChan
@@ -253,6 +300,7 @@ func ExtractCFGAndDFG(
 func ExtractChannelFlow(
 	ssaResult *SSAResult,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	posLookup *PosLookup,
 	cpg *CPG,
 	prog *Progress,
@@ -262,11 +310,8 @@ func ExtractChannelFlow(
 	var chanFlowEdges int
 
 	// For each MakeChan, follow referrers to find all sends and receives
-	for fn := range ssaResult.AllFuncs {
-		if fn.Pkg == nil || fn.Synthetic != "" {
-			continue
-		}
-		if !modSet.IsKnownPkg(fn.Pkg.Pkg.Path()) {
+	for _, fn := range ssaResult.Funcs {
+		if !cpg.InScope(fn.Pkg.Pkg.Path()) {
 			continue
 		}
 
@@ -280,7 +325,7 @@ func ExtractChannelFlow(
 				// Follow all referrers to find sends/receives on this channel
 				var sends, receives []string
 				visited := map[ssa.Value]bool{}
-				chanFollowRefs(mc, fset, posLookup, &sends, &receives, visited)
+				chanFollowRefs(mc, fset, ms, posLookup, &sends, &receives, visited)
 
 				for _, sendID := range sends {
 					for _, recvID := range receives {
@@ -302,7 +347,8 @@ func ExtractChannelFlow(
 // all send and receive operations, including through closures and phi nodes.
 func chanFollowRefs(
 	val ssa.Value,
-	fset *token.FileSet, posLookup *PosLookup,
+	fset *token.FileSet,
+	ms *ModuleSet, posLookup *PosLookup,
 	sends, receives *[]string,
 	visited map[ssa.Value]bool,
 ) {
@@ -320,7 +366,7 @@ func chanFollowRefs(
 		switch inst := ref.(type) {
 		case *ssa.Send:
 			if inst.Chan == val {
-				file, line, col := instrPos(inst, fset)
+				file, line, col := instrPos(inst, fset, ms)
 				if file != "" {
 					if id := posLookup.Get(file, line, col); id != "" {
 						*sends = append(*sends, id)
@@ -330,7 +376,7 @@ func chanFollowRefs(
 		case *ssa.UnOp:
 			if inst.Op == token.ARROW && inst.X == val {
 				// Channel receive: <-ch
-				file, line, col := instrPos(inst, fset)
+				file, line, col := instrPos(inst, fset, ms)
 				if file != "" {
 					if id := posLookup.Get(file, line, col); id != "" {
 						*receives = append(*receives, id)
@@ -339,7 +385,7 @@ func chanFollowRefs(
 			} else if inst.Op == token.MUL {
 				// Pointer dereference (load): channel was stored to an address,
 				// now being loaded back. Follow the loaded value's referrers.
-				chanFollowRefs(inst, fset, posLookup, sends, receives, visited)
+				chanFollowRefs(inst, fset, ms, posLookup, sends, receives, visited)
 			}
 		case *ssa.Select:
 			// select{} statement: each state is a send or receive on a channel.
@@ -352,7 +398,7 @@ func chanFollowRefs(
 					continue
 				}
 				pos := fset.Position(st.Pos)
-				rel := modSet.RelFile(pos.Filename)
+				rel := ms.RelFile(pos.Filename)
 				if rel == "" {
 					continue
 				}
@@ -368,20 +414,20 @@ func chanFollowRefs(
 			}
 		case *ssa.Call:
 			// Channel passed as argument — follow into statically-resolvable callee.
-			chanFollowCallArgs(&inst.Call, val, fset, posLookup, sends, receives, visited)
+			chanFollowCallArgs(&inst.Call, val, fset, ms, posLookup, sends, receives, visited)
 			// Also follow the return value: callee may return the channel.
-			chanFollowRefs(inst, fset, posLookup, sends, receives, visited)
+			chanFollowRefs(inst, fset, ms, posLookup, sends, receives, visited)
 		case *ssa.Go:
 			// Channel passed to a goroutine — follow into the launched function.
 			// *ssa.Go does NOT implement ssa.Value so the fallback won't catch it.
-			chanFollowCallArgs(&inst.Call, val, fset, posLookup, sends, receives, visited)
+			chanFollowCallArgs(&inst.Call, val, fset, ms, posLookup, sends, receives, visited)
 		case *ssa.Defer:
 			// Channel passed to a deferred call — follow into the deferred function.
 			// *ssa.Defer does NOT implement ssa.Value so the fallback won't catch it.
-			chanFollowCallArgs(&inst.Call, val, fset, posLookup, sends, receives, visited)
+			chanFollowCallArgs(&inst.Call, val, fset, ms, posLookup, sends, receives, visited)
 		case *ssa.Phi:
 			// Channel flows through a phi node — follow it
-			chanFollowRefs(inst, fset, posLookup, sends, receives, visited)
+			chanFollowRefs(inst, fset, ms, posLookup, sends, receives, visited)
 		case *ssa.MakeClosure:
 			// Channel captured by a closure — follow into FreeVars
 			closureFn, ok := inst.Fn.(*ssa.Function)
@@ -390,17 +436,17 @@ func chanFollowRefs(
 			}
 			for i, binding := range inst.Bindings {
 				if binding == val && i < len(closureFn.FreeVars) {
-					chanFollowRefs(closureFn.FreeVars[i], fset, posLookup, sends, receives, visited)
+					chanFollowRefs(closureFn.FreeVars[i], fset, ms, posLookup, sends, receives, visited)
 				}
 			}
 		case *ssa.Store:
 			// Channel stored to an address — follow loads from same address
 			if inst.Val == val {
-				chanFollowRefs(inst.Addr, fset, posLookup, sends, receives, visited)
+				chanFollowRefs(inst.Addr, fset, ms, posLookup, sends, receives, visited)
 			}
 		case ssa.Value:
 			// Other values that use this channel — follow referrers
-			chanFollowRefs(inst, fset, posLookup, sends, receives, visited)
+			chanFollowRefs(inst, fset, ms, posLookup, sends, receives, visited)
 		}
 	}
 }
@@ -413,7 +459,8 @@ func chanFollowRefs(
 func chanFollowCallArgs(
 	common *ssa.CallCommon,
 	val ssa.Value,
-	fset *token.FileSet, posLookup *PosLookup,
+	fset *token.FileSet,
+	ms *ModuleSet, posLookup *PosLookup,
 	sends, receives *[]string,
 	visited map[ssa.Value]bool,
 ) {
@@ -426,7 +473,7 @@ func chanFollowCallArgs(
 	}
 	for i, arg := range common.Args {
 		if arg == val && i < len(callee.Params) {
-			chanFollowRefs(callee.Params[i], fset, posLookup, sends, receives, visited)
+			chanFollowRefs(callee.Params[i], fset, ms, posLookup, sends, receives, visited)
 		}
 	}
 }
@@ -436,6 +483,7 @@ func chanFollowCallArgs(
 func ExtractPanicRecover(
 	ssaResult *SSAResult,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	posLookup *PosLookup,
 	funcLookup *FuncLookup,
 	cpg *CPG,
@@ -445,11 +493,8 @@ func ExtractPanicRecover(
 
 	var panicRecoverEdges int
 
-	for fn := range ssaResult.AllFuncs {
-		if fn.Pkg == nil || fn.Synthetic != "" {
-			continue
-		}
-		if !modSet.IsKnownPkg(fn.Pkg.Pkg.Path()) {
+	for _, fn := range ssaResult.Funcs {
+		if !cpg.InScope(fn.Pkg.Pkg.Path()) {
 			continue
 		}
 
@@ -462,7 +507,7 @@ func ExtractPanicRecover(
 			for _, instr := range block.Instrs {
 				switch inst := instr.(type) {
 				case *ssa.Panic:
-					file, line, col := instrPos(inst, fset)
+					file, line, col := instrPos(inst, fset, ms)
 					if file != "" {
 						if id := posLookup.Get(file, line, col); id != "" {
 							panicIDs = append(panicIDs, id)
@@ -471,7 +516,7 @@ func ExtractPanicRecover(
 				case *ssa.Call:
 					// Check for recover() builtin (direct call, not deferred)
 					if b, ok := inst.Call.Value.(*ssa.Builtin); ok && b.Name() == "recover" {
-						file, line, col := instrPos(inst, fset)
+						file, line, col := instrPos(inst, fset, ms)
 						if file != "" {
 							if id := posLookup.Get(file, line, col); id != "" {
 								recoverIDs = append(recoverIDs, id)
@@ -486,10 +531,10 @@ func ExtractPanicRecover(
 					//   3. defer recover()                — direct builtin call
 					deferredFn := deferTarget(inst)
 					if deferredFn != nil {
-						collectRecoverIDs(deferredFn, fset, posLookup, &recoverIDs)
+						collectRecoverIDs(deferredFn, fset, ms, posLookup, &recoverIDs)
 					} else if b, ok := inst.Call.Value.(*ssa.Builtin); ok && b.Name() == "recover" {
 						// Pattern 3: defer recover() — the defer itself is the recover site
-						file, line, col := instrPos(inst, fset)
+						file, line, col := instrPos(inst, fset, ms)
 						if file != "" {
 							if id := posLookup.Get(file, line, col); id != "" {
 								recoverIDs = append(recoverIDs, id)
@@ -532,7 +577,7 @@ func deferTarget(inst *ssa.Defer) *ssa.Function {
 
 // collectRecoverIDs scans all blocks of an SSA function for recover() builtin calls
 // and appends their position-based node IDs to the provided slice.
-func collectRecoverIDs(fn *ssa.Function, fset *token.FileSet, posLookup *PosLookup, ids *[]string) {
+func collectRecoverIDs(fn *ssa.Function, fset *token.FileSet, ms *ModuleSet, posLookup *PosLookup, ids *[]string) {
 	for _, block := range fn.Blocks {
 		for _, instr := range block.Instrs {
 			call, ok := instr.(*ssa.Call)
@@ -543,7 +588,7 @@ func collectRecoverIDs(fn *ssa.Function, fset *token.FileSet, posLookup *PosLook
 			if !ok || b.Name() != "recover" {
 				continue
 			}
-			file, line, col := instrPos(call, fset)
+			file, line, col := instrPos(call, fset, ms)
 			if file == "" {
 				continue
 			}
@@ -555,13 +600,13 @@ func collectRecoverIDs(fn *ssa.Function, fset *token.FileSet, posLookup *PosLook
 }
 
 // ssaFuncNodeID finds the CPG node ID for an SSA function using the func lookup.
-func ssaFuncNodeID(fn *ssa.Function, fset *token.FileSet, funcLookup *FuncLookup) string {
+func ssaFuncNodeID(fn *ssa.Function, fset *token.FileSet, ms *ModuleSet, funcLookup *FuncLookup) string {
 	pos := fn.Pos()
 	if !pos.IsValid() {
 		return ""
 	}
 	p := fset.Position(pos)
-	relFile := modSet.RelFile(p.Filename)
+	relFile := ms.RelFile(p.Filename)
 	if relFile == "" {
 		return ""
 	}
@@ -569,14 +614,14 @@ func ssaFuncNodeID(fn *ssa.Function, fset *token.FileSet, funcLookup *FuncLookup
 }
 
 // blockPos returns the position of the first instruction with a valid Pos in a block.
-func blockPos(block *ssa.BasicBlock, fset *token.FileSet) (line, col int, relFile string) {
+func blockPos(block *ssa.BasicBlock, fset *token.FileSet, ms *ModuleSet) (line, col int, relFile string) {
 	for _, instr := range block.Instrs {
 		p := instr.Pos()
 		if !p.IsValid() {
 			continue
 		}
 		pos := fset.Position(p)
-		rel := modSet.RelFile(pos.Filename)
+		rel := ms.RelFile(pos.Filename)
 		if rel == "" {
 			continue
 		}
@@ -618,13 +663,13 @@ func ssaValueName(v ssa.Value) string {
 
 // instrPos returns the relative file, line, col for an SSA instruction.
 // Returns "" for files outside all known modules.
-func instrPos(instr ssa.Instruction, fset *token.FileSet) (file string, line, col int) {
+func instrPos(instr ssa.Instruction, fset *token.FileSet, ms *ModuleSet) (file string, line, col int) {
 	p := instr.Pos()
 	if !p.IsValid() {
 		return "", 0, 0
 	}
 	pos := fset.Position(p)
-	rel := modSet.RelFile(pos.Filename)
+	rel := ms.RelFile(pos.Filename)
 	if rel == "" {
 		return "", 0, 0
 	}
@@ -0,0 +1,371 @@
+package cpg
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// structTag is one key:"value" pair of a struct field tag, with the value
+// split the way encoding/json and the YAML packages read it: a name, then
+// comma-separated options.
+type structTag struct {
+	Key     string
+	Name    string
+	Options []string
+}
+
+// parseStructTag splits a raw field tag (without backticks) into its
+// key:"value" pairs, in order. It follows the conventional format accepted
+// by reflect.StructTag.Lookup and stops at the first malformed pair.
+func parseStructTag(tag string) []structTag {
+	var tags []structTag
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			return tags
+		}
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return tags
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return tags
+		}
+		value, err := strconv.Unquote(tag[:i+1])
+		if err != nil {
+			return tags
+		}
+		tag = tag[i+1:]
+
+		name, opts, _ := strings.Cut(value, ",")
+		t := structTag{Key: key, Name: name}
+		if opts != "" {
+			t.Options = strings.Split(opts, ",")
+		}
+		tags = append(tags, t)
+	}
+}
+
+// lookupStructTag returns the tag with the given key.
+func lookupStructTag(tags []structTag, key string) (structTag, bool) {
+	for _, t := range tags {
+		if t.Key == key {
+			return t, true
+		}
+	}
+	return structTag{}, false
+}
+
+// structTagProps renders parsed tags as the "tags" property of a field node:
+// key and name, omitempty and inline as flags, and any other options.
+func structTagProps(tags []structTag) []map[string]any {
+	out := make([]map[string]any, len(tags))
+	for i, t := range tags {
+		m := map[string]any{"key": t.Key, "name": t.Name}
+		var other []string
+		for _, o := range t.Options {
+			switch o {
+			case "omitempty", "inline":
+				m[o] = true
+			default:
+				other = append(other, o)
+			}
+		}
+		if len(other) > 0 {
+			m["options"] = other
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// schemaFormats are the tag keys serialized_schema follows.
+var schemaFormats = []string{"yaml", "json"}
+
+// schemaField is a struct field as read back for the serialized schema.
+type schemaField struct {
+	id, name, typeInfo string
+	exported, embedded bool
+	tags               []structTag
+	target, wrap       string // field_type edge
+}
+
+// schemaRow is one key path of serialized_schema.
+type schemaRow struct {
+	path, goType, fieldID, structID string
+	depth                           int
+	omitempty                       bool
+}
+
+// createSerializedSchema builds v_struct_tags and serialized_schema. Each
+// root type is walked through its fields' field_type edges once per format
+// (yaml, json) that its fields are tagged with, listing every key path the
+// format reads. Fields tagged "-" and unexported fields are left out; an
+// ",inline" field, or for JSON an untagged embedded struct, contributes its
+// own fields at the same level. Lists add "[]" to the path and maps ".*".
+// Roots are the given full names (e.g. "config.Config"); when there are none,
+// every tagged struct named *Config that no other tagged struct holds is a
+// root.
+func createSerializedSchema(conn *sqlite.Conn, roots []string, prog *Progress) error {
+	ddl := `
+CREATE VIEW v_struct_tags AS
+SELECT f.id AS field_id, f.name AS field, s.id AS struct_id,
+  json_extract(s.properties, '$.full_name') AS struct_name, f.type_info AS go_type,
+  json_extract(t.value, '$.key') AS key, json_extract(t.value, '$.name') AS name,
+  COALESCE(json_extract(t.value, '$.omitempty'), 0) AS omitempty,
+  COALESCE(json_extract(t.value, '$.inline'), 0) AS inline,
+  json_extract(t.value, '$.options') AS options
+FROM nodes f
+JOIN edges a ON a.target = f.id AND a.kind = 'ast'
+JOIN nodes s ON s.id = a.source AND s.kind = 'type_decl'
+JOIN json_each(f.properties, '$.tags') t
+WHERE f.kind = 'field';
+
+CREATE TABLE serialized_schema (
+    root TEXT NOT NULL,       -- full_name of the root type
+    format TEXT NOT NULL,     -- tag key: yaml or json
+    path TEXT NOT NULL,       -- key path, e.g. scrape_configs[].relabel_configs[].action
+    go_type TEXT,
+    field_id TEXT NOT NULL,
+    struct_id TEXT NOT NULL,  -- type_decl declaring the field
+    depth INTEGER NOT NULL,   -- 1 for the root's own keys
+    omitempty INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (root, format, path)
+);
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('view', 'v_struct_tags', 'One row per struct field tag key: parsed name, omitempty, inline, other options', 'SELECT * FROM v_struct_tags WHERE key = ''yaml'' AND inline = 1'),
+('table', 'serialized_schema', 'Every config key path reachable from the root config types (-schema-roots), per tag format, with its Go type and declaring field', 'SELECT path, go_type FROM serialized_schema WHERE root = ''config.Config'' AND format = ''yaml'' ORDER BY path');
+
+INSERT INTO queries (name, description, sql) VALUES
+('config_keys', 'YAML key paths of the root config types with the declaring field',
+ 'SELECT s.root, s.path, s.go_type, f.file, f.line FROM serialized_schema s JOIN nodes f ON f.id = s.field_id WHERE s.format = ''yaml'' ORDER BY s.root, s.path'),
+('config_key_users', 'Code reading the field behind a config key',
+ 'SELECT n.file, n.line, n.parent_function FROM serialized_schema s JOIN edges e ON e.target = s.field_id AND e.kind = ''ref'' JOIN nodes n ON n.id = e.source WHERE s.path = :path ORDER BY n.file, n.line');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("serialized schema: %w", err)
+	}
+
+	structs := make(map[string][]schemaField) // type_decl → fields in order
+	fullNames := make(map[string]string)      // type_decl → full_name
+	if err := sqlitex.ExecuteTransient(conn,
+		`SELECT s.id, json_extract(s.properties, '$.full_name'), f.id, f.name, COALESCE(f.type_info, ''),
+		        COALESCE(json_extract(f.properties, '$.exported'), 0), COALESCE(json_extract(f.properties, '$.embedded'), 0),
+		        COALESCE(json_extract(f.properties, '$.tag'), ''), COALESCE(ft.target, ''), COALESCE(json_extract(ft.properties, '$.wrap'), '')
+		 FROM nodes s
+		 JOIN edges a ON a.source = s.id AND a.kind = 'ast'
+		 JOIN nodes f ON f.id = a.target AND f.kind = 'field'
+		 LEFT JOIN edges ft ON ft.source = f.id AND ft.kind = 'field_type'
+		 WHERE s.kind = 'type_decl' AND json_extract(s.properties, '$.type_kind') = 'struct'
+		 ORDER BY s.id, f.line, f.col`,
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			id := stmt.ColumnText(0)
+			fullNames[id] = stmt.ColumnText(1)
+			structs[id] = append(structs[id], schemaField{
+				id:       stmt.ColumnText(2),
+				name:     stmt.ColumnText(3),
+				typeInfo: stmt.ColumnText(4),
+				exported: stmt.ColumnInt(5) != 0,
+				embedded: stmt.ColumnInt(6) != 0,
+				tags:     parseStructTag(stmt.ColumnText(7)),
+				target:   stmt.ColumnText(8),
+				wrap:     stmt.ColumnText(9),
+			})
+			return nil
+		}}); err != nil {
+		return fmt.Errorf("read struct fields: %w", err)
+	}
+
+	var rootIDs []string
+	if len(roots) > 0 {
+		byName := make(map[string]string, len(fullNames))
+		for id, name := range fullNames {
+			byName[name] = id
+		}
+		for _, r := range roots {
+			id, ok := byName[r]
+			if !ok {
+				prog.Log("  warning: schema root %s is not a struct type in the graph", r)
+				continue
+			}
+			rootIDs = append(rootIDs, id)
+		}
+	} else {
+		held := make(map[string]bool)
+		for _, fields := range structs {
+			if !hasSchemaTags(fields) {
+				continue
+			}
+			for _, f := range fields {
+				held[f.target] = true
+			}
+		}
+		for id, name := range fullNames {
+			typ := name[strings.LastIndex(name, ".")+1:]
+			if !held[id] && strings.HasSuffix(typ, "Config") && hasSchemaTags(structs[id]) {
+				rootIDs = append(rootIDs, id)
+			}
+		}
+	}
+	slices.Sort(rootIDs)
+
+	stmt, err := conn.Prepare(`INSERT OR IGNORE INTO serialized_schema (root, format, path, go_type, field_id, struct_id, depth, omitempty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare serialized schema insert: %w", err)
+	}
+	defer func() { _ = stmt.Finalize() }()
+
+	var total, rootCount int
+	for _, rootID := range rootIDs {
+		rootName := fullNames[rootID]
+		walked := false
+		for _, format := range schemaFormats {
+			rows, tagged := walkSchema(structs, rootID, format)
+			if !tagged {
+				continue
+			}
+			walked = true
+			for _, r := range rows {
+				stmt.BindText(1, rootName)
+				stmt.BindText(2, format)
+				stmt.BindText(3, r.path)
+				bindTextOrNull(stmt, 4, r.goType)
+				stmt.BindText(5, r.fieldID)
+				stmt.BindText(6, r.structID)
+				stmt.BindInt64(7, int64(r.depth))
+				stmt.BindBool(8, r.omitempty)
+				if _, err := stmt.Step(); err != nil {
+					return fmt.Errorf("insert schema path %s: %w", r.path, err)
+				}
+				_ = stmt.Reset()
+				total++
+			}
+		}
+		if walked {
+			rootCount++
+		}
+	}
+	prog.Log("Serialized schema: %d key paths from %d root types", total, rootCount)
+	return nil
+}
+
+// hasSchemaTags reports whether any field carries a tag for a schema format.
+func hasSchemaTags(fields []schemaField) bool {
+	for _, f := range fields {
+		for _, format := range schemaFormats {
+			if _, ok := lookupStructTag(f.tags, format); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// walkSchema lists the key paths format reads from the struct rootID, and
+// whether any field on the way is tagged for format at all. A type already
+// being expanded further up the path is not expanded again.
+func walkSchema(structs map[string][]schemaField, rootID, format string) ([]schemaRow, bool) {
+	var rows []schemaRow
+	tagged := false
+	expanding := make(map[string]bool)
+	var walk func(structID, prefix string, depth int)
+	walk = func(structID, prefix string, depth int) {
+		expanding[structID] = true
+		defer delete(expanding, structID)
+		for _, f := range structs[structID] {
+			tag, ok := lookupStructTag(f.tags, format)
+			tagged = tagged || ok
+			if tag.Name == "-" && len(tag.Options) == 0 {
+				continue
+			}
+			inline := slices.Contains(tag.Options, "inline") || format == "json" && f.embedded && tag.Name == ""
+			_, isStruct := structs[f.target]
+			if inline {
+				if isStruct && !expanding[f.target] {
+					walk(f.target, prefix, depth)
+				}
+				continue
+			}
+			if !f.exported {
+				continue
+			}
+			key := tag.Name
+			if key == "" {
+				key = strings.TrimPrefix(f.name, "*")
+				key = key[strings.LastIndex(key, ".")+1:]
+				if format == "yaml" {
+					key = strings.ToLower(key)
+				}
+			}
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			rows = append(rows, schemaRow{
+				path:      path,
+				goType:    f.typeInfo,
+				fieldID:   f.id,
+				structID:  structID,
+				depth:     depth,
+				omitempty: slices.Contains(tag.Options, "omitempty"),
+			})
+			if isStruct && !expanding[f.target] {
+				walk(f.target, path+schemaPathSuffix(f.wrap), depth+1)
+			}
+		}
+	}
+	walk(rootID, "", 1)
+	return rows, tagged
+}
+
+// schemaPathSuffix turns a field_type wrap such as "[]*" or
+// "map[string][]" into the path notation for the elements below it: "[]"
+// per list or array and ".*" per map.
+func schemaPathSuffix(wrap string) string {
+	var b strings.Builder
+	for wrap != "" {
+		switch {
+		case strings.HasPrefix(wrap, "*"):
+			wrap = wrap[1:]
+			continue
+		case strings.HasPrefix(wrap, "map["):
+			b.WriteString(".*")
+			wrap = wrap[len("map"):]
+		default:
+			b.WriteString("[]")
+		}
+		// Skip the bracketed length or key type, which may nest brackets.
+		depth := 0
+		for i, c := range wrap {
+			if c == '[' {
+				depth++
+			} else if c == ']' {
+				depth--
+			}
+			if depth == 0 {
+				wrap = wrap[i+1:]
+				break
+			}
+		}
+	}
+	return b.String()
+}
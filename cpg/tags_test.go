@@ -0,0 +1,37 @@
+package cpg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseStructTag checks tag splitting and the path notation of
+// field_type wraps.
+func TestParseStructTag(t *testing.T) {
+	got := parseStructTag(`yaml:"name,omitempty" json:"-"  toml:"a\"b,inline,flow" bad`)
+	want := []structTag{
+		{Key: "yaml", Name: "name", Options: []string{"omitempty"}},
+		{Key: "json", Name: "-"},
+		{Key: "toml", Name: `a"b`, Options: []string{"inline", "flow"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStructTag = %+v, want %+v", got, want)
+	}
+	if got := parseStructTag(`yaml:unquoted`); got != nil {
+		t.Errorf("parseStructTag(malformed) = %+v, want nil", got)
+	}
+
+	for wrap, want := range map[string]string{
+		"":                 "",
+		"*":                "",
+		"[]*":              "[]",
+		"[4]":              "[]",
+		"map[string]":      ".*",
+		"map[[2]int][]":    ".*[]",
+		"[]map[string]*[]": "[].*[]",
+	} {
+		if got := schemaPathSuffix(wrap); got != want {
+			t.Errorf("schemaPathSuffix(%q) = %q, want %q", wrap, got, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package a exercises the constructs most phases look at: enums, generics,
+// struct tags, globals, goroutines, channels, and panic/recover.
+package a
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Mode is an enum.
+type Mode int
+
+const (
+	ModeA Mode = iota
+	ModeB
+	ModeC
+)
+
+const Timeout = 5 * time.Minute
+
+var registry = map[string]int{}
+var mu sync.Mutex
+
+// Config is a config.
+type Config struct {
+	Name    string        `yaml:"name" json:"name,omitempty"`
+	Inner   Inner         `yaml:",inline"`
+	Timeout time.Duration `yaml:"timeout"`
+	count   int
+}
+
+type Inner struct {
+	Level int `yaml:"level"`
+}
+
+// Shape is implemented by Square.
+type Shape interface {
+	Area() int
+}
+
+type Square struct{ Side int }
+
+func (s Square) Area() int { return s.Side * s.Side }
+
+// Deprecated: use Use instead.
+func Old() int { return 1 }
+
+func (c *Config) Bump() {
+	c.count++
+	fmt.Println(c.Name)
+}
+
+func Register(name string) {
+	mu.Lock()
+	registry[name] = 1
+	mu.Unlock()
+	go func() {
+		registry[name+"x"] = 2
+	}()
+}
+
+func init() {
+	registry["init"] = 0
+}
+
+func Max[T int | float64](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func Use(m Mode) string {
+	switch m {
+	case ModeA:
+		return "a"
+	case ModeB:
+		return "b"
+	}
+	_ = Max(1, 2)
+	_ = Old()
+	return fmt.Sprint(Timeout)
+}
+
+// Total sums the areas of shapes sent on ch until it is closed.
+func Total(shapes []Shape) int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for _, s := range shapes {
+			ch <- s.Area()
+		}
+	}()
+	sum := 0
+	for v := range ch {
+		sum += v
+	}
+	return sum
+}
+
+var ErrEmpty = errors.New("empty")
+
+// Safe converts a panic in fn into an error.
+func Safe(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered: %v", r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+func MustPositive(n int) int {
+	if n <= 0 {
+		panic(ErrEmpty)
+	}
+	return n
+}
+
+// Sum adds up xs.
+func Sum[T Number](xs []T) T {
+	var s T
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+// Number is the constraint of Sum, declared after its use.
+type Number interface {
+	~int | ~float64
+}
+
+// Stack is a generic type.
+type Stack[T any] struct{ items []T }
+
+func (s *Stack[T]) Push(v T) { s.items = append(s.items, v) }
+
+// ScrapeConfig is a root config type: it inlines Config and holds targets.
+type ScrapeConfig struct {
+	Config  `yaml:",inline"`
+	Targets []*Target         `yaml:"targets,omitempty" json:"targets"`
+	Groups  map[string]Target `yaml:"groups"`
+	Secret  string            `yaml:"-" json:"-"`
+}
+
+// Target is listed by ScrapeConfig.
+type Target struct {
+	URL    string `yaml:"url" json:"url"`
+	Labels map[string]string
+}
+
+// Perm is a bit set enum.
+type Perm uint8
+
+const (
+	PermRead Perm = 1 << iota
+	PermWrite
+	permAll = PermRead | PermWrite
+)
+
+// Separator switches over Perm with a default and uses a local constant.
+func Separator(p Perm) rune {
+	const sep = ','
+	switch p {
+	case PermRead, PermWrite:
+		return sep
+	default:
+		return ' '
+	}
+}
@@ -0,0 +1,25 @@
+package a
+
+import (
+	_ "embed"
+	_ "unsafe" // for go:linkname
+)
+
+//go:generate stringer -type=Mode
+
+// banner is embedded from static.
+//
+//go:embed static/banner.txt
+var banner string
+
+// nanotime is the runtime's monotonic clock.
+//
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+// Banner returns the embedded banner.
+//
+//go:noinline
+func Banner() string {
+	return banner //nolint:gosec // constant data
+}
@@ -0,0 +1 @@
+// Empty: lets nanotime in directives.go be declared without a body.
@@ -0,0 +1,25 @@
+package b
+
+import (
+	"slices"
+
+	"example.com/basic/a"
+)
+
+//go:noinline
+func Call() string {
+	c := &a.Config{}
+	c.Bump()
+	return a.Use(a.ModeA)
+}
+
+func Area() int {
+	return a.Total([]a.Shape{a.Square{Side: 2}, a.Square{Side: 3}})
+}
+
+func Totals() int {
+	st := &a.Stack[int]{}
+	st.Push(1)
+	n := slices.Index([]string{"x"}, "x")
+	return n + a.Sum([]int{1, 2}) + int(a.Sum([]float64{0.5}))
+}
@@ -0,0 +1,15 @@
+package b
+
+import "testing"
+
+func TestCall(t *testing.T) {
+	if Call() == "" {
+		t.Fatal("empty")
+	}
+}
+
+func TestArea(t *testing.T) {
+	if got := Area(); got != 13 {
+		t.Fatalf("Area() = %d, want 13", got)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/lib"
+)
+
+func main() {
+	s := lib.NewStore()
+	s.Put("k", "v")
+	fmt.Println(s.Get("k"))
+
+	old := lib.New()
+	fmt.Println(strings.Title(old.Get("k")), old.Hits)
+}
@@ -0,0 +1,38 @@
+// Package lib is the additional module of the multi fixture.
+package lib
+
+import "sync"
+
+// Store is a concurrency-safe string map.
+type Store struct {
+	mu sync.RWMutex
+	m  map[string]string
+
+	// Hits counts lookups.
+	//
+	// Deprecated: Hits is no longer updated.
+	Hits int
+}
+
+func NewStore() *Store {
+	return &Store{m: make(map[string]string)}
+}
+
+// New returns an empty Store.
+//
+// Deprecated: Use NewStore, which says what it makes.
+func New() *Store {
+	return NewStore()
+}
+
+func (s *Store) Put(k, v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[k] = v
+}
+
+func (s *Store) Get(k string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m[k]
+}
@@ -0,0 +1,196 @@
+package cpg
+
+import (
+	"fmt"
+	"go/types"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// testNodeKinds are the node kinds WalkAST gives to functions recognized by
+// `go test`. They replace "function" so test code stays out of production
+// complexity, hotspot, and API views.
+var testNodeKinds = []string{"test", "benchmark", "fuzz", "example"}
+
+// testFuncKind classifies a top-level function declared in a _test.go file
+// the way `go test` does: TestXxx(*testing.T), BenchmarkXxx(*testing.B),
+// FuzzXxx(*testing.F), and ExampleXxx() with no parameters or results.
+// Anything else (helpers, TestMain) stays "function".
+func testFuncKind(name string, sig *types.Signature) string {
+	param := ""
+	if sig.Params().Len() == 1 {
+		param = sig.Params().At(0).Type().String()
+	}
+	switch {
+	case isTestName(name, "Test") && param == "*testing.T" && sig.Results().Len() == 0:
+		return "test"
+	case isTestName(name, "Benchmark") && param == "*testing.B" && sig.Results().Len() == 0:
+		return "benchmark"
+	case isTestName(name, "Fuzz") && param == "*testing.F" && sig.Results().Len() == 0:
+		return "fuzz"
+	case isTestName(name, "Example") && sig.Params().Len() == 0 && sig.Results().Len() == 0:
+		return "example"
+	}
+	return "function"
+}
+
+// isTestName reports whether name is prefix followed by nothing or by a
+// character that is not a lower-case letter (the rule cmd/go applies).
+func isTestName(name, prefix string) bool {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return false
+	}
+	if rest == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return !unicode.IsLower(r)
+}
+
+// LinkTests adds a `tests` edge from every test, benchmark, fuzz target, and
+// example to each production function it transitively calls. Closures
+// declared inside a test (t.Run subtests, f.Fuzz targets) count as part of
+// it. Production functions are "function" nodes outside _test.go files;
+// external stubs are not linked. The depth property is the shortest call
+// distance.
+func LinkTests(cpg *CPG, prog *Progress) {
+	prog.Log("Linking tests to production code...")
+
+	production := make(map[string]bool) // linkable targets
+	var tests []string
+	testNodes := make(map[string]Node)
+	closures := make(map[string][]Node) // file → func literals
+	for n := range cpg.AllNodes() {
+		switch {
+		case slices.Contains(testNodeKinds, n.Kind):
+			tests = append(tests, n.ID)
+			testNodes[n.ID] = n
+		case n.Kind != "function":
+		case strings.HasSuffix(n.File, "_test.go"):
+			if n.Name == "func literal" {
+				closures[n.File] = append(closures[n.File], n)
+			}
+		case !strings.HasPrefix(n.ID, "ext::"):
+			production[n.ID] = true
+		}
+	}
+	sort.Strings(tests)
+
+	callees := make(map[string][]string)
+	for e := range cpg.AllEdges() {
+		if e.Kind == "call" {
+			callees[e.Source] = append(callees[e.Source], e.Target)
+		}
+	}
+
+	var edgeCount, covered int
+	reached := make(map[string]bool)
+	for _, test := range tests {
+		depth := map[string]int{test: 0}
+		queue := []string{test}
+		tn := testNodes[test]
+		for _, lit := range closures[tn.File] {
+			if lit.Line >= tn.Line && lit.EndLine <= tn.EndLine {
+				depth[lit.ID] = 0
+				queue = append(queue, lit.ID)
+			}
+		}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, next := range callees[cur] {
+				if _, seen := depth[next]; seen {
+					continue
+				}
+				depth[next] = depth[cur] + 1
+				queue = append(queue, next)
+			}
+		}
+
+		targets := make([]string, 0, len(depth))
+		for id := range depth {
+			if production[id] {
+				targets = append(targets, id)
+			}
+		}
+		sort.Strings(targets)
+		for _, id := range targets {
+			cpg.AddEdge(Edge{
+				Source:     test,
+				Target:     id,
+				Kind:       "tests",
+				Properties: map[string]any{"depth": depth[id]},
+			})
+			edgeCount++
+			if !reached[id] {
+				reached[id] = true
+				covered++
+			}
+		}
+	}
+
+	prog.Log("Created %d tests edges from %d tests; %d production functions reached", edgeCount, len(tests), covered)
+}
+
+// createTestCoverage builds per-function test reachability and flags
+// complex production functions that no test reaches. It only flags when the
+// database contains tests at all, so runs with -skip-tests stay quiet.
+func createTestCoverage(conn *sqlite.Conn, prog *Progress) error {
+	ddl := `
+CREATE VIEW v_test_coverage AS
+SELECT n.id AS function_id, n.name, n.package, n.file, n.line,
+  COALESCE(m.cyclomatic_complexity, 0) AS complexity,
+  COUNT(t.source) AS test_count,
+  MIN(json_extract(t.properties, '$.depth')) AS min_depth,
+  SUM(CASE WHEN json_extract(t.properties, '$.depth') = 1 THEN 1 ELSE 0 END) AS direct_tests
+FROM nodes n
+LEFT JOIN metrics m ON m.function_id = n.id
+LEFT JOIN edges t ON t.target = n.id AND t.kind = 'tests'
+WHERE n.kind = 'function' AND n.file NOT LIKE '%\_test.go' ESCAPE '\'
+  AND n.id NOT LIKE 'ext::%'
+GROUP BY n.id;
+
+INSERT INTO findings (category, severity, node_id, file, line, message, details)
+SELECT 'untested_complex', 'warning', c.function_id, c.file, c.line,
+  c.name || ' (complexity ' || c.complexity || ') is not reached by any test',
+  json_object('complexity', c.complexity, 'package', c.package)
+FROM v_test_coverage c
+WHERE c.test_count = 0
+  AND c.complexity >= (SELECT value FROM thresholds WHERE name = 'complexity')
+  AND EXISTS (SELECT 1 FROM nodes WHERE kind IN ('test', 'benchmark', 'fuzz', 'example'));
+
+INSERT INTO schema_docs (category, name, description, example) VALUES
+('view', 'v_test_coverage', 'Per production function: how many tests reach it (tests edges) and the shortest call depth', 'SELECT * FROM v_test_coverage WHERE test_count = 0 ORDER BY complexity DESC'),
+('edge_kind', 'tests', 'Test/benchmark/fuzz/example → production function it transitively calls', 'Properties: {"depth": shortest call distance}'),
+('node_kind', 'test', 'TestXxx(*testing.T) function', 'SELECT * FROM nodes WHERE kind = ''test'''),
+('node_kind', 'benchmark', 'BenchmarkXxx(*testing.B) function', 'SELECT * FROM nodes WHERE kind = ''benchmark'''),
+('node_kind', 'fuzz', 'FuzzXxx(*testing.F) function', 'SELECT * FROM nodes WHERE kind = ''fuzz'''),
+('node_kind', 'example', 'ExampleXxx() function', 'SELECT * FROM nodes WHERE kind = ''example'''),
+('finding', 'untested_complex', 'Functions at or above the complexity threshold that no test reaches (only when tests are loaded)', NULL);
+
+INSERT INTO queries (name, description, sql) VALUES
+('tests_for_function', 'Tests that reach a function, nearest first',
+ 'SELECT t.name, t.kind, t.file, t.line, json_extract(e.properties, ''$.depth'') AS depth FROM edges e JOIN nodes t ON t.id = e.source WHERE e.kind = ''tests'' AND e.target = :function_id ORDER BY depth, t.name'),
+('untested_complex_functions', 'Complex production functions no test reaches',
+ 'SELECT name, package, file, line, complexity FROM v_test_coverage WHERE test_count = 0 ORDER BY complexity DESC LIMIT 50');
+`
+	if err := sqlitex.ExecuteScript(conn, ddl, nil); err != nil {
+		return fmt.Errorf("test coverage: %w", err)
+	}
+
+	var untested int
+	sqlitex.ExecuteTransient(conn, "SELECT COUNT(*) FROM findings WHERE category = 'untested_complex'",
+		&sqlitex.ExecOptions{ResultFunc: func(stmt *sqlite.Stmt) error {
+			untested = stmt.ColumnInt(0)
+			return nil
+		}})
+	prog.Log("Test coverage: %d complex functions not reached by any test", untested)
+	return nil
+}
@@ -0,0 +1,88 @@
+package cpg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Default per-invocation timeouts for the external tools enrichment phases
+// run (see TimeoutConfig).
+const (
+	DefaultEscapeTimeout = 10 * time.Minute // go build -gcflags=-m, per module
+	DefaultGitTimeout    = 2 * time.Minute  // each git command
+)
+
+// toolWaitDelay is how long a killed tool's children may keep its output
+// pipes open before they are closed on them. go build leaves its compiler
+// processes running when it is killed.
+const toolWaitDelay = 5 * time.Second
+
+// PhaseIssue records why an enrichment phase ran with incomplete input: an
+// external tool failed, timed out, or could not be started. The run goes on
+// without the affected data; the issues end up in the phase_issues table
+// and degrade the phase's status in the phases table.
+type PhaseIssue struct {
+	Phase  string
+	Module string // module path, or "" when the whole phase is affected
+	Reason string
+}
+
+// runTool runs name with args in dir, bounded by timeout (0 for none) on
+// top of ctx, and returns its standard output. The error says whether the
+// tool timed out or failed, with the first line of its stderr.
+func runTool(ctx context.Context, timeout time.Duration, dir, name string, args ...string) ([]byte, error) {
+	tctx, cancel := toolContext(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(tctx, name, args...)
+	cmd.Dir = dir
+	cmd.WaitDelay = toolWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, toolError(ctx, tctx, timeout, name+" "+args[0], err)
+	}
+	return out, nil
+}
+
+// toolContext derives the context one tool invocation runs under.
+func toolContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// toolError describes why a tool invocation under tctx (derived from ctx by
+// toolContext) failed with err. Cancellation of ctx itself is returned as
+// is, so callers can tell an interrupted run from a degraded phase.
+func toolError(ctx, tctx context.Context, timeout time.Duration, tool string, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.Is(tctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%s timed out after %s", tool, timeout)
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		if line, _, _ := strings.Cut(strings.TrimSpace(string(exit.Stderr)), "\n"); line != "" {
+			return fmt.Errorf("%s: %v: %s", tool, err, line)
+		}
+	}
+	return fmt.Errorf("%s: %w", tool, err)
+}
+
+// summarizeIssues renders the issues of one phase for the phases table.
+func summarizeIssues(issues []PhaseIssue) string {
+	parts := make([]string, len(issues))
+	for i, is := range issues {
+		if is.Module == "" {
+			parts[i] = is.Reason
+		} else {
+			parts[i] = is.Module + ": " + is.Reason
+		}
+	}
+	return strings.Join(parts, "; ")
+}
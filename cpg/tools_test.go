@@ -0,0 +1,39 @@
+package cpg
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunTool checks that a tool running past its timeout is killed and
+// reported as timed out, while cancelling the run itself surfaces as the
+// context's error.
+func TestRunTool(t *testing.T) {
+	for _, tool := range []string{"sleep", "git"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+	start := time.Now()
+	_, err := runTool(context.Background(), 100*time.Millisecond, t.TempDir(), "sleep", "10")
+	if err == nil || !strings.Contains(err.Error(), "sleep 10 timed out after 100ms") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("timed-out tool returned after %s", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := runTool(ctx, time.Minute, t.TempDir(), "sleep", "10"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	if _, err := runTool(context.Background(), 0, t.TempDir(), "git", "log"); err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("err = %v, want git's first stderr line", err)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package cpg
 
 import (
 	"go/token"
@@ -11,6 +11,7 @@ import (
 func ExtractTypeRelationships(
 	pkgs []*packages.Package,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	posLookup *PosLookup,
 	cpg *CPG,
 	prog *Progress,
@@ -26,6 +27,11 @@ func ExtractTypeRelationships(
 	var concretes []namedInfo
 	var ifaces []namedInfo
 
+	// inScope limits incremental runs to relationships touching a re-analyzed package.
+	inScope := func(obj *types.TypeName) bool {
+		return obj.Pkg() != nil && cpg.InScope(obj.Pkg().Path())
+	}
+
 	for _, pkg := range pkgs {
 		scope := pkg.Types.Scope()
 		for _, name := range scope.Names() {
@@ -36,7 +42,7 @@ func ExtractTypeRelationships(
 
 			// Find the CPG node ID via position
 			pos := fset.Position(obj.Pos())
-			relFile := modSet.RelFile(pos.Filename)
+			relFile := ms.RelFile(pos.Filename)
 			if relFile == "" {
 				continue
 			}
@@ -65,7 +71,7 @@ func ExtractTypeRelationships(
 			}
 			// Find alias node
 			pos := fset.Position(obj.Pos())
-			relFile := modSet.RelFile(pos.Filename)
+			relFile := ms.RelFile(pos.Filename)
 			if relFile == "" {
 				continue
 			}
@@ -79,9 +85,9 @@ func ExtractTypeRelationships(
 			target := types.Unalias(obj.Type())
 			if named, ok := target.(*types.Named); ok {
 				tObj := named.Obj()
-				if tObj != nil && tObj.Pos().IsValid() {
+				if tObj != nil && tObj.Pos().IsValid() && (inScope(obj) || inScope(tObj)) {
 					tPos := fset.Position(tObj.Pos())
-					tFile := modSet.RelFile(tPos.Filename)
+					tFile := ms.RelFile(tPos.Filename)
 					if tFile != "" {
 						if tID := posLookup.Get(tFile, tPos.Line, tPos.Column); tID != "" {
 							cpg.AddEdge(Edge{Source: aliasID, Target: tID, Kind: "alias_of"})
@@ -101,6 +107,9 @@ func ExtractTypeRelationships(
 		ptrType := types.NewPointer(concreteType)
 
 		for _, iface := range ifaces {
+			if !inScope(concrete.obj) && !inScope(iface.obj) {
+				continue
+			}
 			ifaceType, ok := iface.obj.Type().Underlying().(*types.Interface)
 			if !ok {
 				continue
@@ -118,7 +127,7 @@ func ExtractTypeRelationships(
 				implementsCount++
 
 				// satisfies_method: concrete method → interface method it satisfies
-				emitSatisfiesMethod(concreteType, ifaceType, fset, posLookup, cpg, &satisfiesCount)
+				emitSatisfiesMethod(concreteType, ifaceType, fset, ms, posLookup, cpg, &satisfiesCount)
 			}
 		}
 
@@ -145,9 +154,12 @@ func ExtractTypeRelationships(
 			if embObj == nil || !embObj.Pos().IsValid() {
 				continue
 			}
+			if !inScope(concrete.obj) && !inScope(embObj) {
+				continue
+			}
 
 			embPos := fset.Position(embObj.Pos())
-			embFile := modSet.RelFile(embPos.Filename)
+			embFile := ms.RelFile(embPos.Filename)
 			if embFile == "" {
 				continue
 			}
@@ -174,6 +186,7 @@ func emitSatisfiesMethod(
 	concreteType types.Type,
 	ifaceType *types.Interface,
 	fset *token.FileSet,
+	ms *ModuleSet,
 	posLookup *PosLookup,
 	cpg *CPG,
 	count *int,
@@ -194,14 +207,14 @@ func emitSatisfiesMethod(
 
 			// Resolve both to CPG node IDs via position
 			cmPos := fset.Position(concreteMethod.Pos())
-			cmFile := modSet.RelFile(cmPos.Filename)
+			cmFile := ms.RelFile(cmPos.Filename)
 			if cmFile == "" {
 				continue
 			}
 			cmID := posLookup.Get(cmFile, cmPos.Line, cmPos.Column)
 
 			imPos := fset.Position(ifaceMethod.Pos())
-			imFile := modSet.RelFile(imPos.Filename)
+			imFile := ms.RelFile(imPos.Filename)
 			if imFile == "" {
 				continue
 			}
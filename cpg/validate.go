@@ -0,0 +1,344 @@
+package cpg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Invariant is a property every generated database must satisfy. Query
+// selects the rows that violate it; an empty result means it holds.
+type Invariant struct {
+	Name        string
+	Description string
+	Phase       string // optional phase whose output is checked; "" for always
+	Warning     bool   // violations are reported but do not fail validation
+	Query       string
+}
+
+// invariantSamples is how many violating rows a report includes.
+const invariantSamples = 5
+
+// funcKinds lists the node kinds of function declarations: plain functions
+// and, when tests are loaded, the test kinds from tests.go.
+const funcKinds = `'function', 'test', 'benchmark', 'fuzz', 'example'`
+
+// funcOf is the SQL expression for the function a cfg endpoint belongs to:
+// the function node itself, or the function owning a basic block.
+const funcOf = `CASE WHEN %[1]s.kind IN (` + funcKinds + `) THEN %[1]s.id ELSE %[1]s.parent_function END`
+
+// invariantRegistry lists the invariants -validate checks, in report order.
+var invariantRegistry = []Invariant{
+	{
+		Name:        "edge_endpoints",
+		Description: "Every edge's source and target is a node, and generation removed no orphan edges",
+		Query: `SELECT e.kind, e.source, e.target FROM edges e
+		        WHERE NOT EXISTS (SELECT 1 FROM nodes WHERE id = e.source)
+		           OR NOT EXISTS (SELECT 1 FROM nodes WHERE id = e.target)
+		        UNION ALL
+		        SELECT kind, source, target FROM orphan_edges`,
+	},
+	{
+		Name:        "parent_function",
+		Description: "Every parent_function is a function declaration",
+		Query: `SELECT n.id, n.kind, n.parent_function FROM nodes n
+		        WHERE n.parent_function IS NOT NULL
+		          AND NOT EXISTS (SELECT 1 FROM nodes f WHERE f.id = n.parent_function AND f.kind IN (` + funcKinds + `))`,
+	},
+	{
+		Name:        "node_sources",
+		Description: "Every file a node refers to has its text in sources",
+		Query: `SELECT DISTINCT n.file FROM nodes n
+		        WHERE n.file IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sources s WHERE s.file = n.file)`,
+	},
+	{
+		Name:        "node_spans",
+		Description: "Node byte spans are ordered and lie within their file's source",
+		Query: `SELECT n.id, n.kind, n.start_offset, n.end_offset, length(CAST(s.content AS BLOB)) FROM nodes n
+		        JOIN sources s ON s.file = n.file
+		        WHERE n.end_offset IS NOT NULL
+		          AND (n.start_offset > n.end_offset OR n.end_offset > length(CAST(s.content AS BLOB))
+		               OR (n.end_line IS NOT NULL AND n.end_line < n.line))`,
+	},
+	{
+		Name:        "cfg_same_function",
+		Description: "cfg edges connect basic blocks (and the entry/exit function node) of one function",
+		Phase:       "cfg",
+		Query: fmt.Sprintf(`SELECT e.source, e.target, s.kind, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'cfg'
+		          AND (s.kind NOT IN (%[1]s, 'basic_block') OR t.kind NOT IN (%[1]s, 'basic_block')
+		               OR (%[2]s) IS NOT (%[3]s))`, funcKinds, fmt.Sprintf(funcOf, "s"), fmt.Sprintf(funcOf, "t")),
+	},
+	{
+		Name:        "dfg_same_function",
+		Description: "dfg edges stay within one function; flow between functions uses param_in/param_out",
+		Phase:       "cfg",
+		Query: `SELECT e.source, e.target, s.parent_function, t.parent_function FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'dfg' AND s.parent_function IS NOT t.parent_function`,
+	},
+	{
+		Name:        "cdg_same_function",
+		Description: "cdg, dom, and pdom edges connect basic blocks of one function",
+		Phase:       "cdg",
+		Query: `SELECT e.kind, e.source, e.target FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind IN ('cdg', 'dom', 'pdom')
+		          AND (s.kind != 'basic_block' OR t.kind != 'basic_block' OR s.parent_function IS NOT t.parent_function)`,
+	},
+	{
+		Name:        "call_endpoints",
+		Description: "call edges connect two function declarations",
+		Phase:       "callgraph",
+		Query: `SELECT e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'call' AND (s.kind NOT IN (` + funcKinds + `) OR t.kind NOT IN (` + funcKinds + `))`,
+	},
+	{
+		Name:        "instantiates_endpoints",
+		Description: "instantiates edges lead from an instantiation to a generic function",
+		Phase:       "callgraph",
+		Query: `SELECT e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'instantiates' AND (s.kind != 'instantiation' OR t.kind NOT IN (` + funcKinds + `))`,
+	},
+	{
+		Name:        "param_in_target",
+		Description: "param_in edges end at a parameter node",
+		Phase:       "callgraph",
+		Query: `SELECT e.source, e.target, t.kind FROM edges e JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'param_in' AND t.kind != 'parameter'`,
+	},
+	{
+		Name:        "param_out_source",
+		Description: "param_out edges start at the called function",
+		Phase:       "callgraph",
+		Query: `SELECT e.source, s.kind, e.target FROM edges e JOIN nodes s ON s.id = e.source
+		        WHERE e.kind = 'param_out' AND s.kind NOT IN (` + funcKinds + `)`,
+	},
+	{
+		Name:        "constraint_endpoints",
+		Description: "constraint edges lead from a type parameter to an interface declaration",
+		Query: `SELECT e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'constraint' AND (s.kind != 'type_param' OR t.kind != 'type_decl')`,
+	},
+	{
+		Name:        "field_type_endpoints",
+		Description: "field_type edges lead from a struct field to a type declaration",
+		Query: `SELECT e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'field_type' AND (s.kind != 'field' OR t.kind != 'type_decl')`,
+	},
+	{
+		Name:        "field_access_endpoints",
+		Description: "field_read and field_write edges end at a struct field",
+		Phase:       "cfg",
+		Query: `SELECT e.kind, e.source, e.target, t.kind FROM edges e
+		        JOIN nodes t ON t.id = e.target
+		        WHERE e.kind IN ('field_read', 'field_write') AND t.kind != 'field'`,
+	},
+	{
+		Name:        "global_access_endpoints",
+		Description: "global_read and global_write edges end at a package-level variable",
+		Phase:       "cfg",
+		Query: `SELECT e.kind, e.source, e.target, t.kind FROM edges e
+		        JOIN nodes t ON t.id = e.target
+		        WHERE e.kind IN ('global_read', 'global_write')
+		          AND (t.kind != 'local' OR t.parent_function IS NOT NULL)`,
+	},
+	{
+		Name:        "directive_edges",
+		Description: "applies_to, embed, and linkname edges start at a directive; embed edges end at an embedded file",
+		Query: `SELECT e.kind, e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind IN ('applies_to', 'embed', 'linkname')
+		          AND (s.kind != 'directive' OR (e.kind = 'embed' AND t.kind != 'embedded_file'))`,
+	},
+	{
+		Name:        "implements_types",
+		Description: "implements edges connect two type declarations",
+		Phase:       "types",
+		Query: `SELECT e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'implements' AND (s.kind != 'type_decl' OR t.kind != 'type_decl')`,
+	},
+	{
+		Name:        "metrics_fan_in",
+		Description: "metrics.fan_in equals the number of call edges into the function",
+		Phase:       "metrics",
+		Query: `SELECT m.function_id, m.fan_in, COUNT(e.source) AS calls FROM metrics m
+		        LEFT JOIN edges e ON e.target = m.function_id AND e.kind = 'call'
+		        GROUP BY m.function_id HAVING m.fan_in != COUNT(e.source)`,
+	},
+	{
+		Name:        "metrics_fan_out",
+		Description: "metrics.fan_out equals the number of call edges out of the function",
+		Phase:       "metrics",
+		Query: `SELECT m.function_id, m.fan_out, COUNT(e.target) AS calls FROM metrics m
+		        LEFT JOIN edges e ON e.source = m.function_id AND e.kind = 'call'
+		        GROUP BY m.function_id HAVING m.fan_out != COUNT(e.target)`,
+	},
+	{
+		Name:        "metrics_nodes",
+		Description: "Every metrics row belongs to a function declaration",
+		Phase:       "metrics",
+		Warning:     true,
+		Query: `SELECT m.function_id FROM metrics m
+		        WHERE NOT EXISTS (SELECT 1 FROM nodes n WHERE n.id = m.function_id AND n.kind IN (` + funcKinds + `))`,
+	},
+	{
+		Name:        "tests_endpoints",
+		Description: "tests edges lead from a test, benchmark, fuzz target, or example to a function",
+		Phase:       "tests",
+		Query: `SELECT e.source, s.kind, e.target, t.kind FROM edges e
+		        JOIN nodes s ON s.id = e.source JOIN nodes t ON t.id = e.target
+		        WHERE e.kind = 'tests'
+		          AND (s.kind NOT IN ('test', 'benchmark', 'fuzz', 'example') OR t.kind != 'function')`,
+	},
+}
+
+// Invariants returns the invariants -validate checks, in report order.
+func Invariants() []Invariant {
+	return append([]Invariant(nil), invariantRegistry...)
+}
+
+// ValidationReport is the outcome of checking every invariant against one
+// database. It is what -validate-report writes as JSON.
+type ValidationReport struct {
+	Database   string            `json:"database"`
+	Passed     bool              `json:"passed"`
+	Failed     int               `json:"failed"`
+	Warnings   int               `json:"warnings"`
+	Invariants []InvariantResult `json:"invariants"`
+}
+
+// InvariantResult is the outcome of one invariant.
+type InvariantResult struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"` // "pass", "fail", "warn", or "skipped"
+	Violations  int64      `json:"violations"`
+	Columns     []string   `json:"columns,omitempty"`
+	Samples     [][]string `json:"samples,omitempty"` // up to invariantSamples violating rows
+}
+
+// ValidationError reports that a database violates at least one invariant.
+// The database itself is complete; Report holds the details.
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation failed: %d of %d invariants violated", e.Report.Failed, len(e.Report.Invariants))
+}
+
+// runValidation checks every invariant whose phase ran, logs the outcome,
+// and writes the JSON report to reportPath when it is set. It returns a
+// *ValidationError if an invariant fails.
+func runValidation(conn *sqlite.Conn, path string, phases *PhaseSet, reportPath string, prog *Progress) error {
+	prog.Log("Validating %d invariants...", len(invariantRegistry))
+
+	report := &ValidationReport{Database: path, Passed: true}
+	for _, inv := range invariantRegistry {
+		res := InvariantResult{Name: inv.Name, Description: inv.Description}
+		if inv.Phase != "" && !phases.Enabled(inv.Phase) {
+			res.Status = "skipped"
+			prog.Verbose("  SKIP %s (phase %s skipped)", inv.Name, inv.Phase)
+			report.Invariants = append(report.Invariants, res)
+			continue
+		}
+
+		if err := sqlitex.ExecuteTransient(conn, `SELECT COUNT(*) FROM (`+inv.Query+`)`,
+			&sqlitex.ExecOptions{
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					res.Violations = stmt.ColumnInt64(0)
+					return nil
+				},
+			}); err != nil {
+			return fmt.Errorf("invariant %s: %w", inv.Name, err)
+		}
+		if res.Violations > 0 {
+			if err := sqlitex.ExecuteTransient(conn, fmt.Sprintf(`%s LIMIT %d`, inv.Query, invariantSamples),
+				&sqlitex.ExecOptions{
+					ResultFunc: func(stmt *sqlite.Stmt) error {
+						row := make([]string, stmt.ColumnCount())
+						for i := range row {
+							row[i] = stmt.ColumnText(i)
+						}
+						if res.Columns == nil {
+							for i := range row {
+								res.Columns = append(res.Columns, stmt.ColumnName(i))
+							}
+						}
+						res.Samples = append(res.Samples, row)
+						return nil
+					},
+				}); err != nil {
+				return fmt.Errorf("invariant %s: %w", inv.Name, err)
+			}
+		}
+
+		switch {
+		case res.Violations == 0:
+			res.Status = "pass"
+			prog.Verbose("  OK   %s", inv.Name)
+		case inv.Warning:
+			res.Status = "warn"
+			report.Warnings++
+			prog.Log("  WARN %s: %d violations (%s)", inv.Name, res.Violations, inv.Description)
+		default:
+			res.Status = "fail"
+			report.Failed++
+			report.Passed = false
+			prog.Log("  FAIL %s: %d violations (%s)", inv.Name, res.Violations, inv.Description)
+		}
+		for _, row := range res.Samples {
+			prog.Log("       %v", row)
+		}
+		report.Invariants = append(report.Invariants, res)
+	}
+
+	// Graph shape, for comparing runs
+	for _, table := range []string{"nodes", "edges"} {
+		if err := sqlitex.ExecuteTransient(conn,
+			fmt.Sprintf(`SELECT kind, COUNT(*) FROM %s GROUP BY kind ORDER BY COUNT(*) DESC, kind`, table),
+			&sqlitex.ExecOptions{
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					prog.Verbose("  %s: %s = %d", table, stmt.ColumnText(0), stmt.ColumnInt64(1))
+					return nil
+				},
+			}); err != nil {
+			return err
+		}
+	}
+
+	var skipped int
+	for _, r := range report.Invariants {
+		if r.Status == "skipped" {
+			skipped++
+		}
+	}
+	prog.Log("Validation: %d passed, %d failed, %d warnings, %d skipped",
+		len(report.Invariants)-report.Failed-report.Warnings-skipped, report.Failed, report.Warnings, skipped)
+
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode validation report: %w", err)
+		}
+		if err := os.WriteFile(reportPath, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("write validation report: %w", err)
+		}
+		prog.Log("Wrote validation report to %s", reportPath)
+	}
+
+	if !report.Passed {
+		return &ValidationError{Report: report}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cpg
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// TestValidationFailure breaks three invariants in a generated database
+// (call_endpoints, metrics_fan_in, and edge_endpoints through a recorded
+// orphan edge) and checks that validation reports all three, with samples,
+// in the JSON report.
+func TestValidationFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads and analyzes fixture modules")
+	}
+	db, gen := generateFixture(t, filepath.Join(copyFixtures(t), "basic"), nil)
+
+	conn, err := sqlite.OpenConn(db, sqlite.OpenReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sqlitex.ExecuteScript(conn, `
+		UPDATE metrics SET fan_in = fan_in + 1 WHERE rowid = (SELECT MIN(rowid) FROM metrics);
+		UPDATE edges SET target = (SELECT id FROM nodes WHERE kind = 'file' LIMIT 1)
+		 WHERE rowid = (SELECT MIN(rowid) FROM edges WHERE kind = 'call');
+		INSERT INTO orphan_edges (kind, source, target, missing) VALUES ('ref', 'a::gone', 'a::also_gone', 'both');`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	err = runValidation(conn, db, gen.cfg.phases, reportPath, NewProgress(io.Discard, false))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("runValidation = %v, want *ValidationError", err)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report ValidationReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed {
+		t.Error("report passed")
+	}
+	failed := make(map[string]InvariantResult)
+	for _, r := range report.Invariants {
+		if r.Status == "fail" {
+			failed[r.Name] = r
+		}
+	}
+	for _, name := range []string{"call_endpoints", "metrics_fan_in", "edge_endpoints"} {
+		r, ok := failed[name]
+		if !ok {
+			t.Errorf("%s did not fail", name)
+			continue
+		}
+		if len(r.Samples) == 0 || len(r.Columns) != len(r.Samples[0]) {
+			t.Errorf("%s: columns %v, samples %v", name, r.Columns, r.Samples)
+		}
+	}
+	if report.Failed != len(failed) {
+		t.Errorf("report.Failed = %d, want %d", report.Failed, len(failed))
+	}
+}
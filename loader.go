@@ -1,223 +0,0 @@
-package main
-
-import (
-	"fmt"
-	"go/token"
-	"os"
-	"path/filepath"
-	"strings"
-
-	"golang.org/x/tools/go/packages"
-)
-
-// LoadResult holds the output of package loading.
-type LoadResult struct {
-	Packages []*packages.Package
-	Fset     *token.FileSet
-}
-
-// CreateTempGoWork writes a temporary go.work file that includes all modules
-// in the ModuleSet. Returns the path to the temp file (caller must os.Remove).
-//
-// Sub-modules (nested go.mod files) are discovered automatically. When two
-// directories declare the same module path (e.g. alertmanager/internal/tools
-// and prometheus/internal/tools both declare
-// "github.com/prometheus/prometheus/internal/tools"), only the first
-// directory found is included to avoid Go workspace "appears multiple times"
-// errors. First-wins semantics match the module ordering in the ModuleSet.
-func CreateTempGoWork(ms *ModuleSet) (string, error) {
-	var buf strings.Builder
-	buf.WriteString("go 1.25.7\n\nuse (\n")
-
-	// seenModPaths tracks declared module paths → directory to prevent
-	// duplicate module paths in the workspace (which Go rejects).
-	seenModPaths := make(map[string]string)
-
-	// Collect top-level module dirs for dedup against discovered sub-modules.
-	topDirs := make(map[string]bool, len(ms.Dirs()))
-	for _, m := range ms.Dirs() {
-		buf.WriteString("\t" + m.Dir + "\n")
-		topDirs[m.Dir] = true
-		if mp := readModulePath(filepath.Join(m.Dir, "go.mod")); mp != "" {
-			seenModPaths[mp] = m.Dir
-		}
-	}
-
-	// Walk ALL module directories (not just primary) to find nested sub-modules
-	// with their own go.mod. Deduplicate against already-listed top-level dirs
-	// and against already-seen module paths (two different directories can
-	// declare the same module path, e.g. across repos with shared tooling).
-	for _, m := range ms.Dirs() {
-		for _, d := range findSubModules(m.Dir) {
-			if topDirs[d] {
-				continue
-			}
-			mp := readModulePath(filepath.Join(d, "go.mod"))
-			if mp != "" {
-				if prev, dup := seenModPaths[mp]; dup {
-					// Skip: another directory already provides this module path.
-					_ = prev // could log: "skipping %s (duplicate of %s)", d, prev
-					continue
-				}
-				seenModPaths[mp] = d
-			}
-			buf.WriteString("\t" + d + "\n")
-			topDirs[d] = true // prevent duplicates across module walks
-		}
-	}
-
-	buf.WriteString(")\n")
-
-	f, err := os.CreateTemp("", "cpg-workspace-*.work")
-	if err != nil {
-		return "", fmt.Errorf("create temp go.work: %w", err)
-	}
-	if _, err := f.WriteString(buf.String()); err != nil {
-		f.Close()
-		os.Remove(f.Name())
-		return "", fmt.Errorf("write go.work: %w", err)
-	}
-	if err := f.Close(); err != nil {
-		os.Remove(f.Name())
-		return "", err
-	}
-	return f.Name(), nil
-}
-
-// readModulePath reads a go.mod file and returns the declared module path.
-// Returns "" if the file cannot be read or the module directive is not found.
-func readModulePath(gomodPath string) string {
-	data, err := os.ReadFile(gomodPath)
-	if err != nil {
-		return ""
-	}
-	for _, line := range strings.Split(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "module ") {
-			return strings.TrimSpace(strings.TrimPrefix(line, "module "))
-		}
-	}
-	return ""
-}
-
-// findSubModules walks dir looking for directories with go.mod (excluding dir itself).
-func findSubModules(dir string) []string {
-	var dirs []string
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // skip errors
-		}
-		if info.IsDir() {
-			// Skip vendor and hidden dirs
-			base := filepath.Base(path)
-			if base == "vendor" || base == ".git" || strings.HasPrefix(base, ".") {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if info.Name() == "go.mod" && path != filepath.Join(dir, "go.mod") {
-			dirs = append(dirs, filepath.Dir(path))
-		}
-		return nil
-	})
-	return dirs
-}
-
-// LoadPackages loads all Go packages from all modules via a workspace,
-// filtering to only packages belonging to known modules.
-func LoadPackages(goworkPath string, prog *Progress) (*LoadResult, error) {
-	prog.Log("Loading packages via workspace (%d modules)...", len(modSet.Dirs()))
-
-	fset := token.NewFileSet()
-	cfg := &packages.Config{
-		Mode: packages.NeedName |
-			packages.NeedFiles |
-			packages.NeedCompiledGoFiles |
-			packages.NeedImports |
-			packages.NeedDeps |
-			packages.NeedTypes |
-			packages.NeedSyntax |
-			packages.NeedTypesInfo |
-			packages.NeedTypesSizes,
-		Dir:   modSet.PrimaryDir(),
-		Fset:  fset,
-		Tests: false,
-		Env:   replaceEnv(os.Environ(), "GOWORK", goworkPath),
-	}
-
-	initial, err := packages.Load(cfg, modSet.LoadPatterns()...)
-	if err != nil {
-		return nil, fmt.Errorf("packages.Load: %w", err)
-	}
-
-	// Filter to known module packages only
-	filtered := make([]*packages.Package, 0, len(initial))
-	var errCount int
-	for _, pkg := range initial {
-		if !modSet.IsKnownPkg(pkg.PkgPath) {
-			continue
-		}
-		if len(pkg.Errors) > 0 {
-			errCount++
-			prog.Verbose("  warning: %s has %d errors: %v", pkg.PkgPath, len(pkg.Errors), pkg.Errors[0])
-		}
-		filtered = append(filtered, pkg)
-	}
-
-	// Count files and LOC (respecting skip filters)
-	var fileCount, loc int
-	for _, pkg := range filtered {
-		for i, f := range pkg.CompiledGoFiles {
-			if shouldSkipFile(f) {
-				continue
-			}
-			fileCount++
-			if i < len(pkg.Syntax) {
-				end := fset.Position(pkg.Syntax[i].End())
-				loc += end.Line
-			}
-		}
-	}
-
-	prog.Log("Loaded %d packages (%d files, ~%dk LOC)", len(filtered), fileCount, loc/1000)
-	if errCount > 0 {
-		prog.Log("  %d packages had type-check errors (continuing)", errCount)
-	}
-
-	return &LoadResult{
-		Packages: filtered,
-		Fset:     fset,
-	}, nil
-}
-
-// Skip flags, set by main before any pipeline phase runs.
-var (
-	flagSkipTests     = true
-	flagSkipGenerated = true
-)
-
-// replaceEnv returns a copy of environ with key set to val, replacing any
-// existing entry for key. This avoids duplicate env vars which have
-// platform-dependent behavior (last-wins on Linux, first-wins on some BSDs).
-func replaceEnv(environ []string, key, val string) []string {
-	prefix := key + "="
-	result := make([]string, 0, len(environ)+1)
-	for _, e := range environ {
-		if !strings.HasPrefix(e, prefix) {
-			result = append(result, e)
-		}
-	}
-	return append(result, prefix+val)
-}
-
-// shouldSkipFile returns true for generated/test files that should be excluded.
-func shouldSkipFile(path string) bool {
-	base := BaseName(path)
-	if flagSkipTests && strings.HasSuffix(base, "_test.go") {
-		return true
-	}
-	if flagSkipGenerated && strings.HasSuffix(base, ".pb.go") {
-		return true
-	}
-	return false
-}
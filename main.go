@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"runtime/debug"
 	"strings"
+	"syscall"
+
+	"cpg-gen/cpg"
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(); errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		os.Exit(130)
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
@@ -20,154 +29,171 @@ func main() {
 // (including temp file cleanup) execute even on error paths, unlike os.Exit
 // which skips deferred calls.
 func run() error {
-	skipGenerated := flag.Bool("skip-generated", true, "Skip .pb.go files")
-	skipTests := flag.Bool("skip-tests", true, "Skip _test.go files")
-	verbose := flag.Bool("verbose", false, "Print detailed progress")
-	validate := flag.Bool("validate", false, "Run validation queries after write")
-	modules := flag.String("modules", "", "Comma-separated dir:modpath:name triples for additional modules (e.g. ./adapter:sigs.k8s.io/prometheus-adapter:adapter)")
+	// Flags that only override config file values are read by applyFlags.
+	configPath := flag.String("config", "", "YAML or JSON config file declaring modules, file globs, phases, thresholds, and output (flags given explicitly override it)")
+	flag.Bool("skip-generated", true, "Skip generated files (a \"// Code generated ... DO NOT EDIT.\" header, or named *.pb.go, zz_generated*.go, *.y.go); when false they are kept with an is_generated property")
+	flag.Bool("skip-tests", true, "Skip _test.go files (set false to load test packages and link tests to the code they exercise)")
+	flag.Bool("verbose", false, "Print detailed progress")
+	flag.Bool("validate", false, "Check graph invariants after writing and exit non-zero if any is violated")
+	flag.String("validate-report", "", "Write the invariant check results as JSON to this file (implies -validate)")
+	snapshot := flag.String("snapshot", "", "Add git revision REV of the primary module's repository to the existing output DB as a snapshot, leaving its graph and derived tables unchanged")
+	snapshotName := flag.String("snapshot-name", "", "Name of the -snapshot snapshot (default: the revision as given)")
+	flag.Bool("incremental", false, "Update an existing output DB, re-analyzing only packages changed since the last run (plus their reverse dependencies)")
+	flag.String("modules", "", "Comma-separated additional modules as dir, dir:name, or dir:modpath:name (module path is read from go.mod and the name defaults to its last element)")
+	flag.String("include", "", "Comma-separated module-relative globs selecting the files to analyze (default: all); \"**\" matches any number of directories and a directory pattern matches everything under it")
+	flag.String("exclude", "", "Comma-separated module-relative globs of files to leave out, e.g. web/ui,documentation/examples,**/mock_*.go")
+	flag.String("phases", "", "Comma-separated optional phases to run, plus whatever they require (default: all; see -list-phases)")
+	flag.String("skip-phases", "", "Comma-separated optional phases to skip, together with phases that depend on them")
+	listPhases := flag.Bool("list-phases", false, "List optional phases with their dependencies and exit")
+	flag.String("platforms", "", "Comma-separated build configurations to analyze and merge, as goos/goarch or goos/goarch:tag1+tag2 (default: host only)")
+	flag.Int("workers", 0, "Goroutines for AST walking, CFG/CDG extraction, and metrics (default GOMAXPROCS; output is identical for any value)")
+	flag.String("memory-limit", "8GiB", "Soft memory limit for the Go runtime, e.g. 4GiB or 512MiB (\"off\" disables it)")
+	flag.Bool("stream", false, "Spill nodes, edges, and sources to a staging database once they outgrow an eighth of -memory-limit, instead of holding the whole graph in memory")
+	flag.String("escape-timeout", "10m", "Time limit for each module's go build -gcflags=-m (\"off\" disables it); a module that runs out degrades the escape phase")
+	flag.String("git-timeout", "2m", "Time limit for each git command (\"off\" disables it); a module that runs out degrades the git_history phase")
+	flag.String("cache-dir", "", "Directory caching per-package graph fragments between runs; packages whose files, dependencies, go.sum, and Go version are unchanged are not re-analyzed")
+	flag.String("spill-dir", "", "Directory for the -stream staging database (default: the output directory)")
+	flag.String("schema-roots", "", "Comma-separated root config types for the serialized_schema table, as package.Type (e.g. config.Config); default: tagged struct types named *Config that no other tagged struct holds")
+	flag.String("profiles", "", "Comma-separated seed profiles to apply ("+strings.Join(cpg.ProfileNames(), ", ")+"); default: profiles matching the primary module; \"none\" disables")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: cpg-gen [flags] <primary-dir> <output.db>\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: cpg-gen [flags] <primary-dir> <output.db>\n")
+		fmt.Fprintf(os.Stderr, "       cpg-gen -config cpg.yaml [flags] [<primary-dir> <output.db>]\n\n")
 		fmt.Fprintf(os.Stderr, "Generates a Code Property Graph (CPG) SQLite database from Go modules.\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if flag.NArg() != 2 {
-		flag.Usage()
-		return fmt.Errorf("expected 2 arguments, got %d", flag.NArg())
-	}
-
-	promDir, err := filepath.Abs(flag.Arg(0))
-	if err != nil {
-		return fmt.Errorf("invalid primary dir: %w", err)
-	}
-	outputPath := flag.Arg(1)
-
-	// Set memory limit for GC pressure
-	debug.SetMemoryLimit(8 * 1024 * 1024 * 1024) // 8 GiB
-
-	// Wire skip flags into the package-level config used by shouldSkipFile
-	flagSkipGenerated = *skipGenerated
-	flagSkipTests = *skipTests
-
-	prog := NewProgress(*verbose)
-
-	// Build ModuleSet from primary dir + extra modules
-	primary := ModuleInfo{
-		ModPath: "github.com/prometheus/prometheus",
-		Dir:     promDir,
-		Prefix:  "", // primary module keeps paths unprefixed for backward compat
+	if *listPhases {
+		printPhases(os.Stdout)
+		return nil
 	}
 
-	var extras []ModuleInfo
-	if *modules != "" {
-		for _, spec := range strings.Split(*modules, ",") {
-			parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
-			if len(parts) != 3 {
-				prog.Log("Warning: invalid --modules spec %q (want dir:modpath:name)", spec)
-				continue
-			}
-			dir, err := filepath.Abs(parts[0])
-			if err != nil {
-				prog.Log("Warning: invalid module dir %q: %v", parts[0], err)
-				continue
-			}
-			extras = append(extras, ModuleInfo{
-				Dir:     dir,
-				ModPath: parts[1],
-				Prefix:  parts[2],
-			})
+	cfg := &cpg.Config{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = cpg.LoadConfig(*configPath); err != nil {
+			return err
 		}
 	}
 
-	modSet = NewModuleSet(primary, extras)
-	prog.Log("Analyzing %d modules: %s", len(modSet.Dirs()), moduleNames(modSet))
-
-	// Create temporary go.work for unified type universe
-	goworkPath, err := CreateTempGoWork(modSet)
-	if err != nil {
+	// Positional arguments and explicitly set flags override the config file.
+	switch {
+	case flag.NArg() == 2:
+		cfg.Primary, cfg.Output.Path = flag.Arg(0), flag.Arg(1)
+	case flag.NArg() == 0 && *configPath != "":
+	default:
+		flag.Usage()
+		return fmt.Errorf("expected 2 arguments, got %d", flag.NArg())
+	}
+	if err := applyFlags(cfg, flag.CommandLine); err != nil {
 		return err
 	}
-	defer os.Remove(goworkPath)
-	prog.Verbose("Created workspace: %s", goworkPath)
+	// Interrupting stops the run at the next phase or statement, or cancels a
+	// module download; Generate removes the temporary go.work and the partial
+	// database on the way out.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	cpg := NewCPG()
-
-	// Phase 1: Load packages (all modules, single type universe)
-	loadResult, err := LoadPackages(goworkPath, prog)
+	gen, err := cpg.NewGeneratorContext(ctx, cfg, cpg.Options{Log: os.Stderr})
 	if err != nil {
 		return err
 	}
+	if cfg.Output.Path == "" {
+		return fmt.Errorf("invalid configuration:\noutput.path: required (config key or second argument)")
+	}
 
-	// Phase 2: Walk AST → nodes + AST edges + position lookup
-	posLookup, funcLookup := WalkAST(loadResult.Packages, loadResult.Fset, cpg, prog)
-
-	// Phase 3: Build SSA
-	ssaResult := BuildSSA(loadResult.Packages, prog)
-
-	// Phase 4: Extract CFG + DFG from SSA
-	ExtractCFGAndDFG(ssaResult, loadResult.Fset, posLookup, funcLookup, cpg, prog)
-
-	// Phase 4b: Extract CDG from post-dominator tree
-	ExtractCDG(ssaResult, loadResult.Fset, funcLookup, cpg, prog)
-
-	// Phase 4c: Extract channel send→receive flow edges
-	ExtractChannelFlow(ssaResult, loadResult.Fset, posLookup, cpg, prog)
-
-	// Phase 4d: Extract panic/recover flow edges
-	ExtractPanicRecover(ssaResult, loadResult.Fset, posLookup, funcLookup, cpg, prog)
-
-	// Phase 5: Build VTA call graph → call edges
-	BuildCallGraph(ssaResult, loadResult.Fset, posLookup, funcLookup, cpg, prog)
-
-	// Phase 6: Extract type relationships (implements, embeds)
-	ExtractTypeRelationships(loadResult.Packages, loadResult.Fset, posLookup, cpg, prog)
-
-	// Phase 7: Compute function metrics
-	ComputeMetrics(loadResult.Packages, loadResult.Fset, funcLookup, cpg, prog)
+	// The memory limit is process-wide, so the command sets it rather than
+	// the library.
+	debug.SetMemoryLimit(cfg.MemoryLimit())
 
-	// Phase 7b: Fill fan-in/fan-out from call graph
-	ComputeFanInOut(cpg)
+	if *snapshot != "" {
+		if cfg.Output.Incremental {
+			return fmt.Errorf("-snapshot cannot be combined with -incremental")
+		}
+		return gen.AddSnapshot(ctx, *snapshot, *snapshotName)
+	}
+	return gen.Generate(ctx, &cpg.SQLiteSink{Path: cfg.Output.Path})
+}
 
-	// Add META_DATA node with generator info
-	cpg.AddNode(Node{
-		ID:   "META_DATA",
-		Kind: "meta_data",
-		Name: "CPG Metadata",
-		Properties: map[string]any{
-			"language":  "go",
-			"version":   "1.0",
-			"generator": "cpg-gen",
-			"root":      promDir,
-			"modules":   len(modSet.Dirs()),
-		},
+// applyFlags copies the flags explicitly set in fs over the values cfg got
+// from the config file. Flags left at their defaults do not override it.
+func applyFlags(cfg *cpg.Config, fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		v := f.Value.(flag.Getter).Get()
+		switch f.Name {
+		case "skip-generated":
+			b := v.(bool)
+			cfg.SkipGenerated = &b
+		case "skip-tests":
+			b := v.(bool)
+			cfg.SkipTests = &b
+		case "verbose":
+			cfg.Output.Verbose = v.(bool)
+		case "validate":
+			cfg.Output.Validate = v.(bool)
+		case "validate-report":
+			cfg.Output.ValidateReport = v.(string)
+		case "incremental":
+			cfg.Output.Incremental = v.(bool)
+		case "modules":
+			mods, modErr := cpg.ParseModuleSpecs(v.(string))
+			if modErr != nil {
+				err = modErr
+			}
+			cfg.Modules = mods
+		case "profiles":
+			cfg.Profiles = strings.Split(v.(string), ",")
+		case "workers":
+			cfg.Workers = v.(int)
+		case "memory-limit":
+			cfg.Memory.Limit = v.(string)
+		case "stream":
+			cfg.Memory.Stream = v.(bool)
+		case "spill-dir":
+			cfg.Memory.SpillDir = v.(string)
+		case "cache-dir":
+			cfg.CacheDir = v.(string)
+		case "escape-timeout":
+			cfg.Timeouts.Escape = v.(string)
+		case "git-timeout":
+			cfg.Timeouts.Git = v.(string)
+		case "include":
+			cfg.Include = splitList(v.(string))
+		case "exclude":
+			cfg.Exclude = splitList(v.(string))
+		case "schema-roots":
+			cfg.SchemaRoots = splitList(v.(string))
+		case "platforms":
+			cfg.Platforms = splitList(v.(string))
+		case "phases":
+			cfg.Phases = splitList(v.(string))
+		case "skip-phases":
+			cfg.SkipPhases = splitList(v.(string))
+		}
 	})
+	return err
+}
 
-	// Phase 7c: Escape analysis from Go compiler (all modules)
-	escapeResults := RunEscapeAnalysis(prog)
-
-	// Phase 7d: Git history for diff-aware analysis (all modules)
-	gitHistory := RunGitHistory(prog)
-
-	// Phase 8: Write SQLite
-	if err := WriteDB(outputPath, cpg, escapeResults, gitHistory, *validate, prog); err != nil {
-		return err
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
-
-	prog.Log("Done. %d nodes, %d edges.", len(cpg.Nodes), len(cpg.Edges))
-	return nil
+	return out
 }
 
-// moduleNames returns a human-readable list of module prefixes.
-func moduleNames(ms *ModuleSet) string {
-	names := make([]string, len(ms.Dirs()))
-	for i, m := range ms.Dirs() {
-		if m.Prefix == "" {
-			names[i] = "prometheus (primary)"
-		} else {
-			names[i] = m.Prefix
+// printPhases writes the phase registry for -list-phases.
+func printPhases(w io.Writer) {
+	for _, p := range cpg.Phases() {
+		line := fmt.Sprintf("%-20s %s", p.Name, p.Description)
+		if len(p.Requires) > 0 {
+			line += " (requires " + strings.Join(p.Requires, ", ") + ")"
 		}
+		fmt.Fprintln(w, line)
 	}
-	return strings.Join(names, ", ")
 }
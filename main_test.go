@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"cpg-gen/cpg"
+)
+
+// TestApplyFlags checks that explicitly set flags override config file
+// values and that flags left at their defaults do not.
+func TestApplyFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cpg.yaml")
+	if err := os.WriteFile(file, []byte(`
+primary: .
+workers: 2
+skip_tests: false
+include: [cmd/**]
+phases: [cfg]
+output:
+  path: cpg.db
+  verbose: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := cpg.LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("cpg-gen", flag.ContinueOnError)
+	fs.Int("workers", 0, "")
+	fs.Bool("skip-tests", true, "")
+	fs.String("include", "", "")
+	fs.String("phases", "", "")
+	fs.Bool("verbose", false, "")
+	fs.String("exclude", "", "")
+	if err := fs.Parse([]string{"-workers=8", "-skip-tests", "-phases=cdg,metrics", "-verbose=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyFlags(cfg, fs); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Workers != 8 {
+		t.Errorf("workers = %d, want the flag's 8", cfg.Workers)
+	}
+	if cfg.SkipTests == nil || !*cfg.SkipTests {
+		t.Errorf("skip_tests = %v, want the flag's true", cfg.SkipTests)
+	}
+	if want := []string{"cdg", "metrics"}; !slices.Equal(cfg.Phases, want) {
+		t.Errorf("phases = %q, want the flag's %q", cfg.Phases, want)
+	}
+	if cfg.Output.Verbose {
+		t.Error("verbose = true, want the flag's false")
+	}
+	if want := []string{"cmd/**"}; !slices.Equal(cfg.Include, want) {
+		t.Errorf("include = %q, want the file's %q (flag not set)", cfg.Include, want)
+	}
+	if cfg.Exclude != nil {
+		t.Errorf("exclude = %q, want none (flag not set)", cfg.Exclude)
+	}
+
+	fs = flag.NewFlagSet("cpg-gen", flag.ContinueOnError)
+	fs.String("modules", "", "")
+	if err := fs.Parse([]string{"-modules=a:b:c:d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyFlags(cfg, fs); err == nil {
+		t.Error("applyFlags accepted an invalid -modules value")
+	}
+}